@@ -561,3 +561,49 @@ func (c *valueCtx) Value(key interface{}) interface{} {
 	}
 	return c.Context.Value(key)
 }
+
+// mapKey is the key of the sync.Map attached to a context by WithMap.
+type mapKey struct{}
+
+// WithMap returns a copy of parent, canceled like a context returned by
+// WithCancel, that carries a new, empty sync.Map, which MapFromContext
+// returns. The map serves as a cache scoped to the operation the context
+// stands for, such as memoized lookups for a single request. Once the
+// returned context is done, the map is cleared asynchronously, so that
+// the values it holds do not outlive the operation even if something
+// keeps the map; it may still hold them for a short while after Done is
+// closed, until pinned values are unpinned.
+//
+// Canceling this context releases resources associated with it, so code
+// should call cancel as soon as the operations running in this Context
+// complete.
+func WithMap(parent Context) (ctx Context, cancel CancelFunc) {
+	ctx, cancel = WithCancel(parent)
+	m := new(sync.Map)
+	propagateCancel(ctx, &mapClearer{m})
+	return WithValue(ctx, mapKey{}, m), cancel
+}
+
+// A mapClearer clears the map of a WithMap context when the context is
+// canceled. As a child of the context's cancelCtx, it needs no goroutine
+// to wait for that.
+type mapClearer struct {
+	m *sync.Map
+}
+
+func (c *mapClearer) cancel(removeFromParent bool, err error) {
+	// The parent calls cancel with its lock held, and Clear waits for
+	// the map's pins, whose holders may use the context before they
+	// unpin; so clear the map on a goroutine of its own.
+	go c.m.Clear()
+}
+
+// Done returns nil: only the parent cancels a mapClearer.
+func (c *mapClearer) Done() <-chan struct{} { return nil }
+
+// MapFromContext returns the sync.Map attached to ctx by the nearest
+// call of WithMap among its ancestors, or nil if there is none.
+func MapFromContext(ctx Context) *sync.Map {
+	m, _ := ctx.Value(mapKey{}).(*sync.Map)
+	return m
+}
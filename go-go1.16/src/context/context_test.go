@@ -786,3 +786,46 @@ func XTestCustomContextGoroutines(t testingT) {
 	defer cancel7()
 	checkNoGoroutine()
 }
+
+func XTestWithMap(t testingT) {
+	if m := MapFromContext(Background()); m != nil {
+		t.Fatalf("MapFromContext(Background()) = %v; want nil", m)
+	}
+	ctx, cancel := WithMap(Background())
+	m := MapFromContext(ctx)
+	if m == nil {
+		t.Fatal("MapFromContext of a WithMap context = nil")
+	}
+	child := WithValue(ctx, "k", "v")
+	if got := MapFromContext(child); got != m {
+		t.Fatalf("MapFromContext of a child = %p; want %p", got, m)
+	}
+	m.Store("user", 42)
+
+	waitCleared := func(m *sync.Map, what string) {
+		deadline := time.Now().Add(quiescent(t))
+		for {
+			if _, ok := m.Load("user"); !ok {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("map not cleared after %s", what)
+			}
+			time.Sleep(shortDuration)
+		}
+	}
+	cancel()
+	waitCleared(m, "cancel")
+	if ctx.Err() != Canceled {
+		t.Fatalf("Err after cancel = %v; want %v", ctx.Err(), Canceled)
+	}
+
+	// Canceling the parent clears the map too.
+	parent, cancelParent := WithCancel(Background())
+	ctx, cancel = WithMap(parent)
+	defer cancel()
+	m = MapFromContext(ctx)
+	m.Store("user", 42)
+	cancelParent()
+	waitCleared(m, "cancel of the parent")
+}
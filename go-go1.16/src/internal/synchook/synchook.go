@@ -0,0 +1,59 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package synchook lets a test scheduler observe the points at which
+// package sync blocks and wakes goroutines. It is used by sync/synctest.
+package synchook
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Point identifies where in package sync a hook is called.
+type Point uint8
+
+const (
+	// Preempt is a point at which the calling goroutine may be
+	// descheduled without changing the behavior of the program, such
+	// as the start of a contended Lock or Unlock.
+	Preempt Point = iota
+
+	// Park is called just before the calling goroutine blocks on the
+	// semaphore at addr.
+	Park
+
+	// Woken is called when the calling goroutine returns from blocking
+	// on the semaphore at addr.
+	Woken
+
+	// Wake is called just before the calling goroutine releases the
+	// semaphore at addr, waking exactly one goroutine that called or
+	// will call Park with the same addr.
+	Wake
+)
+
+var hook unsafe.Pointer // *func(Point, unsafe.Pointer)
+
+// Enabled reports whether a hook is installed.
+func Enabled() bool {
+	return atomic.LoadPointer(&hook) != nil
+}
+
+// Call calls the installed hook, if any.
+func Call(p Point, addr unsafe.Pointer) {
+	if h := (*func(Point, unsafe.Pointer))(atomic.LoadPointer(&hook)); h != nil {
+		(*h)(p, addr)
+	}
+}
+
+// Set installs h as the hook, replacing any previous one.
+// A nil h removes the hook.
+func Set(h func(p Point, addr unsafe.Pointer)) {
+	if h == nil {
+		atomic.StorePointer(&hook, nil)
+		return
+	}
+	atomic.StorePointer(&hook, unsafe.Pointer(&h))
+}
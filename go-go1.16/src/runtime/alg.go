@@ -311,6 +311,13 @@ func efaceHash(i interface{}, seed uintptr) uintptr {
 	return nilinterhash(noescape(unsafe.Pointer(&i)), seed)
 }
 
+// sync_runtime_efaceHash hashes i as a map with interface{} keys would,
+// for package sync to shard by key.
+//go:linkname sync_runtime_efaceHash sync.runtime_efaceHash
+func sync_runtime_efaceHash(i interface{}, seed uintptr) uintptr {
+	return efaceHash(i, seed)
+}
+
 func ifaceHash(i interface {
 	F()
 }, seed uintptr) uintptr {
@@ -6126,15 +6126,16 @@ func sync_atomic_runtime_procUnpin() {
 }
 
 // Active spinning for sync.Mutex.
+// sync chooses how many times to spin, as budget; see sync/spin.go.
 //go:linkname sync_runtime_canSpin sync.runtime_canSpin
 //go:nosplit
-func sync_runtime_canSpin(i int) bool {
+func sync_runtime_canSpin(i, budget int) bool {
 	// sync.Mutex is cooperative, so we are conservative with spinning.
 	// Spin only few times and only if running on a multicore machine and
 	// GOMAXPROCS>1 and there is at least one other running P and local runq is empty.
 	// As opposed to runtime mutex we don't do passive spinning here,
 	// because there can be work on global runq or on other Ps.
-	if i >= active_spin || ncpu <= 1 || gomaxprocs <= int32(sched.npidle+sched.nmspinning)+1 {
+	if i >= budget || ncpu <= 1 || gomaxprocs <= int32(sched.npidle+sched.nmspinning)+1 {
 		return false
 	}
 	if p := getg().m.p.ptr(); !runqempty(p) {
@@ -6143,12 +6144,28 @@ func sync_runtime_canSpin(i int) bool {
 	return true
 }
 
+// sync_runtime_gomaxprocs returns the current GOMAXPROCS without
+// taking sched.lock, for sizing the spin budget of sync.Mutex.
+//go:linkname sync_runtime_gomaxprocs sync.runtime_gomaxprocs
+//go:nosplit
+func sync_runtime_gomaxprocs() int {
+	return int(gomaxprocs)
+}
+
 //go:linkname sync_runtime_doSpin sync.runtime_doSpin
 //go:nosplit
 func sync_runtime_doSpin() {
 	procyield(active_spin_cnt)
 }
 
+// sync_runtime_goid returns the current goroutine's ID,
+// for diagnosing misuse of package sync.
+//go:linkname sync_runtime_goid sync.runtime_goid
+//go:nosplit
+func sync_runtime_goid() int64 {
+	return getg().goid
+}
+
 var stealOrder randomOrder
 
 // randomOrder/randomEnum are helper types for randomized work stealing.
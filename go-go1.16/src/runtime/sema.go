@@ -214,6 +214,64 @@ func semrelease1(addr *uint32, handoff bool, skipframes int) {
 	}
 }
 
+// sync_runtime_SemreleaseN is n calls of Semrelease without handoff, for
+// package sync to wake many waiters at once, such as the readers queued
+// behind a writer. It takes the lock of the semaphore root once for all
+// the waiters it wakes rather than once per waiter.
+//
+//go:linkname sync_runtime_SemreleaseN sync.runtime_SemreleaseN
+func sync_runtime_SemreleaseN(addr *uint32, n uint32, skipframes int) {
+	semreleaseN(addr, n, skipframes)
+}
+
+func semreleaseN(addr *uint32, n uint32, skipframes int) {
+	if n == 0 {
+		return
+	}
+	root := semroot(addr)
+	atomic.Xadd(addr, int32(n))
+
+	// Easy case: no waiters? As in semrelease1, this check must
+	// happen after the xadd.
+	if atomic.Load(&root.nwait) == 0 {
+		return
+	}
+
+	// Dequeue up to n waiters under one lock, oldest first.
+	var head, tail *sudog
+	var t0 int64
+	lockWithRank(&root.lock, lockRankRoot)
+	for ; n > 0 && atomic.Load(&root.nwait) != 0; n-- {
+		s, now := root.dequeue(addr)
+		if s == nil {
+			break
+		}
+		atomic.Xadd(&root.nwait, -1)
+		if now != 0 {
+			t0 = now
+		}
+		if tail == nil {
+			head = s
+		} else {
+			tail.next = s
+		}
+		tail = s
+	}
+	unlock(&root.lock)
+	for s := head; s != nil; {
+		next := s.next
+		s.next = nil
+		if s.acquiretime != 0 {
+			mutexevent(t0-s.acquiretime, 3+skipframes)
+		}
+		if s.ticket != 0 {
+			throw("corrupted semaphore ticket")
+		}
+		readyWithTime(s, 5+skipframes)
+		s = next
+	}
+}
+
 func semroot(addr *uint32) *semaRoot {
 	return &semtable[(uintptr(unsafe.Pointer(addr))>>3)%semTabSize].root
 }
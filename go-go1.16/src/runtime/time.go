@@ -193,6 +193,13 @@ func timeSleep(ns int64) {
 	gopark(resetForSleep, unsafe.Pointer(t), waitReasonSleep, traceEvGoSleep, 1)
 }
 
+// sync_runtime_sleep is timeSleep for package sync, which cannot
+// import package time.
+//go:linkname sync_runtime_sleep sync.runtime_sleep
+func sync_runtime_sleep(ns int64) {
+	timeSleep(ns)
+}
+
 // resetForSleep is called after the goroutine is parked for timeSleep.
 // We can't call resettimer in timeSleep itself because if this is a short
 // sleep and there are many goroutines then the P can wind up running the
@@ -229,6 +236,18 @@ func resetTimer(t *timer, when int64) bool {
 	return resettimer(t, when)
 }
 
+// sync_runtime_startTimer is startTimer for package sync.
+//go:linkname sync_runtime_startTimer sync.runtime_startTimer
+func sync_runtime_startTimer(t *timer) {
+	startTimer(t)
+}
+
+// sync_runtime_stopTimer is stopTimer for package sync.
+//go:linkname sync_runtime_stopTimer sync.runtime_stopTimer
+func sync_runtime_stopTimer(t *timer) bool {
+	return stopTimer(t)
+}
+
 // modTimer modifies an existing timer.
 //go:linkname modTimer time.modTimer
 func modTimer(t *timer, when, period int64, f func(interface{}, uintptr), arg interface{}, seq uintptr) {
@@ -1229,3 +1229,19 @@ func trace_userLog(id uint64, category, message string) {
 
 	traceReleaseBuffer(pid)
 }
+
+// sync_runtime_traceEnabled reports whether tracing is enabled, for
+// package sync, which cannot import runtime/trace.
+//
+//go:linkname sync_runtime_traceEnabled sync.runtime_traceEnabled
+func sync_runtime_traceEnabled() bool {
+	return trace.enabled
+}
+
+// sync_runtime_traceRegion is trace_userRegion for package sync. Its
+// regions belong to the background task.
+//
+//go:linkname sync_runtime_traceRegion sync.runtime_traceRegion
+func sync_runtime_traceRegion(mode uint64, name string) {
+	trace_userRegion(0, mode, name)
+}
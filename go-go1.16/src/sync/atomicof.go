@@ -0,0 +1,63 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// An Atomic holds a value that is loaded and stored atomically. Unlike
+// atomic.Value, it may hold nil and values of differing dynamic types,
+// and it can swap its value and compare and swap it.
+//
+// The zero Atomic holds nil. An Atomic must not be copied after first
+// use.
+type Atomic struct {
+	noCopy noCopy
+	p      unsafe.Pointer // *interface{}; nil means nil
+}
+
+// Load atomically loads and returns the value of a.
+func (a *Atomic) Load() (v interface{}) {
+	if p := atomic.LoadPointer(&a.p); p != nil {
+		v = *(*interface{})(p)
+	}
+	return v
+}
+
+// Store atomically sets a to v.
+func (a *Atomic) Store(v interface{}) {
+	atomic.StorePointer(&a.p, unsafe.Pointer(&v))
+}
+
+// Swap atomically sets a to new and returns its previous value.
+func (a *Atomic) Swap(new interface{}) (old interface{}) {
+	if p := atomic.SwapPointer(&a.p, unsafe.Pointer(&new)); p != nil {
+		old = *(*interface{})(p)
+	}
+	return old
+}
+
+// CompareAndSwap atomically sets a to new if it holds a value equal to
+// old, and reports whether it did. Values are compared as by == on
+// interface values, so CompareAndSwap panics if the values have the same
+// dynamic type and it is not comparable.
+func (a *Atomic) CompareAndSwap(old, new interface{}) (swapped bool) {
+	n := unsafe.Pointer(&new)
+	for {
+		p := atomic.LoadPointer(&a.p)
+		var cur interface{}
+		if p != nil {
+			cur = *(*interface{})(p)
+		}
+		if cur != old {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&a.p, p, n) {
+			return true
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"io"
+	. "sync"
+	"testing"
+)
+
+func TestAtomic(t *testing.T) {
+	var a Atomic
+	if v := a.Load(); v != nil {
+		t.Fatalf("zero Atomic holds %v", v)
+	}
+	a.Store("a")
+	if old := a.Swap("b"); old != "a" || a.Load() != "b" {
+		t.Fatalf("Swap returned %v; want a", old)
+	}
+	if a.CompareAndSwap("a", "c") {
+		t.Fatal("CompareAndSwap succeeded with wrong old value")
+	}
+	if !a.CompareAndSwap("b", "c") || a.Load() != "c" {
+		t.Fatal("CompareAndSwap(b, c) failed")
+	}
+
+	var wg WaitGroup
+	var n Atomic
+	n.Store(0)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				for {
+					v := n.Load().(int)
+					if n.CompareAndSwap(v, v+1) {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if v := n.Load(); v != 4000 {
+		t.Fatalf("counter = %d; want 4000", v)
+	}
+}
+
+func TestAtomicNilable(t *testing.T) {
+	// Storing values of differing dynamic types, or nil, must not panic.
+	var a Atomic
+	a.Store(1)
+	a.Store("x")
+	a.Store(nil)
+	if v := a.Load(); v != nil {
+		t.Fatalf("Load() = %v; want nil", v)
+	}
+	var e Atomic
+	if !e.CompareAndSwap(nil, io.EOF) || e.Load() != io.EOF {
+		t.Fatal("CompareAndSwap(nil, io.EOF) failed")
+	}
+	var m Atomic
+	m.Store(map[string]int{"a": 1})
+	if old := m.Swap(nil); old.(map[string]int)["a"] != 1 || m.Load() != nil {
+		t.Fatal("Swap(nil) misbehaved")
+	}
+}
+
+func TestAtomicCompareAndSwapIncomparable(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("CompareAndSwap on incomparable type did not panic")
+		}
+	}()
+	var a Atomic
+	a.Store([]int{1})
+	a.CompareAndSwap([]int{1}, nil)
+}
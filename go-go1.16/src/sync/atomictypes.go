@@ -0,0 +1,242 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// The types in this file wrap a single word and expose only atomic
+// operations on it, so that a field accessed atomically cannot also be
+// read or written with a plain, racy access by mistake. Each has noCopy,
+// so vet reports copies, and each zero value holds the zero value of its
+// type.
+//
+// On ARM, 386, and 32-bit MIPS, the 64-bit types must be 64-bit aligned,
+// just like the words passed to the 64-bit functions in sync/atomic.
+// Placing them first in an allocated struct is enough; see the Bugs
+// section of the sync/atomic documentation.
+
+// An AtomicBool is a bool that is read and written atomically.
+type AtomicBool struct {
+	noCopy noCopy
+	v      uint32
+}
+
+func b32(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Load atomically loads and returns the value of b.
+func (b *AtomicBool) Load() bool { return atomic.LoadUint32(&b.v) != 0 }
+
+// Store atomically sets b to val.
+func (b *AtomicBool) Store(val bool) { atomic.StoreUint32(&b.v, b32(val)) }
+
+// Swap atomically sets b to new and returns its previous value.
+func (b *AtomicBool) Swap(new bool) (old bool) { return atomic.SwapUint32(&b.v, b32(new)) != 0 }
+
+// CompareAndSwap atomically sets b to new if it holds old, and reports
+// whether it did.
+func (b *AtomicBool) CompareAndSwap(old, new bool) (swapped bool) {
+	return atomic.CompareAndSwapUint32(&b.v, b32(old), b32(new))
+}
+
+// An AtomicInt32 is an int32 that is read and written atomically.
+type AtomicInt32 struct {
+	noCopy noCopy
+	v      int32
+}
+
+// Load atomically loads and returns the value of i.
+func (i *AtomicInt32) Load() int32 { return atomic.LoadInt32(&i.v) }
+
+// Store atomically sets i to val.
+func (i *AtomicInt32) Store(val int32) { atomic.StoreInt32(&i.v, val) }
+
+// Add atomically adds delta to i and returns the new value.
+func (i *AtomicInt32) Add(delta int32) (new int32) { return atomic.AddInt32(&i.v, delta) }
+
+// Swap atomically sets i to new and returns its previous value.
+func (i *AtomicInt32) Swap(new int32) (old int32) { return atomic.SwapInt32(&i.v, new) }
+
+// CompareAndSwap atomically sets i to new if it holds old, and reports
+// whether it did.
+func (i *AtomicInt32) CompareAndSwap(old, new int32) (swapped bool) {
+	return atomic.CompareAndSwapInt32(&i.v, old, new)
+}
+
+// An AtomicInt64 is an int64 that is read and written atomically.
+type AtomicInt64 struct {
+	noCopy noCopy
+	v      int64
+}
+
+// Load atomically loads and returns the value of i.
+func (i *AtomicInt64) Load() int64 { return atomic.LoadInt64(&i.v) }
+
+// Store atomically sets i to val.
+func (i *AtomicInt64) Store(val int64) { atomic.StoreInt64(&i.v, val) }
+
+// Add atomically adds delta to i and returns the new value.
+func (i *AtomicInt64) Add(delta int64) (new int64) { return atomic.AddInt64(&i.v, delta) }
+
+// Swap atomically sets i to new and returns its previous value.
+func (i *AtomicInt64) Swap(new int64) (old int64) { return atomic.SwapInt64(&i.v, new) }
+
+// CompareAndSwap atomically sets i to new if it holds old, and reports
+// whether it did.
+func (i *AtomicInt64) CompareAndSwap(old, new int64) (swapped bool) {
+	return atomic.CompareAndSwapInt64(&i.v, old, new)
+}
+
+// An AtomicUint64 is a uint64 that is read and written atomically.
+type AtomicUint64 struct {
+	noCopy noCopy
+	v      uint64
+}
+
+// Load atomically loads and returns the value of u.
+func (u *AtomicUint64) Load() uint64 { return atomic.LoadUint64(&u.v) }
+
+// Store atomically sets u to val.
+func (u *AtomicUint64) Store(val uint64) { atomic.StoreUint64(&u.v, val) }
+
+// Add atomically adds delta to u and returns the new value. To subtract
+// a positive constant c, add ^uint64(c-1).
+func (u *AtomicUint64) Add(delta uint64) (new uint64) { return atomic.AddUint64(&u.v, delta) }
+
+// Swap atomically sets u to new and returns its previous value.
+func (u *AtomicUint64) Swap(new uint64) (old uint64) { return atomic.SwapUint64(&u.v, new) }
+
+// CompareAndSwap atomically sets u to new if it holds old, and reports
+// whether it did.
+func (u *AtomicUint64) CompareAndSwap(old, new uint64) (swapped bool) {
+	return atomic.CompareAndSwapUint64(&u.v, old, new)
+}
+
+// An AtomicDuration is a duration in nanoseconds that is read and written
+// atomically. Its values convert directly to and from time.Duration.
+type AtomicDuration struct {
+	noCopy noCopy
+	v      int64
+}
+
+// Load atomically loads and returns the value of d.
+func (d *AtomicDuration) Load() int64 { return atomic.LoadInt64(&d.v) }
+
+// Store atomically sets d to val.
+func (d *AtomicDuration) Store(val int64) { atomic.StoreInt64(&d.v, val) }
+
+// Add atomically adds delta to d and returns the new value.
+func (d *AtomicDuration) Add(delta int64) (new int64) { return atomic.AddInt64(&d.v, delta) }
+
+// Swap atomically sets d to new and returns its previous value.
+func (d *AtomicDuration) Swap(new int64) (old int64) { return atomic.SwapInt64(&d.v, new) }
+
+// CompareAndSwap atomically sets d to new if it holds old, and reports
+// whether it did.
+func (d *AtomicDuration) CompareAndSwap(old, new int64) (swapped bool) {
+	return atomic.CompareAndSwapInt64(&d.v, old, new)
+}
+
+// An AtomicFloat64 is a float64 that is read and written atomically.
+type AtomicFloat64 struct {
+	noCopy noCopy
+	v      uint64 // float64bits of the value
+}
+
+// Load atomically loads and returns the value of f.
+func (f *AtomicFloat64) Load() float64 { return float64frombits(atomic.LoadUint64(&f.v)) }
+
+// Store atomically sets f to val.
+func (f *AtomicFloat64) Store(val float64) { atomic.StoreUint64(&f.v, float64bits(val)) }
+
+// Add atomically adds delta to f and returns the new value.
+func (f *AtomicFloat64) Add(delta float64) (new float64) {
+	for {
+		old := atomic.LoadUint64(&f.v)
+		new = float64frombits(old) + delta
+		if atomic.CompareAndSwapUint64(&f.v, old, float64bits(new)) {
+			return new
+		}
+	}
+}
+
+// Swap atomically sets f to new and returns its previous value.
+func (f *AtomicFloat64) Swap(new float64) (old float64) {
+	return float64frombits(atomic.SwapUint64(&f.v, float64bits(new)))
+}
+
+// CompareAndSwap atomically sets f to new if it holds old, and reports
+// whether it did. The comparison is of bit patterns rather than ==, so a
+// NaN matches an identical NaN, and 0 and -0 do not match each other.
+func (f *AtomicFloat64) CompareAndSwap(old, new float64) (swapped bool) {
+	return atomic.CompareAndSwapUint64(&f.v, float64bits(old), float64bits(new))
+}
+
+// An AtomicError is an error that is read and written atomically.
+// Unlike atomic.Value, it accepts errors of differing concrete types,
+// including nil.
+type AtomicError struct {
+	noCopy noCopy
+	p      unsafe.Pointer // *atomicErrorBox; nil means a nil error
+}
+
+type atomicErrorBox struct {
+	err error
+}
+
+func boxError(err error) unsafe.Pointer {
+	if err == nil {
+		return nil
+	}
+	return unsafe.Pointer(&atomicErrorBox{err})
+}
+
+func unboxError(p unsafe.Pointer) error {
+	if p == nil {
+		return nil
+	}
+	return (*atomicErrorBox)(p).err
+}
+
+// Load atomically loads and returns the value of e.
+func (e *AtomicError) Load() error { return unboxError(atomic.LoadPointer(&e.p)) }
+
+// Store atomically sets e to err.
+func (e *AtomicError) Store(err error) { atomic.StorePointer(&e.p, boxError(err)) }
+
+// Swap atomically sets e to new and returns its previous value.
+func (e *AtomicError) Swap(new error) (old error) {
+	return unboxError(atomic.SwapPointer(&e.p, boxError(new)))
+}
+
+// CompareAndSwap atomically sets e to new if it holds an error equal to
+// old, and reports whether it did. Like ==, it panics if old and the
+// current value have the same incomparable dynamic type.
+func (e *AtomicError) CompareAndSwap(old, new error) (swapped bool) {
+	n := boxError(new)
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if unboxError(p) != old {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, n) {
+			return true
+		}
+	}
+}
+
+// float64bits and float64frombits are math.Float64bits and
+// math.Float64frombits, which package sync, below math in the dependency
+// order, cannot import.
+func float64bits(f float64) uint64 { return *(*uint64)(unsafe.Pointer(&f)) }
+
+func float64frombits(b uint64) float64 { return *(*float64)(unsafe.Pointer(&b)) }
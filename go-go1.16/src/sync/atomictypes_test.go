@@ -0,0 +1,142 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"errors"
+	"io"
+	"math"
+	. "sync"
+	"testing"
+)
+
+func TestAtomicBool(t *testing.T) {
+	var b AtomicBool
+	if b.Load() {
+		t.Fatal("zero AtomicBool is true")
+	}
+	b.Store(true)
+	if !b.Load() {
+		t.Fatal("Store(true) had no effect")
+	}
+	if old := b.Swap(false); !old {
+		t.Fatal("Swap returned false; want true")
+	}
+	if b.CompareAndSwap(true, true) {
+		t.Fatal("CompareAndSwap(true, true) succeeded on false")
+	}
+	if !b.CompareAndSwap(false, true) || !b.Load() {
+		t.Fatal("CompareAndSwap(false, true) failed")
+	}
+}
+
+func TestAtomicInts(t *testing.T) {
+	var i32 AtomicInt32
+	var i64 AtomicInt64
+	var u64 AtomicUint64
+	var d AtomicDuration
+	var wg WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 1000; n++ {
+				i32.Add(1)
+				i64.Add(-1)
+				u64.Add(2)
+				d.Add(3)
+			}
+		}()
+	}
+	wg.Wait()
+	if v := i32.Load(); v != 4000 {
+		t.Errorf("AtomicInt32 = %d; want 4000", v)
+	}
+	if v := i64.Load(); v != -4000 {
+		t.Errorf("AtomicInt64 = %d; want -4000", v)
+	}
+	if v := u64.Add(^uint64(8000 - 1)); v != 0 {
+		t.Errorf("AtomicUint64 = %d; want 0", v)
+	}
+	if v := d.Swap(5); v != 12000 {
+		t.Errorf("AtomicDuration = %d; want 12000", v)
+	}
+	if d.CompareAndSwap(4, 6) || !d.CompareAndSwap(5, 6) || d.Load() != 6 {
+		t.Error("AtomicDuration.CompareAndSwap misbehaved")
+	}
+	i32.Store(7)
+	if old := i32.Swap(8); old != 7 || !i32.CompareAndSwap(8, 9) || i32.Load() != 9 {
+		t.Error("AtomicInt32 Store/Swap/CompareAndSwap misbehaved")
+	}
+	i64.Store(7)
+	if old := i64.Swap(8); old != 7 || !i64.CompareAndSwap(8, 9) || i64.Load() != 9 {
+		t.Error("AtomicInt64 Store/Swap/CompareAndSwap misbehaved")
+	}
+	u64.Store(7)
+	if old := u64.Swap(8); old != 7 || !u64.CompareAndSwap(8, 9) || u64.Load() != 9 {
+		t.Error("AtomicUint64 Store/Swap/CompareAndSwap misbehaved")
+	}
+}
+
+func TestAtomicFloat64(t *testing.T) {
+	var f AtomicFloat64
+	if v := f.Load(); v != 0 {
+		t.Fatalf("zero AtomicFloat64 holds %g", v)
+	}
+	var wg WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				f.Add(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+	if v := f.Load(); v != 2000 {
+		t.Fatalf("AtomicFloat64 = %g; want 2000", v)
+	}
+	if old := f.Swap(math.NaN()); old != 2000 {
+		t.Fatalf("Swap returned %g; want 2000", old)
+	}
+	if !f.CompareAndSwap(f.Load(), -1.5) || f.Load() != -1.5 {
+		t.Fatal("CompareAndSwap from NaN failed")
+	}
+	f.Store(0)
+	if f.CompareAndSwap(math.Copysign(0, -1), 1) {
+		t.Fatal("CompareAndSwap matched -0 against 0")
+	}
+}
+
+type testError struct{ s string }
+
+func (e testError) Error() string { return e.s }
+
+func TestAtomicError(t *testing.T) {
+	var e AtomicError
+	if err := e.Load(); err != nil {
+		t.Fatalf("zero AtomicError holds %v", err)
+	}
+	// Values of different concrete types must be accepted.
+	e.Store(io.EOF)
+	e.Store(testError{"x"})
+	if err := e.Load(); err != (testError{"x"}) {
+		t.Fatalf("Load() = %v; want x", err)
+	}
+	if old := e.Swap(nil); old != (testError{"x"}) || e.Load() != nil {
+		t.Fatalf("Swap(nil) = %v", old)
+	}
+	if e.CompareAndSwap(io.EOF, io.ErrUnexpectedEOF) {
+		t.Fatal("CompareAndSwap succeeded with wrong old value")
+	}
+	if !e.CompareAndSwap(nil, io.EOF) || e.Load() != io.EOF {
+		t.Fatal("CompareAndSwap(nil, io.EOF) failed")
+	}
+	errX := errors.New("x")
+	if !e.CompareAndSwap(io.EOF, errX) || e.Load() != errX {
+		t.Fatal("CompareAndSwap(io.EOF, errX) failed")
+	}
+}
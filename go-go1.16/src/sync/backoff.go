@@ -0,0 +1,66 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "runtime"
+
+// A Backoff paces the retries of a loop that waits for another goroutine,
+// such as a compare-and-swap loop under contention. Each call to Wait
+// waits longer than the last: the first few spin briefly on the processor,
+// the next few yield it to other goroutines, and the rest sleep for
+// exponentially growing, randomly jittered times up to a millisecond.
+// This keeps short waits cheap without burning CPU on long ones, and the
+// jitter keeps goroutines that collided from retrying in lockstep.
+//
+// A typical use is
+//
+//    var b sync.Backoff
+//    for !atomic.CompareAndSwapInt64(&x, old, new) {
+//        b.Wait()
+//        old = atomic.LoadInt64(&x)
+//        new = f(old)
+//    }
+//
+// The zero Backoff is ready for use. A Backoff is meant for use by a
+// single goroutine.
+type Backoff struct {
+	n int // calls to Wait since the last Reset, capped
+}
+
+const (
+	backoffSpins    = 4   // Waits that spin, 1, 2, 4 and 8 times
+	backoffYields   = 4   // Waits after those that yield
+	backoffMinSleep = 1e3 // first sleep, in nanoseconds
+	backoffMaxSleep = 1e6 // longest sleep, in nanoseconds
+)
+
+// Wait waits before the next attempt, for longer than the previous call
+// to Wait did, until the maximum is reached.
+func (b *Backoff) Wait() {
+	switch {
+	case b.n < backoffSpins:
+		for i := 0; i < 1<<b.n; i++ {
+			runtime_doSpin()
+		}
+	case b.n < backoffSpins+backoffYields:
+		runtime.Gosched()
+	default:
+		d := int64(backoffMaxSleep)
+		if k := b.n - backoffSpins - backoffYields; k < 10 && backoffMinSleep<<k < d {
+			d = backoffMinSleep << k
+		}
+		// Sleep for a random time in [d/2, d).
+		runtime_sleep(d/2 + int64(fastrand())%(d/2))
+	}
+	if b.n < backoffSpins+backoffYields+10 {
+		b.n++
+	}
+}
+
+// Reset makes the next call to Wait wait as briefly as the first one,
+// as after an attempt succeeds.
+func (b *Backoff) Reset() {
+	b.n = 0
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	var b Backoff
+	start := time.Now()
+	for i := 0; i < 8; i++ {
+		b.Wait() // spins and yields
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("first 8 Waits took %v; want them not to sleep", d)
+	}
+	// Sleeps grow until capped at 1ms; 20 more Waits must sleep
+	// at least the capped half-millisecond many times over.
+	start = time.Now()
+	for i := 0; i < 20; i++ {
+		b.Wait()
+	}
+	if d := time.Since(start); d < 5*time.Millisecond {
+		t.Errorf("sleeping Waits took only %v", d)
+	}
+	b.Reset()
+	start = time.Now()
+	b.Wait()
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Wait after Reset took %v", d)
+	}
+}
+
+func TestBackoffCAS(t *testing.T) {
+	var x int64
+	var wg WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				var b Backoff
+				for {
+					old := atomic.LoadInt64(&x)
+					if atomic.CompareAndSwapInt64(&x, old, old+1) {
+						break
+					}
+					b.Wait()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if x != 4000 {
+		t.Fatalf("x = %d; want 4000", x)
+	}
+}
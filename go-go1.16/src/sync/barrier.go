@@ -0,0 +1,151 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// ErrBarrierBroken is returned by Barrier.Await when the barrier is
+// broken: because a goroutine gave up waiting at it, because its action
+// panicked, or because it was Reset while goroutines were waiting.
+var ErrBarrierBroken error = syncError("sync: barrier broken")
+
+// A syncError is an error with a fixed message. Package sync sits below
+// errors in the dependency order, so it cannot use errors.New.
+type syncError string
+
+func (e syncError) Error() string { return string(e) }
+
+// A Barrier lets a fixed number of goroutines wait for each other at a
+// common point, as in phased parallel algorithms where each phase must
+// finish before the next starts. A Barrier is cyclic: once all of the
+// goroutines have arrived and been released, it can be used again.
+//
+// If a goroutine gives up waiting, by its context being done, the
+// barrier breaks: the goroutines waiting at it and those arriving later
+// get ErrBarrierBroken until Reset is called. This keeps a failure of
+// one participant from leaving the others waiting forever.
+//
+// A Barrier must be created with NewBarrier and must not be copied
+// after first use.
+type Barrier struct {
+	n      int
+	action func()
+
+	mu  Mutex
+	gen *barrierGen // the current round
+}
+
+// A barrierGen is one round of a Barrier.
+type barrierGen struct {
+	arrived int
+	broken  bool
+	done    chan struct{} // closed when the round completes or breaks
+}
+
+// NewBarrier returns a new Barrier for n goroutines. If action is not
+// nil, the last goroutine to arrive in each round calls it before any
+// of them are released; it must not call methods on the Barrier.
+func NewBarrier(n int, action func()) *Barrier {
+	if n <= 0 {
+		panic("sync: non-positive Barrier size")
+	}
+	return &Barrier{n: n, action: action, gen: newBarrierGen()}
+}
+
+func newBarrierGen() *barrierGen {
+	return &barrierGen{done: make(chan struct{})}
+}
+
+// Await waits until all of b's goroutines have called Await, then
+// returns nil. It returns ErrBarrierBroken if b is or becomes broken.
+// If b's action panics, Await panics in the goroutine that ran it and
+// returns ErrBarrierBroken in the others.
+func (b *Barrier) Await() error {
+	return b.await(nil)
+}
+
+// AwaitContext is like Await, but gives up waiting if ctx is done
+// first, in which case it breaks b and returns ctx.Err().
+func (b *Barrier) AwaitContext(ctx Context) error {
+	return b.await(ctx)
+}
+
+func (b *Barrier) await(ctx Context) error {
+	b.mu.Lock()
+	g := b.gen
+	if g.broken {
+		b.mu.Unlock()
+		return ErrBarrierBroken
+	}
+	g.arrived++
+	if g.arrived == b.n {
+		b.trip(g)
+		return nil
+	}
+	b.mu.Unlock()
+
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	select {
+	case <-g.done:
+	case <-cancel:
+		b.mu.Lock()
+		if b.gen == g && !g.broken {
+			// The round is still waiting for others.
+			b.breakGen(g)
+			b.mu.Unlock()
+			return ctx.Err()
+		}
+		b.mu.Unlock()
+	}
+	if g.broken {
+		return ErrBarrierBroken
+	}
+	return nil
+}
+
+// trip runs b's action and completes round g. It is called with b.mu
+// held, and releases it.
+func (b *Barrier) trip(g *barrierGen) {
+	tripped := false
+	defer func() {
+		if !tripped {
+			// The action panicked.
+			b.breakGen(g)
+		}
+		b.mu.Unlock()
+	}()
+	if b.action != nil {
+		b.action()
+	}
+	tripped = true
+	b.gen = newBarrierGen()
+	close(g.done)
+}
+
+// breakGen breaks round g, releasing the goroutines waiting in it.
+// b.mu must be held.
+func (b *Barrier) breakGen(g *barrierGen) {
+	g.broken = true
+	close(g.done)
+}
+
+// Reset returns b to its initial state. Goroutines waiting at b when
+// Reset is called get ErrBarrierBroken.
+func (b *Barrier) Reset() {
+	b.mu.Lock()
+	if g := b.gen; !g.broken && g.arrived > 0 {
+		b.breakGen(g)
+	}
+	b.gen = newBarrierGen()
+	b.mu.Unlock()
+}
+
+// Broken reports whether b is broken. See Await.
+func (b *Barrier) Broken() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.gen.broken
+}
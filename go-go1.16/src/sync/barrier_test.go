@@ -0,0 +1,102 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	. "sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBarrier(t *testing.T) {
+	const (
+		n      = 8
+		rounds = 100
+	)
+	var phase int32
+	b := NewBarrier(n, func() { atomic.AddInt32(&phase, 1) })
+	var wg WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				if p := atomic.LoadInt32(&phase); p != int32(r) {
+					t.Errorf("goroutine in round %d saw phase %d", r, p)
+					return
+				}
+				if err := b.Await(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if phase != rounds {
+		t.Fatalf("action ran %d times; want %d", phase, rounds)
+	}
+}
+
+func TestBarrierBroken(t *testing.T) {
+	b := NewBarrier(3, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() { errc <- b.Await() }()
+	go func() { errc <- b.AwaitContext(ctx) }()
+	cancel()
+	errs := []error{<-errc, <-errc}
+	if !(errs[0] == ErrBarrierBroken && errs[1] == context.Canceled ||
+		errs[0] == context.Canceled && errs[1] == ErrBarrierBroken) {
+		t.Fatalf("got %v; want %v and %v", errs, ErrBarrierBroken, context.Canceled)
+	}
+	if !b.Broken() {
+		t.Fatal("barrier not broken after a canceled Await")
+	}
+	if err := b.Await(); err != ErrBarrierBroken {
+		t.Fatalf("Await on broken barrier returned %v", err)
+	}
+
+	b.Reset()
+	if b.Broken() {
+		t.Fatal("barrier broken after Reset")
+	}
+	for i := 0; i < 2; i++ {
+		go func() { errc <- b.Await() }()
+	}
+	if err := b.Await(); err != nil {
+		t.Fatalf("Await after Reset returned %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			t.Fatalf("Await after Reset returned %v", err)
+		}
+	}
+}
+
+func TestBarrierActionPanic(t *testing.T) {
+	b := NewBarrier(2, func() { panic("boom") })
+	results := make(chan interface{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer func() {
+				if err := recover(); err != nil {
+					results <- err
+				}
+			}()
+			results <- b.Await()
+		}()
+	}
+	// The last goroutine to arrive runs the action and panics;
+	// the other finds the barrier broken.
+	r1, r2 := <-results, <-results
+	if !(r1 == "boom" && r2 == ErrBarrierBroken || r1 == ErrBarrierBroken && r2 == "boom") {
+		t.Fatalf("got %v and %v; want a panic and %v", r1, r2, ErrBarrierBroken)
+	}
+	if !b.Broken() {
+		t.Fatal("barrier not broken after its action panicked")
+	}
+}
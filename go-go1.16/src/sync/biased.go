@@ -0,0 +1,86 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// A BiasedMutex is a mutual exclusion lock biased toward one goroutine,
+// its owner, for the common case of a lock almost always taken by the
+// same worker. The owner locks it with OwnerLock and OwnerUnlock, which
+// take it with a store and a load, without a compare-and-swap and
+// without touching a cache line that other goroutines write. Any other
+// goroutine locks it with Lock and Unlock.
+//
+// Lock revokes the bias: it announces the goroutine, waits for the owner
+// to unlock if the owner holds the lock, and from then on it and the
+// owner take an ordinary Mutex, until no other goroutine holds or wants
+// the lock and the owner takes the cheap path again. The wait for the
+// owner polls, backing off as Backoff does, so a BiasedMutex suits locks
+// that other goroutines take rarely.
+//
+// Which goroutine is the owner is up to the caller: at most one
+// goroutine at a time may call OwnerLock and OwnerUnlock, as with the
+// producer of an SPSCRing. The zero value is an unlocked mutex.
+//
+// A BiasedMutex must not be copied after first use.
+type BiasedMutex struct {
+	mu       Mutex // the lock of the goroutines other than the owner
+	held     int32 // 1 while the owner holds the lock without mu
+	revoking int32 // number of other goroutines that hold or want mu
+}
+
+// OwnerLock locks b on behalf of its owner. If the lock is already in
+// use, the calling goroutine blocks until the lock is available.
+func (b *BiasedMutex) OwnerLock() {
+	// Announce the lock, then look for other goroutines. Lock does
+	// the same in the other order, so at least one of the two sees
+	// the other.
+	atomic.StoreInt32(&b.held, 1)
+	if atomic.LoadInt32(&b.revoking) == 0 {
+		return
+	}
+	atomic.StoreInt32(&b.held, 0)
+	b.mu.Lock()
+}
+
+// OwnerUnlock unlocks b after OwnerLock.
+// It is a run-time error if b is not locked by OwnerLock.
+func (b *BiasedMutex) OwnerUnlock() {
+	if atomic.LoadInt32(&b.held) != 0 {
+		atomic.StoreInt32(&b.held, 0)
+		return
+	}
+	b.mu.Unlock()
+}
+
+// Lock locks b on behalf of a goroutine other than the owner. If the
+// lock is already in use, the calling goroutine blocks until the lock is
+// available.
+func (b *BiasedMutex) Lock() {
+	atomic.AddInt32(&b.revoking, 1)
+	b.mu.Lock()
+	var bo Backoff
+	for atomic.LoadInt32(&b.held) != 0 {
+		bo.Wait()
+	}
+}
+
+// Unlock unlocks b after Lock.
+// It is a run-time error if b is not locked by Lock.
+func (b *BiasedMutex) Unlock() {
+	b.mu.Unlock()
+	atomic.AddInt32(&b.revoking, -1)
+}
+
+// Owner returns a Locker interface that implements the Lock and Unlock
+// methods by calling b.OwnerLock and b.OwnerUnlock.
+func (b *BiasedMutex) Owner() Locker {
+	return (*biasOwner)(b)
+}
+
+type biasOwner BiasedMutex
+
+func (o *biasOwner) Lock()   { (*BiasedMutex)(o).OwnerLock() }
+func (o *biasOwner) Unlock() { (*BiasedMutex)(o).OwnerUnlock() }
@@ -0,0 +1,123 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"sync/atomic"
+	"sync/stress"
+	"testing"
+	"time"
+)
+
+func TestBiasedMutexStress(t *testing.T) {
+	for _, c := range stress.Standard {
+		if _, err := stress.Run(new(BiasedMutex), c); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestBiasedMutexOwner(t *testing.T) {
+	var mu BiasedMutex
+	var holders int32
+	n := 0
+	check := func() {
+		if h := atomic.AddInt32(&holders, 1); h != 1 {
+			t.Errorf("%d goroutines hold the BiasedMutex", h)
+		}
+		n++
+		atomic.AddInt32(&holders, -1)
+	}
+	const others, iters = 3, 1000
+	done := make(chan bool)
+	for g := 0; g < others; g++ {
+		go func() {
+			for i := 0; i < iters/10; i++ {
+				mu.Lock()
+				check()
+				mu.Unlock()
+			}
+			done <- true
+		}()
+	}
+	owner := mu.Owner()
+	for i := 0; i < iters; i++ {
+		owner.Lock()
+		check()
+		owner.Unlock()
+	}
+	for g := 0; g < others; g++ {
+		<-done
+	}
+	if want := iters + others*iters/10; n != want {
+		t.Errorf("%d critical sections ran; want %d", n, want)
+	}
+}
+
+func TestBiasedMutexRevoke(t *testing.T) {
+	var mu BiasedMutex
+	mu.OwnerLock()
+
+	locked := make(chan bool)
+	release := make(chan bool)
+	go func() {
+		mu.Lock()
+		locked <- true
+		<-release
+		mu.Unlock()
+		locked <- false
+	}()
+	select {
+	case <-locked:
+		t.Fatal("Lock succeeded while the owner held the BiasedMutex")
+	case <-time.After(10 * time.Millisecond):
+	}
+	mu.OwnerUnlock()
+	<-locked
+
+	// The owner waits for the other goroutine in turn.
+	var released int32
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		atomic.StoreInt32(&released, 1)
+		release <- true
+	}()
+	mu.OwnerLock()
+	if atomic.LoadInt32(&released) == 0 {
+		t.Fatal("OwnerLock succeeded while another goroutine held the BiasedMutex")
+	}
+	mu.OwnerUnlock()
+	<-locked
+
+	// With no one else around, the owner takes the cheap path again.
+	for i := 0; i < 3; i++ {
+		mu.OwnerLock()
+		mu.OwnerUnlock()
+	}
+}
+
+func BenchmarkBiasedMutexOwner(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		var mu struct {
+			BiasedMutex
+			_ CacheLinePad
+		}
+		for pb.Next() {
+			mu.OwnerLock()
+			mu.OwnerUnlock()
+		}
+	})
+}
+
+func BenchmarkBiasedMutexContended(b *testing.B) {
+	var mu BiasedMutex
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mu.Lock()
+			mu.Unlock()
+		}
+	})
+}
@@ -0,0 +1,137 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// A Bitset is a fixed-size set of bits that goroutines set, clear and
+// test concurrently, each operation an atomic operation on the word
+// holding the bit. It tracks membership or claims over many slots, such
+// as which pages of a file are cached or which jobs have been taken,
+// for the cost of a bit per slot and with no lock at all.
+//
+// Each operation on a bit is atomic, but an operation over many bits,
+// such as Count or Range, sees each word of the set at a different
+// time, not the whole set at once.
+//
+// A Bitset must be created with NewBitset and must not be copied after
+// first use.
+type Bitset struct {
+	words []uint64
+	n     int
+}
+
+// NewBitset returns a new Bitset of n bits, all clear. It panics if n
+// is negative.
+func NewBitset(n int) *Bitset {
+	if n < 0 {
+		panic("sync: NewBitset with negative size")
+	}
+	return &Bitset{words: make([]uint64, (n+63)/64), n: n}
+}
+
+// Len returns the number of bits in b.
+func (b *Bitset) Len() int {
+	return b.n
+}
+
+// word returns the word holding bit i and the mask of the bit in it.
+func (b *Bitset) word(i int) (*uint64, uint64) {
+	if uint(i) >= uint(b.n) {
+		panic("sync: Bitset index out of range")
+	}
+	return &b.words[i/64], 1 << (uint(i) % 64)
+}
+
+// Test reports whether bit i of b is set. It panics if i is out of
+// range, as do the other methods that take a bit index.
+func (b *Bitset) Test(i int) bool {
+	w, m := b.word(i)
+	return atomic.LoadUint64(w)&m != 0
+}
+
+// Set sets bit i of b.
+func (b *Bitset) Set(i int) {
+	b.TestAndSet(i)
+}
+
+// Clear clears bit i of b.
+func (b *Bitset) Clear(i int) {
+	b.TestAndClear(i)
+}
+
+// TestAndSet sets bit i of b and reports whether it was set already. Of
+// the goroutines that call it for a clear bit, exactly one gets false,
+// which makes it a claim on slot i.
+func (b *Bitset) TestAndSet(i int) (wasSet bool) {
+	w, m := b.word(i)
+	for {
+		old := atomic.LoadUint64(w)
+		if old&m != 0 {
+			return true
+		}
+		if atomic.CompareAndSwapUint64(w, old, old|m) {
+			return false
+		}
+	}
+}
+
+// TestAndClear clears bit i of b and reports whether it was set.
+func (b *Bitset) TestAndClear(i int) (wasSet bool) {
+	w, m := b.word(i)
+	for {
+		old := atomic.LoadUint64(w)
+		if old&m == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(w, old, old&^m) {
+			return true
+		}
+	}
+}
+
+// Count returns the number of bits of b that are set.
+func (b *Bitset) Count() int {
+	n := 0
+	for i := range b.words {
+		for w := atomic.LoadUint64(&b.words[i]); w != 0; w &= w - 1 {
+			n++
+		}
+	}
+	return n
+}
+
+// Range calls f with the index of each bit of b that is set, in
+// increasing order, until f returns false. It loads each word of b once,
+// when it reaches it, and goes through the bits of that copy, so f may
+// set or clear bits of b: the changes to words Range has yet to reach
+// show, and those to the others do not.
+func (b *Bitset) Range(f func(i int) bool) {
+	for wi := range b.words {
+		w := atomic.LoadUint64(&b.words[wi])
+		for w != 0 {
+			low := w & -w
+			if !f(wi*64 + bitIndex(low)) {
+				return
+			}
+			w &^= low
+		}
+	}
+}
+
+// bitIndex returns the index of the single bit set in x, as
+// bits.TrailingZeros64 does, which package sync cannot import.
+func bitIndex(x uint64) int {
+	return int(deBruijn64tab[(x*deBruijn64)>>58])
+}
+
+const deBruijn64 = 0x03f79d71b4ca8b09
+
+var deBruijn64tab = [64]byte{
+	0, 1, 56, 2, 57, 49, 28, 3, 61, 58, 42, 50, 38, 29, 17, 4,
+	62, 47, 59, 36, 45, 43, 51, 22, 53, 39, 33, 30, 24, 18, 12, 5,
+	63, 55, 48, 27, 60, 41, 37, 16, 46, 35, 44, 21, 52, 32, 23, 11,
+	54, 26, 40, 15, 34, 20, 31, 10, 25, 14, 19, 9, 13, 8, 7, 6,
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBitset(t *testing.T) {
+	b := NewBitset(200)
+	set := []int{0, 5, 63, 64, 130, 199}
+	for _, i := range set {
+		b.Set(i)
+	}
+	if n := b.Count(); n != len(set) {
+		t.Fatalf("Count = %d; want %d", n, len(set))
+	}
+	var got []int
+	b.Range(func(i int) bool {
+		got = append(got, i)
+		b.Clear(i)
+		return true
+	})
+	if len(got) != len(set) {
+		t.Fatalf("Range visited %v; want %v", got, set)
+	}
+	for k, i := range set {
+		if got[k] != i {
+			t.Fatalf("Range visited %v; want %v", got, set)
+		}
+		if b.Test(i) {
+			t.Fatalf("bit %d still set after Clear", i)
+		}
+	}
+	if b.TestAndSet(7) || !b.TestAndSet(7) {
+		t.Fatal("TestAndSet of a clear bit, then a set one, wrong")
+	}
+	if !b.TestAndClear(7) || b.TestAndClear(7) {
+		t.Fatal("TestAndClear of a set bit, then a clear one, wrong")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Test out of range did not panic")
+			}
+		}()
+		b.Test(200)
+	}()
+}
+
+// TestBitsetClaims checks that each bit is claimed by exactly one of the
+// goroutines racing to claim it, including bits sharing a word.
+func TestBitsetClaims(t *testing.T) {
+	const (
+		n       = 10000
+		workers = 8
+	)
+	b := NewBitset(n)
+	var claimed int64
+	done := make(chan bool)
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := 0; i < n; i++ {
+				if !b.TestAndSet(i) {
+					atomic.AddInt64(&claimed, 1)
+				}
+			}
+			done <- true
+		}()
+	}
+	for w := 0; w < workers; w++ {
+		<-done
+	}
+	if claimed != n || b.Count() != n {
+		t.Fatalf("%d claims, %d bits set; want %d of each", claimed, b.Count(), n)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// ErrQueueClosed is returned by the Put methods of BlockingQueue and
+// PriorityQueue after Close, and by their Take methods once the queue is
+// closed and empty.
+var ErrQueueClosed error = syncError("sync: queue is closed")
+
+// A BlockingQueue is a first-in, first-out queue of bounded capacity
+// between producers and consumers: Put waits while the queue is full,
+// which pushes back on producers that outpace their consumers, and Take
+// waits while it is empty. Both give up when their context is done.
+//
+// Close stops the producers but lets the consumers drain the queue: Put
+// fails after Close, while Take goes on returning the queued values
+// and fails only once none are left.
+//
+// The values live in a buffered channel, whose runtime semaphores do
+// the waiting, rather than in a slice guarded by a Cond, which could
+// not wait for a context.
+//
+// A BlockingQueue must be created with NewBlockingQueue and must not be
+// copied after first use.
+type BlockingQueue struct {
+	items chan interface{}
+
+	mu        RWMutex // held for reading by Put and TryPut, for writing by Close
+	closed    bool
+	closeOnce Once
+	closing   chan struct{} // closed when Close starts, to stop waiting Puts
+	sealed    chan struct{} // closed once no Put can add a value
+}
+
+// NewBlockingQueue returns a new BlockingQueue that holds up to capacity
+// values. It panics if capacity is not positive.
+func NewBlockingQueue(capacity int) *BlockingQueue {
+	if capacity <= 0 {
+		panic("sync: NewBlockingQueue with non-positive capacity")
+	}
+	return &BlockingQueue{
+		items:   make(chan interface{}, capacity),
+		closing: make(chan struct{}),
+		sealed:  make(chan struct{}),
+	}
+}
+
+// Put adds v at the end of q, waiting for room if q is full. It returns
+// ErrQueueClosed if q is closed before v is added, or ctx.Err() if ctx
+// is done first. A nil ctx never gives up.
+func (q *BlockingQueue) Put(ctx Context, v interface{}) error {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	select {
+	case q.items <- v:
+		return nil
+	default:
+	}
+	select {
+	case q.items <- v:
+		return nil
+	case <-q.closing:
+		return ErrQueueClosed
+	case <-cancel:
+		return ctx.Err()
+	}
+}
+
+// TryPut adds v at the end of q if there is room, without waiting. It
+// reports whether it added v, which it does not if q is full or closed.
+func (q *BlockingQueue) TryPut(v interface{}) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.items <- v:
+		return true
+	default:
+		return false
+	}
+}
+
+// Take removes and returns the value at the front of q, waiting for one
+// if q is empty. It returns ErrQueueClosed if q is closed and empty, or
+// ctx.Err() if ctx is done first. A nil ctx never gives up.
+func (q *BlockingQueue) Take(ctx Context) (interface{}, error) {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	select {
+	case v := <-q.items:
+		return v, nil
+	default:
+	}
+	select {
+	case v := <-q.items:
+		return v, nil
+	case <-q.sealed:
+		// No more values can come; take those left, if any.
+		select {
+		case v := <-q.items:
+			return v, nil
+		default:
+			return nil, ErrQueueClosed
+		}
+	case <-cancel:
+		return nil, ctx.Err()
+	}
+}
+
+// TryTake removes and returns the value at the front of q, if there is
+// one, without waiting. The ok result reports whether there was.
+func (q *BlockingQueue) TryTake() (v interface{}, ok bool) {
+	select {
+	case v = <-q.items:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+// Len returns the number of values in q.
+func (q *BlockingQueue) Len() int {
+	return len(q.items)
+}
+
+// Cap returns the capacity of q.
+func (q *BlockingQueue) Cap() int {
+	return cap(q.items)
+}
+
+// Close closes q to producers: waiting and later calls of Put fail, and
+// once the values queued by then have been taken, so do calls of Take.
+// A Put that returns nil has added its value before Close returns.
+// Calling Close more than once is harmless.
+func (q *BlockingQueue) Close() {
+	q.closeOnce.Do(func() {
+		// Wake the waiting Puts first: they hold q.mu for reading.
+		close(q.closing)
+		q.mu.Lock()
+		q.closed = true
+		q.mu.Unlock()
+		close(q.sealed)
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	. "sync"
+	"testing"
+	"time"
+)
+
+func TestBlockingQueue(t *testing.T) {
+	q := NewBlockingQueue(2)
+	if !q.TryPut(1) || !q.TryPut(2) {
+		t.Fatal("TryPut failed with room in the queue")
+	}
+	if q.TryPut(3) {
+		t.Fatal("TryPut succeeded on a full queue")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Put(ctx, 3); err != context.DeadlineExceeded {
+		t.Fatalf("Put on a full queue = %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	done := make(chan error)
+	go func() { done <- q.Put(nil, 3) }()
+	if v, err := q.Take(nil); err != nil || v != 1 {
+		t.Fatalf("Take = %v, %v; want 1, nil", v, err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Put after Take = %v", err)
+	}
+	if n := q.Len(); n != 2 {
+		t.Fatalf("Len = %d; want 2", n)
+	}
+
+	// A closed queue refuses values but drains those it has.
+	go func() { done <- q.Put(nil, 4) }()
+	q.Close()
+	if err := <-done; err != ErrQueueClosed {
+		t.Fatalf("Put waiting across Close = %v; want %v", err, ErrQueueClosed)
+	}
+	q.Close()
+	for _, want := range []interface{}{2, 3} {
+		if v, err := q.Take(nil); err != nil || v != want {
+			t.Fatalf("Take after Close = %v, %v; want %v, nil", v, err, want)
+		}
+	}
+	if v, err := q.Take(nil); err != ErrQueueClosed {
+		t.Fatalf("Take of a closed, empty queue = %v, %v; want %v", v, err, ErrQueueClosed)
+	}
+	if _, ok := q.TryTake(); ok {
+		t.Fatal("TryTake succeeded on an empty queue")
+	}
+}
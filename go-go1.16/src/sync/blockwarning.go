@@ -0,0 +1,111 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A BlockWarning describes a goroutine that has been blocked acquiring a
+// lock for longer than the duration set with SetBlockWarning.
+type BlockWarning struct {
+	Goroutine int64     // ID of the blocked goroutine
+	Lock      uintptr   // address of the lock
+	Kind      LockKind  // kind of acquisition
+	Label     string    // label of the lock, see SetLockLabel
+	Waited    int64     // nanoseconds blocked so far
+	Stack     []uintptr // caller of the lock method and its callers, as from runtime.Callers
+
+	// In debug mode, the goroutine that holds the lock and the stack it
+	// locked it from, if known. See DumpWaiters.
+	Holder      int64
+	HolderStack []uintptr
+}
+
+// blockWarning is the state of the block warning watchdog.
+var blockWarning struct {
+	mu  Mutex  // serializes SetBlockWarning
+	gen uint32 // incremented by SetBlockWarning, which stops older watchdogs
+}
+
+// SetBlockWarning arranges for fn to be called whenever a goroutine has
+// been blocked locking a Mutex or RWMutex, or the lock of a Map, for d
+// nanoseconds, such as behind a holder that was preempted by a busier
+// goroutine or that is itself stuck. fn is called once per blocked
+// acquisition, while the goroutine is still blocked, from a watchdog
+// goroutine, so it may take its time to log or export the warning. It
+// must not acquire a lock that a blocked goroutine may hold.
+//
+// The watchdog checks the blocked goroutines every d/4 nanoseconds, so a
+// warning fires between d and 5d/4 nanoseconds into a wait. Only waits
+// that begin after SetBlockWarning have a Stack, and unless waiter
+// tracking is on, only those are watched; see SetWaiterTracking.
+//
+// A d of 0 or a nil fn turns the warning off. Each call replaces the
+// warning set by the previous one.
+func SetBlockWarning(d int64, fn func(BlockWarning)) {
+	blockWarning.mu.Lock()
+	defer blockWarning.mu.Unlock()
+	gen := atomic.AddUint32(&blockWarning.gen, 1)
+	on := d > 0 && fn != nil
+	setLockEvents(lockEventWarning, on)
+	if on {
+		go blockWatchdog(gen, d, fn)
+	}
+}
+
+// minWatchdogPeriod bounds how often the block warning watchdog runs.
+const minWatchdogPeriod = 1e5 // 100µs
+
+// blockWatchdog checks the blocked goroutines for waits that are longer
+// than d until SetBlockWarning is called again.
+func blockWatchdog(gen uint32, d int64, fn func(BlockWarning)) {
+	period := d / 4
+	if period < minWatchdogPeriod {
+		period = minWatchdogPeriod
+	}
+	var warnings []BlockWarning
+	var locks []unsafe.Pointer // the locks of warnings
+	for {
+		sleep(period)
+		if atomic.LoadUint32(&blockWarning.gen) != gen {
+			return
+		}
+		now := nanotime()
+		warnings = warnings[:0]
+		locks = locks[:0]
+		for i := range waiters {
+			s := &waiters[i]
+			s.acquire()
+			for goid, lw := range s.m {
+				if lw.warned || now-lw.start < d || lw.kind >= LockWaitGroup {
+					continue
+				}
+				lw.warned = true
+				s.m[goid] = lw
+				warnings = append(warnings, BlockWarning{
+					Goroutine: goid,
+					Lock:      uintptr(lw.lock),
+					Kind:      lw.kind,
+					Waited:    now - lw.start,
+					Stack:     lw.stack,
+				})
+				locks = append(locks, lw.lock)
+			}
+			s.release()
+		}
+		for i, bw := range warnings {
+			if atomic.LoadUint32(&blockWarning.gen) != gen {
+				return
+			}
+			bw.Label = lockLabel(locks[i])
+			if syncDebug {
+				bw.Holder, bw.HolderStack = lockHolder(locks[i])
+			}
+			fn(bw)
+		}
+	}
+}
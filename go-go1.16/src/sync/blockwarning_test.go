@@ -0,0 +1,77 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	"strings"
+	. "sync"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestSetBlockWarning(t *testing.T) {
+	// Other tests may leave goroutines blocked, so only the warnings
+	// for mu count.
+	var mu Mutex
+	warnings := make(chan BlockWarning, 10)
+	SetBlockWarning(int64(10*time.Millisecond), func(bw BlockWarning) {
+		if bw.Lock == uintptr(unsafe.Pointer(&mu)) {
+			warnings <- bw
+		}
+	})
+	defer SetBlockWarning(0, nil)
+
+	SetLockLabel(&mu, "slow")
+	defer SetLockLabel(&mu, "")
+	mu.Lock()
+	done := make(chan bool)
+	go func() {
+		mu.Lock()
+		mu.Unlock()
+		done <- true
+	}()
+
+	var bw BlockWarning
+	select {
+	case bw = <-warnings:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no BlockWarning for a goroutine blocked for 10s")
+	}
+	if bw.Kind != LockMutex || bw.Label != "slow" {
+		t.Errorf("BlockWarning = %+v, want one for the Mutex labeled slow", bw)
+	}
+	if bw.Waited < int64(10*time.Millisecond) {
+		t.Errorf("BlockWarning.Waited = %v, want at least 10ms", time.Duration(bw.Waited))
+	}
+	if len(bw.Stack) == 0 {
+		t.Errorf("BlockWarning has no stack")
+	} else if f, _ := runtime.CallersFrames(bw.Stack).Next(); !strings.HasSuffix(f.Function, "TestSetBlockWarning.func2") {
+		t.Errorf("BlockWarning stack starts in %s, want the goroutine that called Lock", f.Function)
+	}
+
+	// A wait warns only once.
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case bw := <-warnings:
+		t.Errorf("second BlockWarning for the same wait: %+v", bw)
+	default:
+	}
+	mu.Unlock()
+	<-done
+
+	// Turning the warning off stops it.
+	SetBlockWarning(0, nil)
+	blockOn(mu.Lock, func() {
+		time.Sleep(20 * time.Millisecond)
+		mu.Unlock()
+	}, mu.Lock, mu.Unlock)
+	select {
+	case bw := <-warnings:
+		t.Errorf("BlockWarning after SetBlockWarning(0, nil): %+v", bw)
+	default:
+	}
+}
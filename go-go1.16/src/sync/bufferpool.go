@@ -0,0 +1,97 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "unsafe"
+
+const (
+	minBufferShift = 6  // smallest size class is 64 bytes
+	maxBufferShift = 30 // largest size class is 1 GiB
+	bufferClasses  = maxBufferShift - minBufferShift + 1
+)
+
+// A BufferPool is a set of byte slices grouped into power-of-two size
+// classes, each kept in its own Pool. It saves callers that need
+// buffers of varying sizes from keeping a Pool per size themselves.
+//
+// Buffers larger than 1 GiB are neither pooled nor retained.
+//
+// The zero BufferPool is empty and ready for use. A BufferPool must not
+// be copied after first use.
+type BufferPool struct {
+	pools [bufferClasses]Pool
+}
+
+// sliceHeader is the runtime representation of a []byte.
+type sliceHeader struct {
+	data     unsafe.Pointer
+	len, cap int
+}
+
+// Get returns a buffer of length n from the pool, allocating one if the
+// pool has none that is big enough. Its capacity is n rounded up to a
+// power of two, and its contents are unspecified.
+func (bp *BufferPool) Get(n int) []byte {
+	if n < 0 {
+		panic("sync: negative BufferPool.Get size")
+	}
+	c := bufferClassGet(n)
+	if c >= bufferClasses {
+		return make([]byte, n)
+	}
+	size := 1 << (c + minBufferShift)
+	if p, ok := bp.pools[c].Get().(unsafe.Pointer); ok {
+		var b []byte
+		*(*sliceHeader)(unsafe.Pointer(&b)) = sliceHeader{p, n, size}
+		return b
+	}
+	return make([]byte, n, size)
+}
+
+// Put adds b to the pool. Its capacity need not be a power of two; the
+// pool uses its largest power-of-two prefix. Buffers with a capacity
+// below 64 bytes are dropped. The caller must not use b after Put.
+func (bp *BufferPool) Put(b []byte) {
+	c := bufferClassPut(cap(b))
+	if c < 0 {
+		return
+	}
+	// Store a pointer rather than the slice itself, which would have
+	// to be allocated to fit in an interface. Get recovers the
+	// capacity from the size class.
+	bp.pools[c].Put(unsafe.Pointer(&b[:1][0]))
+}
+
+// bufferClassGet returns the size class of the smallest buffers that
+// can hold n bytes.
+func bufferClassGet(n int) int {
+	if n <= 1<<minBufferShift {
+		return 0
+	}
+	return bitLen(uint(n-1)) - minBufferShift
+}
+
+// bufferClassPut returns the size class of the largest buffers that fit
+// in capacity n, or -1 if there is none.
+func bufferClassPut(n int) int {
+	c := bitLen(uint(n)) - 1 - minBufferShift
+	if c >= bufferClasses {
+		return -1
+	}
+	return c
+}
+
+// bitLen returns the minimum number of bits needed to represent x, as
+// bits.Len does. Package sync sits below math/bits in the dependency
+// order, so it cannot import it.
+func bitLen(x uint) (n int) {
+	for ; x >= 1<<8; x >>= 8 {
+		n += 8
+	}
+	for ; x != 0; x >>= 1 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Pool is no-op under race detector, so all these tests do not work.
+// +build !race
+
+package sync_test
+
+import (
+	"math/bits"
+	"runtime/debug"
+	. "sync"
+	"testing"
+)
+
+func TestBufferPool(t *testing.T) {
+	// disable GC so we can control when it happens.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	var p BufferPool
+	for _, tt := range []struct{ n, cap int }{
+		{0, 64},
+		{1, 64},
+		{64, 64},
+		{65, 128},
+		{1000, 1024},
+		{1 << 20, 1 << 20},
+	} {
+		b := p.Get(tt.n)
+		if len(b) != tt.n || cap(b) != tt.cap {
+			t.Errorf("Get(%d) returned len %d cap %d; want len %d cap %d", tt.n, len(b), cap(b), tt.n, tt.cap)
+		}
+	}
+
+	b := p.Get(100)
+	b[0] = 'x'
+	p.Put(b)
+	c := p.Get(70)
+	if len(c) != 70 || cap(c) != 128 || &c[0] != &b[0] {
+		t.Fatalf("Get after Put did not reuse the buffer")
+	}
+
+	// A buffer is filed under the largest size class it can serve.
+	p.Put(make([]byte, 10, 200))
+	if c := p.Get(100); cap(c) != 128 {
+		t.Fatalf("got cap %d for buffer of cap 200; want 128", cap(c))
+	}
+
+	// Buffers too small for any class are dropped.
+	p.Put(make([]byte, 10))
+	if c := p.Get(1); cap(c) != 64 {
+		t.Fatalf("got cap %d; want 64", cap(c))
+	}
+}
+
+func BenchmarkBufferPool(b *testing.B) {
+	var p BufferPool
+	b.RunParallel(func(pb *testing.PB) {
+		n := 1
+		for pb.Next() {
+			buf := p.Get(n)
+			p.Put(buf)
+			n = n*2 + 1
+			if n > 1<<16 {
+				n = 1
+			}
+		}
+	})
+}
+
+func TestBitLen(t *testing.T) {
+	for _, x := range []uint{0, 1, 2, 3, 255, 256, 257, 1<<20 - 1, 1 << 20, 1<<32 - 1, ^uint(0)} {
+		if got, want := BitLen(x), bits.Len(x); got != want {
+			t.Errorf("BitLen(%#x) = %d; want %d", x, got, want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// Chaos mode.
+//
+// Building with the syncchaos build tag makes Mutex, RWMutex and
+// WaitGroup pause at random before their compare-and-swaps and after
+// waking from a wait: sometimes they yield the processor, sometimes they
+// sleep for a short while. This shakes up the order in which goroutines
+// get through synchronization points, so that code relying on an order
+// it does not enforce fails in stress runs rather than in production.
+// Without the tag, syncChaos is false and the compiler removes the
+// pauses.
+
+const defaultChaosDelay = 20e3 // longest chaos sleep, in nanoseconds
+
+var chaos = struct {
+	seq      uint64 // position in the sequence of decisions
+	maxDelay int64  // longest sleep, in nanoseconds
+}{maxDelay: defaultChaosDelay}
+
+// SetChaos restarts the sequence of chaos mode decisions from seed and
+// sets the longest sleep to maxDelay nanoseconds. The decisions are
+// drawn in turn from a sequence determined by seed, so a run that
+// reaches the synchronization points in the same order, such as one
+// under sync/synctest, pauses in the same places. A maxDelay of 0 limits
+// the pauses to yields, and a negative one turns them off. Until
+// SetChaos is called, the seed is 0 and the longest sleep is 20µs.
+//
+// SetChaos has no effect unless the package is built with the
+// syncchaos build tag.
+func SetChaos(seed, maxDelay int64) {
+	atomic.StoreInt64(&chaos.maxDelay, maxDelay)
+	atomic.StoreUint64(&chaos.seq, uint64(seed))
+}
+
+// chaosPause pauses the calling goroutine as the next chaos decision
+// says. It sleeps in real time even under SetClockForTesting, since a
+// fake clock would not wake it.
+func chaosPause() {
+	delay, ok := chaosNext()
+	switch {
+	case !ok:
+	case delay == 0:
+		runtime.Gosched()
+	default:
+		runtime_sleep(delay)
+	}
+}
+
+// chaosNext draws the next chaos decision. If ok is false, there is no
+// pause; otherwise there is a sleep of delay nanoseconds, or a yield if
+// delay is 0.
+func chaosNext() (delay int64, ok bool) {
+	max := atomic.LoadInt64(&chaos.maxDelay)
+	if max < 0 {
+		return 0, false
+	}
+	// splitmix64
+	z := atomic.AddUint64(&chaos.seq, 0x9e3779b97f4a7c15)
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	z ^= z >> 31
+	switch {
+	case z%4 < 2:
+		return 0, false
+	case z%4 == 2 || max == 0:
+		return 0, true
+	}
+	return 1 + int64((z>>2)%uint64(max)), true
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"testing"
+	"time"
+)
+
+// chaosDecisions draws n chaos decisions, returning -1 for no pause.
+func chaosDecisions(n int) []int64 {
+	ds := make([]int64, n)
+	for i := range ds {
+		d, ok := ChaosNext()
+		if !ok {
+			d = -1
+		}
+		ds[i] = d
+	}
+	return ds
+}
+
+func TestChaosDecisions(t *testing.T) {
+	defer SetChaos(0, int64(20*time.Microsecond))
+
+	SetChaos(7, 1000)
+	a := chaosDecisions(1000)
+	SetChaos(7, 1000)
+	b := chaosDecisions(1000)
+	var none, yields, sleeps int
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("decision %d with the same seed: %d, then %d", i, a[i], b[i])
+		}
+		switch d := a[i]; {
+		case d < 0:
+			none++
+		case d == 0:
+			yields++
+		case d <= 1000:
+			sleeps++
+		default:
+			t.Fatalf("decision %d: sleep %d, longer than the maximum", i, d)
+		}
+	}
+	if none < 400 || yields < 150 || sleeps < 150 {
+		t.Errorf("1000 decisions: %d none, %d yields, %d sleeps", none, yields, sleeps)
+	}
+
+	SetChaos(8, 1000)
+	c := chaosDecisions(1000)
+	same := 0
+	for i := range a {
+		if a[i] == c[i] {
+			same++
+		}
+	}
+	if same > 600 {
+		t.Errorf("seeds 7 and 8 made %d of 1000 decisions the same", same)
+	}
+
+	SetChaos(7, 0)
+	for i, d := range chaosDecisions(100) {
+		if d > 0 {
+			t.Fatalf("decision %d with no delay: sleep %d", i, d)
+		}
+	}
+	SetChaos(7, -1)
+	for i, d := range chaosDecisions(100) {
+		if d >= 0 {
+			t.Fatalf("decision %d with chaos off: %d", i, d)
+		}
+	}
+}
+
+func TestChaosPrimitives(t *testing.T) {
+	SetChaos(1, int64(10*time.Microsecond))
+	defer SetChaos(0, int64(20*time.Microsecond))
+
+	var mu Mutex
+	var rw RWMutex
+	var wg WaitGroup
+	n, m := 0, 0
+	const goroutines, iters = 4, 200
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iters; i++ {
+				mu.Lock()
+				n++
+				mu.Unlock()
+				if i%4 == 0 {
+					rw.Lock()
+					m++
+					rw.Unlock()
+				} else {
+					rw.RLock()
+					_ = m
+					rw.RUnlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n != goroutines*iters || m != goroutines*iters/4 {
+		t.Fatalf("counts %d and %d; want %d and %d", n, m, goroutines*iters, goroutines*iters/4)
+	}
+}
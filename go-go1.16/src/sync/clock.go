@@ -0,0 +1,81 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Clock is a source of time for the time-dependent behavior of this
+// package: Mutex starvation, lock wait times, block warnings, Pool idle
+// timeouts, rate limits and timed waits. See SetClockForTesting.
+//
+// Times are in nanoseconds, and only differences between them are
+// meaningful, but they must be positive, as a zero time marks a wait that
+// has not started. Now is called on the slow paths of Mutex and RWMutex, so it
+// must not block or use the locks of this package.
+type Clock interface {
+	// Now returns the current time.
+	Now() int64
+
+	// Sleep blocks the calling goroutine until d nanoseconds have passed.
+	Sleep(d int64)
+
+	// AfterFunc arranges for f to be called in its own goroutine once d
+	// nanoseconds have passed. Calling stop before then cancels the call
+	// and reports true; after that, stop reports false.
+	AfterFunc(d int64, f func()) (stop func() bool)
+}
+
+var clock unsafe.Pointer // *Clock; nil for the real clock
+
+// SetClockForTesting makes the package read time from c instead of the
+// real clock, and returns the clock it used before, or nil for the real
+// one. A nil c restores the real clock. It lets tests of starvation,
+// timeouts and expiry advance time by hand instead of sleeping:
+//
+//    defer sync.SetClockForTesting(sync.SetClockForTesting(fake))
+//
+// Timers that are running and goroutines that are sleeping keep using the
+// clock they started with, and a wait that spans the change is measured
+// across two clocks, so set the clock before using the package.
+func SetClockForTesting(c Clock) (old Clock) {
+	var p unsafe.Pointer
+	if c != nil {
+		p = unsafe.Pointer(&c)
+	}
+	if p = atomic.SwapPointer(&clock, p); p != nil {
+		old = *(*Clock)(p)
+	}
+	return old
+}
+
+// loadClock returns the clock set by SetClockForTesting, or nil for the
+// real clock.
+func loadClock() Clock {
+	if p := atomic.LoadPointer(&clock); p != nil {
+		return *(*Clock)(p)
+	}
+	return nil
+}
+
+// nanotime returns the current time of the package's clock.
+func nanotime() int64 {
+	if c := loadClock(); c != nil {
+		return c.Now()
+	}
+	return runtime_nanotime()
+}
+
+// sleep blocks the calling goroutine for ns nanoseconds of the package's
+// clock.
+func sleep(ns int64) {
+	if c := loadClock(); c != nil {
+		c.Sleep(ns)
+		return
+	}
+	runtime_sleep(ns)
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	. "sync"
+	"sync/atomic"
+	"sync/synctest"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when told to. Use newFakeClock.
+type fakeClock struct {
+	now    int64 // read atomically, as Now must not lock
+	mu     Mutex
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	when int64
+	f    func()
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: int64(time.Second)}
+}
+
+func (c *fakeClock) Now() int64 { return atomic.LoadInt64(&c.now) }
+
+func (c *fakeClock) Sleep(d int64) {
+	done := make(chan struct{})
+	c.AfterFunc(d, func() { close(done) })
+	<-done
+}
+
+func (c *fakeClock) AfterFunc(d int64, f func()) (stop func() bool) {
+	t := &fakeTimer{when: c.Now() + d, f: f}
+	c.mu.Lock()
+	c.timers = append(c.timers, t)
+	c.mu.Unlock()
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, t1 := range c.timers {
+			if t1 == t {
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Advance moves the clock forward by d and fires the timers that are due.
+func (c *fakeClock) Advance(d int64) {
+	now := atomic.AddInt64(&c.now, d)
+	c.mu.Lock()
+	var due []*fakeTimer
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.when <= now {
+			due = append(due, t)
+		} else {
+			timers = append(timers, t)
+		}
+	}
+	c.timers = timers
+	c.mu.Unlock()
+	for _, t := range due {
+		go t.f()
+	}
+}
+
+func (c *fakeClock) numTimers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func TestClockWaitTime(t *testing.T) {
+	c := newFakeClock()
+	defer SetClockForTesting(SetClockForTesting(c))
+	var mu Mutex
+	RegisterMetrics("test.clock", &mu)
+	defer UnregisterMetrics("test.clock")
+
+	// Under the scheduler, the waiter has read the clock by the time
+	// it is seen waiting.
+	err := synctest.Run(0, func() {
+		mu.Lock()
+		synctest.Go(func() {
+			mu.Lock()
+			mu.Unlock()
+		})
+		for MutexWaiters(&mu) == 0 {
+			synctest.Yield()
+		}
+		c.Advance(int64(5 * time.Millisecond))
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := metricValues("test.clock")["wait_ns"]; got != int64(5*time.Millisecond) {
+		t.Errorf("wait_ns = %d; want %d", got, int64(5*time.Millisecond))
+	}
+}
+
+func TestClockWaitTimeout(t *testing.T) {
+	c := newFakeClock()
+	defer SetClockForTesting(SetClockForTesting(c))
+	var mu Mutex
+	cond := NewCond(&mu)
+	woken := make(chan bool)
+	go func() {
+		mu.Lock()
+		woken <- cond.WaitTimeout(int64(time.Hour))
+		mu.Unlock()
+	}()
+	for c.numTimers() == 0 {
+		runtime.Gosched()
+	}
+	c.Advance(int64(time.Hour - 1))
+	select {
+	case <-woken:
+		t.Fatal("WaitTimeout returned before its timeout")
+	case <-time.After(10 * time.Millisecond):
+	}
+	c.Advance(1)
+	if <-woken {
+		t.Error("WaitTimeout reported a wakeup without Signal")
+	}
+}
+
+// TestClockStarvation checks that a Mutex switches to starvation mode
+// when, and only when, the clock says a waiter has waited too long.
+func TestClockStarvation(t *testing.T) {
+	for _, wait := range []time.Duration{0, 2 * time.Millisecond} {
+		c := newFakeClock()
+		old := SetClockForTesting(c)
+		starved := false
+		_, err := synctest.Explore(0, func() {
+			var mu Mutex
+			mu.Lock()
+			synctest.Go(func() {
+				mu.Lock()
+				mu.Unlock()
+			})
+			synctest.Yield()
+			c.Advance(int64(wait))
+			mu.Unlock()
+			mu.Lock()
+			synctest.Yield()
+			starved = starved || MutexStarving(&mu)
+			mu.Unlock()
+		})
+		SetClockForTesting(old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := wait > 1e6; starved != want {
+			t.Errorf("waiting %v: starvation mode seen = %v; want %v", wait, starved, want)
+		}
+	}
+}
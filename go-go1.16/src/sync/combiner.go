@@ -0,0 +1,122 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Combiner serializes operations on a shared structure using flat
+// combining. Instead of each goroutine taking a lock in turn, goroutines
+// publish their operations to the Combiner, and whichever one finds no
+// combiner active becomes the combiner and runs every published operation
+// in a batch before returning. The others sleep until their operation has
+// run.
+//
+// For hot, short critical sections, such as pushing to a shared heap or
+// updating a stats registry, this replaces a lock handoff per operation
+// with one per batch, and keeps the shared structure in one processor's
+// cache while the batch runs.
+//
+// Operations passed to the same Combiner never run concurrently, and each
+// runs after every operation whose Do returned before its own Do started.
+// Operations run on whichever goroutine is combining, so they must not
+// depend on goroutine identity, block for long, call Do on the same
+// Combiner, or call runtime.Goexit.
+//
+// The zero Combiner is ready for use. A Combiner must not be copied after
+// first use.
+type Combiner struct {
+	noCopy noCopy
+
+	pending   unsafe.Pointer // *combinerOp; published operations, newest first
+	combining uint32         // 1 while a goroutine is combining
+}
+
+type combinerOp struct {
+	fn    func()
+	next  *combinerOp
+	state uint32 // combinerWaiting or combinerDone
+	sema  uint32
+
+	panicked bool
+	p        interface{} // recovered value if fn panicked
+}
+
+const (
+	combinerWaiting = iota
+	combinerDone
+)
+
+// Do runs op with exclusive access to the structure c guards and returns
+// when op has returned. If op panics, Do panics with the same value on the
+// calling goroutine.
+func (c *Combiner) Do(op func()) {
+	o := &combinerOp{fn: op}
+	for {
+		head := atomic.LoadPointer(&c.pending)
+		o.next = (*combinerOp)(head)
+		if atomic.CompareAndSwapPointer(&c.pending, head, unsafe.Pointer(o)) {
+			break
+		}
+	}
+	for atomic.LoadUint32(&o.state) != combinerDone {
+		if atomic.CompareAndSwapUint32(&c.combining, 0, 1) {
+			// Our operation was published before we started
+			// combining and every earlier combiner finished its
+			// batch, so this batch contains it if it has not run.
+			c.combine()
+			break
+		}
+		// The active combiner either runs o or, finding more work
+		// when it finishes, wakes o's owner to take over.
+		runtime_Semacquire(&o.sema)
+	}
+	if o.panicked {
+		panic(o.p)
+	}
+}
+
+// combine runs one batch of pending operations and hands off to a waiting
+// goroutine if more have been published meanwhile. c.combining must be 1.
+func (c *Combiner) combine() {
+	// Take the whole list and reverse it, so that operations run in the
+	// order they were published.
+	var batch *combinerOp
+	for o := (*combinerOp)(atomic.SwapPointer(&c.pending, nil)); o != nil; {
+		next := o.next
+		o.next = batch
+		batch = o
+		o = next
+	}
+	for o := batch; o != nil; {
+		next := o.next
+		o.run()
+		atomic.StoreUint32(&o.state, combinerDone)
+		runtime_Semrelease(&o.sema, false, 0)
+		o = next
+	}
+	atomic.StoreUint32(&c.combining, 0)
+
+	// Goroutines that published while we ran found us combining and went
+	// to sleep. Wake the newest of them to combine the rest. Anything
+	// published after this load sees combining clear, or another
+	// combiner active that will do the same.
+	if o := (*combinerOp)(atomic.LoadPointer(&c.pending)); o != nil {
+		runtime_Semrelease(&o.sema, false, 0)
+	}
+}
+
+func (o *combinerOp) run() {
+	defer func() {
+		if o.panicked {
+			o.p = recover()
+		}
+	}()
+	o.panicked = true
+	o.fn()
+	o.panicked = false
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	. "sync"
+	"testing"
+)
+
+func TestCombiner(t *testing.T) {
+	var c Combiner
+	var n, active int
+	P := runtime.GOMAXPROCS(0) * 4
+	N := 10000
+	if testing.Short() {
+		N = 1000
+	}
+	var wg WaitGroup
+	for p := 0; p < P; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < N; i++ {
+				c.Do(func() {
+					active++
+					if active != 1 {
+						panic("operations ran concurrently")
+					}
+					n++
+					active--
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if n != P*N {
+		t.Fatalf("n = %d; want %d", n, P*N)
+	}
+}
+
+func TestCombinerOrder(t *testing.T) {
+	var c Combiner
+	var log []int
+	for i := 0; i < 10; i++ {
+		i := i
+		c.Do(func() { log = append(log, i) })
+	}
+	for i, v := range log {
+		if v != i {
+			t.Fatalf("operations ran in order %v", log)
+		}
+	}
+}
+
+func TestCombinerPanic(t *testing.T) {
+	var c Combiner
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatalf("recovered %v; want boom", r)
+			}
+		}()
+		c.Do(func() { panic("boom") })
+	}()
+	// The Combiner must still work after an operation panics.
+	ran := false
+	c.Do(func() { ran = true })
+	if !ran {
+		t.Fatal("operation after panic did not run")
+	}
+}
+
+func BenchmarkCombiner(b *testing.B) {
+	var c Combiner
+	var n int
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Do(func() { n++ })
+		}
+	})
+}
+
+func BenchmarkCombinerMutex(b *testing.B) {
+	var mu Mutex
+	var n int
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mu.Lock()
+			n++
+			mu.Unlock()
+		}
+	})
+}
@@ -26,6 +26,20 @@ type Cond struct {
 
 	notify  notifyList
 	checker copyChecker
+
+	// Goroutines in WaitContext or WaitTimeout, which the runtime's
+	// notifyList cannot handle since they may stop waiting, in order
+	// of arrival. nwait is len(waiters), read atomically so that
+	// Signal and Broadcast can skip mu when there are none.
+	mu      Mutex
+	waiters []*condWaiter
+	nwait   int32
+}
+
+// A condWaiter is a goroutine waiting in WaitContext or WaitTimeout.
+type condWaiter struct {
+	ch     chan struct{} // closed to wake the waiter
+	ticket uint32        // the notifyList ticket the next Wait would get
 }
 
 // NewCond returns a new Cond with Locker l.
@@ -51,19 +65,180 @@ func NewCond(l Locker) *Cond {
 //
 func (c *Cond) Wait() {
 	c.checker.check()
+	if syncDebug {
+		c.checkLocked()
+	}
 	t := runtime_notifyListAdd(&c.notify)
 	c.L.Unlock()
 	runtime_notifyListWait(&c.notify, t)
 	c.L.Lock()
 }
 
+// WaitUntil waits on c until pred returns true. It calls pred with c.L
+// held, first before waiting at all and then each time it is woken, so
+// it replaces the loop around Wait shown above:
+//
+//    c.L.Lock()
+//    c.WaitUntil(condition)
+//    ... make use of condition ...
+//    c.L.Unlock()
+//
+func (c *Cond) WaitUntil(pred func() bool) {
+	for !pred() {
+		c.Wait()
+	}
+}
+
+// WaitUntilContext is like WaitUntil, but gives up waiting if ctx is
+// done before pred returns true, in which case it returns ctx.Err().
+// Either way, c.L is locked when it returns. A nil ctx never gives up.
+func (c *Cond) WaitUntilContext(ctx Context, pred func() bool) error {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	for !pred() {
+		if !c.waitOrCancel(cancel) {
+			// The condition may have become true just as ctx
+			// was done; prefer reporting success.
+			if pred() {
+				return nil
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// WaitContext is like Wait, but gives up waiting if ctx is done first,
+// in which case it returns ctx.Err(). Either way, it locks c.L before
+// returning. A Signal is never lost to a waiter that gives up: if one
+// arrives as ctx is done, WaitContext returns nil. A nil ctx never
+// gives up.
+func (c *Cond) WaitContext(ctx Context) error {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	if c.waitOrCancel(cancel) {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// WaitTimeout is like Wait, but gives up waiting after d nanoseconds.
+// It reports whether it was woken by Signal or Broadcast rather than
+// timing out. Either way, it locks c.L before returning.
+func (c *Cond) WaitTimeout(d int64) bool {
+	done := make(chan struct{})
+	stop := startCloseTimer(d, done)
+	woken := c.waitOrCancel(done)
+	stop()
+	return woken
+}
+
+// waitOrCancel waits like Wait until woken or until cancel is closed.
+// It reports whether it was woken.
+func (c *Cond) waitOrCancel(cancel <-chan struct{}) bool {
+	c.checker.check()
+	if syncDebug {
+		c.checkLocked()
+	}
+	w := &condWaiter{
+		ch:     make(chan struct{}),
+		ticket: atomic.LoadUint32(&c.notify.wait),
+	}
+	c.mu.Lock()
+	c.waiters = append(c.waiters, w)
+	atomic.StoreInt32(&c.nwait, int32(len(c.waiters)))
+	c.mu.Unlock()
+	c.L.Unlock()
+
+	woken := true
+	select {
+	case <-w.ch:
+	case <-cancel:
+		c.mu.Lock()
+		for i, w2 := range c.waiters {
+			if w2 == w {
+				// Still waiting, so nobody woke us.
+				copy(c.waiters[i:], c.waiters[i+1:])
+				c.waiters[len(c.waiters)-1] = nil
+				c.waiters = c.waiters[:len(c.waiters)-1]
+				atomic.StoreInt32(&c.nwait, int32(len(c.waiters)))
+				woken = false
+				break
+			}
+		}
+		c.mu.Unlock()
+	}
+	c.L.Lock()
+	return woken
+}
+
 // Signal wakes one goroutine waiting on c, if there is any.
 //
 // It is allowed but not required for the caller to hold c.L
 // during the call.
 func (c *Cond) Signal() {
 	c.checker.check()
-	runtime_notifyListNotifyOne(&c.notify)
+	if atomic.LoadInt32(&c.nwait) == 0 || !c.signalWaiter() {
+		runtime_notifyListNotifyOne(&c.notify)
+	}
+}
+
+// SignalN wakes up to n goroutines waiting on c, as n calls to Signal
+// would, but stops as soon as there are no waiters left. It lets a
+// producer that has made n units of work available wake just enough
+// consumers, where Broadcast would wake them all.
+//
+// It is allowed but not required for the caller to hold c.L
+// during the call.
+func (c *Cond) SignalN(n int) {
+	c.checker.check()
+	for ; n > 0; n-- {
+		if atomic.LoadInt32(&c.nwait) != 0 && c.signalWaiter() {
+			continue
+		}
+		if atomic.LoadUint32(&c.notify.wait) == atomic.LoadUint32(&c.notify.notify) {
+			// Every Wait has been woken already.
+			return
+		}
+		runtime_notifyListNotifyOne(&c.notify)
+	}
+}
+
+// Waiters returns the number of goroutines waiting on c that have yet
+// to be woken. Unless the caller holds c.L, goroutines may start or
+// stop waiting at any moment, so the result is only a hint.
+func (c *Cond) Waiters() int {
+	n := atomic.LoadInt32(&c.nwait)
+	// Waits take tickets in order and are woken in ticket order.
+	n += int32(atomic.LoadUint32(&c.notify.wait) - atomic.LoadUint32(&c.notify.notify))
+	return int(n)
+}
+
+// signalWaiter wakes the longest-waiting goroutine in WaitContext or
+// WaitTimeout and reports true, unless a goroutine that is still
+// blocked in Wait has been waiting longer.
+func (c *Cond) signalWaiter() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.waiters) == 0 {
+		return false
+	}
+	w := c.waiters[0]
+	// The notifyList wakes Waits in ticket order. If it has yet to
+	// wake one with a ticket below w's, that Wait came first.
+	if int32(atomic.LoadUint32(&c.notify.notify)-w.ticket) < 0 {
+		return false
+	}
+	copy(c.waiters, c.waiters[1:])
+	c.waiters[len(c.waiters)-1] = nil
+	c.waiters = c.waiters[:len(c.waiters)-1]
+	atomic.StoreInt32(&c.nwait, int32(len(c.waiters)))
+	close(w.ch)
+	return true
 }
 
 // Broadcast wakes all goroutines waiting on c.
@@ -72,9 +247,44 @@ func (c *Cond) Signal() {
 // during the call.
 func (c *Cond) Broadcast() {
 	c.checker.check()
+	if atomic.LoadInt32(&c.nwait) != 0 {
+		c.mu.Lock()
+		for i, w := range c.waiters {
+			close(w.ch)
+			c.waiters[i] = nil
+		}
+		c.waiters = c.waiters[:0]
+		atomic.StoreInt32(&c.nwait, 0)
+		c.mu.Unlock()
+	}
 	runtime_notifyListNotifyAll(&c.notify)
 }
 
+// checkLocked panics if c.L is known not to be locked. Waiting without
+// holding c.L would otherwise corrupt c.L or hang, far from the bug.
+// It recognizes only the lockers in this package, and it cannot tell
+// whether it is the caller that holds the lock. It is only called in
+// debug mode.
+func (c *Cond) checkLocked() {
+	locked := true
+	switch l := c.L.(type) {
+	case *Mutex:
+		locked = atomic.LoadInt32(&l.state)&mutexLocked != 0
+	case *RWMutex:
+		// A writer holds l.w for as long as it holds l.
+		locked = atomic.LoadInt32(&l.w.state)&mutexLocked != 0
+	case *rlocker:
+		r := atomic.LoadInt32(&l.readerCount)
+		if r < 0 {
+			r += rwmutexMaxReaders
+		}
+		locked = r > 0
+	}
+	if !locked {
+		panic("sync: Cond.Wait called without holding c.L")
+	}
+}
+
 // copyChecker holds back pointer to itself to detect object copying.
 type copyChecker uintptr
 
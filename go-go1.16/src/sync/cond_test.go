@@ -5,6 +5,7 @@
 package sync_test
 
 import (
+	"context"
 	"reflect"
 	"runtime"
 	. "sync"
@@ -243,6 +244,264 @@ func TestCondSignalStealing(t *testing.T) {
 	}
 }
 
+func TestCondWaitUntil(t *testing.T) {
+	var m Mutex
+	c := NewCond(&m)
+	n := 0
+	done := make(chan bool)
+	go func() {
+		m.Lock()
+		c.WaitUntil(func() bool { return n == 3 })
+		if n != 3 {
+			t.Errorf("WaitUntil returned with n = %d", n)
+		}
+		m.Unlock()
+		done <- true
+	}()
+	for i := 0; i < 3; i++ {
+		m.Lock()
+		n++
+		m.Unlock()
+		c.Broadcast()
+	}
+	<-done
+
+	// A nil ctx waits until the condition holds.
+	go func() {
+		m.Lock()
+		if err := c.WaitUntilContext(nil, func() bool { return n == 4 }); err != nil {
+			t.Errorf("WaitUntilContext returned %v for a nil ctx", err)
+		}
+		m.Unlock()
+		done <- true
+	}()
+	m.Lock()
+	n++
+	m.Unlock()
+	c.Broadcast()
+	<-done
+
+	// WaitUntilContext does not wait if the condition holds.
+	m.Lock()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.WaitUntilContext(ctx, func() bool { return n == 4 }); err != nil {
+		t.Fatalf("WaitUntilContext returned %v for a true condition", err)
+	}
+	if err := c.WaitUntilContext(ctx, func() bool { return n == 5 }); err != context.Canceled {
+		t.Fatalf("WaitUntilContext returned %v; want %v", err, context.Canceled)
+	}
+	m.Unlock()
+}
+
+func TestCondSignalN(t *testing.T) {
+	var m Mutex
+	c := NewCond(&m)
+	const n = 6
+	running := make(chan bool)
+	woken := make(chan bool, n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			m.Lock()
+			running <- true
+			if i%2 == 0 {
+				c.Wait()
+			} else {
+				c.WaitContext(context.Background())
+			}
+			m.Unlock()
+			woken <- true
+		}(i)
+		<-running
+	}
+	m.Lock()
+	if w := c.Waiters(); w != n {
+		t.Fatalf("Waiters() = %d; want %d", w, n)
+	}
+	m.Unlock()
+
+	c.SignalN(4)
+	for i := 0; i < 4; i++ {
+		<-woken
+	}
+	select {
+	case <-woken:
+		t.Fatal("SignalN(4) woke more than 4 goroutines")
+	case <-time.After(10 * time.Millisecond):
+	}
+	m.Lock()
+	if w := c.Waiters(); w != n-4 {
+		t.Fatalf("Waiters() = %d after SignalN(4); want %d", w, n-4)
+	}
+	m.Unlock()
+
+	// Signals beyond the number of waiters are not saved for later.
+	c.SignalN(10)
+	<-woken
+	<-woken
+	if w := c.Waiters(); w != 0 {
+		t.Fatalf("Waiters() = %d; want 0", w)
+	}
+	go func() {
+		m.Lock()
+		running <- true
+		c.Wait()
+		m.Unlock()
+		woken <- true
+	}()
+	<-running
+	select {
+	case <-woken:
+		t.Fatal("Wait was woken by an earlier SignalN")
+	case <-time.After(10 * time.Millisecond):
+	}
+	m.Lock()
+	m.Unlock()
+	c.Signal()
+	<-woken
+}
+
+func TestCondWaitTimeout(t *testing.T) {
+	var m Mutex
+	c := NewCond(&m)
+	m.Lock()
+	if c.WaitTimeout(int64(10 * time.Millisecond)) {
+		t.Fatal("WaitTimeout reported a wakeup without Signal")
+	}
+	m.Unlock()
+
+	running := make(chan bool)
+	woken := make(chan bool)
+	go func() {
+		m.Lock()
+		running <- true
+		woken <- c.WaitTimeout(int64(time.Hour))
+		m.Unlock()
+	}()
+	<-running
+	m.Lock() // the waiter has released m, so it is waiting
+	m.Unlock()
+	c.Signal()
+	if !<-woken {
+		t.Fatal("WaitTimeout timed out despite Signal")
+	}
+}
+
+func TestCondWaitContext(t *testing.T) {
+	var m Mutex
+	c := NewCond(&m)
+	ctx, cancel := context.WithCancel(context.Background())
+	running := make(chan bool)
+	errc := make(chan error)
+	go func() {
+		m.Lock()
+		running <- true
+		errc <- c.WaitContext(ctx)
+		m.Unlock()
+	}()
+	<-running
+	m.Lock()
+	m.Unlock()
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("WaitContext returned %v; want %v", err, context.Canceled)
+	}
+
+	// Broadcast wakes waiters of both kinds.
+	const n = 3
+	woken := make(chan bool)
+	for i := 0; i < 2*n; i++ {
+		go func(i int) {
+			m.Lock()
+			running <- true
+			if i%2 == 0 {
+				c.Wait()
+			} else if err := c.WaitContext(nil); err != nil {
+				t.Error(err)
+			}
+			m.Unlock()
+			woken <- true
+		}(i)
+	}
+	for i := 0; i < 2*n; i++ {
+		<-running
+	}
+	m.Lock()
+	m.Unlock()
+	c.Broadcast()
+	for i := 0; i < 2*n; i++ {
+		<-woken
+	}
+}
+
+// Test that Signal wakes Wait and WaitContext in order of arrival, and
+// that a waiter that gives up does not absorb a Signal.
+func TestCondWaitContextOrder(t *testing.T) {
+	var m Mutex
+	c := NewCond(&m)
+	m.Lock()
+	if c.WaitTimeout(1) {
+		t.Fatal("WaitTimeout reported a wakeup without Signal")
+	}
+	m.Unlock()
+
+	running := make(chan bool)
+	woken := make(chan int, 4)
+	for i := 0; i < 4; i++ {
+		go func(i int) {
+			m.Lock()
+			running <- true
+			if i%2 == 0 {
+				c.Wait()
+			} else {
+				c.WaitContext(context.Background())
+			}
+			woken <- i
+			m.Unlock()
+		}(i)
+		<-running
+	}
+	for i := 0; i < 4; i++ {
+		m.Lock()
+		m.Unlock()
+		c.Signal()
+		if w := <-woken; w != i {
+			t.Fatalf("Signal #%d woke waiter %d", i, w)
+		}
+	}
+}
+
+func TestCondWaitUnlocked(t *testing.T) {
+	if !SyncDebug {
+		t.Skip("Cond.Wait checks c.L only in debug mode")
+	}
+	var rw RWMutex
+	for _, l := range []Locker{&Mutex{}, &rw, rw.RLocker()} {
+		c := NewCond(l)
+		for _, wait := range []func(){
+			c.Wait,
+			func() { c.WaitTimeout(1) },
+			func() { c.WaitContext(context.Background()) },
+		} {
+			func() {
+				defer func() {
+					const want = "sync: Cond.Wait called without holding c.L"
+					if err := recover(); err != want {
+						t.Errorf("%T: got panic %v; want %q", l, err, want)
+					}
+				}()
+				wait()
+			}()
+		}
+		// The Cond still works after the failed Waits.
+		l.Lock()
+		if c.WaitTimeout(1) {
+			t.Errorf("%T: WaitTimeout reported a wakeup without Signal", l)
+		}
+		l.Unlock()
+	}
+}
+
 func TestCondCopy(t *testing.T) {
 	defer func() {
 		err := recover()
@@ -0,0 +1,137 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Config holds a read-mostly value, such as a service's hot-reloaded
+// configuration, together with a version that counts its updates.
+// Reading it is a single atomic load. Each update runs a chain of hooks
+// in order: the validators added by Validate, which may reject the new
+// value, then the publication of the value under the next version, then
+// the subscribers added by Subscribe.
+//
+// Updates are serialized, so subscribers see the versions in order, and
+// a rejected update changes nothing. Values must be treated as
+// immutable once stored: to change a map or struct pointer, Update must
+// copy it, change the copy and return that.
+//
+// The zero Config holds nil at version 0 and is ready for use. A Config
+// must not be copied after first use.
+type Config struct {
+	cur unsafe.Pointer // *configValue; nil means nil at version 0
+
+	update Mutex // serializes updates
+
+	mu         Mutex // guards the hooks
+	validators []func(old, new interface{}) error
+	subs       []*configSub // copied on removal
+}
+
+type configValue struct {
+	v       interface{}
+	version uint64
+}
+
+type configSub struct {
+	f func(v interface{}, version uint64)
+}
+
+// Load returns the current value of c.
+func (c *Config) Load() interface{} {
+	v, _ := c.LoadVersion()
+	return v
+}
+
+// LoadVersion returns the current value of c and its version.
+func (c *Config) LoadVersion() (v interface{}, version uint64) {
+	if cv := (*configValue)(atomic.LoadPointer(&c.cur)); cv != nil {
+		return cv.v, cv.version
+	}
+	return nil, 0
+}
+
+// Store validates v and, if every validator accepts it, publishes it
+// and notifies the subscribers. It returns the version of v, or the
+// error of the first validator that rejected it.
+func (c *Config) Store(v interface{}) (version uint64, err error) {
+	return c.Update(func(interface{}) (interface{}, error) { return v, nil })
+}
+
+// Update calls f with the current value of c and stores the value f
+// returns, as Store does. If f returns an error, Update returns it and
+// leaves c unchanged. Calls to Update and Store are serialized, so no
+// update is lost to a concurrent one. f must not call Update or Store
+// on c.
+func (c *Config) Update(f func(old interface{}) (new interface{}, err error)) (version uint64, err error) {
+	c.update.Lock()
+	defer c.update.Unlock()
+	// Run the hooks without mu, so that they may add hooks or cancel
+	// their subscriptions.
+	c.mu.Lock()
+	validators, subs := c.validators, c.subs
+	c.mu.Unlock()
+
+	old, version := c.LoadVersion()
+	new, err := f(old)
+	if err != nil {
+		return version, err
+	}
+	for _, validate := range validators {
+		if err := validate(old, new); err != nil {
+			return version, err
+		}
+	}
+	version++
+	atomic.StorePointer(&c.cur, unsafe.Pointer(&configValue{new, version}))
+	for _, s := range subs {
+		s.f(new, version)
+	}
+	return version, nil
+}
+
+// Validate adds f to the validators of c. Each update calls the
+// validators in the order they were added, with the current value and
+// the proposed one, and stops at the first that returns an error. The
+// current value is not validated. A validator must not call Update or
+// Store on c.
+func (c *Config) Validate(f func(old, new interface{}) error) {
+	c.mu.Lock()
+	c.validators = append(c.validators, f)
+	c.mu.Unlock()
+}
+
+// Subscribe adds f to the subscribers of c and returns a function that
+// removes it. After each update, the caller of Update or Store calls
+// the subscribers in the order they subscribed, with the new value and
+// its version, before the next update is published. So subscribers see
+// every version in order, but they delay updates and must not call
+// Update or Store on c themselves; a subscriber with slow work to do
+// should hand it off to another goroutine, or use a Watched. A
+// subscriber may call cancel, which takes effect from the next update.
+// Calling cancel more than once is harmless.
+func (c *Config) Subscribe(f func(v interface{}, version uint64)) (cancel func()) {
+	s := &configSub{f}
+	c.mu.Lock()
+	c.subs = append(c.subs, s)
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		for i, t := range c.subs {
+			if t == s {
+				// Copy, as an update may be notifying the
+				// subscribers in the old slice.
+				subs := make([]*configSub, 0, len(c.subs)-1)
+				subs = append(subs, c.subs[:i]...)
+				c.subs = append(subs, c.subs[i+1:]...)
+				break
+			}
+		}
+		c.mu.Unlock()
+	}
+}
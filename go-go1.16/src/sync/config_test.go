@@ -0,0 +1,115 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"errors"
+	"fmt"
+	. "sync"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	var c Config
+	if v, version := c.LoadVersion(); v != nil || version != 0 {
+		t.Fatalf("zero Config holds %v at version %d", v, version)
+	}
+
+	var trace []string
+	c.Validate(func(old, new interface{}) error {
+		trace = append(trace, fmt.Sprintf("validate %v->%v", old, new))
+		if new.(int) < 0 {
+			return errors.New("negative")
+		}
+		return nil
+	})
+	c.Subscribe(func(v interface{}, version uint64) {
+		trace = append(trace, fmt.Sprintf("notify %v@%d", v, version))
+	})
+	if version, err := c.Store(1); version != 1 || err != nil {
+		t.Fatalf("Store(1) = %d, %v; want 1, nil", version, err)
+	}
+	if version, err := c.Store(-1); version != 1 || err == nil {
+		t.Fatalf("Store(-1) = %d, %v; want 1 and an error", version, err)
+	}
+	version, err := c.Update(func(old interface{}) (interface{}, error) {
+		return old.(int) + 1, nil
+	})
+	if version != 2 || err != nil {
+		t.Fatalf("Update = %d, %v; want 2, nil", version, err)
+	}
+	if v, version := c.LoadVersion(); v != 2 || version != 2 {
+		t.Fatalf("LoadVersion() = %v, %d; want 2, 2", v, version)
+	}
+	want := []string{
+		"validate <nil>->1", "notify 1@1",
+		"validate 1->-1",
+		"validate 1->2", "notify 2@2",
+	}
+	if fmt.Sprint(trace) != fmt.Sprint(want) {
+		t.Fatalf("hooks ran as %q; want %q", trace, want)
+	}
+}
+
+func TestConfigUpdateError(t *testing.T) {
+	var c Config
+	c.Store("a")
+	errBad := errors.New("bad")
+	if _, err := c.Update(func(interface{}) (interface{}, error) { return "b", errBad }); err != errBad {
+		t.Fatalf("Update returned %v; want %v", err, errBad)
+	}
+	if v, version := c.LoadVersion(); v != "a" || version != 1 {
+		t.Fatalf("LoadVersion() after failed Update = %v, %d; want a, 1", v, version)
+	}
+}
+
+func TestConfigSubscribeCancel(t *testing.T) {
+	var c Config
+	var got []uint64
+	var cancel func()
+	cancel = c.Subscribe(func(_ interface{}, version uint64) {
+		got = append(got, version)
+		if version == 2 {
+			cancel() // from within the subscriber
+		}
+	})
+	for i := 0; i < 4; i++ {
+		c.Store(i)
+	}
+	cancel()
+	if fmt.Sprint(got) != "[1 2]" {
+		t.Fatalf("subscriber saw versions %v; want [1 2]", got)
+	}
+}
+
+func TestConfigConcurrentUpdate(t *testing.T) {
+	var c Config
+	last, _ := c.Store(0)
+	c.Subscribe(func(_ interface{}, version uint64) {
+		if version != last+1 {
+			t.Errorf("subscriber saw version %d after %d", version, last)
+		}
+		last = version
+	})
+	const n, loops = 8, 1000
+	done := make(chan bool)
+	for i := 0; i < n; i++ {
+		go func() {
+			for j := 0; j < loops; j++ {
+				c.Update(func(old interface{}) (interface{}, error) {
+					return old.(int) + 1, nil
+				})
+				c.Load()
+			}
+			done <- true
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-done
+	}
+	if v, version := c.LoadVersion(); v != n*loops || version != n*loops+1 {
+		t.Fatalf("LoadVersion() = %v, %d; want %d, %d", v, version, n*loops, n*loops+1)
+	}
+}
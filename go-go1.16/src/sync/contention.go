@@ -0,0 +1,119 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// A ContentionReport describes the blocked lock acquisitions recorded by
+// a contention profile, as returned by StopAndReport. Times are in
+// nanoseconds.
+type ContentionReport struct {
+	Duration int64              // how long the profile ran
+	Records  []ContentionRecord // most total wait first
+}
+
+// A ContentionRecord describes the blocked acquisitions of one lock from
+// one call stack.
+type ContentionRecord struct {
+	Lock    uintptr   // address of the lock
+	Kind    LockKind  // kind of acquisition
+	Count   int64     // number of acquisitions that blocked
+	Wait    int64     // total time spent blocked
+	MaxWait int64     // longest time spent blocked in one acquisition
+	Stack   []uintptr // caller of the lock method and its callers, as from runtime.Callers
+}
+
+// contentionDepth is the number of stack frames a contention profile
+// records per acquisition.
+const contentionDepth = 32
+
+type contentionKey struct {
+	lock  uintptr
+	kind  LockKind
+	stack [contentionDepth]uintptr
+}
+
+// contention is the state of the contention profile.
+var contention struct {
+	mu      Mutex // guards the fields below; its own waits are not recorded
+	running bool
+	start   int64
+	records map[contentionKey]*ContentionRecord
+}
+
+var errContentionRunning error = syncError("sync: contention profile already running")
+
+// StartContentionProfile starts recording the acquisitions of Mutex,
+// RWMutex and Map locks, across the whole program, that have to block:
+// which lock, from where, and for how long. Acquisitions that do not
+// block cost nothing extra, and those that do are slow already, so the
+// profile is cheap enough to run in production.
+//
+// StartContentionProfile returns an error if a profile is already
+// running. Call StopAndReport to stop the profile and get its results.
+func StartContentionProfile() error {
+	contention.mu.Lock()
+	defer contention.mu.Unlock()
+	if contention.running {
+		return errContentionRunning
+	}
+	contention.running = true
+	contention.start = nanotime()
+	contention.records = make(map[contentionKey]*ContentionRecord)
+	setLockEvents(lockEventContention, true)
+	return nil
+}
+
+// StopAndReport stops the contention profile started by
+// StartContentionProfile and returns what it recorded. If no profile is
+// running, it returns nil.
+func StopAndReport() *ContentionReport {
+	contention.mu.Lock()
+	defer contention.mu.Unlock()
+	if !contention.running {
+		return nil
+	}
+	setLockEvents(lockEventContention, false)
+	contention.running = false
+	r := &ContentionReport{Duration: nanotime() - contention.start}
+	for _, rec := range contention.records {
+		r.Records = append(r.Records, *rec)
+	}
+	contention.records = nil
+	recs := r.Records
+	sortSlice(len(recs), func(i, j int) bool { return recs[i].Wait > recs[j].Wait }, func(i, j int) { recs[i], recs[j] = recs[j], recs[i] })
+	return r
+}
+
+// recordContention records that lock was acquired after blocking for
+// wait nanoseconds. skip is as for lockWait.end, counting
+// recordContention in place of end.
+func recordContention(lock unsafe.Pointer, kind LockKind, wait int64, skip int) {
+	if lock == unsafe.Pointer(&contention.mu) {
+		return
+	}
+	key := contentionKey{lock: uintptr(lock), kind: kind}
+	n := runtime.Callers(skip, key.stack[:])
+	contention.mu.Lock()
+	defer contention.mu.Unlock()
+	if !contention.running {
+		return
+	}
+	rec := contention.records[key]
+	if rec == nil {
+		stack := make([]uintptr, n)
+		copy(stack, key.stack[:n])
+		rec = &ContentionRecord{Lock: key.lock, Kind: kind, Stack: stack}
+		contention.records[key] = rec
+	}
+	rec.Count++
+	rec.Wait += wait
+	if wait > rec.MaxWait {
+		rec.MaxWait = wait
+	}
+}
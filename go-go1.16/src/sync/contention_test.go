@@ -0,0 +1,98 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	"strings"
+	. "sync"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// blockOn makes a new goroutine block in lock while the caller holds the
+// lock with hold, and returns once the goroutine has acquired it.
+func blockOn(hold, release, lock, unlock func()) {
+	hold()
+	done := make(chan bool)
+	go func() {
+		lock()
+		unlock()
+		done <- true
+	}()
+	time.Sleep(10 * time.Millisecond)
+	release()
+	<-done
+}
+
+func TestContentionProfile(t *testing.T) {
+	if err := StartContentionProfile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartContentionProfile(); err == nil {
+		t.Fatal("second StartContentionProfile succeeded")
+	}
+	var mu Mutex
+	var rw RWMutex
+	var m Map
+	blockOn(mu.Lock, mu.Unlock, mu.Lock, mu.Unlock)
+	blockOn(rw.RLock, rw.RUnlock, rw.Lock, rw.Unlock)
+	blockOn(rw.Lock, rw.Unlock, rw.RLock, rw.RUnlock)
+	blockOn(m.LockForTest, m.UnlockForTest, func() { m.Store("k", 1) }, func() {})
+	r := StopAndReport()
+	if r == nil {
+		t.Fatal("StopAndReport returned nil")
+	}
+	if StopAndReport() != nil {
+		t.Fatal("second StopAndReport returned a report")
+	}
+
+	want := map[LockKind]uintptr{
+		LockMutex:       uintptr(unsafe.Pointer(&mu)),
+		LockRWMutex:     uintptr(unsafe.Pointer(&rw)),
+		LockRWMutexRead: uintptr(unsafe.Pointer(&rw)),
+		LockMap:         uintptr(unsafe.Pointer(&m)),
+	}
+	for _, rec := range r.Records {
+		lock, ok := want[rec.Kind]
+		if !ok || rec.Lock != lock {
+			continue
+		}
+		delete(want, rec.Kind)
+		if rec.Count != 1 || rec.Wait < int64(5*time.Millisecond) || rec.MaxWait != rec.Wait {
+			t.Errorf("%v record: count %d, wait %v, max %v", rec.Kind, rec.Count,
+				time.Duration(rec.Wait), time.Duration(rec.MaxWait))
+		}
+		wantCaller := "blockOn.func1"
+		if rec.Kind == LockMap {
+			// Store and StorePointer share store.
+			wantCaller = "(*Map).store"
+		}
+		f, _ := runtime.CallersFrames(rec.Stack).Next()
+		if !strings.HasSuffix(f.Function, wantCaller) {
+			t.Errorf("%v record: stack starts at %s; want %s", rec.Kind, f.Function, wantCaller)
+		}
+	}
+	for kind := range want {
+		t.Errorf("no record for %v", kind)
+	}
+	if r.Duration < int64(30*time.Millisecond) {
+		t.Errorf("Duration = %v; want at least 30ms", time.Duration(r.Duration))
+	}
+}
+
+func TestLockKindString(t *testing.T) {
+	for k, want := range map[LockKind]string{
+		LockMutex:       "Mutex",
+		LockRWMutexRead: "RWMutex.RLock",
+		LockMap:         "Map",
+		LockKind(99):    "LockKind(99)",
+	} {
+		if got := k.String(); got != want {
+			t.Errorf("LockKind(%d).String() = %q; want %q", k, got, want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// Context is the part of context.Context that package sync uses to let
+// blocking operations give up early. Any context.Context satisfies it;
+// package sync declares its own type only because package context
+// depends on it.
+type Context interface {
+	// Done returns a channel that is closed when the operation
+	// should be abandoned, or nil if it never should.
+	Done() <-chan struct{}
+
+	// Err returns a non-nil error explaining why Done was closed.
+	Err() error
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Counter is an int64 counter for heavily concurrent updates, such as
+// request or byte counts shared by every goroutine in a server.
+//
+// A single atomically updated int64 bounces its cache line between every
+// processor that touches it. Counter instead spreads its value over one
+// padded cell per P, so Add usually writes to memory no other processor is
+// writing, and Sum adds the cells up. Add is therefore cheap and scalable,
+// while Sum costs time proportional to GOMAXPROCS; Counter suits values
+// that are updated far more often than they are read.
+//
+// The zero Counter has the value 0 and is ready for use. A Counter must
+// not be copied after first use.
+type Counter struct {
+	noCopy noCopy
+
+	cells unsafe.Pointer // *[]counterCell, allocated on first Add
+}
+
+type counterCell struct {
+	n int64
+
+	// Prevents false sharing on widespread platforms with
+	// 128 mod (cache line size) = 0 .
+	pad [128 - 8]byte
+}
+
+// Add adds delta to c.
+func (c *Counter) Add(delta int64) {
+	cells := c.load()
+	if cells == nil {
+		cells = c.alloc()
+	}
+	// The P only picks a cell; the add itself is atomic, so it stays
+	// correct if the goroutine migrates or GOMAXPROCS changes.
+	pid := runtime_procPin()
+	runtime_procUnpin()
+	atomic.AddInt64(&cells[pid%len(cells)].n, delta)
+}
+
+// Sum returns the value of c. Adds that run concurrently with Sum may or
+// may not be included, but an Add that completes before Sum starts always
+// is.
+func (c *Counter) Sum() int64 {
+	var sum int64
+	for i, cells := 0, c.load(); i < len(cells); i++ {
+		sum += atomic.LoadInt64(&cells[i].n)
+	}
+	return sum
+}
+
+// Reset sets c to 0 and returns its previous value. Adds that run
+// concurrently with Reset are either counted in the returned value or
+// left in c, never lost.
+func (c *Counter) Reset() int64 {
+	var sum int64
+	for i, cells := 0, c.load(); i < len(cells); i++ {
+		sum += atomic.SwapInt64(&cells[i].n, 0)
+	}
+	return sum
+}
+
+func (c *Counter) load() []counterCell {
+	p := (*[]counterCell)(atomic.LoadPointer(&c.cells))
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func (c *Counter) alloc() []counterCell {
+	cells := make([]counterCell, runtime.GOMAXPROCS(0))
+	if atomic.CompareAndSwapPointer(&c.cells, nil, unsafe.Pointer(&cells)) {
+		return cells
+	}
+	return c.load() // another goroutine won the race
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	. "sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	var c Counter
+	if n := c.Sum(); n != 0 {
+		t.Fatalf("zero Counter has Sum %d", n)
+	}
+	P := runtime.GOMAXPROCS(0)
+	N := 10000
+	if testing.Short() {
+		N = 1000
+	}
+	var wg WaitGroup
+	for p := 0; p < P*2; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < N; i++ {
+				c.Add(2)
+				c.Add(-1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n, want := c.Sum(), int64(P*2*N); n != want {
+		t.Fatalf("Sum() = %d; want %d", n, want)
+	}
+	if n, want := c.Reset(), int64(P*2*N); n != want {
+		t.Fatalf("Reset() = %d; want %d", n, want)
+	}
+	if n := c.Sum(); n != 0 {
+		t.Fatalf("Sum() after Reset = %d; want 0", n)
+	}
+}
+
+func TestCounterResetConcurrent(t *testing.T) {
+	var c Counter
+	N := 10000
+	if testing.Short() {
+		N = 1000
+	}
+	var total int64
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < N; i++ {
+			c.Add(1)
+		}
+		done <- true
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		atomic.AddInt64(&total, c.Reset())
+	}
+	if total != int64(N) {
+		t.Fatalf("Reset collected %d; want %d", total, N)
+	}
+}
+
+func BenchmarkCounter(b *testing.B) {
+	var c Counter
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Add(1)
+		}
+	})
+}
+
+func BenchmarkCounterAtomic(b *testing.B) {
+	var n int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			atomic.AddInt64(&n, 1)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A COWValue holds a value that is updated by copy-on-write:
+// a writer builds a new value from the old one and publishes it in a
+// single atomic store, so readers never wait for writers and never see a
+// partly built value. It suits values that are read far more often than
+// they are written, such as routing tables and configuration maps.
+//
+// Values passed to Read and Write must be treated as immutable once
+// published: to change a map or slice, Write must copy it, change the
+// copy and return that.
+//
+// The zero COWValue holds nil and is ready for use. A
+// COWValue must not be copied after first use.
+type COWValue struct {
+	v  Atomic
+	mu Mutex // serializes writers
+}
+
+// Load returns the current value of c.
+func (c *COWValue) Load() interface{} {
+	return c.v.Load()
+}
+
+// Read calls f with the current value of c. Writes that happen while f
+// runs do not affect the value f sees.
+func (c *COWValue) Read(f func(interface{})) {
+	f(c.v.Load())
+}
+
+// Write calls f with the current value of c and publishes the value f
+// returns. Calls to Write are serialized, so no update is lost to a
+// concurrent one. If f panics, c is unchanged.
+func (c *COWValue) Write(f func(old interface{}) (new interface{})) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.v.Store(f(c.v.Load()))
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"testing"
+)
+
+func TestCOWValue(t *testing.T) {
+	var c COWValue
+	if m := c.Load(); m != nil {
+		t.Fatalf("zero COWValue holds %v", m)
+	}
+	const N = 100
+	var wg WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < N; i++ {
+				c.Write(func(v interface{}) interface{} {
+					old, _ := v.(map[string]int)
+					m := make(map[string]int, len(old)+1)
+					for k, v := range old {
+						m[k] = v
+					}
+					m["n"]++
+					m["sum"] += 2
+					return m
+				})
+			}
+		}(g)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < N; i++ {
+				c.Read(func(v interface{}) {
+					m, _ := v.(map[string]int)
+					// Readers must never see a half-updated map.
+					if m["sum"] != 2*m["n"] {
+						t.Errorf("inconsistent value %v", m)
+					}
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if n := c.Load().(map[string]int)["n"]; n != 4*N {
+		t.Fatalf("n = %d; want %d", n, 4*N)
+	}
+}
+
+func TestCOWValueWritePanic(t *testing.T) {
+	var c COWValue
+	c.Write(func(interface{}) interface{} { return 1 })
+	func() {
+		defer func() { recover() }()
+		c.Write(func(interface{}) interface{} { panic("boom") })
+	}()
+	c.Write(func(old interface{}) interface{} { return old.(int) + 1 })
+	if v := c.Load(); v != 2 {
+		t.Fatalf("Load() = %v; want 2", v)
+	}
+}
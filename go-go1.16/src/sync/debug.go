@@ -0,0 +1,93 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "runtime"
+
+// Debug mode.
+//
+// Building with the syncdebug build tag turns on checks and records that
+// are too costly for production use: Mutex and RWMutex record their
+// last few operations, with the goroutine and call stack of each, and
+// include them in the fatal errors for misuse such as unlocking an
+// unlocked mutex, and Cond.Wait panics if c.L is one of them and is
+// not locked. The last Lock of a lock tells which goroutine holds
+// it, which DumpWaiters and SetBlockWarning report along with its
+// waiters. Without the tag, syncDebug is false and the compiler removes
+// all of it.
+
+// A lockOp is an operation recorded in a lock's history in debug mode.
+type lockOp uint8
+
+const (
+	lockOpLock lockOp = 1 + iota
+	lockOpUnlock
+	lockOpRLock
+	lockOpRUnlock
+)
+
+var lockOpNames = [...]string{
+	lockOpLock:    "Lock",
+	lockOpUnlock:  "Unlock",
+	lockOpRLock:   "RLock",
+	lockOpRUnlock: "RUnlock",
+}
+
+func (op lockOp) String() string {
+	if int(op) < len(lockOpNames) && lockOpNames[op] != "" {
+		return lockOpNames[op]
+	}
+	return "lockOp(" + itoa(int(op)) + ")"
+}
+
+// AssertHeld panics if l is not locked. Together with AssertNotHeld, it
+// lets a function check the locking preconditions it documents, such as
+// a method that must be called with its receiver's mutex held.
+//
+// l may be a *Mutex, a *RWMutex, which must be locked for writing, or
+// the Locker returned by RWMutex.RLocker, which must be locked for
+// reading. Since a locked Mutex is not associated with a particular
+// goroutine, a lock held by any goroutine passes.
+//
+// The check is made only in debug mode, when the package is built with
+// the syncdebug build tag. Otherwise, and for other Lockers, AssertHeld
+// does nothing.
+func AssertHeld(l Locker) {
+	if syncDebug {
+		assertHeld(l)
+	}
+}
+
+// AssertNotHeld panics if the calling goroutine holds l, as far as
+// the lock's recent history tells: if the goroutine made the last Lock
+// of a locked *Mutex or *RWMutex, or still holds a read lock of the
+// RWMutex of the Locker returned by RWMutex.RLocker. It catches a
+// function about to lock l that is called with l held, which would
+// deadlock.
+//
+// Like AssertHeld, AssertNotHeld checks only in debug mode and does
+// nothing otherwise or for other Lockers.
+func AssertNotHeld(l Locker) {
+	if syncDebug {
+		assertNotHeld(l)
+	}
+}
+
+// appendFrames appends the functions and lines of stack, as from
+// runtime.Callers, to buf, in the format of a goroutine traceback with
+// each line prefixed by indent.
+func appendFrames(buf []byte, stack []uintptr, indent string) []byte {
+	if len(stack) == 0 {
+		return buf
+	}
+	frames := runtime.CallersFrames(stack)
+	for {
+		f, more := frames.Next()
+		buf = append(buf, indent+f.Function+"(...)\n"+indent+"\t"+f.File+":"+itoa(f.Line)+"\n"...)
+		if !more {
+			return buf
+		}
+	}
+}
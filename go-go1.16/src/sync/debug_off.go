@@ -0,0 +1,30 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !syncdebug
+
+package sync
+
+import "unsafe"
+
+// syncDebug reports whether the package is built in debug mode.
+const syncDebug = false
+
+func recordLockOp(lock unsafe.Pointer, op lockOp) {}
+
+func withLockHistory(lock unsafe.Pointer, msg string) string { return msg }
+
+func lockHolder(lock unsafe.Pointer) (goid int64, stack []uintptr) { return 0, nil }
+
+func recordHold(x unsafe.Pointer, n int64) {}
+
+func recordRelease(x unsafe.Pointer, n int64) {}
+
+func clearHolds(x unsafe.Pointer) {}
+
+func holders(x unsafe.Pointer) []int64 { return nil }
+
+func assertHeld(l Locker) {}
+
+func assertNotHeld(l Locker) {}
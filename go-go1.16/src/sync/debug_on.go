@@ -0,0 +1,329 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build syncdebug
+
+package sync
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// syncDebug reports whether the package is built in debug mode.
+const syncDebug = true
+
+const (
+	lockHistorySetBits = 8
+	lockHistorySets    = 1 << lockHistorySetBits // sets of lockHistoryWays histories
+	lockHistoryWays    = 4                       // histories per set
+	lockHistoryLen     = 8                       // operations kept per lock
+	lockHistoryDepth   = 16                      // stack frames kept per operation
+)
+
+// lockHistories holds the recent operations of locks. The history of a
+// lock is kept in one of the ways of the set chosen by hashing the
+// address of the lock. A lock whose set is full takes over the least
+// recently used history of the set, so the memory used is bounded no
+// matter how many locks the program creates, at the price of sometimes
+// losing the history of a lock.
+//
+// The sets are guarded by spin locks rather than Mutexes, which record
+// their operations here.
+var lockHistories [lockHistorySets]lockHistorySet
+
+type lockHistorySet struct {
+	mu   uint32
+	tick uint64 // incremented by each recorded operation
+	ways [lockHistoryWays]lockHistory
+}
+
+type lockHistory struct {
+	lock uintptr // address of the lock the history belongs to
+	used uint64  // tick of the set when last recorded to
+	n    int     // operations recorded; the last lockHistoryLen are kept
+	ops  [lockHistoryLen]lockOpRecord
+}
+
+type lockOpRecord struct {
+	op    lockOp
+	goid  int64
+	stack [lockHistoryDepth]uintptr
+}
+
+// lockHistorySetFor returns the set of the history of lock, acquired.
+func lockHistorySetFor(lock unsafe.Pointer) *lockHistorySet {
+	// Fibonacci hashing: the top bits of the product depend on all
+	// the bits of the address.
+	h := uint64(uintptr(lock)) * 0x9e3779b97f4a7c15 >> (64 - lockHistorySetBits)
+	s := &lockHistories[h]
+	var b Backoff
+	for !atomic.CompareAndSwapUint32(&s.mu, 0, 1) {
+		b.Wait()
+	}
+	return s
+}
+
+func (s *lockHistorySet) release() {
+	atomic.StoreUint32(&s.mu, 0)
+}
+
+// find returns the history of lock in s, or nil.
+func (s *lockHistorySet) find(lock unsafe.Pointer) *lockHistory {
+	for i := range s.ways {
+		if h := &s.ways[i]; h.lock == uintptr(lock) {
+			return h
+		}
+	}
+	return nil
+}
+
+// recordLockOp records op on lock, from the caller of the lock method
+// that calls recordLockOp.
+func recordLockOp(lock unsafe.Pointer, op lockOp) {
+	r := lockOpRecord{op: op, goid: runtime_goid()}
+	runtime.Callers(3, r.stack[:])
+	s := lockHistorySetFor(lock)
+	h := s.find(lock)
+	if h == nil {
+		h = &s.ways[0]
+		for i := range s.ways {
+			if s.ways[i].used < h.used {
+				h = &s.ways[i]
+			}
+		}
+		h.lock = uintptr(lock)
+		h.n = 0
+	}
+	s.tick++
+	h.used = s.tick
+	h.ops[h.n%lockHistoryLen] = r
+	h.n++
+	s.release()
+}
+
+// withLockHistory returns msg followed by the recent operations on lock,
+// oldest first, for a fatal error about lock.
+func withLockHistory(lock unsafe.Pointer, msg string) string {
+	s := lockHistorySetFor(lock)
+	var ops []lockOpRecord
+	if h := s.find(lock); h != nil {
+		first := 0
+		if h.n > lockHistoryLen {
+			first = h.n - lockHistoryLen
+		}
+		for i := first; i < h.n; i++ {
+			ops = append(ops, h.ops[i%lockHistoryLen])
+		}
+	}
+	s.release()
+
+	if len(ops) == 0 {
+		return msg + "\n\nno recent operations recorded on lock " + hexString(uintptr(lock))
+	}
+	buf := []byte(msg + "\n\nrecent operations on lock " + hexString(uintptr(lock)) + ", oldest first:\n")
+	for _, r := range ops {
+		buf = append(buf, "\n"+r.op.String()+" by goroutine "+itoa(int(r.goid))+":\n"...)
+		buf = appendFrames(buf, r.callers(), "")
+	}
+	return string(buf)
+}
+
+// callers returns the recorded stack of r.
+func (r *lockOpRecord) callers() []uintptr {
+	n := 0
+	for n < len(r.stack) && r.stack[n] != 0 {
+		n++
+	}
+	return r.stack[:n]
+}
+
+// lockHolder returns the goroutine that holds lock and the stack it
+// locked lock from, if the recent history of lock tells: if the last
+// operation on lock was Lock. Otherwise it returns 0 and nil.
+func lockHolder(lock unsafe.Pointer) (goid int64, stack []uintptr) {
+	r, ok := lastLockOp(lock, 0)
+	if !ok || r.op != lockOpLock {
+		return 0, nil
+	}
+	return r.goid, append([]uintptr(nil), r.callers()...)
+}
+
+// holds records, for each Semaphore and WaitGroup, the goroutines that
+// are expected to release it: those that hold weight of a Semaphore, by
+// how much, and those that have added to the counter of a WaitGroup
+// since it was last zero, by how much. Entries go away once nothing is
+// held, so the map stays as small as the set of Semaphores and
+// WaitGroups in use.
+var holds struct {
+	mu Mutex
+	m  map[unsafe.Pointer]map[int64]int64
+}
+
+// recordHold records that the calling goroutine acquired a weight of n
+// of the Semaphore at x, or added n to the WaitGroup at x.
+func recordHold(x unsafe.Pointer, n int64) {
+	goid := runtime_goid()
+	holds.mu.Lock()
+	if holds.m == nil {
+		holds.m = make(map[unsafe.Pointer]map[int64]int64)
+	}
+	h := holds.m[x]
+	if h == nil {
+		h = make(map[int64]int64)
+		holds.m[x] = h
+	}
+	h[goid] += n
+	holds.mu.Unlock()
+}
+
+// recordRelease records that the calling goroutine released a weight of
+// n of the Semaphore at x. The weight comes off what the goroutine holds
+// first, and off what others hold if it holds less, since a Semaphore
+// may be released by a goroutine other than the one that acquired it.
+func recordRelease(x unsafe.Pointer, n int64) {
+	goid := runtime_goid()
+	holds.mu.Lock()
+	defer holds.mu.Unlock()
+	h := holds.m[x]
+	if h == nil {
+		return
+	}
+	take := func(g int64) {
+		d := h[g]
+		if d > n {
+			d = n
+		}
+		n -= d
+		if h[g] -= d; h[g] == 0 {
+			delete(h, g)
+		}
+	}
+	take(goid)
+	for g := range h {
+		if n == 0 {
+			break
+		}
+		take(g)
+	}
+	if len(h) == 0 {
+		delete(holds.m, x)
+	}
+}
+
+// clearHolds records that the WaitGroup at x has reached zero.
+func clearHolds(x unsafe.Pointer) {
+	holds.mu.Lock()
+	delete(holds.m, x)
+	holds.mu.Unlock()
+}
+
+// holders returns the goroutines recorded as holding the Semaphore or
+// WaitGroup at x, in increasing order.
+func holders(x unsafe.Pointer) []int64 {
+	holds.mu.Lock()
+	var gs []int64
+	for g := range holds.m[x] {
+		gs = append(gs, g)
+	}
+	holds.mu.Unlock()
+	sortSlice(len(gs), func(i, j int) bool { return gs[i] < gs[j] }, func(i, j int) { gs[i], gs[j] = gs[j], gs[i] })
+	return gs
+}
+
+func assertHeld(l Locker) {
+	var lock unsafe.Pointer
+	var held bool
+	switch l := l.(type) {
+	case *Mutex:
+		lock = unsafe.Pointer(l)
+		held = atomic.LoadInt32(&l.state)&mutexLocked != 0
+	case *RWMutex:
+		lock = unsafe.Pointer(l)
+		held = rwWriteHeld(l)
+	case *rlocker:
+		lock = unsafe.Pointer(l)
+		held = rwReaders((*RWMutex)(l)) > 0
+	default:
+		return
+	}
+	if !held {
+		panic(withLockHistory(lock, "sync: AssertHeld of unlocked "+lockerName(l)))
+	}
+}
+
+func assertNotHeld(l Locker) {
+	me := runtime_goid()
+	var lock unsafe.Pointer
+	var held bool
+	switch l := l.(type) {
+	case *Mutex:
+		lock = unsafe.Pointer(l)
+		r, ok := lastLockOp(lock, 0)
+		held = ok && r.op == lockOpLock && r.goid == me && atomic.LoadInt32(&l.state)&mutexLocked != 0
+	case *RWMutex:
+		lock = unsafe.Pointer(l)
+		r, ok := lastLockOp(lock, 0)
+		held = ok && r.op == lockOpLock && r.goid == me && rwWriteHeld(l)
+	case *rlocker:
+		lock = unsafe.Pointer(l)
+		r, ok := lastLockOp(lock, me)
+		held = ok && r.op == lockOpRLock && rwReaders((*RWMutex)(l)) > 0
+	default:
+		return
+	}
+	if held {
+		panic(withLockHistory(lock, "sync: AssertNotHeld of "+lockerName(l)+" held by the calling goroutine"))
+	}
+}
+
+// lastLockOp returns the last recorded operation on lock, by the
+// goroutine goid if it is not 0.
+func lastLockOp(lock unsafe.Pointer, goid int64) (r lockOpRecord, ok bool) {
+	s := lockHistorySetFor(lock)
+	defer s.release()
+	h := s.find(lock)
+	if h == nil {
+		return r, false
+	}
+	for i := h.n - 1; i >= 0 && i >= h.n-lockHistoryLen; i-- {
+		r = h.ops[i%lockHistoryLen]
+		if goid == 0 || r.goid == goid {
+			return r, true
+		}
+	}
+	return r, false
+}
+
+// rwWriteHeld reports whether rw is locked for writing: a writer holds
+// its w and has announced itself to readers, and no readers remain.
+func rwWriteHeld(rw *RWMutex) bool {
+	return atomic.LoadInt32(&rw.w.state)&mutexLocked != 0 &&
+		atomic.LoadInt32(&rw.readerCount) < 0 &&
+		atomic.LoadInt32(&rw.readerWait) == 0
+}
+
+// rwReaders returns the number of readers holding rw.
+func rwReaders(rw *RWMutex) int32 {
+	r := atomic.LoadInt32(&rw.readerCount)
+	if r < 0 {
+		// A writer is pending or holds rw. Readers that came
+		// after it wait, and readerWait counts those before it that
+		// have yet to leave.
+		return atomic.LoadInt32(&rw.readerWait)
+	}
+	return r
+}
+
+func lockerName(l Locker) string {
+	switch l.(type) {
+	case *Mutex:
+		return "Mutex"
+	case *RWMutex:
+		return "RWMutex"
+	default:
+		return "RWMutex for reading"
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build syncdebug
+
+package sync_test
+
+import (
+	"context"
+	"internal/testenv"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	. "sync"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// lastOps returns the names of the last n operations in a lock history.
+// The history may begin with operations on an earlier lock at the same
+// address, so tests look at its end only.
+func lastOps(history string, n int) []string {
+	var ops []string
+	for _, line := range strings.Split(history, "\n") {
+		if i := strings.Index(line, " by goroutine "); i >= 0 {
+			ops = append(ops, line[:i])
+		}
+	}
+	if len(ops) > n {
+		ops = ops[len(ops)-n:]
+	}
+	return ops
+}
+
+func TestLockHistory(t *testing.T) {
+	var mu Mutex
+	var rw RWMutex
+	mu.Lock()
+	mu.Unlock()
+	rw.RLock()
+	rw.RUnlock()
+	rw.Lock()
+	rw.Unlock()
+
+	h := LockHistory(&mu)
+	if got, want := lastOps(h, 2), []string{"Lock", "Unlock"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Mutex history ends with %v, want %v:\n%s", got, want, h)
+	}
+	if !strings.Contains(h, "sync_test.TestLockHistory(...)") {
+		t.Errorf("Mutex history does not have the caller of Lock:\n%s", h)
+	}
+	h = LockHistory(&rw)
+	if got, want := lastOps(h, 4), []string{"RLock", "RUnlock", "Lock", "Unlock"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RWMutex history ends with %v, want %v:\n%s", got, want, h)
+	}
+}
+
+func TestMutexMisuseHistory(t *testing.T) {
+	testenv.MustHaveExec(t)
+	out, err := exec.Command(os.Args[0], "TESTMISUSE", "Mutex.Unlock2").CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "recent operations on lock") || strings.Count(string(out), "Unlock by goroutine ") != 2 {
+		t.Errorf("did not find failure with the history of the lock: %s\n%s\n", err, out)
+	}
+}
+
+// assertPanics reports whether f panics.
+func assertPanics(f func()) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+	f()
+	return false
+}
+
+func TestAssertHeld(t *testing.T) {
+	var mu Mutex
+	var rw RWMutex
+	rl := rw.RLocker()
+
+	for _, l := range []Locker{&mu, &rw, rl} {
+		if !assertPanics(func() { AssertHeld(l) }) {
+			t.Errorf("AssertHeld(%T) of an unlocked lock did not panic", l)
+		}
+		if assertPanics(func() { AssertNotHeld(l) }) {
+			t.Errorf("AssertNotHeld(%T) of an unlocked lock panicked", l)
+		}
+		l.Lock()
+		if assertPanics(func() { AssertHeld(l) }) {
+			t.Errorf("AssertHeld(%T) of a held lock panicked", l)
+		}
+		if !assertPanics(func() { AssertNotHeld(l) }) {
+			t.Errorf("AssertNotHeld(%T) of a lock held by the caller did not panic", l)
+		}
+		done := make(chan bool)
+		go func() {
+			done <- assertPanics(func() { AssertNotHeld(l) })
+		}()
+		if <-done {
+			t.Errorf("AssertNotHeld(%T) in another goroutine panicked", l)
+		}
+		l.Unlock()
+	}
+
+	// A read lock does not hold the RWMutex for writing.
+	rw.RLock()
+	if !assertPanics(func() { AssertHeld(&rw) }) {
+		t.Errorf("AssertHeld(*RWMutex) of a read-locked RWMutex did not panic")
+	}
+	rw.RUnlock()
+}
+
+func TestLockHolder(t *testing.T) {
+	var mu Mutex
+	warnings := make(chan BlockWarning, 1)
+	SetBlockWarning(int64(10*time.Millisecond), func(bw BlockWarning) {
+		if bw.Lock == uintptr(unsafe.Pointer(&mu)) {
+			warnings <- bw
+		}
+	})
+	defer SetBlockWarning(0, nil)
+
+	SetLockLabel(&mu, "held")
+	defer SetLockLabel(&mu, "")
+	mu.Lock()
+	done := make(chan bool)
+	go func() {
+		mu.Lock()
+		mu.Unlock()
+		done <- true
+	}()
+	bw := <-warnings
+	want := "held by goroutine "
+	dump := waitersDump(want)
+	mu.Unlock()
+	<-done
+
+	if bw.Holder == 0 || len(bw.HolderStack) == 0 {
+		t.Errorf("BlockWarning = %+v, want a Holder and its stack", bw)
+	} else if f, _ := runtime.CallersFrames(bw.HolderStack).Next(); !strings.HasSuffix(f.Function, "TestLockHolder") {
+		t.Errorf("BlockWarning.HolderStack starts in %s, want TestLockHolder", f.Function)
+	}
+	if !strings.Contains(dump, want) || !strings.Contains(dump, "sync_test.TestLockHolder(...)") {
+		t.Errorf("DumpWaiters does not tell who holds the lock:\n%s", dump)
+	}
+}
+
+func TestFindLeakedWaiters(t *testing.T) {
+	// A goroutine that exits holding a lock.
+	var exited Mutex
+	done := make(chan bool)
+	go func() {
+		exited.Lock()
+		done <- true
+	}()
+	<-done
+	go func() {
+		exited.Lock() // leaks
+	}()
+
+	// Two goroutines that deadlock.
+	var a, b Mutex
+	locked := make(chan bool)
+	proceed := make(chan bool)
+	go func() {
+		a.Lock()
+		locked <- true
+		<-proceed
+		b.Lock() // leaks
+	}()
+	go func() {
+		b.Lock()
+		locked <- true
+		<-proceed
+		a.Lock() // leaks
+	}()
+	<-locked
+	<-locked
+	close(proceed)
+
+	var leaks []LeakedWaiter
+	for i := 0; i < 100; i++ {
+		leaks = FindLeakedWaiters()
+		if len(leaks) >= 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	byLock := make(map[uintptr]LeakedWaiter)
+	for _, l := range leaks {
+		byLock[l.Lock] = l
+	}
+	if l, ok := byLock[uintptr(unsafe.Pointer(&exited))]; !ok || !l.HolderExited {
+		t.Errorf("leak behind an exited holder: got %+v, want HolderExited; all leaks: %+v", l, leaks)
+	}
+	la, oka := byLock[uintptr(unsafe.Pointer(&a))]
+	lb, okb := byLock[uintptr(unsafe.Pointer(&b))]
+	if !oka || !okb || len(la.Cycle) != 2 || len(lb.Cycle) != 2 || la.Holder != lb.Goroutine || lb.Holder != la.Goroutine {
+		t.Errorf("deadlock leaks: got %+v and %+v, want a cycle of two; all leaks: %+v", la, lb, leaks)
+	}
+
+	// Release the leaked goroutines.
+	exited.Unlock()
+	a.Unlock()
+	b.Unlock()
+}
+
+func TestFindLeakedWaitersWaitGroup(t *testing.T) {
+	// A goroutine that adds to a WaitGroup and exits without Done.
+	var wg WaitGroup
+	done := make(chan bool)
+	go func() {
+		wg.Add(1)
+		done <- true
+	}()
+	<-done
+	go wg.Wait() // leaks
+
+	// A goroutine that exits holding all of a Semaphore.
+	sem := NewSemaphore(2)
+	go func() {
+		sem.Acquire(context.Background(), 2)
+		done <- true
+	}()
+	<-done
+	go sem.Acquire(context.Background(), 1) // leaks
+
+	// A WaitGroup added to by its waiter, for a goroutine that is
+	// still running, is not reported.
+	var running WaitGroup
+	release := make(chan bool)
+	running.Add(1)
+	go func() {
+		<-release
+		running.Done()
+	}()
+	go running.Wait()
+
+	var leaks []LeakedWaiter
+	for i := 0; i < 100; i++ {
+		leaks = FindLeakedWaiters()
+		if len(leaks) >= 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	byLock := make(map[uintptr]LeakedWaiter)
+	for _, l := range leaks {
+		byLock[l.Lock] = l
+	}
+	if l, ok := byLock[uintptr(unsafe.Pointer(&wg))]; !ok || l.Kind != LockWaitGroup || !l.HolderExited {
+		t.Errorf("leaked WaitGroup.Wait: got %+v; all leaks: %+v", l, leaks)
+	}
+	if l, ok := byLock[uintptr(unsafe.Pointer(sem))]; !ok || l.Kind != LockSemaphore || !l.HolderExited {
+		t.Errorf("leaked Semaphore.Acquire: got %+v; all leaks: %+v", l, leaks)
+	}
+	if l, ok := byLock[uintptr(unsafe.Pointer(&running))]; ok {
+		t.Errorf("WaitGroup.Wait for a running goroutine reported: %+v", l)
+	}
+
+	// Release the leaked goroutines.
+	close(release)
+	wg.Done()
+	sem.Release(2)
+}
@@ -0,0 +1,228 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// Timer wheel.
+//
+// A DelayQueue files its items in a hierarchical timer wheel: levels of
+// delayWheelSize slots, where a slot of level 0 spans one tick and a
+// slot of level l spans delayWheelSize^l ticks. An item goes into the
+// lowest level whose span of slots reaches its deadline, in the slot
+// its deadline falls in. As the wheel turns, the items of the level 0
+// slot of the current tick become ready, and each time a level comes
+// round to its first slot, the slot of the next level up that the
+// wheel has reached is emptied and its items filed again, a level or
+// more lower. Filing and turning cost the same whatever the number of
+// items, and the whole queue needs a single timer, for the next tick
+// with items, rather than one per item.
+
+const (
+	delayWheelBits   = 6
+	delayWheelSize   = 1 << delayWheelBits
+	delayWheelMask   = delayWheelSize - 1
+	delayWheelLevels = 4 // 2^24 ticks: four and a half hours of 1ms ticks
+
+	// defaultDelayTick is the tick of a DelayQueue made with a tick of
+	// zero or less.
+	defaultDelayTick = 1e6 // 1ms
+)
+
+// A DelayQueue holds items that become available only after a delay,
+// such as retries or timeouts of a scheduler: Put adds an item with its
+// delay, and Take waits for the next item whose delay has passed. Items
+// come out in the order of their deadlines, rounded up to the queue's
+// tick; items due in the same tick come out in the order they were put.
+//
+// See the comment on the timer wheel in delayqueue.go for how a
+// DelayQueue avoids a timer per item.
+//
+// A DelayQueue must be created with NewDelayQueue and must not be
+// copied after first use.
+type DelayQueue struct {
+	tick  int64 // nanoseconds per tick
+	start int64 // nanotime of tick 0
+
+	mu    Mutex
+	now   int64 // the tick the wheel has turned to
+	wheel [delayWheelLevels][delayWheelSize][]delayItem
+	filed int           // number of items in the wheel
+	ready []delayItem   // items due, in order
+	wake  chan struct{} // closed by Put to wake waiting Takes; made by them
+}
+
+type delayItem struct {
+	v  interface{}
+	at int64 // the tick at which v is due
+}
+
+// NewDelayQueue returns a new, empty DelayQueue that measures delays in
+// ticks of tick nanoseconds, or 1ms if tick is zero or less. Finer ticks
+// hand out items closer to their deadlines; coarser ones let the queue
+// sleep longer and reach further before it needs to file items again.
+func NewDelayQueue(tick int64) *DelayQueue {
+	if tick <= 0 {
+		tick = defaultDelayTick
+	}
+	return &DelayQueue{tick: tick, start: nanotime()}
+}
+
+// Put adds v to q, to become available after delay nanoseconds. A delay
+// of zero or less makes it available at once.
+func (q *DelayQueue) Put(v interface{}, delay int64) {
+	q.mu.Lock()
+	q.advanceLocked()
+	at := q.now
+	if delay > 0 {
+		// Round up, so that v never comes out early.
+		at = (nanotime() + delay - q.start + q.tick - 1) / q.tick
+	}
+	q.fileLocked(delayItem{v, at})
+	wakeWaiters(&q.wake)
+	q.mu.Unlock()
+}
+
+// Take removes and returns the item of q that became available first,
+// waiting for one if there is none. It returns ctx.Err() if ctx is done
+// first. A nil ctx never gives up.
+func (q *DelayQueue) Take(ctx Context) (interface{}, error) {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	for {
+		q.mu.Lock()
+		q.advanceLocked()
+		if v, ok := q.popLocked(); ok {
+			q.mu.Unlock()
+			return v, nil
+		}
+		if q.wake == nil {
+			q.wake = make(chan struct{})
+		}
+		wake := q.wake
+		var timer chan struct{}
+		var stop func() bool
+		if ticks := q.nextLocked(); ticks > 0 {
+			timer = make(chan struct{})
+			stop = startCloseTimer((q.now+ticks)*q.tick+q.start-nanotime(), timer)
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-timer:
+		case <-wake:
+		case <-cancel:
+			if stop != nil {
+				stop()
+			}
+			return nil, ctx.Err()
+		}
+		if stop != nil {
+			stop()
+		}
+	}
+}
+
+// TryTake removes and returns the item of q that became available
+// first, if there is one, without waiting. The ok result reports
+// whether there was.
+func (q *DelayQueue) TryTake() (v interface{}, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.advanceLocked()
+	return q.popLocked()
+}
+
+// Len returns the number of items in q, available or not.
+func (q *DelayQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.filed + len(q.ready)
+}
+
+// popLocked removes and returns the first ready item. q.mu must be held.
+func (q *DelayQueue) popLocked() (interface{}, bool) {
+	if len(q.ready) == 0 {
+		return nil, false
+	}
+	v := q.ready[0].v
+	q.ready[0] = delayItem{}
+	q.ready = q.ready[1:]
+	return v, true
+}
+
+// fileLocked files it in the wheel, or with the ready items if it is
+// due. q.mu must be held.
+func (q *DelayQueue) fileLocked(it delayItem) {
+	d := it.at - q.now
+	if d <= 0 {
+		q.ready = append(q.ready, it)
+		return
+	}
+	at := it.at
+	level := 0
+	for d >= delayWheelSize<<(delayWheelBits*level) {
+		if level == delayWheelLevels-1 {
+			// Beyond the reach of the wheel: file it in the furthest
+			// slot, to be filed again from there.
+			at = q.now + delayWheelSize<<(delayWheelBits*level) - 1
+			break
+		}
+		level++
+	}
+	slot := &q.wheel[level][at>>(delayWheelBits*level)&delayWheelMask]
+	*slot = append(*slot, it)
+	q.filed++
+}
+
+// advanceLocked turns the wheel to the current tick. q.mu must be held.
+func (q *DelayQueue) advanceLocked() {
+	to := (nanotime() - q.start) / q.tick
+	for q.now < to {
+		if q.filed == 0 {
+			q.now = to
+			return
+		}
+		q.now++
+		// Refile the slots that the higher levels have come round to,
+		// from the top down, so that their items can reach level 0.
+		for level := delayWheelLevels - 1; level > 0; level-- {
+			if q.now&(1<<(delayWheelBits*level)-1) == 0 {
+				q.refileLocked(level, q.now>>(delayWheelBits*level)&delayWheelMask)
+			}
+		}
+		q.refileLocked(0, q.now&delayWheelMask)
+	}
+}
+
+// refileLocked empties a slot of the wheel and files its items again.
+// q.mu must be held.
+func (q *DelayQueue) refileLocked(level int, slot int64) {
+	items := q.wheel[level][slot]
+	if len(items) == 0 {
+		return
+	}
+	q.wheel[level][slot] = nil
+	q.filed -= len(items)
+	for _, it := range items {
+		q.fileLocked(it)
+	}
+}
+
+// nextLocked returns the number of ticks after which q should turn its
+// wheel again: at the next level 0 slot that has items, or when level 0
+// comes round, for items in higher levels. It returns 0 if the wheel is
+// empty. q.mu must be held.
+func (q *DelayQueue) nextLocked() int64 {
+	if q.filed == 0 {
+		return 0
+	}
+	for t := int64(1); t < delayWheelSize; t++ {
+		if len(q.wheel[0][(q.now+t)&delayWheelMask]) > 0 {
+			return t
+		}
+	}
+	return delayWheelSize - q.now&delayWheelMask
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	"runtime"
+	. "sync"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue(t *testing.T) {
+	c := newFakeClock()
+	defer SetClockForTesting(SetClockForTesting(c))
+	const ms = int64(time.Millisecond)
+	q := NewDelayQueue(ms)
+
+	// Delays that land in each level of the wheel, put out of order.
+	delays := []int64{5000 * ms, 3 * ms, 70 * ms, 0, 300000 * ms, 3 * ms}
+	for i, d := range delays {
+		q.Put(i, d)
+	}
+	if n := q.Len(); n != len(delays) {
+		t.Fatalf("Len = %d; want %d", n, len(delays))
+	}
+	for _, step := range []struct {
+		advance int64
+		want    []interface{}
+	}{
+		{0, []interface{}{3}},
+		{2 * ms, nil},
+		{ms, []interface{}{1, 5}},
+		{66 * ms, nil},
+		{ms, []interface{}{2}},
+		{4929 * ms, nil},
+		{ms, []interface{}{0}},
+		{295000 * ms, []interface{}{4}},
+	} {
+		c.Advance(step.advance)
+		for _, want := range step.want {
+			if v, ok := q.TryTake(); !ok || v != want {
+				t.Fatalf("TryTake = %v, %v; want %v, true", v, ok, want)
+			}
+		}
+		if v, ok := q.TryTake(); ok {
+			t.Fatalf("TryTake = %v before its deadline", v)
+		}
+	}
+	if n := q.Len(); n != 0 {
+		t.Fatalf("Len = %d; want 0", n)
+	}
+
+	// Take sleeps until the next deadline, and a Put wakes it.
+	done := make(chan interface{})
+	go func() {
+		v, _ := q.Take(nil)
+		done <- v
+	}()
+	for i := 0; i < 10; i++ {
+		runtime.Gosched()
+	}
+	q.Put("a", 10*ms)
+	for c.numTimers() == 0 {
+		runtime.Gosched()
+	}
+	c.Advance(10 * ms)
+	if v := <-done; v != "a" {
+		t.Fatalf("Take = %v; want a", v)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.Take(ctx); err != context.Canceled {
+		t.Fatalf("Take with a canceled context = %v; want %v", err, context.Canceled)
+	}
+}
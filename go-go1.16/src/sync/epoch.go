@@ -0,0 +1,147 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// An Epoch is a domain for epoch-based reclamation. It tells the writer
+// of a lock-free data structure when no reader can still be using a node
+// it has unlinked, so that the node can be reused or its resources
+// released.
+//
+// Readers bracket each access to the structure with Pin and Unpin. A
+// writer that unlinks a node passes a function that frees it to Defer,
+// and the Epoch runs that function only after every reader that was
+// pinned at the time of the Defer has unpinned.
+//
+// The garbage collector already keeps unlinked nodes alive for as long as
+// any goroutine can reach them, so lock-free structures in Go, including
+// Stack in this package, are memory safe without an Epoch. An Epoch is
+// for what the collector does not do: recycling nodes through a free list
+// instead of allocating, and releasing memory or handles it does not
+// manage.
+//
+// The zero Epoch is ready for use. An Epoch must not be copied after first
+// use.
+type Epoch struct {
+	noCopy noCopy
+
+	global uint64 // current epoch; written only with mu held
+
+	free Stack // unpinned *EpochGuards, for reuse
+
+	mu        Mutex
+	guards    []*EpochGuard // every guard ever created
+	limbo     [3][]func()   // deferred functions, by epoch mod 3
+	ndeferred int           // Defer calls since the last advance attempt
+}
+
+// An EpochGuard records that a goroutine is pinned to an Epoch. It is
+// returned by Epoch.Pin and must be released with Unpin.
+type EpochGuard struct {
+	// state is first in the struct so that 64-bit atomic operations on
+	// it are aligned on 32-bit platforms.
+	state uint64 // epoch<<1 | 1 while pinned, 0 while not
+	e     *Epoch
+}
+
+// epochAdvanceEvery is how many Defer calls an Epoch collects before it
+// tries to advance. Advancing scans every guard, so it is amortized.
+const epochAdvanceEvery = 64
+
+// Pin pins the calling goroutine to the current epoch and returns a guard
+// that must be passed to Unpin when the goroutine has finished with the
+// nodes it reads. Functions deferred after Pin returns do not run until
+// the guard is unpinned. Pinning is cheap and need not be held for long;
+// a long-held pin delays every deferred function in e.
+func (e *Epoch) Pin() *EpochGuard {
+	x, _ := e.free.Pop()
+	g, _ := x.(*EpochGuard)
+	if g == nil {
+		g = &EpochGuard{e: e}
+		e.mu.Lock()
+		e.guards = append(e.guards, g)
+		e.mu.Unlock()
+	}
+	for {
+		ge := atomic.LoadUint64(&e.global)
+		atomic.StoreUint64(&g.state, ge<<1|1)
+		// If the epoch advanced before our store became visible, the
+		// advance may not have seen us; pin to the new epoch instead.
+		if atomic.LoadUint64(&e.global) == ge {
+			return g
+		}
+	}
+}
+
+// Unpin releases g. It panics if g is not pinned.
+func (g *EpochGuard) Unpin() {
+	if atomic.SwapUint64(&g.state, 0) == 0 {
+		panic("sync: Unpin of unpinned EpochGuard")
+	}
+	g.e.free.Push(g)
+}
+
+// Defer arranges for free to be called once every goroutine pinned to e
+// at the time of the call has unpinned. The caller must already have made
+// the node that free releases unreachable to goroutines that pin later.
+// Deferred functions run on the goroutine that advances the epoch, in a
+// later call to Defer or Reclaim.
+func (e *Epoch) Defer(free func()) {
+	e.mu.Lock()
+	ge := atomic.LoadUint64(&e.global)
+	e.limbo[ge%3] = append(e.limbo[ge%3], free)
+	e.ndeferred++
+	try := e.ndeferred >= epochAdvanceEvery
+	e.mu.Unlock()
+	if try {
+		fs, _ := e.advance()
+		e.run(fs)
+	}
+}
+
+// Reclaim runs every deferred function that no pinned goroutine can still
+// be relying on. Deferred functions also run without calls to Reclaim, as
+// Defer is called; Reclaim is for when the caller wants them to run
+// promptly, such as before shutting down.
+func (e *Epoch) Reclaim() {
+	// Functions deferred in the current epoch become safe two epochs
+	// later; after a third advance every bucket has been emptied once.
+	for i := 0; i < 3; i++ {
+		fs, ok := e.advance()
+		if !ok {
+			break
+		}
+		e.run(fs)
+	}
+}
+
+// advance advances the epoch, if every pinned guard has observed the
+// current one. It reports whether it did and returns the deferred
+// functions that are now safe to run.
+func (e *Epoch) advance() (fs []func(), ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ndeferred = 0
+	ge := atomic.LoadUint64(&e.global)
+	for _, g := range e.guards {
+		if s := atomic.LoadUint64(&g.state); s&1 != 0 && s>>1 != ge {
+			return nil, false
+		}
+	}
+	// Functions deferred in epoch n are run when advancing to n+2,
+	// which is the bucket that epoch n+3 is about to reuse.
+	n := ge + 1
+	atomic.StoreUint64(&e.global, n)
+	fs = e.limbo[(n+1)%3]
+	e.limbo[(n+1)%3] = nil
+	return fs, true
+}
+
+func (e *Epoch) run(fs []func()) {
+	for _, f := range fs {
+		f()
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	. "sync"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+)
+
+func TestEpoch(t *testing.T) {
+	var e Epoch
+	g := e.Pin()
+	freed := false
+	e.Defer(func() { freed = true })
+	e.Reclaim()
+	if freed {
+		t.Fatal("deferred function ran while a goroutine was pinned")
+	}
+	g.Unpin()
+	e.Reclaim()
+	if !freed {
+		t.Fatal("deferred function did not run after Unpin and Reclaim")
+	}
+
+	// A goroutine pinned after the Defer must not hold it up.
+	freed = false
+	e.Defer(func() { freed = true })
+	g = e.Pin()
+	g2 := e.Pin()
+	g.Unpin()
+	e.Reclaim()
+	g2.Unpin()
+	e.Reclaim()
+	if !freed {
+		t.Fatal("deferred function did not run")
+	}
+}
+
+func TestEpochUnpinTwice(t *testing.T) {
+	var e Epoch
+	g := e.Pin()
+	g.Unpin()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("second Unpin did not panic")
+		}
+	}()
+	g.Unpin()
+}
+
+type epochNode struct {
+	val   int
+	freed uint32
+}
+
+// TestEpochRecycle recycles nodes through a free list, as the writer of
+// a lock-free structure would, and checks that readers never see a node
+// that has been freed while they are pinned.
+func TestEpochRecycle(t *testing.T) {
+	var e Epoch
+	var free Stack
+	var cur unsafe.Pointer = unsafe.Pointer(&epochNode{})
+	N := 10000
+	if testing.Short() {
+		N = 1000
+	}
+	done := make(chan bool)
+	for r := 0; r < runtime.GOMAXPROCS(0)+1; r++ {
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				g := e.Pin()
+				n := (*epochNode)(atomic.LoadPointer(&cur))
+				if atomic.LoadUint32(&n.freed) != 0 {
+					panic("reader saw a freed node")
+				}
+				runtime.Gosched()
+				if atomic.LoadUint32(&n.freed) != 0 {
+					panic("node freed while reader was pinned")
+				}
+				g.Unpin()
+			}
+		}()
+	}
+	for i := 0; i < N; i++ {
+		x, _ := free.Pop()
+		n, _ := x.(*epochNode)
+		if n == nil {
+			n = new(epochNode)
+		}
+		atomic.StoreUint32(&n.freed, 0)
+		n.val = i
+		old := (*epochNode)(atomic.SwapPointer(&cur, unsafe.Pointer(n)))
+		e.Defer(func() {
+			atomic.StoreUint32(&old.freed, 1)
+			free.Push(old)
+		})
+	}
+	close(done)
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// An Exchanger is a rendezvous point at which pairs of goroutines swap
+// values: each goroutine calling Exchange is matched with
+// another, and each receives the other's value. A pair meets through a
+// single compare-and-swap on a shared slot rather than a lock, so the
+// exchange itself is cheap.
+//
+// Exchanger is also the building block of elimination backoff: when a
+// push and a pop on a contended Stack both fail, they may pair up in an
+// Exchanger and cancel out, leaving the top of the stack alone.
+//
+// The zero Exchanger is ready for use. An Exchanger must not be copied
+// after first use.
+type Exchanger struct {
+	slot unsafe.Pointer // *exchangeNode offered by a waiting goroutine
+}
+
+// An exchangeNode is a value offered in an Exchanger's slot.
+type exchangeNode struct {
+	v      interface{}
+	reply  interface{}   // set by the partner
+	filled uint32        // 1 once reply is set
+	done   chan struct{} // closed once reply is set, if non-nil
+}
+
+// Exchange waits for another goroutine to call Exchange on x and returns
+// that goroutine's value, while the other goroutine receives v. If ctx is
+// done first, Exchange returns nil and ctx.Err(). A nil
+// ctx never gives up.
+func (x *Exchanger) Exchange(ctx Context, v interface{}) (interface{}, error) {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	var n *exchangeNode
+	for {
+		if other, ok := x.take(v); ok {
+			return other, nil
+		}
+		if n == nil {
+			n = &exchangeNode{v: v, done: make(chan struct{})}
+		}
+		if atomic.CompareAndSwapPointer(&x.slot, nil, unsafe.Pointer(n)) {
+			break
+		}
+	}
+	select {
+	case <-n.done:
+		return n.reply, nil
+	case <-cancel:
+	}
+	if atomic.CompareAndSwapPointer(&x.slot, unsafe.Pointer(n), nil) {
+		return nil, ctx.Err()
+	}
+	// A partner took n as ctx was done; the exchange has happened.
+	<-n.done
+	return n.reply, nil
+}
+
+// take completes the exchange offered in x's slot, if any, giving v to
+// the goroutine that offered it. It returns that goroutine's value and
+// whether there was one.
+func (x *Exchanger) take(v interface{}) (interface{}, bool) {
+	p := atomic.LoadPointer(&x.slot)
+	if p == nil || !atomic.CompareAndSwapPointer(&x.slot, p, nil) {
+		return nil, false
+	}
+	n := (*exchangeNode)(p)
+	n.reply = v
+	atomic.StoreUint32(&n.filled, 1)
+	if n.done != nil {
+		close(n.done)
+	}
+	return n.v, true
+}
+
+// trySpin attempts an exchange without blocking: it takes a waiting
+// goroutine's offer if there is one, and otherwise offers v and spins
+// for about spins iterations waiting for a partner. It reports whether
+// the exchange happened.
+func (x *Exchanger) trySpin(v interface{}, spins int) (interface{}, bool) {
+	if other, ok := x.take(v); ok {
+		return other, true
+	}
+	n := &exchangeNode{v: v}
+	if !atomic.CompareAndSwapPointer(&x.slot, nil, unsafe.Pointer(n)) {
+		return nil, false
+	}
+	for i := 0; i < spins; i++ {
+		if atomic.LoadUint32(&n.filled) != 0 {
+			return n.reply, true
+		}
+		runtime_doSpin()
+	}
+	if atomic.CompareAndSwapPointer(&x.slot, unsafe.Pointer(n), nil) {
+		return nil, false
+	}
+	// A partner took n and is about to fill in its reply.
+	for atomic.LoadUint32(&n.filled) == 0 {
+		runtime.Gosched()
+	}
+	return n.reply, true
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	. "sync"
+	"testing"
+	"time"
+)
+
+func TestExchanger(t *testing.T) {
+	var x Exchanger
+	got := make(chan interface{})
+	go func() {
+		v, err := x.Exchange(nil, "a")
+		if err != nil {
+			t.Error(err)
+		}
+		got <- v
+	}()
+	v, err := x.Exchange(context.Background(), "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "a" {
+		t.Fatalf("Exchange returned %v; want a", v)
+	}
+	if v := <-got; v != "b" {
+		t.Fatalf("partner's Exchange returned %v; want b", v)
+	}
+}
+
+func TestExchangerPairs(t *testing.T) {
+	var x Exchanger
+	const N = 100
+	var wg WaitGroup
+	results := make([]int, 2*N)
+	for i := 0; i < 2*N; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := x.Exchange(nil, i)
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = v.(int)
+		}(i)
+	}
+	wg.Wait()
+	// Exchanges pair goroutines: each one's partner got its value.
+	for i, v := range results {
+		if v == i || results[v] != i {
+			t.Fatalf("goroutine %d got %d, which got %d", i, v, results[v])
+		}
+	}
+}
+
+func TestExchangerContext(t *testing.T) {
+	var x Exchanger
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := x.Exchange(ctx, 1); err != context.DeadlineExceeded {
+		t.Fatalf("Exchange() = %v; want %v", err, context.DeadlineExceeded)
+	}
+	// The abandoned offer must not be matched by a later exchange.
+	got := make(chan interface{})
+	go func() {
+		v, _ := x.Exchange(nil, 2)
+		got <- v
+	}()
+	if v, _ := x.Exchange(nil, 3); v != 2 {
+		t.Fatalf("Exchange returned %v; want 2", v)
+	}
+	<-got
+}
@@ -4,6 +4,11 @@
 
 package sync
 
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
 // Export for testing.
 var Runtime_Semacquire = runtime_Semacquire
 var Runtime_Semrelease = runtime_Semrelease
@@ -55,3 +60,76 @@ func (c *poolChain) PopHead() (interface{}, bool) {
 func (c *poolChain) PopTail() (interface{}, bool) {
 	return c.popTail()
 }
+
+// Length of a Pool's PutAsync queue.
+const PoolAsyncQueue = poolAsyncQueue
+
+// Chaos mode decisions.
+var ChaosNext = chaosNext
+
+// Mutex state, for clock tests.
+func MutexWaiters(m *Mutex) int {
+	return int(atomic.LoadInt32(&m.state) >> mutexWaiterShift)
+}
+
+func MutexStarving(m *Mutex) bool {
+	return atomic.LoadInt32(&m.state)&mutexStarving != 0
+}
+
+// Blocked readers and waiters, for wakeup benchmarks.
+func RWMutexBlockedReaders(rw *RWMutex) int {
+	return int(atomic.LoadInt32(&rw.readerCount) + rwmutexMaxReaders)
+}
+
+func WaitGroupWaiters(wg *WaitGroup) int {
+	statep, _ := wg.state()
+	return int(uint32(atomic.LoadUint64(statep)))
+}
+
+// Map lock, for contention tests.
+func (m *Map) LockForTest()   { m.mu.Lock() }
+func (m *Map) UnlockForTest() { m.mu.Unlock() }
+
+// AmendedForTest reports whether m has keys outside its read map.
+func (m *Map) AmendedForTest() bool {
+	read, _ := m.read.Load().(readOnly)
+	return read.amended
+}
+
+// WorkerPool lock, for tests of tasks submitted as a worker times out.
+func (p *WorkerPool) LockForTest()   { p.mu.Lock() }
+func (p *WorkerPool) UnlockForTest() { p.mu.Unlock() }
+
+func (p *WorkerPool) EnqueueLockedForTest(task func()) error { return p.enqueue(task) }
+func (p *WorkerPool) MutexForTest() *Mutex                   { return &p.mu }
+
+// Internal locks, for tests that Metrics does not take them.
+func (m *Map) MutexForTest() *Mutex       { return &m.mu }
+func (s *Semaphore) MutexForTest() *Mutex { return &s.mu }
+
+// Queue length, for priority tests.
+func SemaphoreWaiters(s *Semaphore) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int(s.waiters)
+}
+
+// Lock labels, for trace region tests.
+func LockRegionName(l Locker, kind LockKind) string {
+	return lockRegionName(lockerPointer(l), kind)
+}
+
+// Lock histories, for debug mode tests.
+const SyncDebug = syncDebug
+
+func LockHistory(l Locker) string {
+	x := interface{}(l)
+	return withLockHistory((*eface)(unsafe.Pointer(&x)).val, "sync: history")
+}
+
+var BitLen = bitLen
+var SortSlice = sortSlice
+
+// Spin budget, for spin tests.
+var SpinBudget = spinBudget
+var RecordSpin = recordSpin
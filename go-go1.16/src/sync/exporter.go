@@ -0,0 +1,72 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A WaitExporter receives the blocked lock acquisitions of the whole
+// program as they happen, to export them to a tracing or telemetry
+// system, such as OpenTelemetry spans, without this package depending
+// on one. Install it with SetWaitExporter.
+//
+// Both methods are called by the goroutine that blocks: OnBlock just
+// before it blocks acquiring a lock of the given kind, and OnWake once
+// it has acquired it, with the same kind, label and start. label is the
+// label of the lock, see SetLockLabel, or "". Times are nanoseconds on
+// the runtime's monotonic clock, so only their differences are
+// meaningful: the wall clock time a wait began is time.Now() less
+// end-start when OnWake is called.
+//
+// The methods run on the slow paths of Mutex and RWMutex, so they should
+// be quick. Blocking acquisitions of locks that they make are exported
+// too, which recurses until such an acquisition does not block.
+type WaitExporter interface {
+	OnBlock(kind LockKind, label string, start int64)
+	OnWake(kind LockKind, label string, start, end int64)
+}
+
+// NopWaitExporter is a WaitExporter that ignores all events. It is the
+// default, and a WaitExporter may embed it to ignore the events it does
+// not handle.
+type NopWaitExporter struct{}
+
+func (NopWaitExporter) OnBlock(kind LockKind, label string, start int64)     {}
+func (NopWaitExporter) OnWake(kind LockKind, label string, start, end int64) {}
+
+// waitExporter is the installed WaitExporter, a *WaitExporter, or nil
+// for the default.
+var waitExporter unsafe.Pointer
+
+// SetWaitExporter installs e to receive blocked lock acquisitions in
+// place of the previous WaitExporter. A nil e restores the default
+// NopWaitExporter. Acquisitions that were blocked when the exporter was
+// replaced may be reported to the new exporter by OnWake only.
+func SetWaitExporter(e WaitExporter) {
+	if _, nop := e.(NopWaitExporter); nop {
+		e = nil
+	}
+	var p unsafe.Pointer
+	if e != nil {
+		p = unsafe.Pointer(&e)
+	}
+	atomic.StorePointer(&waitExporter, p)
+	setLockEvents(lockEventExport, e != nil)
+}
+
+// exportBlock and exportWake report w to the installed WaitExporter.
+func exportBlock(w *lockWait) {
+	if p := atomic.LoadPointer(&waitExporter); p != nil {
+		(*(*WaitExporter)(p)).OnBlock(w.kind, lockLabel(w.lock), w.start)
+	}
+}
+
+func exportWake(w *lockWait, end int64) {
+	if p := atomic.LoadPointer(&waitExporter); p != nil {
+		(*(*WaitExporter)(p)).OnWake(w.kind, lockLabel(w.lock), w.start, end)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"testing"
+)
+
+type waitEvent struct {
+	wake       bool
+	kind       LockKind
+	label      string
+	start, end int64
+}
+
+// recordingExporter records the events of one lock kind.
+type recordingExporter struct {
+	NopWaitExporter
+	kind   LockKind
+	events chan waitEvent
+}
+
+func (e *recordingExporter) OnBlock(kind LockKind, label string, start int64) {
+	if kind == e.kind {
+		e.events <- waitEvent{false, kind, label, start, 0}
+	}
+}
+
+func (e *recordingExporter) OnWake(kind LockKind, label string, start, end int64) {
+	if kind == e.kind {
+		e.events <- waitEvent{true, kind, label, start, end}
+	}
+}
+
+func TestWaitExporter(t *testing.T) {
+	e := &recordingExporter{kind: LockRWMutexRead, events: make(chan waitEvent, 10)}
+	SetWaitExporter(e)
+	defer SetWaitExporter(nil)
+
+	var rw RWMutex
+	SetLockLabel(&rw, "exported")
+	defer SetLockLabel(&rw, "")
+	blockOn(rw.Lock, rw.Unlock, rw.RLock, rw.RUnlock)
+
+	block, wake := <-e.events, <-e.events
+	if block.wake || block.label != "exported" || block.start == 0 {
+		t.Errorf("first event = %+v, want OnBlock for the RWMutex labeled exported", block)
+	}
+	if !wake.wake || wake.label != "exported" || wake.start != block.start || wake.end <= wake.start {
+		t.Errorf("second event = %+v, want OnWake matching %+v", wake, block)
+	}
+
+	SetWaitExporter(NopWaitExporter{})
+	blockOn(rw.Lock, rw.Unlock, rw.RLock, rw.RUnlock)
+	select {
+	case ev := <-e.events:
+		t.Errorf("event after the exporter was replaced: %+v", ev)
+	default:
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A Future holds the result of an operation that completes once,
+// typically in another goroutine: a value and an error.
+// Any number of goroutines may wait for the result.
+//
+// The zero Future is pending and ready for use. A Future must not be
+// copied after first use.
+type Future struct {
+	mu        Mutex
+	done      chan struct{} // closed on completion; nil until needed
+	completed bool
+	v         interface{}
+	err       error
+}
+
+// Complete sets the result of f to v and err and wakes the goroutines
+// waiting for it. Only the first call has an effect: Complete reports
+// whether it was that call, so that racing producers need not
+// coordinate among themselves.
+func (f *Future) Complete(v interface{}, err error) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.completed {
+		return false
+	}
+	f.v, f.err = v, err
+	f.completed = true
+	if f.done == nil {
+		f.done = closedchan
+	} else {
+		close(f.done)
+	}
+	return true
+}
+
+// Done returns a channel that is closed when f completes.
+func (f *Future) Done() <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done == nil {
+		f.done = make(chan struct{})
+	}
+	return f.done
+}
+
+// Get waits for f to complete and returns its result. If ctx is done
+// first, Get returns nil and ctx.Err(). A nil ctx never
+// gives up.
+func (f *Future) Get(ctx Context) (interface{}, error) {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	select {
+	case <-f.Done():
+		// Completion happens before the close of done,
+		// so the result is safe to read.
+		return f.v, f.err
+	case <-cancel:
+		return nil, ctx.Err()
+	}
+}
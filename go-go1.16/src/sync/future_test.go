@@ -0,0 +1,68 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	"errors"
+	. "sync"
+	"testing"
+)
+
+func TestFuture(t *testing.T) {
+	var f Future
+	select {
+	case <-f.Done():
+		t.Fatal("pending Future is done")
+	default:
+	}
+
+	const n = 10
+	results := make(chan interface{})
+	for i := 0; i < n; i++ {
+		go func() {
+			v, err := f.Get(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+			results <- v
+		}()
+	}
+	if !f.Complete(42, nil) {
+		t.Fatal("first Complete reported false")
+	}
+	if f.Complete(43, errors.New("late")) {
+		t.Fatal("second Complete reported true")
+	}
+	for i := 0; i < n; i++ {
+		if v := <-results; v != 42 {
+			t.Fatalf("Get returned %v; want 42", v)
+		}
+	}
+	<-f.Done()
+	if v, err := f.Get(nil); v != 42 || err != nil {
+		t.Fatalf("Get after completion returned %v, %v; want 42, nil", v, err)
+	}
+}
+
+func TestFutureCanceled(t *testing.T) {
+	var f Future
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if v, err := f.Get(ctx); v != nil || err != context.Canceled {
+		t.Fatalf("Get returned %v, %v; want nil, %v", v, err, context.Canceled)
+	}
+
+	// Completing before anyone waits works too.
+	var g Future
+	someErr := errors.New("some error")
+	g.Complete("", someErr)
+	if _, err := g.Get(ctx); err != someErr && err != context.Canceled {
+		t.Fatalf("Get returned %v", err)
+	}
+	if _, err := g.Get(nil); err != someErr {
+		t.Fatalf("Get returned %v; want %v", err, someErr)
+	}
+}
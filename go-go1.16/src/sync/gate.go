@@ -0,0 +1,77 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A Gate lets goroutines through while it is open and holds them back
+// while it is closed, as for pausing and resuming a set of workers.
+// Unlike a Notifier, whose waiters always wait for the next event, a
+// Gate remembers its state: waiting at an open Gate does not block.
+//
+// The zero Gate is open and ready for use. A Gate must not be copied
+// after first use.
+type Gate struct {
+	mu Mutex
+	ch chan struct{} // while closed, a channel Open closes; nil while open
+}
+
+// Open opens g, letting through the goroutines waiting at it and any
+// that arrive while it stays open. Opening an open Gate has no effect.
+func (g *Gate) Open() {
+	g.mu.Lock()
+	if g.ch != nil {
+		close(g.ch)
+		g.ch = nil
+	}
+	g.mu.Unlock()
+}
+
+// Close closes g, so that goroutines arriving at it wait until it is
+// opened again. Closing a closed Gate has no effect.
+func (g *Gate) Close() {
+	g.mu.Lock()
+	if g.ch == nil {
+		g.ch = make(chan struct{})
+	}
+	g.mu.Unlock()
+}
+
+// IsOpen reports whether g is open.
+func (g *Gate) IsOpen() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.ch == nil
+}
+
+// Opened returns a channel that is closed once g is open. If g is open
+// already, the channel is closed already. Selecting on it lets a
+// goroutine wait at g along with other events.
+func (g *Gate) Opened() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ch == nil {
+		return closedchan
+	}
+	return g.ch
+}
+
+// Wait waits until g is open. If ctx is done first, it returns
+// ctx.Err(). A nil ctx never gives up. Since g may be closed again
+// right after opening, g may be closed by the time Wait returns.
+func (g *Gate) Wait(ctx Context) error {
+	opened := g.Opened()
+	if opened == closedchan {
+		return nil
+	}
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	select {
+	case <-opened:
+		return nil
+	case <-cancel:
+		return ctx.Err()
+	}
+}
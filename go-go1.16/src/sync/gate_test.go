@@ -0,0 +1,56 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	. "sync"
+	"testing"
+	"time"
+)
+
+func TestGate(t *testing.T) {
+	var g Gate
+	if !g.IsOpen() {
+		t.Fatal("zero Gate is closed")
+	}
+	if err := g.Wait(nil); err != nil {
+		t.Fatalf("Wait at open Gate returned %v", err)
+	}
+
+	g.Close()
+	g.Close()
+	if g.IsOpen() {
+		t.Fatal("Gate open after Close")
+	}
+	const n = 5
+	passed := make(chan bool)
+	for i := 0; i < n; i++ {
+		go func() {
+			if err := g.Wait(context.Background()); err != nil {
+				t.Error(err)
+			}
+			passed <- true
+		}()
+	}
+	select {
+	case <-passed:
+		t.Fatal("goroutine passed a closed Gate")
+	case <-time.After(10 * time.Millisecond):
+	}
+	g.Open()
+	for i := 0; i < n; i++ {
+		<-passed
+	}
+	<-g.Opened()
+	g.Open()
+
+	g.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.Wait(ctx); err != context.Canceled {
+		t.Fatalf("Wait returned %v; want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A Guarded holds a value that is reached only with its lock held: Do
+// passes the value to a function with the lock held for writing, and
+// RDo with it held for reading. State kept in a Guarded cannot be
+// touched without its lock, as can a field beside a Mutex whose comment
+// says it is guarded.
+//
+// The guarantee extends to what the value points to only as far as the
+// functions passed to Do and RDo keep such pointers to themselves. A
+// value is best a pointer to the guarded struct, changed in place by Do
+// and only read by RDo.
+//
+// The zero Guarded holds nil. A Guarded must not be copied after first
+// use.
+type Guarded struct {
+	mu RWMutex
+	v  interface{}
+}
+
+// NewGuarded returns a new Guarded holding v.
+func NewGuarded(v interface{}) *Guarded {
+	return &Guarded{v: v}
+}
+
+// Do calls f with a pointer to the value of g, with g locked for
+// writing, so that f may change the value or replace it. It unlocks g
+// when f returns or panics. f must not keep the pointer.
+func (g *Guarded) Do(f func(v *interface{})) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	f(&g.v)
+}
+
+// RDo calls f with the value of g, with g locked for reading, so that
+// calls of RDo run concurrently with each other but not with Do. It
+// unlocks g when f returns or panics. f must not change what the value
+// points to.
+func (g *Guarded) RDo(f func(v interface{})) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	f(g.v)
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A HazardDomain is a domain for reclamation by hazard pointers. Like an
+// Epoch, it tells the writer of a lock-free data structure when no reader
+// can still be using a node it has unlinked. Where an Epoch holds back
+// every deferred function while any reader is pinned, a hazard pointer
+// holds back only the one node it protects, so readers that keep hold of
+// nodes for a long time do not stall reclamation of the others.
+//
+// A reader loads a shared pointer with Acquire, which protects the node
+// it returns until the HazardPointer is released. A writer that unlinks a
+// node passes it to Retire with a function that frees it, and the domain
+// runs that function once no HazardPointer protects the node.
+//
+// As with Epoch, the garbage collector already makes lock-free structures
+// in Go memory safe, and Stack in this package does not need hazard
+// pointers. A HazardDomain is for recycling nodes, such as through a
+// Stack used as a free list, and for releasing resources the collector
+// does not manage.
+//
+// The zero HazardDomain is ready for use. A HazardDomain must not be
+// copied after first use.
+type HazardDomain struct {
+	noCopy noCopy
+
+	free Stack // released *HazardPointers, for reuse
+
+	mu      Mutex
+	hazards []*HazardPointer // every hazard pointer ever created
+	retired []hazardRetired
+}
+
+// A HazardPointer protects one node from reclamation. It is returned by
+// HazardDomain.Acquire and must be released with Release.
+type HazardPointer struct {
+	d    *HazardDomain
+	p    unsafe.Pointer // the protected node
+	held uint32
+}
+
+type hazardRetired struct {
+	p    unsafe.Pointer
+	free func()
+}
+
+// hazardScanEvery is the least number of retired nodes a HazardDomain
+// collects before it scans the hazard pointers. It scans no more often
+// than every two retirements per hazard pointer, so scans are amortized.
+const hazardScanEvery = 64
+
+// Acquire atomically loads the pointer at *src and returns it along with
+// a HazardPointer that protects the node it points to from reclamation
+// until it is released. The node may be unlinked meanwhile, but a free
+// function retired for it does not run before Release.
+func (d *HazardDomain) Acquire(src *unsafe.Pointer) (unsafe.Pointer, *HazardPointer) {
+	x, _ := d.free.Pop()
+	h, _ := x.(*HazardPointer)
+	if h == nil {
+		h = &HazardPointer{d: d}
+		d.mu.Lock()
+		d.hazards = append(d.hazards, h)
+		d.mu.Unlock()
+	}
+	atomic.StoreUint32(&h.held, 1)
+	for {
+		p := atomic.LoadPointer(src)
+		atomic.StorePointer(&h.p, p)
+		// If *src still holds p, p was linked when the hazard became
+		// visible, so a writer that unlinks it later will see it.
+		if atomic.LoadPointer(src) == p {
+			return p, h
+		}
+	}
+}
+
+// Release ends the protection of h. It panics if h is already released.
+func (h *HazardPointer) Release() {
+	if atomic.SwapUint32(&h.held, 0) == 0 {
+		panic("sync: Release of released HazardPointer")
+	}
+	atomic.StorePointer(&h.p, nil)
+	h.d.free.Push(h)
+}
+
+// Retire arranges for free to be called once no HazardPointer in d
+// protects p. The caller must already have unlinked p, so that no later
+// Acquire can return it. Free functions run on the goroutine that scans
+// the hazard pointers, in a later call to Retire or Reclaim.
+func (d *HazardDomain) Retire(p unsafe.Pointer, free func()) {
+	d.mu.Lock()
+	d.retired = append(d.retired, hazardRetired{p, free})
+	scan := len(d.retired) >= hazardScanEvery && len(d.retired) >= 2*len(d.hazards)
+	d.mu.Unlock()
+	if scan {
+		d.Reclaim()
+	}
+}
+
+// Reclaim runs the free function of every retired node that no
+// HazardPointer protects. Free functions also run without calls to
+// Reclaim, as Retire is called; Reclaim is for when the caller wants them
+// to run promptly.
+func (d *HazardDomain) Reclaim() {
+	d.mu.Lock()
+	retired := d.retired
+	d.retired = nil
+	hazards := d.hazards
+	d.mu.Unlock()
+	if len(retired) == 0 {
+		return
+	}
+
+	protected := make(map[unsafe.Pointer]bool, len(hazards))
+	for _, h := range hazards {
+		if p := atomic.LoadPointer(&h.p); p != nil {
+			protected[p] = true
+		}
+	}
+	var keep []hazardRetired
+	var frees []func()
+	for _, r := range retired {
+		if protected[r.p] {
+			keep = append(keep, r)
+		} else {
+			frees = append(frees, r.free)
+		}
+	}
+	if len(keep) > 0 {
+		d.mu.Lock()
+		d.retired = append(d.retired, keep...)
+		d.mu.Unlock()
+	}
+	for _, f := range frees {
+		f()
+	}
+}
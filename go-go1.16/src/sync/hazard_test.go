@@ -0,0 +1,105 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	. "sync"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+)
+
+func TestHazardPointer(t *testing.T) {
+	var d HazardDomain
+	a, b := new(int), new(int)
+	src := unsafe.Pointer(a)
+	p, h := d.Acquire(&src)
+	if p != unsafe.Pointer(a) {
+		t.Fatal("Acquire returned the wrong pointer")
+	}
+	src = unsafe.Pointer(b)
+	var freedA, freedB bool
+	d.Retire(unsafe.Pointer(a), func() { freedA = true })
+	d.Retire(unsafe.Pointer(b), func() { freedB = true })
+	d.Reclaim()
+	if freedA {
+		t.Fatal("protected node was freed")
+	}
+	if !freedB {
+		t.Fatal("unprotected node was not freed")
+	}
+	h.Release()
+	d.Reclaim()
+	if !freedA {
+		t.Fatal("node was not freed after Release")
+	}
+}
+
+func TestHazardPointerReleaseTwice(t *testing.T) {
+	var d HazardDomain
+	var src unsafe.Pointer
+	_, h := d.Acquire(&src)
+	h.Release()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("second Release did not panic")
+		}
+	}()
+	h.Release()
+}
+
+type hazardNode struct {
+	freed uint32
+}
+
+// TestHazardPointerRecycle recycles nodes through a Stack used as a free
+// list and checks that readers never see a node that has been freed while
+// they hold a hazard pointer to it.
+func TestHazardPointerRecycle(t *testing.T) {
+	var d HazardDomain
+	var free Stack
+	cur := unsafe.Pointer(new(hazardNode))
+	N := 10000
+	if testing.Short() {
+		N = 1000
+	}
+	done := make(chan bool)
+	for r := 0; r < runtime.GOMAXPROCS(0)+1; r++ {
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				p, h := d.Acquire(&cur)
+				n := (*hazardNode)(p)
+				for i := 0; i < 2; i++ {
+					if atomic.LoadUint32(&n.freed) != 0 {
+						panic("node freed while protected")
+					}
+					runtime.Gosched()
+				}
+				h.Release()
+			}
+		}()
+	}
+	for i := 0; i < N; i++ {
+		x, _ := free.Pop()
+		n, _ := x.(*hazardNode)
+		if n == nil {
+			n = new(hazardNode)
+		}
+		atomic.StoreUint32(&n.freed, 0)
+		old := atomic.SwapPointer(&cur, unsafe.Pointer(n))
+		d.Retire(old, func() {
+			n := (*hazardNode)(old)
+			atomic.StoreUint32(&n.freed, 1)
+			free.Push(n)
+		})
+	}
+	close(done)
+}
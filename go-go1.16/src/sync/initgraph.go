@@ -0,0 +1,181 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// An InitGraph runs named initializers that depend on each other, such
+// as the setup of a program's clients, caches and servers, in place of
+// chains of Once values whose order is kept only by convention. Each
+// initializer declares the initializers it depends on, and Run runs it
+// after them, concurrently with the initializers it does not depend on.
+//
+// Each initializer runs at most once, as with Once: later calls of Run
+// wait for it, or return its result. An initializer that fails keeps
+// the initializers that depend on it from running; their error is an
+// *InitError that wraps the failure.
+//
+// The zero InitGraph is empty and ready for use. An InitGraph must not
+// be copied after first use.
+type InitGraph struct {
+	mu    Mutex
+	nodes map[string]*initNode
+	names []string // in order of Add
+}
+
+type initNode struct {
+	name    string
+	deps    []string
+	f       func(ctx Context) error
+	started bool   // guarded by InitGraph.mu
+	result  Future // completed with the error of the initializer
+}
+
+// An InitError reports an initializer that failed or did not run.
+type InitError struct {
+	Name string // the initializer
+	Err  error  // its error, or the *InitError of a dependency that failed
+}
+
+func (e *InitError) Error() string {
+	if _, ok := e.Err.(*InitError); ok {
+		return "sync: initializer " + e.Name + " not run: " + e.Err.Error()
+	}
+	return "sync: initializer " + e.Name + ": " + e.Err.Error()
+}
+
+func (e *InitError) Unwrap() error { return e.Err }
+
+// Add adds an initializer named name that runs f after the initializers
+// named in deps. The dependencies need not have been added yet, but
+// must be by the time Run needs them. Add panics if name has already
+// been added.
+func (g *InitGraph) Add(name string, deps []string, f func(ctx Context) error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, dup := g.nodes[name]; dup {
+		panic("sync: InitGraph.Add called twice for " + name)
+	}
+	if g.nodes == nil {
+		g.nodes = make(map[string]*initNode)
+	}
+	g.nodes[name] = &initNode{name: name, deps: append([]string(nil), deps...), f: f}
+	g.names = append(g.names, name)
+}
+
+// Run runs the initializers named in names, or all of them if names is
+// empty, together with the initializers they depend on, and waits for
+// them. Initializers that have already run are not run again, and
+// those that another call of Run has started are waited for. An
+// initializer started by this call is passed ctx.
+//
+// Run returns the error of the first of names, in order, whose
+// initializer failed or did not run, or ctx.Err() if ctx is done
+// first; the initializers go on running then. Before running anything,
+// Run checks that every dependency has been added and that no
+// initializer depends on itself, directly or not, and returns an error
+// if not. A nil ctx never gives up.
+func (g *InitGraph) Run(ctx Context, names ...string) error {
+	g.mu.Lock()
+	if len(names) == 0 {
+		names = append([]string(nil), g.names...)
+	}
+	targets := make([]*initNode, len(names))
+	for i, name := range names {
+		if targets[i] = g.nodes[name]; targets[i] == nil {
+			g.mu.Unlock()
+			return syncError("sync: InitGraph has no initializer " + name)
+		}
+	}
+	if err := g.checkLocked(targets); err != nil {
+		g.mu.Unlock()
+		return err
+	}
+	for _, n := range targets {
+		g.startLocked(ctx, n)
+	}
+	g.mu.Unlock()
+
+	for _, n := range targets {
+		if _, err := n.result.Get(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLocked checks that the initializers that targets depend on have
+// all been added and that their dependencies have no cycle. g.mu must
+// be held.
+func (g *InitGraph) checkLocked(targets []*initNode) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[*initNode]int)
+	var path []string
+	var visit func(n *initNode) error
+	visit = func(n *initNode) error {
+		switch state[n] {
+		case visiting:
+			i := len(path) - 1
+			for path[i] != n.name {
+				i--
+			}
+			cycle := ""
+			for _, name := range path[i:] {
+				cycle += name + " -> "
+			}
+			return syncError("sync: InitGraph has a dependency cycle: " + cycle + n.name)
+		case visited:
+			return nil
+		}
+		state[n] = visiting
+		path = append(path, n.name)
+		for _, dep := range n.deps {
+			d := g.nodes[dep]
+			if d == nil {
+				return syncError("sync: initializer " + n.name + " depends on unknown " + dep)
+			}
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[n] = visited
+		return nil
+	}
+	for _, n := range targets {
+		if err := visit(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startLocked starts n and its dependencies, if they have not been
+// started. g.mu must be held.
+func (g *InitGraph) startLocked(ctx Context, n *initNode) {
+	if n.started {
+		return
+	}
+	n.started = true
+	deps := make([]*initNode, len(n.deps))
+	for i, dep := range n.deps {
+		deps[i] = g.nodes[dep]
+		g.startLocked(ctx, deps[i])
+	}
+	go func() {
+		for _, d := range deps {
+			if _, err := d.result.Get(nil); err != nil {
+				n.result.Complete(nil, &InitError{n.name, err})
+				return
+			}
+		}
+		if err := n.f(ctx); err != nil {
+			n.result.Complete(nil, &InitError{n.name, err})
+			return
+		}
+		n.result.Complete(nil, nil)
+	}()
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	. "sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestInitGraphOrder(t *testing.T) {
+	var g InitGraph
+	var mu Mutex
+	done := make(map[string]bool)
+	var runs int32
+	step := func(name string, deps ...string) {
+		g.Add(name, deps, func(Context) error {
+			atomic.AddInt32(&runs, 1)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, dep := range deps {
+				if !done[dep] {
+					t.Errorf("%s ran before its dependency %s", name, dep)
+				}
+			}
+			done[name] = true
+			return nil
+		})
+	}
+	step("server", "cache", "db")
+	step("cache", "config")
+	step("db", "config")
+	step("config")
+
+	if err := g.Run(context.Background(), "cache"); err != nil {
+		t.Fatalf("Run(cache) = %v", err)
+	}
+	if n := atomic.LoadInt32(&runs); n != 2 {
+		t.Fatalf("Run(cache) ran %d initializers; want 2", n)
+	}
+	if err := g.Run(nil); err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	if n := atomic.LoadInt32(&runs); n != 4 {
+		t.Fatalf("initializers ran %d times; want 4", n)
+	}
+}
+
+func TestInitGraphError(t *testing.T) {
+	var g InitGraph
+	errDial := errors.New("dial failed")
+	var calls int32
+	g.Add("db", nil, func(Context) error {
+		atomic.AddInt32(&calls, 1)
+		return errDial
+	})
+	g.Add("server", []string{"db"}, func(Context) error {
+		t.Error("server ran after db failed")
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		err := g.Run(nil, "server")
+		var ie *InitError
+		if !errors.As(err, &ie) || ie.Name != "server" {
+			t.Fatalf("Run = %v; want *InitError for server", err)
+		}
+		if !errors.Is(err, errDial) {
+			t.Fatalf("Run = %v; want it to wrap %v", err, errDial)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("db ran %d times; want 1", n)
+	}
+}
+
+func TestInitGraphInvalid(t *testing.T) {
+	var g InitGraph
+	g.Add("a", []string{"b"}, func(Context) error { return nil })
+	g.Add("b", []string{"c"}, func(Context) error { return nil })
+	g.Add("c", []string{"a"}, func(Context) error { return nil })
+	g.Add("d", []string{"missing"}, func(Context) error { return nil })
+
+	if err := g.Run(nil, "a"); err == nil || !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Errorf("Run(a) = %v; want a cycle error", err)
+	}
+	if err := g.Run(nil, "d"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Run(d) = %v; want an unknown dependency error", err)
+	}
+	if err := g.Run(nil, "e"); err == nil {
+		t.Errorf("Run(e) = nil; want an error")
+	}
+}
+
+func TestInitGraphContext(t *testing.T) {
+	var g InitGraph
+	release := make(chan struct{})
+	g.Add("slow", nil, func(Context) error {
+		<-release
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.Run(ctx); err != context.Canceled {
+		t.Fatalf("Run with canceled context = %v; want %v", err, context.Canceled)
+	}
+	close(release)
+	if err := g.Run(nil); err != nil {
+		t.Fatalf("Run = %v", err)
+	}
+}
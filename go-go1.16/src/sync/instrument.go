@@ -0,0 +1,79 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// InstrumentLocker returns a Locker that locks and unlocks l, timing how
+// long each Lock waits for l and how long l is then held, and publishes
+// the timings as the metrics of a primitive "Locker" named name, as
+// RegisterMetrics does for the primitives of this package. It panics if
+// name is already registered. The metrics are:
+//
+//    held      callers holding l
+//    waiters   callers waiting in Lock
+//    acquires  calls of Lock that acquired l
+//    wait_ns   nanoseconds spent waiting in Lock
+//    hold_ns   nanoseconds l was held, up to its last release
+//
+// Unlike the waits of a registered Mutex, acquires and wait_ns include
+// the acquisitions that did not block, which InstrumentLocker cannot
+// tell apart. l may be any Locker, including those of other packages and
+// those that more than one caller can hold at once, such as the Locker
+// returned by RWMutex.RLocker; for those, hold_ns counts the time l was
+// held by at least one caller. Only the locking done through the
+// returned Locker is measured. UnregisterMetrics with name stops
+// publishing the metrics; the returned Locker goes on working.
+func InstrumentLocker(l Locker, name string) Locker {
+	il := &instrumentedLocker{l: l}
+	registerMetricSource(name, il)
+	return il
+}
+
+type instrumentedLocker struct {
+	l Locker
+
+	held      int64
+	waiters   int64
+	acquires  int64
+	waitNs    int64
+	holdNs    int64 // total of the periods l was held that have ended
+	heldSince int64 // nanotime when l was last acquired with held at 0
+}
+
+func (il *instrumentedLocker) Lock() {
+	atomic.AddInt64(&il.waiters, 1)
+	start := nanotime()
+	il.l.Lock()
+	now := nanotime()
+	atomic.AddInt64(&il.waiters, -1)
+	atomic.AddInt64(&il.acquires, 1)
+	atomic.AddInt64(&il.waitNs, now-start)
+	if atomic.AddInt64(&il.held, 1) == 1 {
+		atomic.StoreInt64(&il.heldSince, now)
+	}
+}
+
+func (il *instrumentedLocker) Unlock() {
+	// heldSince is set when held goes from 0 to 1, which it cannot do
+	// again before this caller releases its hold. (With several holders,
+	// this caller may still read the previous setting if the first
+	// holder has not set it yet; hold_ns then counts a little extra.)
+	since := atomic.LoadInt64(&il.heldSince)
+	if atomic.AddInt64(&il.held, -1) == 0 {
+		atomic.AddInt64(&il.holdNs, nanotime()-since)
+	}
+	il.l.Unlock()
+}
+
+func (*instrumentedLocker) primitive() string { return "Locker" }
+
+func (il *instrumentedLocker) metrics(emit func(name string, counter bool, v int64)) {
+	emit("held", false, atomic.LoadInt64(&il.held))
+	emit("waiters", false, atomic.LoadInt64(&il.waiters))
+	emit("acquires", true, atomic.LoadInt64(&il.acquires))
+	emit("wait_ns", true, atomic.LoadInt64(&il.waitNs))
+	emit("hold_ns", true, atomic.LoadInt64(&il.holdNs))
+}
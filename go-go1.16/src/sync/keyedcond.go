@@ -0,0 +1,132 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// KeyedCond is a set of condition variables indexed by key, for waiting
+// on events about one of many objects, such as "object X is ready".
+// It behaves as a Cond per key that exists only while goroutines are
+// waiting on it, so it costs nothing for keys no one is waiting for.
+//
+// As with Cond, the associated Locker L must be held when changing the
+// condition for a key and when calling Wait or WaitContext. Keys must be
+// comparable, as for map keys.
+//
+// A KeyedCond must not be copied after first use.
+type KeyedCond struct {
+	noCopy noCopy
+
+	// L is held while observing or changing the conditions.
+	L Locker
+
+	mu      Mutex
+	waiters map[interface{}][]chan struct{} // in order of arrival
+}
+
+// NewKeyedCond returns a new KeyedCond with Locker l.
+func NewKeyedCond(l Locker) *KeyedCond {
+	return &KeyedCond{L: l}
+}
+
+// Wait atomically unlocks c.L and suspends execution of the calling
+// goroutine until Signal or Broadcast is called for key. It locks c.L
+// before returning. As with Cond.Wait, the caller should Wait in a loop
+// that rechecks the condition.
+func (c *KeyedCond) Wait(key interface{}) {
+	ch := c.add(key)
+	c.L.Unlock()
+	<-ch
+	c.L.Lock()
+}
+
+// WaitContext is like Wait, but gives up waiting if ctx is done first,
+// in which case it returns ctx.Err(). Either way, it locks c.L before
+// returning. A Signal is never lost to a waiter that gives up: if one
+// arrives as ctx is done, WaitContext returns nil. A nil ctx never gives
+// up.
+func (c *KeyedCond) WaitContext(ctx Context, key interface{}) error {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	ch := c.add(key)
+	c.L.Unlock()
+	defer c.L.Lock()
+	select {
+	case <-ch:
+		return nil
+	case <-cancel:
+	}
+	if c.remove(key, ch) {
+		return ctx.Err()
+	}
+	return nil // woken as ctx was done
+}
+
+// Signal wakes the goroutine that has waited longest for key, if any.
+// It is allowed but not required for the caller to hold c.L during the
+// call.
+func (c *KeyedCond) Signal(key interface{}) {
+	c.mu.Lock()
+	if ws := c.waiters[key]; len(ws) > 0 {
+		close(ws[0])
+		ws[0] = nil
+		if len(ws) == 1 {
+			delete(c.waiters, key)
+		} else {
+			c.waiters[key] = ws[1:]
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Broadcast wakes all goroutines waiting for key. It is allowed but not
+// required for the caller to hold c.L during the call.
+func (c *KeyedCond) Broadcast(key interface{}) {
+	c.mu.Lock()
+	ws := c.waiters[key]
+	delete(c.waiters, key)
+	c.mu.Unlock()
+	for _, ch := range ws {
+		close(ch)
+	}
+}
+
+// Len returns the number of keys with waiting goroutines.
+func (c *KeyedCond) Len() int {
+	c.mu.Lock()
+	n := len(c.waiters)
+	c.mu.Unlock()
+	return n
+}
+
+func (c *KeyedCond) add(key interface{}) chan struct{} {
+	ch := make(chan struct{})
+	c.mu.Lock()
+	if c.waiters == nil {
+		c.waiters = make(map[interface{}][]chan struct{})
+	}
+	c.waiters[key] = append(c.waiters[key], ch)
+	c.mu.Unlock()
+	return ch
+}
+
+// remove removes ch from the waiters for key and reports whether it was
+// still there, that is, whether it had not yet been woken.
+func (c *KeyedCond) remove(key interface{}, ch chan struct{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ws := c.waiters[key]
+	for i, w := range ws {
+		if w == ch {
+			if len(ws) == 1 {
+				delete(c.waiters, key)
+			} else {
+				c.waiters[key] = append(ws[:i:i], ws[i+1:]...)
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	. "sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedCond(t *testing.T) {
+	var m Mutex
+	c := NewKeyedCond(&m)
+	ready := make(map[int]bool)
+	const N = 10
+	done := make(chan int)
+	for i := 0; i < N; i++ {
+		go func(i int) {
+			key := i % 2
+			m.Lock()
+			for !ready[key] {
+				c.Wait(key)
+			}
+			m.Unlock()
+			done <- key
+		}(i)
+	}
+	// Wait for all goroutines to be waiting.
+	for {
+		m.Lock()
+		n := c.Len()
+		m.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	m.Lock()
+	ready[0] = true
+	m.Unlock()
+	c.Broadcast(0)
+	for i := 0; i < N/2; i++ {
+		if key := <-done; key != 0 {
+			t.Fatalf("goroutine waiting for key %d woke", key)
+		}
+	}
+
+	m.Lock()
+	ready[1] = true
+	m.Unlock()
+	for i := 0; i < N/2; i++ {
+		c.Signal(1)
+		if key := <-done; key != 1 {
+			t.Fatalf("goroutine waiting for key %d woke", key)
+		}
+	}
+	if n := c.Len(); n != 0 {
+		t.Fatalf("Len() = %d after all waiters woke; want 0", n)
+	}
+}
+
+func TestKeyedCondWaitContext(t *testing.T) {
+	var m Mutex
+	c := NewKeyedCond(&m)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	m.Lock()
+	if err := c.WaitContext(ctx, "k"); err != context.DeadlineExceeded {
+		t.Fatalf("WaitContext() = %v; want %v", err, context.DeadlineExceeded)
+	}
+	m.Unlock()
+	if n := c.Len(); n != 0 {
+		t.Fatalf("Len() = %d after WaitContext gave up; want 0", n)
+	}
+
+	done := make(chan error)
+	go func() {
+		m.Lock()
+		done <- c.WaitContext(nil, "k")
+		m.Unlock()
+	}()
+	for c.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Signal("k")
+	if err := <-done; err != nil {
+		t.Fatalf("WaitContext() = %v; want nil", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A KeyedSemaphore is a set of weighted semaphores indexed by key, for
+// limits that apply per key, such as on the requests in flight for each
+// tenant or to each host. Each key has its own capacity, given by a
+// function of the key, and behaves as a Semaphore of that size that
+// exists only while some of its weight is held or waited for: a key
+// that falls idle is forgotten, so a KeyedSemaphore costs nothing for
+// keys not in use. Keys must be comparable, as for map keys.
+//
+// A KeyedSemaphore must be created with NewKeyedSemaphore and must not
+// be copied after first use.
+type KeyedSemaphore struct {
+	capacity func(key interface{}) int64
+
+	mu   Mutex
+	sems map[interface{}]*keyedSema
+}
+
+type keyedSema struct {
+	sem  *Semaphore
+	refs int64 // weight held or waited for
+}
+
+// NewKeyedSemaphore returns a new KeyedSemaphore in which each key has a
+// total weight of capacity(key). capacity is called, with no lock held,
+// when a key that is not in use is first acquired; a key that falls idle
+// and is acquired again gets its capacity anew, so changes to the
+// capacities take effect once keys fall idle.
+func NewKeyedSemaphore(capacity func(key interface{}) int64) *KeyedSemaphore {
+	return &KeyedSemaphore{
+		capacity: capacity,
+		sems:     make(map[interface{}]*keyedSema),
+	}
+}
+
+// Acquire acquires the semaphore of key with a weight of n, blocking
+// until resources are available or ctx is done, as Semaphore.Acquire
+// does. On failure, it returns ctx.Err() and leaves the semaphore of
+// key unchanged.
+func (s *KeyedSemaphore) Acquire(ctx Context, key interface{}, n int64) error {
+	ks := s.ref(key, n)
+	if err := ks.sem.Acquire(ctx, n); err != nil {
+		s.unref(key, ks, n)
+		return err
+	}
+	return nil
+}
+
+// TryAcquire acquires the semaphore of key with a weight of n without
+// blocking. It reports whether it succeeded; on failure, it leaves the
+// semaphore of key unchanged.
+func (s *KeyedSemaphore) TryAcquire(key interface{}, n int64) bool {
+	ks := s.ref(key, n)
+	if !ks.sem.TryAcquire(n) {
+		s.unref(key, ks, n)
+		return false
+	}
+	return true
+}
+
+// Release releases the semaphore of key with a weight of n. It panics
+// if less than n of the weight of key is held.
+func (s *KeyedSemaphore) Release(key interface{}, n int64) {
+	s.mu.Lock()
+	ks := s.sems[key]
+	s.mu.Unlock()
+	if ks == nil {
+		panic("sync: KeyedSemaphore released more than held")
+	}
+	ks.sem.Release(n)
+	s.unref(key, ks, n)
+}
+
+// Len returns the number of keys in use: those of which some weight is
+// held or waited for.
+func (s *KeyedSemaphore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sems)
+}
+
+// ref returns the semaphore of key, making it if key is idle, and adds
+// n to the weight it is referenced for.
+func (s *KeyedSemaphore) ref(key interface{}, n int64) *keyedSema {
+	s.mu.Lock()
+	ks := s.sems[key]
+	if ks == nil {
+		s.mu.Unlock()
+		size := s.capacity(key)
+		s.mu.Lock()
+		// Another goroutine may have made it meanwhile.
+		if ks = s.sems[key]; ks == nil {
+			ks = &keyedSema{sem: NewSemaphore(size)}
+			s.sems[key] = ks
+		}
+	}
+	ks.refs += n
+	s.mu.Unlock()
+	return ks
+}
+
+// unref subtracts n from the weight ks, the semaphore of key, is
+// referenced for, and forgets it once that drops to zero.
+func (s *KeyedSemaphore) unref(key interface{}, ks *keyedSema, n int64) {
+	s.mu.Lock()
+	if ks.refs -= n; ks.refs <= 0 {
+		delete(s.sems, key)
+	}
+	s.mu.Unlock()
+}
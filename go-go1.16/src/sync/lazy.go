@@ -0,0 +1,70 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+)
+
+// Lazy holds a value that is computed by New on first use.
+// After the first call to Get returns, later calls cost a single
+// atomic load.
+//
+// The zero Lazy is usable once New is set:
+//
+//	var config = sync.Lazy{New: func() interface{} { return loadConfig() }}
+//
+//	cfg := config.Get().(*Config)
+//
+// A Lazy must not be copied after first use.
+type Lazy struct {
+	// done is 0 before New has run, lazyDone after it has returned and
+	// lazyPanicked if it panicked. It is first in the struct for the same
+	// reason as Once.done.
+	done uint32
+	m    Mutex
+	v    interface{}
+	p    interface{} // value New panicked with
+
+	// New specifies the function that computes the value.
+	// It may not be changed concurrently with calls to Get.
+	New func() interface{}
+}
+
+const (
+	lazyDone = 1 + iota
+	lazyPanicked
+)
+
+// Get returns the value of l, calling l.New to compute it if this is the
+// first call to Get. Concurrent callers block until the one call to New
+// returns. If New panics, Get panics with the same value, and so does
+// every later call to Get.
+func (l *Lazy) Get() interface{} {
+	if atomic.LoadUint32(&l.done) != lazyDone {
+		// Outlined slow-path to allow inlining of the fast-path.
+		l.getSlow()
+	}
+	return l.v
+}
+
+func (l *Lazy) getSlow() {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.done == 0 {
+		func() {
+			defer func() {
+				if l.p = recover(); l.p != nil {
+					atomic.StoreUint32(&l.done, lazyPanicked)
+				}
+			}()
+			l.v = l.New()
+			atomic.StoreUint32(&l.done, lazyDone)
+		}()
+	}
+	if l.done == lazyPanicked {
+		panic(l.p)
+	}
+}
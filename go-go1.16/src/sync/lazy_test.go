@@ -0,0 +1,63 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"testing"
+)
+
+func TestLazy(t *testing.T) {
+	calls := 0
+	l := Lazy{New: func() interface{} {
+		calls++
+		v := 42
+		return &v
+	}}
+	const N = 10
+	c := make(chan *int)
+	for i := 0; i < N; i++ {
+		go func() { c <- l.Get().(*int) }()
+	}
+	first := <-c
+	for i := 1; i < N; i++ {
+		if p := <-c; p != first {
+			t.Fatalf("Get returned different pointers %p and %p", first, p)
+		}
+	}
+	if *first != 42 || calls != 1 {
+		t.Errorf("got %d after %d calls; want 42 after 1 call", *first, calls)
+	}
+}
+
+func TestLazyPanic(t *testing.T) {
+	calls := 0
+	l := Lazy{New: func() interface{} {
+		calls++
+		panic("failed")
+	}}
+	for i := 0; i < 2; i++ {
+		func() {
+			defer func() {
+				if r := recover(); r != "failed" {
+					t.Fatalf("Get %d: recovered %v; want failed", i, r)
+				}
+			}()
+			l.Get()
+		}()
+	}
+	if calls != 1 {
+		t.Errorf("New called %d times; want 1", calls)
+	}
+}
+
+func BenchmarkLazy(b *testing.B) {
+	l := Lazy{New: func() interface{} { return 1 }}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Get()
+		}
+	})
+}
@@ -0,0 +1,204 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// A LeakedWaiter describes a goroutine blocked on a lock, WaitGroup or
+// Semaphore that will probably never be released. See FindLeakedWaiters.
+type LeakedWaiter struct {
+	Goroutine int64    // ID of the blocked goroutine
+	Lock      uintptr  // address of the lock, WaitGroup or Semaphore
+	Kind      LockKind // kind of wait
+	Label     string   // label of the lock, see SetLockLabel
+	Waited    int64    // nanoseconds blocked so far
+	Holder    int64    // goroutine that holds the lock, or one that held the WaitGroup or Semaphore
+
+	// HolderExited is set if Holder has exited. Otherwise Holder is
+	// blocked in turn, and Cycle has the goroutines, Holder first, that
+	// wait for each other's locks in a circle that includes Holder and
+	// may include Goroutine.
+	HolderExited bool
+	Cycle        []int64
+}
+
+// FindLeakedWaiters returns the goroutines blocked in this package that
+// will probably stay blocked forever, which in a long-running service
+// leak the goroutines and everything they refer to. It works only in
+// debug mode, when the package is built with the syncdebug build tag,
+// since only then does the package record who holds what; in other
+// builds it always returns nil.
+//
+// A goroutine blocked locking a Mutex or RWMutex is reported if the
+// goroutine that holds the lock has exited without unlocking it, or if
+// it waits, possibly through a chain of other blocked holders, for a set
+// of goroutines that wait for each other's locks: a deadlock. Which
+// goroutine holds a lock is known as far as the lock's recent history
+// tells.
+//
+// A goroutine blocked in WaitGroup.Wait is reported if every goroutine
+// that has added to the counter since it was last zero has exited, and
+// one blocked in Semaphore.Acquire if every goroutine holding weight of
+// the semaphore has exited. Since Done and Release may be called by any
+// goroutine, a WaitGroup whose goroutines were added for by a goroutine
+// that is still running, typically the waiter itself, is never
+// reported.
+//
+// Since a locked Mutex may be unlocked by any goroutine, and since the
+// waiters and holders are observed while they run, the findings are
+// probable rather than certain; a leak that persists across calls is
+// real.
+//
+// FindLeakedWaiters lists all goroutines, which stops the world, so it
+// should be called sparingly, such as from a debug endpoint.
+func FindLeakedWaiters() []LeakedWaiter {
+	if !syncDebug {
+		return nil
+	}
+	var ws []lockWait
+	for i := range waiters {
+		s := &waiters[i]
+		s.acquire()
+		for _, lw := range s.m {
+			ws = append(ws, lw)
+		}
+		s.release()
+	}
+	if len(ws) == 0 {
+		return nil
+	}
+	blocked := make(map[int64]*lockWait, len(ws))
+	for i := range ws {
+		blocked[ws[i].goid] = &ws[i]
+	}
+	holders := make(map[unsafe.Pointer]int64)
+	holder := func(lock unsafe.Pointer) int64 {
+		g, ok := holders[lock]
+		if !ok {
+			g, _ = lockHolder(lock)
+			holders[lock] = g
+		}
+		return g
+	}
+	live := liveGoroutines()
+
+	now := nanotime()
+	var leaks []LeakedWaiter
+	for i := range ws {
+		lw := &ws[i]
+		if lw.kind == LockWaitGroup || lw.kind == LockSemaphore {
+			if h, ok := exitedHolders(lw.lock, live); ok {
+				leaks = append(leaks, LeakedWaiter{
+					Goroutine:    lw.goid,
+					Lock:         uintptr(lw.lock),
+					Kind:         lw.kind,
+					Label:        lockLabel(lw.lock),
+					Waited:       now - lw.start,
+					Holder:       h,
+					HolderExited: true,
+				})
+			}
+			continue
+		}
+		h := holder(lw.lock)
+		if h == 0 {
+			continue
+		}
+		leak := LeakedWaiter{
+			Goroutine: lw.goid,
+			Lock:      uintptr(lw.lock),
+			Kind:      lw.kind,
+			Label:     lockLabel(lw.lock),
+			Waited:    now - lw.start,
+			Holder:    h,
+		}
+		if !live[h] {
+			leak.HolderExited = true
+			leaks = append(leaks, leak)
+			continue
+		}
+		// Follow the chain of blocked holders from h. It ends at a
+		// goroutine that is running or whose holder is unknown,
+		// or it runs into a cycle.
+		seen := map[int64]int{}
+		var chain []int64
+		for g := h; g != 0; {
+			if i, ok := seen[g]; ok {
+				leak.Cycle = chain[i:]
+				break
+			}
+			seen[g] = len(chain)
+			chain = append(chain, g)
+			next, ok := blocked[g]
+			if !ok {
+				break
+			}
+			g = holder(next.lock)
+		}
+		if leak.Cycle != nil {
+			// Start the cycle at Holder if Holder is on it.
+			for i, g := range leak.Cycle {
+				if g == h {
+					leak.Cycle = append(leak.Cycle[i:len(leak.Cycle):len(leak.Cycle)], leak.Cycle[:i]...)
+					break
+				}
+			}
+			leaks = append(leaks, leak)
+		}
+	}
+	sortSlice(len(leaks), func(i, j int) bool { return leaks[i].Goroutine < leaks[j].Goroutine }, func(i, j int) { leaks[i], leaks[j] = leaks[j], leaks[i] })
+	return leaks
+}
+
+// exitedHolders reports whether the goroutines recorded as holding the
+// WaitGroup or Semaphore at x have all exited, and returns the first of
+// them if so. It reports false if no holder is recorded.
+func exitedHolders(x unsafe.Pointer, live map[int64]bool) (first int64, ok bool) {
+	hs := holders(x)
+	if len(hs) == 0 {
+		return 0, false
+	}
+	for _, g := range hs {
+		if live[g] {
+			return 0, false
+		}
+	}
+	return hs[0], true
+}
+
+// liveGoroutines returns the set of the IDs of all goroutines.
+func liveGoroutines() map[int64]bool {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	// The goroutines are separated by blank lines, each beginning
+	// with "goroutine N [status]:".
+	live := make(map[int64]bool)
+	const prefix = "goroutine "
+	for i := 0; i < len(buf); {
+		if (i == 0 || buf[i-1] == '\n') && len(buf)-i > len(prefix) && string(buf[i:i+len(prefix)]) == prefix {
+			i += len(prefix)
+			var id int64
+			for ; i < len(buf) && '0' <= buf[i] && buf[i] <= '9'; i++ {
+				id = id*10 + int64(buf[i]-'0')
+			}
+			live[id] = true
+		}
+		for i < len(buf) && buf[i] != '\n' {
+			i++
+		}
+		i++
+	}
+	return live
+}
@@ -0,0 +1,204 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A LifecycleState is a state of a Lifecycle.
+type LifecycleState uint8
+
+const (
+	LifecycleNew      LifecycleState = iota // not started yet
+	LifecycleStarting                       // Start is running its function
+	LifecycleRunning                        // started
+	LifecycleStopping                       // Stop is running its function
+	LifecycleStopped                        // stopped, or failed to start
+)
+
+var lifecycleStateNames = [...]string{
+	LifecycleNew:      "new",
+	LifecycleStarting: "starting",
+	LifecycleRunning:  "running",
+	LifecycleStopping: "stopping",
+	LifecycleStopped:  "stopped",
+}
+
+func (s LifecycleState) String() string {
+	if int(s) < len(lifecycleStateNames) {
+		return lifecycleStateNames[s]
+	}
+	return "LifecycleState(" + itoa(int(s)) + ")"
+}
+
+// A LifecycleError reports a transition a Lifecycle cannot make, such
+// as starting once stopped, or a wait for a state it can no longer
+// reach.
+type LifecycleError struct {
+	From, To LifecycleState
+}
+
+func (e *LifecycleError) Error() string {
+	return "sync: lifecycle cannot go from " + e.From.String() + " to " + e.To.String()
+}
+
+// A Lifecycle tracks the life of a long-lived component, such as a
+// server or a background worker, through the states new, starting,
+// running, stopping and stopped, in that order, and lets goroutines wait
+// for it to be running or stopped. It takes the place of the mutex,
+// flags and channels that each component would otherwise keep, and of
+// their bugs, such as a Stop racing with Start.
+//
+// Start and Stop run the functions that start and stop the component,
+// and may be called more than once, or concurrently: only the first call
+// of each runs its function, and the others wait for its result. A
+// Lifecycle is started at most once; once it has stopped, it stays
+// stopped.
+//
+// The zero Lifecycle is new and ready for use. A Lifecycle must not be
+// copied after first use.
+type Lifecycle struct {
+	mu       Mutex
+	state    LifecycleState
+	startErr error // what the start function returned
+	stopErr  error // what the stop function returned
+	changed  Notifier
+}
+
+// State returns the current state of l.
+func (l *Lifecycle) State() LifecycleState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state
+}
+
+// Start starts l, if it is new, by calling start, if not nil, with ctx:
+// l is starting while start runs, and then running, or stopped if start
+// returns an error, which Start returns. If l is already starting or
+// running, Start waits for it to be running, as AwaitRunning does. If l
+// is stopping or stopped, Start returns a *LifecycleError.
+func (l *Lifecycle) Start(ctx Context, start func(ctx Context) error) error {
+	l.mu.Lock()
+	switch state := l.state; state {
+	case LifecycleNew:
+		l.state = LifecycleStarting
+		l.mu.Unlock()
+		l.changed.Broadcast()
+		var err error
+		if start != nil {
+			err = start(ctx)
+		}
+		l.mu.Lock()
+		l.startErr = err
+		if err != nil {
+			l.state = LifecycleStopped
+		} else {
+			l.state = LifecycleRunning
+		}
+		l.mu.Unlock()
+		l.changed.Broadcast()
+		return err
+	case LifecycleStarting, LifecycleRunning:
+		l.mu.Unlock()
+		return l.AwaitRunning(ctx)
+	default:
+		l.mu.Unlock()
+		return &LifecycleError{From: state, To: LifecycleStarting}
+	}
+}
+
+// Stop stops l. If l is running, Stop calls stop, if not nil, with ctx:
+// l is stopping while stop runs, and then stopped, and Stop returns
+// what stop returned. If l is new, it is stopped at once, without a
+// call of stop. If l is starting, Stop first waits for it to be running
+// or stopped. If l is already stopping or stopped, Stop waits for it to
+// be stopped, as AwaitStopped does.
+//
+// Stop returns ctx.Err() if ctx is done before it can call stop, or
+// while it waits. A nil ctx never gives up.
+func (l *Lifecycle) Stop(ctx Context, stop func(ctx Context) error) error {
+	for {
+		l.mu.Lock()
+		switch l.state {
+		case LifecycleNew:
+			l.state = LifecycleStopped
+			l.mu.Unlock()
+			l.changed.Broadcast()
+			return nil
+		case LifecycleStarting:
+			l.mu.Unlock()
+			if err := l.await(ctx, LifecycleRunning); err != nil {
+				return err
+			}
+			continue
+		case LifecycleRunning:
+			l.state = LifecycleStopping
+			l.mu.Unlock()
+			l.changed.Broadcast()
+			var err error
+			if stop != nil {
+				err = stop(ctx)
+			}
+			l.mu.Lock()
+			l.stopErr = err
+			l.state = LifecycleStopped
+			l.mu.Unlock()
+			l.changed.Broadcast()
+			return err
+		default:
+			l.mu.Unlock()
+			return l.AwaitStopped(ctx)
+		}
+	}
+}
+
+// AwaitRunning waits for l to be running and returns nil. If l fails to
+// start, it returns the error of the start function; if l stops, or was
+// stopped without starting, a *LifecycleError. It returns ctx.Err() if
+// ctx is done first. A nil ctx never gives up.
+func (l *Lifecycle) AwaitRunning(ctx Context) error {
+	if err := l.await(ctx, LifecycleRunning); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case l.state == LifecycleRunning:
+		return nil
+	case l.startErr != nil:
+		return l.startErr
+	default:
+		return &LifecycleError{From: l.state, To: LifecycleRunning}
+	}
+}
+
+// AwaitStopped waits for l to be stopped and returns what the stop
+// function returned, or nil if it was not called. It returns ctx.Err()
+// if ctx is done first. A nil ctx never gives up.
+func (l *Lifecycle) AwaitStopped(ctx Context) error {
+	if err := l.await(ctx, LifecycleStopped); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stopErr
+}
+
+// await waits for l to reach state or a later one. It returns ctx.Err()
+// if ctx is done first.
+func (l *Lifecycle) await(ctx Context, state LifecycleState) error {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	for {
+		ch := l.changed.Wait()
+		if l.State() >= state {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-cancel:
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	. "sync"
+	"testing"
+)
+
+func TestLifecycle(t *testing.T) {
+	var l Lifecycle
+	if s := l.State(); s != LifecycleNew {
+		t.Fatalf("zero Lifecycle is %v; want new", s)
+	}
+
+	// Goroutines that start l concurrently wait for the one start.
+	release := make(chan struct{})
+	starts := 0
+	start := func(ctx Context) error {
+		starts++
+		<-release
+		return nil
+	}
+	errc := make(chan error)
+	go func() { errc <- l.Start(nil, start) }()
+	go func() { errc <- l.AwaitRunning(nil) }()
+	for l.State() != LifecycleStarting {
+		runtime.Gosched()
+	}
+	go func() { errc <- l.Start(nil, start) }()
+	close(release)
+	for i := 0; i < 3; i++ {
+		if err := <-errc; err != nil {
+			t.Fatalf("Start or AwaitRunning = %v", err)
+		}
+	}
+	if starts != 1 || l.State() != LifecycleRunning {
+		t.Fatalf("%d starts, state %v; want 1, running", starts, l.State())
+	}
+
+	errStop := errors.New("flush failed")
+	if err := l.Stop(nil, func(ctx Context) error { return errStop }); err != errStop {
+		t.Fatalf("Stop = %v; want %v", err, errStop)
+	}
+	if err := l.Stop(nil, nil); err != errStop {
+		t.Fatalf("second Stop = %v; want %v", err, errStop)
+	}
+	var le *LifecycleError
+	if err := l.Start(nil, start); !errors.As(err, &le) || le.From != LifecycleStopped || le.To != LifecycleStarting {
+		t.Fatalf("Start after Stop = %v; want a LifecycleError from stopped to starting", err)
+	}
+	if err := l.AwaitRunning(nil); !errors.As(err, &le) {
+		t.Fatalf("AwaitRunning after Stop = %v; want a LifecycleError", err)
+	}
+}
+
+func TestLifecycleFailedStart(t *testing.T) {
+	var l Lifecycle
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.AwaitRunning(ctx); err != context.Canceled {
+		t.Fatalf("AwaitRunning of a new Lifecycle = %v; want %v", err, context.Canceled)
+	}
+	errStart := errors.New("no port")
+	if err := l.Start(nil, func(ctx Context) error { return errStart }); err != errStart {
+		t.Fatalf("Start = %v; want %v", err, errStart)
+	}
+	if err := l.AwaitRunning(nil); err != errStart {
+		t.Fatalf("AwaitRunning after a failed start = %v; want %v", err, errStart)
+	}
+	if s := l.State(); s != LifecycleStopped {
+		t.Fatalf("state after a failed start = %v; want stopped", s)
+	}
+	stopped := false
+	if err := l.Stop(nil, func(ctx Context) error { stopped = true; return nil }); err != nil || stopped {
+		t.Fatalf("Stop after a failed start = %v, stop called %v; want nil, false", err, stopped)
+	}
+}
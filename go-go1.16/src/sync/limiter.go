@@ -0,0 +1,119 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A Limiter is a Semaphore that keeps statistics on its use: how much
+// weight is held and how long callers wait to acquire it. They tell an
+// operator whether the limit, rather than the work done under it, is what
+// is slowing requests down.
+//
+// A Limiter must be created with NewLimiter and must not be copied after
+// first use.
+type Limiter struct {
+	// 64-bit fields first, for alignment on 32-bit platforms.
+	inFlight     AtomicInt64
+	waiting      AtomicInt64
+	acquired     AtomicUint64
+	canceled     AtomicUint64
+	queueTime    AtomicInt64
+	maxQueueTime AtomicInt64
+
+	sem  *Semaphore
+	size int64
+}
+
+// LimiterStats holds statistics about a Limiter, as returned by
+// Limiter.Stats. Times are in nanoseconds.
+type LimiterStats struct {
+	Size         int64  // total weight of the Limiter
+	InFlight     int64  // weight currently held
+	Waiting      int64  // calls to Acquire currently waiting
+	Acquired     uint64 // calls to Acquire and TryAcquire that succeeded
+	Canceled     uint64 // calls to Acquire that gave up
+	QueueTime    int64  // total time spent waiting in Acquire
+	MaxQueueTime int64  // longest time spent waiting in one Acquire
+}
+
+// NewLimiter returns a new Limiter with a total weight of n.
+func NewLimiter(n int64) *Limiter {
+	return &Limiter{sem: NewSemaphore(n), size: n}
+}
+
+// Acquire acquires the limiter with a weight of n, blocking until
+// resources are available or ctx is done, as Semaphore.Acquire does, and
+// records how long it waited.
+func (l *Limiter) Acquire(ctx Context, n int64) error {
+	if l.sem.TryAcquire(n) {
+		l.acquired.Add(1)
+		l.inFlight.Add(n)
+		return nil
+	}
+	l.waiting.Add(1)
+	start := nanotime()
+	err := l.sem.Acquire(ctx, n)
+	wait := nanotime() - start
+	l.waiting.Add(-1)
+	l.queueTime.Add(wait)
+	for {
+		max := l.maxQueueTime.Load()
+		if wait <= max || l.maxQueueTime.CompareAndSwap(max, wait) {
+			break
+		}
+	}
+	if err != nil {
+		l.canceled.Add(1)
+		return err
+	}
+	l.acquired.Add(1)
+	l.inFlight.Add(n)
+	return nil
+}
+
+// TryAcquire acquires the limiter with a weight of n without blocking.
+// On success, it returns true. On failure, it returns false and leaves
+// the limiter unchanged.
+func (l *Limiter) TryAcquire(n int64) bool {
+	if !l.sem.TryAcquire(n) {
+		return false
+	}
+	l.acquired.Add(1)
+	l.inFlight.Add(n)
+	return true
+}
+
+// Release releases the limiter with a weight of n.
+func (l *Limiter) Release(n int64) {
+	l.inFlight.Add(-n)
+	l.sem.Release(n)
+}
+
+// AsLocker returns a Locker interface that implements the Lock and
+// Unlock methods by acquiring and releasing l with a weight of n, as
+// Semaphore.AsLocker does. Its waits count in the statistics of l.
+func (l *Limiter) AsLocker(n int64) Locker {
+	return &limiterLocker{l, n}
+}
+
+type limiterLocker struct {
+	l *Limiter
+	n int64
+}
+
+func (l *limiterLocker) Lock()   { l.l.Acquire(nil, l.n) }
+func (l *limiterLocker) Unlock() { l.l.Release(l.n) }
+
+// Stats returns statistics about l. The fields are read separately, so
+// they may not be mutually consistent while l is in use.
+func (l *Limiter) Stats() LimiterStats {
+	return LimiterStats{
+		Size:         l.size,
+		InFlight:     l.inFlight.Load(),
+		Waiting:      l.waiting.Load(),
+		Acquired:     l.acquired.Load(),
+		Canceled:     l.canceled.Load(),
+		QueueTime:    l.queueTime.Load(),
+		MaxQueueTime: l.maxQueueTime.Load(),
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	. "sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(2)
+	ctx := context.Background()
+	if err := l.Acquire(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !l.TryAcquire(1) {
+		t.Fatal("TryAcquire failed with weight available")
+	}
+	if l.TryAcquire(1) {
+		t.Fatal("TryAcquire succeeded with no weight available")
+	}
+	if s := l.Stats(); s.Size != 2 || s.InFlight != 2 || s.Acquired != 2 || s.QueueTime != 0 {
+		t.Fatalf("Stats() = %+v", s)
+	}
+
+	acquired := make(chan bool)
+	go func() {
+		l.Acquire(ctx, 1)
+		acquired <- true
+	}()
+	for l.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	l.Release(1)
+	<-acquired
+	s := l.Stats()
+	if s.Waiting != 0 || s.InFlight != 2 || s.Acquired != 3 {
+		t.Fatalf("Stats() = %+v", s)
+	}
+	if s.QueueTime < int64(10*time.Millisecond) || s.MaxQueueTime != s.QueueTime {
+		t.Fatalf("QueueTime = %v, MaxQueueTime = %v; want equal and at least 10ms",
+			time.Duration(s.QueueTime), time.Duration(s.MaxQueueTime))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if err := l.Acquire(ctx, 1); err != context.DeadlineExceeded {
+		t.Fatalf("Acquire() = %v; want %v", err, context.DeadlineExceeded)
+	}
+	if s := l.Stats(); s.Canceled != 1 || s.InFlight != 2 {
+		t.Fatalf("Stats() = %+v", s)
+	}
+	l.Release(2)
+	if s := l.Stats(); s.InFlight != 0 {
+		t.Fatalf("InFlight = %d after releasing everything", s.InFlight)
+	}
+}
+
+func TestLimiterAsLocker(t *testing.T) {
+	l := NewLimiter(1)
+	lk := l.AsLocker(1)
+	if !l.TryAcquire(1) {
+		t.Fatal("TryAcquire failed on an idle limiter")
+	}
+	locked := make(chan bool)
+	go func() {
+		lk.Lock()
+		locked <- true
+	}()
+	for l.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-locked:
+		t.Fatal("Lock succeeded with the limiter held")
+	default:
+	}
+	l.Release(1)
+	<-locked
+	if s := l.Stats(); s.InFlight != 1 || s.Acquired != 2 {
+		t.Fatalf("Stats() = %+v", s)
+	}
+	lk.Unlock()
+}
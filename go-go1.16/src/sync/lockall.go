@@ -0,0 +1,73 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "unsafe"
+
+// A RankedLocker is a Locker with a rank that fixes its place in the lock
+// order used by LockAll. Lockers of lower rank are locked first.
+type RankedLocker interface {
+	Locker
+	LockRank() int
+}
+
+// LockAll locks every locker in lockers and returns a function that
+// unlocks them all.
+//
+// Goroutines that lock overlapping sets of locks one by one deadlock if
+// two take the same pair in opposite orders, as when each of two
+// transfers between the same accounts locks its source account first.
+// LockAll avoids this by always locking in one global order: by rank for
+// lockers that implement RankedLocker, treating others as rank 0, and by
+// address among lockers of equal rank. Passing the same locker more than
+// once locks it once. All goroutines that lock a given set of locks
+// together must use LockAll, or otherwise follow the same order, for the
+// guarantee to hold.
+func LockAll(lockers ...Locker) (unlock func()) {
+	ls := make([]Locker, len(lockers))
+	copy(ls, lockers)
+	less := func(i, j int) bool {
+		ri, rj := lockerRank(ls[i]), lockerRank(ls[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return lockerAddr(ls[i]) < lockerAddr(ls[j])
+	}
+	sortSlice(len(ls), less, func(i, j int) { ls[i], ls[j] = ls[j], ls[i] })
+	n := 0
+	for i, l := range ls {
+		if i > 0 && lockerAddr(l) == lockerAddr(ls[n-1]) {
+			continue
+		}
+		l.Lock()
+		ls[n] = l
+		n++
+	}
+	ls = ls[:n]
+	return func() {
+		for i := len(ls) - 1; i >= 0; i-- {
+			ls[i].Unlock()
+		}
+	}
+}
+
+func lockerRank(l Locker) int {
+	if r, ok := l.(RankedLocker); ok {
+		return r.LockRank()
+	}
+	return 0
+}
+
+// lockerAddr returns the address of the value l refers to. Lockers are
+// almost always pointers, so this identifies the lock itself.
+func lockerAddr(l Locker) uintptr {
+	return uintptr(lockerPointer(l))
+}
+
+// lockerPointer returns a pointer to the value l refers to.
+func lockerPointer(l Locker) unsafe.Pointer {
+	x := interface{}(l)
+	return (*eface)(unsafe.Pointer(&x)).val
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"testing"
+)
+
+func TestLockAll(t *testing.T) {
+	var a, b, c Mutex
+	var rw RWMutex
+	// a is passed twice; locking it twice would deadlock.
+	unlock := LockAll(&b, &a, rw.RLocker(), &c, &a)
+	locked := make(chan bool)
+	go func() {
+		rw.Lock() // blocks until the read lock is released
+		locked <- true
+		rw.Unlock()
+	}()
+	select {
+	case <-locked:
+		t.Fatal("LockAll did not read-lock rw")
+	default:
+	}
+	unlock()
+	<-locked
+	// unlock must have released every mutex.
+	a.Lock()
+	b.Lock()
+	c.Lock()
+}
+
+type account struct {
+	Mutex
+	balance int
+}
+
+func TestLockAllTransfers(t *testing.T) {
+	// Transfers in opposite directions between the same accounts would
+	// deadlock if each locked its source first.
+	accts := []*account{{balance: 100}, {balance: 100}, {balance: 100}}
+	var wg WaitGroup
+	for g := 0; g < 6; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				from, to := accts[(g+i)%3], accts[(g+i+1+g%2)%3]
+				unlock := LockAll(from, to)
+				from.balance--
+				to.balance++
+				unlock()
+			}
+		}(g)
+	}
+	wg.Wait()
+	total := 0
+	for _, a := range accts {
+		total += a.balance
+	}
+	if total != 300 {
+		t.Fatalf("total balance = %d; want 300", total)
+	}
+}
+
+type rankedMutex struct {
+	Mutex
+	rank int
+	log  *[]int
+}
+
+func (m *rankedMutex) Lock()         { m.Mutex.Lock(); *m.log = append(*m.log, m.rank) }
+func (m *rankedMutex) LockRank() int { return m.rank }
+
+func TestLockAllRank(t *testing.T) {
+	var log []int
+	ms := []Locker{
+		&rankedMutex{rank: 3, log: &log},
+		&rankedMutex{rank: 1, log: &log},
+		&rankedMutex{rank: 2, log: &log},
+	}
+	LockAll(ms...)()
+	if len(log) != 3 || log[0] != 1 || log[1] != 2 || log[2] != 3 {
+		t.Fatalf("locked in rank order %v; want [1 2 3]", log)
+	}
+}
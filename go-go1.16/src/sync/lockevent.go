@@ -0,0 +1,178 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"internal/race"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A LockKind identifies the kind of lock acquisition a lock event or
+// report entry is about. LockWaitGroup and LockSemaphore are not lock
+// acquisitions, and appear only in DumpWaiters and FindLeakedWaiters.
+type LockKind uint8
+
+const (
+	LockMutex       LockKind = 1 + iota // Mutex.Lock
+	LockRWMutex                         // RWMutex.Lock
+	LockRWMutexRead                     // RWMutex.RLock
+	LockMap                             // the internal lock of a Map
+	LockWaitGroup                       // WaitGroup.Wait
+	LockSemaphore                       // Semaphore.Acquire
+)
+
+var lockKindNames = [...]string{
+	LockMutex:       "Mutex",
+	LockRWMutex:     "RWMutex",
+	LockRWMutexRead: "RWMutex.RLock",
+	LockMap:         "Map",
+	LockWaitGroup:   "WaitGroup",
+	LockSemaphore:   "Semaphore",
+}
+
+func (k LockKind) String() string {
+	if int(k) < len(lockKindNames) && lockKindNames[k] != "" {
+		return lockKindNames[k]
+	}
+	return "LockKind(" + itoa(int(k)) + ")"
+}
+
+// lockEvents is a set of lockEvent bits for the observers of lock events
+// that are active. The slow paths of Mutex and RWMutex check it before
+// and after blocking and skip tracking the wait while it is zero, unless
+// in debug mode or while the runtime is tracing, so observing costs
+// nothing otherwise.
+var lockEvents uint32
+
+const (
+	lockEventContention = 1 << iota // a contention profile is running
+	lockEventMetrics                // a lock is registered for metrics
+	lockEventWarning                // a block warning is set
+	lockEventExport                 // a WaitExporter is installed
+	lockEventWaiters                // waiter tracking is on
+)
+
+func setLockEvents(bit uint32, on bool) {
+	for {
+		old := atomic.LoadUint32(&lockEvents)
+		new := old &^ bit
+		if on {
+			new |= bit
+		}
+		if atomic.CompareAndSwapUint32(&lockEvents, old, new) {
+			return
+		}
+	}
+}
+
+// lockObserved reports whether a blocked acquisition would be observed
+// by anything, so that lock methods can skip tracking it otherwise.
+func lockObserved() bool {
+	return syncDebug || atomic.LoadUint32(&lockEvents) != 0 || lockTraced()
+}
+
+// lockTraced reports whether blocked acquisitions open trace regions.
+// They do not in race-enabled builds: the lock methods of RWMutex call
+// race.Disable, which hides the runtime's lock on its trace strings from
+// the race detector, and the regions would be reported as racing.
+func lockTraced() bool {
+	return !race.Enabled && runtime_traceEnabled()
+}
+
+// A lockWait tracks one blocked acquisition of a lock, from begin to
+// end. The zero value is a wait that never began, and ending it does
+// nothing.
+type lockWait struct {
+	lock   unsafe.Pointer
+	kind   LockKind
+	goid   int64 // the waiting goroutine, if registered in waiters
+	start  int64
+	region string    // name of the open trace region, if any
+	stack  []uintptr // caller of the lock method, if a block warning is set
+	warned bool      // the block warning fired for this wait
+}
+
+// begin starts the wait for lock, of the given kind, at start. Callers
+// call it only if lockObserved. While the runtime is tracing it opens a
+// user region named after the lock, so that the trace shows which lock
+// the goroutine waited for, and while waiters are tracked or a block
+// warning is set it registers the wait in waiters. skip is as for end,
+// counting begin in place of end.
+func (w *lockWait) begin(lock unsafe.Pointer, kind LockKind, start int64, skip int) {
+	w.lock = lock
+	w.kind = kind
+	w.start = start
+	events := atomic.LoadUint32(&lockEvents)
+	if events&lockEventWarning != 0 {
+		var stack [contentionDepth]uintptr
+		w.stack = stack[:runtime.Callers(skip, stack[:])]
+	}
+	if lockTraced() {
+		w.region = lockRegionName(lock, kind)
+		runtime_traceRegion(traceRegionStart, w.region)
+	}
+	if events&lockEventExport != 0 {
+		// Before addWaiter, since the exporter may block on a
+		// lock of its own, which registers the goroutine too.
+		exportBlock(w)
+	}
+	if syncDebug || events&(lockEventWaiters|lockEventWarning) != 0 {
+		w.goid = runtime_goid()
+		addWaiter(w)
+	}
+}
+
+// end is called when the goroutine acquires the lock. skip is the
+// number of stack frames to skip to reach the caller of the lock
+// method, counting runtime.Callers and end itself.
+func (w *lockWait) end(skip int) {
+	if w.start == 0 {
+		return
+	}
+	if w.goid != 0 {
+		removeWaiter(w)
+	}
+	if w.region != "" {
+		runtime_traceRegion(traceRegionEnd, w.region)
+	}
+	events := atomic.LoadUint32(&lockEvents)
+	if events == 0 {
+		return
+	}
+	wait := nanotime() - w.start
+	if events&lockEventContention != 0 {
+		recordContention(w.lock, w.kind, wait, skip+1)
+	}
+	if events&lockEventMetrics != 0 {
+		countWait(w.lock, wait)
+	}
+	if events&lockEventExport != 0 {
+		exportWake(w, w.start+wait)
+	}
+}
+
+// Region modes of runtime_traceRegion, as in runtime/trace.
+const (
+	traceRegionStart = 0
+	traceRegionEnd   = 1
+)
+
+// itoa converts val to a decimal string.
+func itoa(val int) string {
+	if val < 0 {
+		return "-" + itoa(-val)
+	}
+	var buf [20]byte
+	i := len(buf) - 1
+	for val >= 10 {
+		buf[i] = byte(val%10 + '0')
+		i--
+		val /= 10
+	}
+	buf[i] = byte(val + '0')
+	return string(buf[i:])
+}
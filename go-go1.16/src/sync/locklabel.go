@@ -0,0 +1,57 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "unsafe"
+
+// lockLabels maps a labeled lock to its label. It is copied on write, so
+// a blocked lock method can look up a label without taking a lock of its
+// own. It holds a map[unsafe.Pointer]string: keeping the pointer, rather
+// than the address, keeps the lock on the heap, where it does not move as
+// a stack would when it grows.
+var lockLabels COWValue
+
+// SetLockLabel sets the label of l, which names l in execution traces:
+// while the runtime is tracing, a goroutine that blocks locking a
+// Mutex or RWMutex is inside a user region named after the lock and its
+// label, so that go tool trace shows which lock the goroutine waited
+// for. An empty label removes the label of l. Race-enabled builds open
+// no such regions, but still report labels elsewhere, such as in
+// DumpWaiters.
+//
+// A labeled lock is kept alive until its label is removed, so a lock
+// that is discarded should have its label removed first.
+func SetLockLabel(l Locker, label string) {
+	lock := lockerPointer(l)
+	lockLabels.Write(func(v interface{}) interface{} {
+		old, _ := v.(map[unsafe.Pointer]string)
+		m := make(map[unsafe.Pointer]string, len(old)+1)
+		for k, v := range old {
+			m[k] = v
+		}
+		if label == "" {
+			delete(m, lock)
+		} else {
+			m[lock] = label
+		}
+		return m
+	})
+}
+
+// lockLabel returns the label of lock, or "".
+func lockLabel(lock unsafe.Pointer) string {
+	m, _ := lockLabels.Load().(map[unsafe.Pointer]string)
+	return m[lock]
+}
+
+// lockRegionName returns the name of the trace region for a wait of
+// the given kind on lock.
+func lockRegionName(lock unsafe.Pointer, kind LockKind) string {
+	name := "sync: wait for " + kind.String()
+	if label := lockLabel(lock); label != "" {
+		name += " " + label
+	}
+	return name
+}
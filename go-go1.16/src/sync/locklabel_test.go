@@ -0,0 +1,108 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"bytes"
+	"internal/race"
+	"internal/trace"
+	rtrace "runtime/trace"
+	. "sync"
+	"testing"
+)
+
+func TestSetLockLabel(t *testing.T) {
+	var mu Mutex
+	var rw RWMutex
+	if got, want := LockRegionName(&mu, LockMutex), "sync: wait for Mutex"; got != want {
+		t.Errorf("unlabeled region = %q, want %q", got, want)
+	}
+	SetLockLabel(&mu, "cache")
+	SetLockLabel(&rw, "index")
+	if got, want := LockRegionName(&mu, LockMutex), "sync: wait for Mutex cache"; got != want {
+		t.Errorf("labeled region = %q, want %q", got, want)
+	}
+	if got, want := LockRegionName(rw.RLocker(), LockRWMutexRead), "sync: wait for RWMutex.RLock index"; got != want {
+		t.Errorf("RLocker region = %q, want %q", got, want)
+	}
+	SetLockLabel(&mu, "")
+	SetLockLabel(&rw, "")
+	if got, want := LockRegionName(&mu, LockMutex), "sync: wait for Mutex"; got != want {
+		t.Errorf("region after removing label = %q, want %q", got, want)
+	}
+}
+
+// growStack uses about n KB of stack, so that the runtime moves the
+// stack of the calling goroutine to a larger one.
+func growStack(n int) byte {
+	var buf [1024]byte
+	buf[n%len(buf)] = byte(n)
+	if n > 0 {
+		return growStack(n-1) + buf[(n+1)%len(buf)]
+	}
+	return buf[0]
+}
+
+func TestSetLockLabelStackGrowth(t *testing.T) {
+	// The label must stay with a lock declared on the stack, whose
+	// address would change if the stack grew under it.
+	var mu Mutex
+	SetLockLabel(&mu, "grown")
+	defer SetLockLabel(&mu, "")
+	growStack(256)
+	if got, want := LockRegionName(&mu, LockMutex), "sync: wait for Mutex grown"; got != want {
+		t.Errorf("region after stack growth = %q, want %q", got, want)
+	}
+}
+
+func TestLockWaitTraceRegion(t *testing.T) {
+	if rtrace.IsEnabled() {
+		t.Skip("skipping because -test.trace is set")
+	}
+	if race.Enabled {
+		t.Skip("skipping because lock waits open no trace regions in race-enabled builds")
+	}
+	var mu Mutex
+	var rw RWMutex
+	SetLockLabel(&mu, "mu")
+	SetLockLabel(&rw, "rw")
+	defer SetLockLabel(&mu, "")
+	defer SetLockLabel(&rw, "")
+
+	buf := new(bytes.Buffer)
+	if err := rtrace.Start(buf); err != nil {
+		t.Fatalf("failed to start tracing: %v", err)
+	}
+	blockOn(mu.Lock, mu.Unlock, mu.Lock, mu.Unlock)
+	blockOn(rw.Lock, rw.Unlock, rw.Lock, rw.Unlock)
+	blockOn(rw.Lock, rw.Unlock, rw.RLock, rw.RUnlock)
+	rtrace.Stop()
+
+	res, err := trace.Parse(buf, "")
+	if err == trace.ErrTimeOrder {
+		// golang.org/issues/16755
+		t.Skipf("skipping trace: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	regions := map[string][2]int{} // counts of starts and ends by name
+	for _, e := range res.Events {
+		if e.Type == trace.EvUserRegion && e.Args[1] < 2 {
+			n := regions[e.SArgs[0]]
+			n[e.Args[1]]++
+			regions[e.SArgs[0]] = n
+		}
+	}
+	for _, name := range []string{
+		"sync: wait for Mutex mu",
+		"sync: wait for RWMutex rw",
+		"sync: wait for RWMutex.RLock rw",
+	} {
+		if regions[name] != [2]int{1, 1} {
+			t.Errorf("region %q: got %d, want a start and an end; regions: %v", name, regions[name], regions)
+		}
+	}
+}
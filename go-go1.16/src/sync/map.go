@@ -13,7 +13,14 @@ type Map struct {
 	mu     Mutex
 	read   atomic.Value // readOnly
 	dirty  map[interface{}]*entry
-	misses int
+
+	// misses and added are written with mu held, and read atomically
+	// by Metrics, which does not take mu. added counts the keys in
+	// dirty that are not in read.
+	misses uintptr
+	added  uintptr
+
+	pinned unsafe.Pointer // *mapPins, made by the first LoadPinned
 }
 
 type readOnly struct {
@@ -33,10 +40,20 @@ func newEntry(i interface{}) *entry {
 }
 
 func (m *Map) Load(key interface{}) (value interface{}, ok bool) {
+	e, ok := m.loadEntry(key)
+	if !ok { // 最终还是没找到，返回
+		return nil, false
+	}
+	// 找到了 key 对应的 entry，但是 entry 也有可能是被标记为删除的
+	return e.load()
+}
+
+// loadEntry returns the entry for key, if m has one.
+func (m *Map) loadEntry(key interface{}) (e *entry, ok bool) {
 	read, _ := m.read.Load().(readOnly)
-	e, ok := read.m[key]
+	e, ok = read.m[key]
 	if !ok && read.amended { // read 里没有，并且 dirty 中包含 read 不存在的元素，去 dirty 试试看
-		m.mu.Lock() // 锁住 dirty
+		m.mu.lockMap() // 锁住 dirty
 		// 二次检查，万一在抢夺锁的过程中，read 被更新了呢，再去 read 尝试一次
 		// dirty 已经被锁了，如果这次 read 还没有，那锁释放前，都不可能再有了
 		// 因为 read 若想新增 key，只能通过把 dirty 升级为 read 完成，而 dirty 的升级需要持有锁
@@ -48,11 +65,7 @@ func (m *Map) Load(key interface{}) (value interface{}, ok bool) {
 		}
 		m.mu.Unlock()
 	}
-	if !ok { // 最终还是没找到，返回
-		return nil, false
-	}
-	// 找到了 key 对应的 entry，但是 entry 也有可能是被标记为删除的
-	return e.load()
+	return e, ok
 }
 
 func (e *entry) load() (value interface{}, ok bool) {
@@ -67,14 +80,33 @@ func (e *entry) load() (value interface{}, ok bool) {
 
 // 存储一个key，会出现哪些情况？
 func (m *Map) Store(key, value interface{}) {
+	m.store(key, &value)
+}
+
+// StorePointer sets the value for a key to *value, like Store, but keeps
+// value itself rather than a copy of *value. Store boxes every value it
+// stores, and a new key costs it a second allocation for the copy;
+// StorePointer lets a caller that stores many values allocate the boxes
+// itself, in bulk or from a Pool, so that an update costs nothing and a
+// new key costs only its entry. The caller must not modify *value after
+// the call. StorePointer panics if value is nil.
+func (m *Map) StorePointer(key interface{}, value *interface{}) {
+	if value == nil {
+		panic("sync: Map.StorePointer with nil value")
+	}
+	m.store(key, value)
+}
+
+// store sets the value for key to *i, keeping i.
+func (m *Map) store(key interface{}, i *interface{}) {
 	read, _ := m.read.Load().(readOnly)
 	// 先去 read 查找一下，是否存在 key 对应的节点，存在的话尝试直接更新
-	if e, ok := read.m[key]; ok && e.tryStore(&value) { // 节点存在，还是一个未标记清除的节点，直接存储成功可以返回了
+	if e, ok := read.m[key]; ok && e.tryStore(i) { // 节点存在，还是一个未标记清除的节点，直接存储成功可以返回了
 		return
 	}
 
 	// 试图在 read 里更新的操作没有执行成功，那需要在 dirty 里进行了
-	m.mu.Lock()
+	m.mu.lockMap()
 	read, _ = m.read.Load().(readOnly) // 二次检查 read 中是否存在 key 对应的节点，因为在尝试锁的过程中，read 可能已经更新了
 	if e, ok := read.m[key]; ok {      // read 中存在要更新的 key
 		if e.unexpungeLocked() {
@@ -87,17 +119,18 @@ func (m *Map) Store(key, value interface{}) {
 		}
 		// entry 存入新的正确的 value
 		// read 和 dirty 中的 entry 是同一个，都是持有了 entry 的指针
-		e.storeLocked(&value)
+		e.storeLocked(i)
 	} else if e, ok := m.dirty[key]; ok {
 		// read 中不存在，dirty 中存在 key 的映射
 		// 直接更新 entry 保存的 value
-		e.storeLocked(&value)
+		e.storeLocked(i)
 	} else {               // read 和 dirty 都不存在，新增
 		if !read.amended { // 要加入新的 key，如果 read 是完整的，那要把它标记为不完整，因为我们要在 dirty 中加入一个新的映射关系
 			m.dirtyLocked() // 如果 dirty 是空的，会先拷贝一份 read 给 dirty。read 是完整的才会出现这种情况，read 如果已经不完整了，那 dirty 肯定不是 nil
 			m.read.Store(readOnly{m: read.m, amended: true})
 		}
-		m.dirty[key] = newEntry(value) // dirty 加入新的映射
+		m.dirty[key] = &entry{p: unsafe.Pointer(i)} // dirty 加入新的映射，i 已在堆上，不必再拷贝
+		atomic.StoreUintptr(&m.added, m.added+1)
 	}
 	m.mu.Unlock()
 }
@@ -139,7 +172,7 @@ func (m *Map) LoadOrStore(key, value interface{}) (actual interface{}, loaded bo
 			return actual, loaded
 		}
 	}
-	m.mu.Lock()
+	m.mu.lockMap()
 	read, _ = m.read.Load().(readOnly)
 	if e, ok := read.m[key]; ok {
 		if e.unexpungeLocked() {
@@ -155,6 +188,7 @@ func (m *Map) LoadOrStore(key, value interface{}) (actual interface{}, loaded bo
 			m.read.Store(readOnly{m: read.m, amended: true})
 		}
 		m.dirty[key] = newEntry(value)
+		atomic.StoreUintptr(&m.added, m.added+1)
 		actual, loaded = value, false
 	}
 	m.mu.Unlock()
@@ -196,18 +230,36 @@ func (m *Map) LoadAndDelete(key interface{}) (value interface{}, loaded bool) {
 	read, _ := m.read.Load().(readOnly)
 	e, ok := read.m[key]
 	if !ok && read.amended {
-		m.mu.Lock()
+		m.mu.lockMap()
 		read, _ = m.read.Load().(readOnly)
 		e, ok = read.m[key]
 		if !ok && read.amended {
 			e, ok = m.dirty[key]
-			delete(m.dirty, key)
+			if ok {
+				delete(m.dirty, key)
+				atomic.StoreUintptr(&m.added, m.added-1)
+			}
 			m.missLocked()
+			if ok {
+				// e is in neither map now, so it must not take
+				// stores for key any more; see MapKey.
+				i, loaded := e.remove()
+				m.mu.Unlock()
+				if loaded {
+					m.waitUnpinned(i)
+					return *i, true
+				}
+				return nil, false
+			}
 		}
 		m.mu.Unlock()
 	}
 	if ok {
-		return e.delete()
+		if i, loaded := e.delete(); loaded {
+			m.waitUnpinned(i)
+			return *i, true
+		}
+		return nil, false
 	}
 	return nil, false
 }
@@ -218,15 +270,65 @@ func (m *Map) Delete(key interface{}) {
 	m.LoadAndDelete(key)
 }
 
+// Clear deletes all the keys of the map. As with Delete, Clear of a key
+// pinned by LoadPinned waits for the pin to be released.
+//
+// Clear drops both the read and the dirty maps and marks their entries
+// expunged, so that no store goes to them any more; a store of a key
+// concurrent with Clear may or may not survive it.
+func (m *Map) Clear() {
+	m.mu.lockMap()
+	read, _ := m.read.Load().(readOnly)
+	var removed []*interface{}
+	for _, e := range read.m {
+		if i, ok := e.remove(); ok {
+			removed = append(removed, i)
+		}
+	}
+	for _, e := range m.dirty {
+		// An entry in both maps is expunged already, and not removed
+		// again.
+		if i, ok := e.remove(); ok {
+			removed = append(removed, i)
+		}
+	}
+	m.read.Store(readOnly{})
+	m.dirty = nil
+	atomic.StoreUintptr(&m.misses, 0)
+	atomic.StoreUintptr(&m.added, 0)
+	m.mu.Unlock()
+	for _, i := range removed {
+		m.waitUnpinned(i)
+	}
+}
+
 // 删除一个 entry，其实是把 entry 的 p 修改为 nil
-func (e *entry) delete() (value interface{}, ok bool) {
+// 返回被删除的 value 的指针，LoadPinned 的 pin 以它为键
+func (e *entry) delete() (i *interface{}, ok bool) {
 	for {
 		p := atomic.LoadPointer(&e.p)
 		if p == nil || p == expunged {
 			return nil, false
 		}
 		if atomic.CompareAndSwapPointer(&e.p, p, nil) {
-			return *(*interface{})(p), true
+			return (*interface{})(p), true
+		}
+	}
+}
+
+// remove is like delete, but marks e expunged, for an entry that is being
+// dropped from the dirty map.
+func (e *entry) remove() (i *interface{}, ok bool) {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == expunged {
+			return nil, false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, expunged) {
+			if p == nil {
+				return nil, false
+			}
+			return (*interface{})(p), true
 		}
 	}
 }
@@ -234,42 +336,50 @@ func (e *entry) delete() (value interface{}, ok bool) {
 // 遍历
 // amended 为 true 时，升级 dirty 为 read
 func (m *Map) Range(f func(key, value interface{}) bool) {
+	read := m.rangeRead()
+	for k, e := range read.m {
+		v, ok := e.load()
+		if !ok {
+			continue
+		}
+		if !f(k, v) {
+			break
+		}
+	}
+}
+
+// rangeRead returns the read map holding every key of m, promoting the
+// dirty map first if it has keys the read map lacks.
+func (m *Map) rangeRead() readOnly {
 	read, _ := m.read.Load().(readOnly)
 	if read.amended {
-		m.mu.Lock()
+		m.mu.lockMap()
 		read, _ = m.read.Load().(readOnly)
 		if read.amended {
 			read = readOnly{m: m.dirty}
 			m.read.Store(read)
 			m.dirty = nil
-			m.misses = 0
+			atomic.StoreUintptr(&m.misses, 0)
+			atomic.StoreUintptr(&m.added, 0)
 		}
 		m.mu.Unlock()
 	}
-
-	for k, e := range read.m {
-		v, ok := e.load()
-		if !ok {
-			continue
-		}
-		if !f(k, v) {
-			break
-		}
-	}
+	return read
 }
 
 // misses 处理
 // misses 次数到了，升级 dirty 为 read
 // 不用考虑并发读写问题，missLocked 调用的地方都先获取了锁
 func (m *Map) missLocked() {
-	m.misses++
-	if m.misses < len(m.dirty) {
+	atomic.StoreUintptr(&m.misses, m.misses+1)
+	if m.misses < uintptr(len(m.dirty)) {
 		return
 	}
 	// miss 次数大于等于 dirty 长度时，把 dirty 升级为 read，并清空 dirty
 	m.read.Store(readOnly{m: m.dirty})
 	m.dirty = nil // 清空 dirty
-	m.misses = 0
+	atomic.StoreUintptr(&m.misses, 0)
+	atomic.StoreUintptr(&m.added, 0)
 }
 
 // 把 read 拷贝一份给 dirty
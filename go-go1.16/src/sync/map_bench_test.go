@@ -7,6 +7,7 @@ package sync_test
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -287,3 +288,24 @@ func BenchmarkDeleteCollision(b *testing.B) {
 		},
 	})
 }
+
+func BenchmarkLoadLongStringKey(b *testing.B) {
+	key := strings.Repeat("k", 256)
+	var m sync.Map
+	m.Store(key, 0)
+	b.Run("Map.Load", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				m.Load(key)
+			}
+		})
+	})
+	b.Run("MapKey.Load", func(b *testing.B) {
+		k := m.Key(key)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				k.Load()
+			}
+		})
+	})
+}
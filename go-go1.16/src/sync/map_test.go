@@ -195,3 +195,277 @@ func TestIssue40999(t *testing.T) {
 		runtime.GC()
 	}
 }
+
+func TestMapStorePointer(t *testing.T) {
+	var m sync.Map
+	v := interface{}(1)
+	m.StorePointer("k", &v)
+	if got, ok := m.Load("k"); !ok || got != 1 {
+		t.Fatalf("Load after StorePointer = %v, %v; want 1, true", got, ok)
+	}
+	w := interface{}(2)
+	m.StorePointer("k", &w)
+	if got, ok := m.Load("k"); !ok || got != 2 {
+		t.Fatalf("Load after second StorePointer = %v, %v; want 2, true", got, ok)
+	}
+
+	// Updating a key with a boxed value does not allocate.
+	if testing.Short() {
+		return
+	}
+	if n := testing.AllocsPerRun(100, func() { m.StorePointer("k", &v) }); n != 0 {
+		t.Errorf("StorePointer of an existing key: %v allocations; want 0", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { m.Store("k", 1) }); n > 1 {
+		t.Errorf("Store of an existing key: %v allocations; want at most 1", n)
+	}
+}
+
+func TestMapKey(t *testing.T) {
+	var m sync.Map
+	// Keep enough other keys in the dirty map that the lookups below
+	// don't promote it.
+	for i := 0; i < 10; i++ {
+		m.Store(i, i)
+	}
+	k := m.Key("k")
+	if got, ok := k.Load(); ok {
+		t.Fatalf("Load of a missing key = %v, true; want nil, false", got)
+	}
+	m.Store("k", 1)
+	if got, ok := k.Load(); !ok || got != 1 {
+		t.Fatalf("Load after Map.Store = %v, %v; want 1, true", got, ok)
+	}
+	k.Store(2)
+	if got, ok := m.Load("k"); !ok || got != 2 {
+		t.Fatalf("Map.Load after Store = %v, %v; want 2, true", got, ok)
+	}
+
+	// Delete the key while it is only in the dirty map, then store it
+	// again: k must not keep using the dropped slot.
+	m.Delete("k")
+	if got, ok := k.Load(); ok {
+		t.Fatalf("Load after Delete = %v, true; want nil, false", got)
+	}
+	m.Store("k", 3)
+	if got, ok := k.Load(); !ok || got != 3 {
+		t.Fatalf("Load after Delete and Map.Store = %v, %v; want 3, true", got, ok)
+	}
+
+	// Promote the dirty map and delete the key, so that the next dirty
+	// map leaves its slot out, then store the key again.
+	m.Range(func(_, _ interface{}) bool { return true })
+	m.Delete("k")
+	m.Store("new", 0)
+	m.Range(func(_, _ interface{}) bool { return true })
+	k.Store(4)
+	if got, ok := m.Load("k"); !ok || got != 4 {
+		t.Fatalf("Map.Load after the slot was dropped and Store = %v, %v; want 4, true", got, ok)
+	}
+	if got, ok := k.Load(); !ok || got != 4 {
+		t.Fatalf("Load after the slot was dropped = %v, %v; want 4, true", got, ok)
+	}
+}
+
+func TestMapRangeParallel(t *testing.T) {
+	const n = 10000
+	var m sync.Map
+	for i := 0; i < n; i++ {
+		m.Store(i, i*2)
+	}
+
+	seen := make([]int32, n)
+	m.RangeParallel(4, func(k, v interface{}) bool {
+		if v != k.(int)*2 {
+			t.Errorf("RangeParallel visited %v with value %v; want %v", k, v, k.(int)*2)
+		}
+		atomic.AddInt32(&seen[k.(int)], 1)
+		return true
+	})
+	for i, c := range seen {
+		if c != 1 {
+			t.Fatalf("RangeParallel visited key %d %d times; want 1", i, c)
+		}
+	}
+
+	// Once f returns false, each worker stops after its call in progress.
+	var calls int32
+	m.RangeParallel(4, func(_, _ interface{}) bool {
+		atomic.AddInt32(&calls, 1)
+		return false
+	})
+	if c := atomic.LoadInt32(&calls); c < 1 || c > 4 {
+		t.Fatalf("RangeParallel made %d calls after f returned false; want 1 to 4", c)
+	}
+}
+
+func TestMapLoadPinned(t *testing.T) {
+	var m sync.Map
+	if _, unpin, ok := m.LoadPinned("k"); ok {
+		t.Fatal("LoadPinned of a missing key returned ok")
+	} else {
+		unpin()
+	}
+
+	m.Store("k", 1)
+	v, unpin, ok := m.LoadPinned("k")
+	if !ok || v != 1 {
+		t.Fatalf("LoadPinned = %v, %v; want 1, true", v, ok)
+	}
+	deleted := make(chan interface{})
+	go func() {
+		v, _ := m.LoadAndDelete("k")
+		deleted <- v
+	}()
+	// The delete removes the key at once, but waits for the pin.
+	for {
+		if _, ok := m.Load("k"); !ok {
+			break
+		}
+		runtime.Gosched()
+	}
+	select {
+	case <-deleted:
+		t.Fatal("LoadAndDelete returned while the key was pinned")
+	default:
+	}
+	unpin()
+	unpin()
+	if v := <-deleted; v != 1 {
+		t.Fatalf("LoadAndDelete = %v; want 1", v)
+	}
+
+	// Without pins, deletes do not wait.
+	m.Store("k", 2)
+	m.Delete("k")
+
+	// A delete waits only for the pins of the value it removed, not
+	// for those of a value stored in the same entry after it.
+	m.Store("k", 3)
+	_, unpin, _ = m.LoadPinned("k")
+	go func() {
+		v, _ := m.LoadAndDelete("k")
+		deleted <- v
+	}()
+	for {
+		if _, ok := m.Load("k"); !ok {
+			break
+		}
+		runtime.Gosched()
+	}
+	m.Store("k", 4)
+	_, unpin4, _ := m.LoadPinned("k")
+	unpin()
+	if v := <-deleted; v != 3 {
+		t.Fatalf("LoadAndDelete = %v; want 3", v)
+	}
+	unpin4()
+	m.Delete("k")
+}
+
+func TestMapRangeFor(t *testing.T) {
+	const n = 1000
+	var m sync.Map
+	for i := 0; i < n; i++ {
+		m.Store(i, i)
+	}
+
+	// With no budget, each call visits one batch of entries.
+	var c sync.MapCursor
+	seen := make(map[interface{}]bool)
+	calls := 0
+	for {
+		calls++
+		done := m.RangeFor(0, &c, func(k, v interface{}) bool {
+			if seen[k] {
+				t.Fatalf("RangeFor visited %v twice in one pass", k)
+			}
+			seen[k] = true
+			return true
+		})
+		if done {
+			break
+		}
+	}
+	if len(seen) != n {
+		t.Fatalf("RangeFor visited %d keys; want %d", len(seen), n)
+	}
+	if calls < 2 {
+		t.Fatalf("RangeFor with no budget finished in %d call; want several", calls)
+	}
+
+	// With a large budget, one call does it, and the cursor starts over.
+	for i := 0; i < 2; i++ {
+		visited := 0
+		if !m.RangeFor(1e12, &c, func(_, _ interface{}) bool { visited++; return true }) {
+			t.Fatal("RangeFor with a large budget did not complete")
+		}
+		if visited != n {
+			t.Fatalf("pass %d visited %d keys; want %d", i, visited, n)
+		}
+	}
+}
+
+func TestMapRangeNoPromote(t *testing.T) {
+	var m sync.Map
+	for i := 0; i < 10; i++ {
+		m.Store(i, i)
+	}
+	m.Range(func(_, _ interface{}) bool { return true }) // promote 0-9
+	for i := 10; i < 20; i++ {
+		m.Store(i, i)
+	}
+	m.Delete(3)
+	m.Delete(13)
+
+	seen := make(map[interface{}]bool)
+	m.RangeNoPromote(func(k, v interface{}) bool {
+		if seen[k] {
+			t.Fatalf("RangeNoPromote visited %v twice", k)
+		}
+		seen[k] = true
+		return true
+	})
+	if len(seen) != 18 || seen[3] || seen[13] {
+		t.Fatalf("RangeNoPromote visited %v; want 0-19 but 3 and 13", seen)
+	}
+	if !m.AmendedForTest() {
+		t.Fatal("RangeNoPromote promoted the dirty map")
+	}
+}
+
+func TestMapClear(t *testing.T) {
+	var m sync.Map
+	for i := 0; i < 10; i++ {
+		m.Store(i, i)
+	}
+	m.Range(func(_, _ interface{}) bool { return true }) // promote 0-9
+	for i := 10; i < 20; i++ {
+		m.Store(i, i)
+	}
+	k := m.Key(5)
+	if v, ok := k.Load(); !ok || v != 5 {
+		t.Fatalf("MapKey.Load = %v, %v; want 5, true", v, ok)
+	}
+
+	m.Clear()
+	n := 0
+	m.Range(func(_, _ interface{}) bool { n++; return true })
+	if n != 0 {
+		t.Fatalf("Range after Clear visited %d keys; want 0", n)
+	}
+	if v, ok := k.Load(); ok {
+		t.Fatalf("MapKey.Load after Clear = %v; want none", v)
+	}
+	k.Store(50)
+	if v, ok := m.Load(5); !ok || v != 50 {
+		t.Fatalf("Load after MapKey.Store = %v, %v; want 50, true", v, ok)
+	}
+	m.Store(15, 150)
+	if v, ok := m.Load(15); !ok || v != 150 {
+		t.Fatalf("Load after Store = %v, %v; want 150, true", v, ok)
+	}
+	if _, ok := m.Load(3); ok {
+		t.Fatal("cleared key 3 came back")
+	}
+}
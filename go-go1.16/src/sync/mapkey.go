@@ -0,0 +1,70 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A MapKey is a key of a Map that remembers where the Map keeps its
+// value. Every Load or Store on a Map hashes the key and compares it
+// with the keys in the Map, which for long strings or large structs can
+// cost more than the rest of the call; a MapKey does that once and then
+// goes straight to the value until the Map drops the key's slot, after
+// which it looks the key up again.
+//
+// The Map drops the slot of a key some time after the key is deleted,
+// so a MapKey pays off for keys that are loaded or stored many times
+// between deletions.
+//
+// A MapKey is safe for use by multiple goroutines simultaneously.
+type MapKey struct {
+	m   *Map
+	key interface{}
+	e   unsafe.Pointer // *entry, or nil if not looked up yet
+}
+
+// Key returns a MapKey for key in m.
+func (m *Map) Key(key interface{}) *MapKey {
+	return &MapKey{m: m, key: key}
+}
+
+// Key returns the key k stands for.
+func (k *MapKey) Key() interface{} {
+	return k.key
+}
+
+// Load returns the value stored in the map for k's key, or nil if no
+// value is present. The ok result indicates whether value was found in
+// the map.
+func (k *MapKey) Load() (value interface{}, ok bool) {
+	// An entry stands for its key until it is expunged: until then, any
+	// store of the key goes to it, and a nil entry means the key is
+	// absent.
+	if e := (*entry)(atomic.LoadPointer(&k.e)); e != nil {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil {
+			return nil, false
+		}
+		if p != expunged {
+			return *(*interface{})(p), true
+		}
+	}
+	e, ok := k.m.loadEntry(k.key)
+	if !ok {
+		return nil, false
+	}
+	atomic.StorePointer(&k.e, unsafe.Pointer(e))
+	return e.load()
+}
+
+// Store sets the value for k's key.
+func (k *MapKey) Store(value interface{}) {
+	if e := (*entry)(atomic.LoadPointer(&k.e)); e != nil && e.tryStore(&value) {
+		return
+	}
+	k.m.store(k.key, &value)
+}
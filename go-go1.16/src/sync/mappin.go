@@ -0,0 +1,146 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// Pins.
+//
+// A pin keeps the value of a key in use: LoadAndDelete and Delete of a
+// pinned value remove it at once, so that later loads miss it, but return
+// only once the value has no pins left. A caller that frees what a value
+// holds after deleting it thus never frees it under a pinned user.
+//
+// Pins are kept per value, by the pointer an entry holds for it, and not
+// per entry: an entry takes new values after its value is deleted, and
+// the delete of one value must not wait for pins of a later one.
+//
+// A pinner registers its pin on the value pointer it loaded and then
+// checks that the entry still holds it, and a deleter looks for pins
+// after it removes the pointer. So either the pinner's check comes
+// before the removal, and then the deleter sees the pin and waits for
+// it, or the pinner sees the pointer gone and lets go of its pin.
+//
+// The pins of a Map live in a table made by its first LoadPinned, so a
+// Map that is never pinned pays only a load of the table pointer on a
+// delete, and a pinned one a load of the count of pins held.
+
+// mapPins is the pin table of a Map.
+type mapPins struct {
+	n    int32 // number of pins held, read without mu
+	mu   Mutex
+	pins map[*interface{}]*valuePins
+}
+
+// valuePins counts the pins of a value.
+type valuePins struct {
+	n        int
+	unpinned chan struct{} // closed when n drops to 0; made by a waiting deleter
+}
+
+// noUnpin is the unpin of a LoadPinned that found no value.
+func noUnpin() {}
+
+// LoadPinned returns the value stored in the map for key, as Load does,
+// and pins it: until the caller calls unpin, LoadAndDelete and Delete of
+// key do not return, although they remove key at once. Stores of key
+// are not held up; they replace the value the caller holds, and it is
+// up to the caller not to free what replaced values hold while they
+// may be in use; nor do deletes of the values that replaced the pinned
+// one wait for its pin. Calling unpin more than once is harmless.
+//
+// The caller must not delete key while it holds its pin, which would
+// deadlock. If ok is false, there is no value to pin and unpin does
+// nothing.
+func (m *Map) LoadPinned(key interface{}) (value interface{}, unpin func(), ok bool) {
+	e, ok := m.loadEntry(key)
+	if !ok {
+		return nil, noUnpin, false
+	}
+	ps := m.pins()
+	var i *interface{}
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged {
+			return nil, noUnpin, false
+		}
+		i = (*interface{})(p)
+		ps.pin(i)
+		if atomic.LoadPointer(&e.p) == p {
+			break
+		}
+		// A store replaced the value, or a delete removed it, before
+		// the pin was seen; try the next value, if any.
+		ps.unpin(i)
+	}
+	var done uint32
+	return *i, func() {
+		if atomic.CompareAndSwapUint32(&done, 0, 1) {
+			ps.unpin(i)
+		}
+	}, true
+}
+
+// pins returns the pin table of m, making it if need be.
+func (m *Map) pins() *mapPins {
+	if ps := (*mapPins)(atomic.LoadPointer(&m.pinned)); ps != nil {
+		return ps
+	}
+	ps := &mapPins{pins: make(map[*interface{}]*valuePins)}
+	if atomic.CompareAndSwapPointer(&m.pinned, nil, unsafe.Pointer(ps)) {
+		return ps
+	}
+	return (*mapPins)(atomic.LoadPointer(&m.pinned))
+}
+
+// waitUnpinned waits for the pins of i, the value the caller has just
+// removed from its entry, to be released.
+func (m *Map) waitUnpinned(i *interface{}) {
+	ps := (*mapPins)(atomic.LoadPointer(&m.pinned))
+	if ps == nil || atomic.LoadInt32(&ps.n) == 0 {
+		return
+	}
+	ps.mu.Lock()
+	p := ps.pins[i]
+	if p == nil {
+		ps.mu.Unlock()
+		return
+	}
+	if p.unpinned == nil {
+		p.unpinned = make(chan struct{})
+	}
+	ch := p.unpinned
+	ps.mu.Unlock()
+	<-ch
+}
+
+func (ps *mapPins) pin(i *interface{}) {
+	ps.mu.Lock()
+	p := ps.pins[i]
+	if p == nil {
+		p = new(valuePins)
+		ps.pins[i] = p
+	}
+	p.n++
+	atomic.AddInt32(&ps.n, 1)
+	ps.mu.Unlock()
+}
+
+func (ps *mapPins) unpin(i *interface{}) {
+	ps.mu.Lock()
+	p := ps.pins[i]
+	p.n--
+	atomic.AddInt32(&ps.n, -1)
+	if p.n == 0 {
+		delete(ps.pins, i)
+		if p.unpinned != nil {
+			close(p.unpinned)
+		}
+	}
+	ps.mu.Unlock()
+}
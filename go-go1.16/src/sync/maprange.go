@@ -0,0 +1,175 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// mapKV is a key of a Map and its entry, as copied by snapshot.
+type mapKV struct {
+	k interface{}
+	e *entry
+}
+
+// snapshot returns the keys of m and their entries.
+func (m *Map) snapshot() []mapKV {
+	read := m.rangeRead()
+	snap := make([]mapKV, 0, len(read.m))
+	for k, e := range read.m {
+		snap = append(snap, mapKV{k, e})
+	}
+	return snap
+}
+
+// RangeNoPromote calls f for each key and value present in the map, as
+// Range does, but without promoting the map's recent stores.
+//
+// Range first moves the keys stored since the last promotion into the
+// part of the map that loads read without locking, which costs a copy
+// of the map at the next store of a new key; a program that calls Range
+// often while it keeps storing new keys pays for that copy again and
+// again. RangeNoPromote leaves the map as it is: it visits the keys in
+// the lock-free part, then, if there are others, copies them under the
+// map's lock and visits them after unlocking it. It suits scans for
+// monitoring that should not change how the map performs.
+func (m *Map) RangeNoPromote(f func(key, value interface{}) bool) {
+	read, _ := m.read.Load().(readOnly)
+	for k, e := range read.m {
+		if v, ok := e.load(); ok && !f(k, v) {
+			return
+		}
+	}
+	if !read.amended {
+		return
+	}
+
+	// Collect the keys not visited above: those of the dirty map, or of
+	// the read map if the dirty map has been promoted since.
+	var rest []mapKV
+	m.mu.lockMap()
+	src := m.dirty
+	if src == nil {
+		cur, _ := m.read.Load().(readOnly)
+		src = cur.m
+	}
+	for k, e := range src {
+		if _, seen := read.m[k]; !seen {
+			rest = append(rest, mapKV{k, e})
+		}
+	}
+	m.mu.Unlock()
+	for _, p := range rest {
+		if v, ok := p.e.load(); ok && !f(p.k, v) {
+			return
+		}
+	}
+}
+
+// rangeParallelChunk is the number of entries a worker of RangeParallel
+// claims at a time: enough to make claiming cheap, few enough that the
+// workers finish at about the same time.
+const rangeParallelChunk = 256
+
+// RangeParallel calls f for each key and value present in the map, as
+// Range does, but from workers goroutines at once, for maps large
+// enough and work per entry heavy enough that one goroutine is too
+// slow. If workers is zero or less, RangeParallel uses GOMAXPROCS
+// workers. f must be safe to call concurrently. If f returns false for
+// any entry, the workers stop after the calls in progress. Either way,
+// RangeParallel returns once every call of f has returned.
+//
+// RangeParallel copies the keys of m once up front and splits the copy
+// among the workers; the values are loaded as each key is visited. So,
+// as with Range, no key is visited more than once, a key stored or
+// deleted concurrently may or may not be visited, and the value seen
+// for a key is one stored in it at some time during the call.
+func (m *Map) RangeParallel(workers int, f func(key, value interface{}) bool) {
+	if workers <= 0 {
+		workers = runtime_gomaxprocs()
+	}
+	snap := m.snapshot()
+	if max := (len(snap) + rangeParallelChunk - 1) / rangeParallelChunk; workers > max {
+		workers = max
+	}
+
+	var next int64 // index of the next chunk to claim
+	var stop int32
+	var wg WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&stop) == 0 {
+				lo := int(atomic.AddInt64(&next, rangeParallelChunk)) - rangeParallelChunk
+				if lo >= len(snap) {
+					return
+				}
+				hi := lo + rangeParallelChunk
+				if hi > len(snap) {
+					hi = len(snap)
+				}
+				for _, p := range snap[lo:hi] {
+					v, ok := p.e.load()
+					if !ok {
+						continue
+					}
+					if !f(p.k, v) {
+						atomic.StoreInt32(&stop, 1)
+						return
+					}
+					if atomic.LoadInt32(&stop) != 0 {
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// A MapCursor records how far RangeFor has got through a Map, for the
+// next call to go on from there. The zero MapCursor starts at the
+// beginning. A MapCursor belongs to one Map and must not be used by
+// multiple goroutines simultaneously.
+type MapCursor struct {
+	snap []mapKV
+	next int
+}
+
+// rangeForCheck is the number of entries RangeFor visits between looks
+// at the clock.
+const rangeForCheck = 64
+
+// RangeFor calls f for each key and value present in the map, as Range
+// does, for at most about d nanoseconds, and reports whether it got
+// through the map. If it did not, c records where it stopped, and the
+// next call of RangeFor with c goes on from there; a caller such as a
+// health check can thus go through a huge map in slices that fit its
+// latency budget. RangeFor looks at the clock every few entries, so the
+// budget is exceeded by up to that many calls of f.
+//
+// A pass over the map starts with a zero c, or after a call that
+// completed it, by copying the keys of m into c; the values are loaded
+// as the keys are visited. So keys stored after the start of a pass are
+// not visited in it, and keys deleted since are skipped. If f returns
+// false, the pass ends there, and RangeFor reports it complete.
+func (m *Map) RangeFor(d int64, c *MapCursor, f func(key, value interface{}) bool) (completed bool) {
+	if c.snap == nil {
+		c.snap = m.snapshot()
+		c.next = 0
+	}
+	deadline := nanotime() + d
+	for c.next < len(c.snap) {
+		p := c.snap[c.next]
+		c.next++
+		if v, ok := p.e.load(); ok && !f(p.k, v) {
+			break
+		}
+		if c.next%rangeForCheck == 0 && c.next < len(c.snap) && nanotime() >= deadline {
+			return false
+		}
+	}
+	*c = MapCursor{}
+	return true
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// ErrCanceled is the error reported by a Context made by MergeCancel
+// once its cancel function has been called.
+var ErrCanceled error = syncError("sync: canceled")
+
+// mergeBatch is the number of parents a goroutine of MergeCancel
+// watches.
+const mergeBatch = 4
+
+// MergeCancel returns a Context that is done as soon as any of parents
+// is, with the Err of that parent, or once cancel is called, with
+// ErrCanceled. It lets an operation of this package give up on any of
+// several reasons at once, such as a request's context and a server's
+// shutdown Signal. Nil parents, and parents whose Done returns nil, are
+// ignored.
+//
+// The returned Context is only a Context of this package, with no
+// deadline or values. It is a *Signal.
+//
+// MergeCancel watches the parents from a goroutine for every four of
+// them, with none at all if a parent is already done or none can be.
+// Callers must call cancel once they are done with the Context, to stop
+// the goroutines; calling it more than once is harmless.
+func MergeCancel(parents ...Context) (ctx Context, cancel func()) {
+	s := new(Signal)
+	var ps []Context
+	var ds []<-chan struct{}
+	for _, p := range parents {
+		if p == nil {
+			continue
+		}
+		d := p.Done()
+		if d == nil {
+			continue
+		}
+		select {
+		case <-d:
+			s.Fire(p.Err())
+			return s, func() {}
+		default:
+		}
+		ps = append(ps, p)
+		ds = append(ds, d)
+	}
+	if len(ps) > 0 {
+		stop := s.Done()
+		for i := 0; i < len(ps); i += mergeBatch {
+			j := i + mergeBatch
+			if j > len(ps) {
+				j = len(ps)
+			}
+			go mergeWatch(s, stop, ps[i:j], ds[i:j])
+		}
+	}
+	return s, func() { s.Fire(ErrCanceled) }
+}
+
+// mergeWatch fires s with the Err of the first of up to mergeBatch
+// parents to be done, unless stop is closed first.
+func mergeWatch(s *Signal, stop <-chan struct{}, ps []Context, ds []<-chan struct{}) {
+	var d [mergeBatch]<-chan struct{} // nil past len(ds), never ready
+	copy(d[:], ds)
+	var i int
+	select {
+	case <-stop:
+		return
+	case <-d[0]:
+		i = 0
+	case <-d[1]:
+		i = 1
+	case <-d[2]:
+		i = 2
+	case <-d[3]:
+		i = 3
+	}
+	s.Fire(ps[i].Err())
+}
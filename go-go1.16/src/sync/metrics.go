@@ -0,0 +1,291 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Metric is one value published by a primitive registered with
+// RegisterMetrics. It is shaped to map directly onto expvar variables or
+// Prometheus samples: Name is the metric and Object and Primitive are
+// labels.
+type Metric struct {
+	Object    string // the name the primitive was registered under
+	Primitive string // "Mutex", "RWMutex", "Semaphore", "Pool", "Map" or "Locker"
+	Name      string // what is measured, such as "waiters" or "misses"
+	Counter   bool   // Value only grows; otherwise it is a gauge
+	Value     int64
+}
+
+// A metricSource publishes the metrics of one registered primitive.
+type metricSource interface {
+	primitive() string
+	metrics(emit func(name string, counter bool, v int64))
+}
+
+// A lockMetricSource is a metricSource for a lock, whose blocked
+// acquisitions are counted in a lockMetrics.
+type lockMetricSource interface {
+	metricSource
+	lock() (addr unsafe.Pointer, lm *lockMetrics)
+}
+
+// metricSources holds the registered primitives as a
+// map[string]metricSource, so that Metrics reads it without waiting for
+// registrations.
+var metricSources COWValue
+
+// lockMetrics counts the blocked acquisitions of a registered lock. The
+// counters are kept by the address of the lock, in metricLocks, so that
+// lockWait.end can find them without taking a lock.
+type lockMetrics struct {
+	waits    uint64
+	waitTime uint64
+}
+
+var metricLocks COWValue // map[uintptr]*lockMetrics
+
+// RegisterMetrics registers x, which must be a *Mutex, *RWMutex,
+// *Semaphore, *Pool or *Map, to publish its metrics under name, until
+// UnregisterMetrics is called with name. It panics if name is already
+// registered or x is of another type. The metrics of each are:
+//
+//    Mutex      locked, waiters, waits, wait_ns
+//    RWMutex    readers, writer, waits, wait_ns
+//    Semaphore  size, held, waiters
+//    Pool       retained, gets, misses, puts, drops
+//    Map        size, misses
+//
+// waits and wait_ns count the acquisitions that blocked and the
+// nanoseconds they blocked for, since registration. The readers of an
+// RWMutex include those waiting for a writer. The metrics of a Pool are
+// those of Pool.Stats; registering a Pool turns on its counting, see
+// Pool.SetCounting, so gets, misses and puts count from then on. The
+// misses of a Map are the loads that missed its read-only part since it
+// last promoted its dirty part.
+//
+// Registration is opt-in because counting waits costs a little on the
+// slow paths of registered locks; other primitives cost nothing.
+func RegisterMetrics(name string, x interface{}) {
+	var src metricSource
+	switch x := x.(type) {
+	case *Mutex:
+		src = &mutexMetrics{x, new(lockMetrics)}
+	case *RWMutex:
+		src = &rwMutexMetrics{x, new(lockMetrics)}
+	case *Semaphore:
+		src = semaphoreMetrics{x}
+	case *Pool:
+		x.SetCounting(true)
+		src = poolMetrics{x}
+	case *Map:
+		src = mapMetrics{x}
+	default:
+		panic("sync: RegisterMetrics of unsupported type")
+	}
+	registerMetricSource(name, src)
+}
+
+func registerMetricSource(name string, src metricSource) {
+	metricSources.Write(func(v interface{}) interface{} {
+		old, _ := v.(map[string]metricSource)
+		if _, dup := old[name]; dup {
+			panic("sync: RegisterMetrics called twice for " + name)
+		}
+		m := make(map[string]metricSource, len(old)+1)
+		for k, v := range old {
+			m[k] = v
+		}
+		m[name] = src
+		if ls, ok := src.(lockMetricSource); ok {
+			addLockMetrics(ls.lock())
+		}
+		return m
+	})
+}
+
+// UnregisterMetrics removes the primitive registered under name, if
+// any. A primitive that is discarded should be unregistered first.
+func UnregisterMetrics(name string) {
+	metricSources.Write(func(v interface{}) interface{} {
+		old, _ := v.(map[string]metricSource)
+		src, ok := old[name]
+		if !ok {
+			return v
+		}
+		m := make(map[string]metricSource, len(old))
+		for k, v := range old {
+			if k != name {
+				m[k] = v
+			}
+		}
+		if ls, ok := src.(lockMetricSource); ok {
+			addr, _ := ls.lock()
+			removeLockMetrics(addr)
+		}
+		return m
+	})
+}
+
+// Metrics returns the current metrics of all registered primitives,
+// ordered by Object. Metrics takes no lock that the users of the
+// primitives or RegisterMetrics take, so scraping the metrics adds no
+// contention to the locks being measured. The values of each primitive
+// are read while it is in use, so they are only approximately
+// consistent with each other.
+func Metrics() []Metric {
+	srcs, _ := metricSources.Load().(map[string]metricSource)
+	names := make([]string, 0, len(srcs))
+	for name := range srcs {
+		names = append(names, name)
+	}
+
+	sortSlice(len(names), func(i, j int) bool { return names[i] < names[j] }, func(i, j int) { names[i], names[j] = names[j], names[i] })
+	var ms []Metric
+	for _, name := range names {
+		src := srcs[name]
+		prim := src.primitive()
+		src.metrics(func(metric string, counter bool, v int64) {
+			ms = append(ms, Metric{Object: name, Primitive: prim, Name: metric, Counter: counter, Value: v})
+		})
+	}
+	return ms
+}
+
+// addLockMetrics starts counting the blocked acquisitions of the lock at
+// addr in lm, and removeLockMetrics stops it.
+func addLockMetrics(addr unsafe.Pointer, lm *lockMetrics) {
+	metricLocks.Write(func(v interface{}) interface{} {
+		old, _ := v.(map[uintptr]*lockMetrics)
+		m := make(map[uintptr]*lockMetrics, len(old)+1)
+		for k, v := range old {
+			m[k] = v
+		}
+		m[uintptr(addr)] = lm
+		setLockEvents(lockEventMetrics, true)
+		return m
+	})
+}
+
+func removeLockMetrics(addr unsafe.Pointer) {
+	metricLocks.Write(func(v interface{}) interface{} {
+		old, _ := v.(map[uintptr]*lockMetrics)
+		m := make(map[uintptr]*lockMetrics, len(old))
+		for k, v := range old {
+			if k != uintptr(addr) {
+				m[k] = v
+			}
+		}
+		setLockEvents(lockEventMetrics, len(m) > 0)
+		return m
+	})
+}
+
+// countWait counts a blocked acquisition of the lock at addr that took
+// wait nanoseconds, if the lock is registered.
+func countWait(addr unsafe.Pointer, wait int64) {
+	m, _ := metricLocks.Load().(map[uintptr]*lockMetrics)
+	if lm := m[uintptr(addr)]; lm != nil {
+		atomic.AddUint64(&lm.waits, 1)
+		atomic.AddUint64(&lm.waitTime, uint64(wait))
+	}
+}
+
+func (lm *lockMetrics) emit(emit func(name string, counter bool, v int64)) {
+	emit("waits", true, int64(atomic.LoadUint64(&lm.waits)))
+	emit("wait_ns", true, int64(atomic.LoadUint64(&lm.waitTime)))
+}
+
+type mutexMetrics struct {
+	m  *Mutex
+	lm *lockMetrics
+}
+
+func (*mutexMetrics) primitive() string { return "Mutex" }
+
+func (s *mutexMetrics) lock() (unsafe.Pointer, *lockMetrics) { return unsafe.Pointer(s.m), s.lm }
+
+func (s *mutexMetrics) metrics(emit func(name string, counter bool, v int64)) {
+	state := atomic.LoadInt32(&s.m.state)
+	emit("locked", false, int64(state&mutexLocked))
+	emit("waiters", false, int64(state>>mutexWaiterShift))
+	s.lm.emit(emit)
+}
+
+type rwMutexMetrics struct {
+	rw *RWMutex
+	lm *lockMetrics
+}
+
+func (*rwMutexMetrics) primitive() string { return "RWMutex" }
+
+func (s *rwMutexMetrics) lock() (unsafe.Pointer, *lockMetrics) { return unsafe.Pointer(s.rw), s.lm }
+
+func (s *rwMutexMetrics) metrics(emit func(name string, counter bool, v int64)) {
+	// readerCount counts the readers holding the lock or waiting for
+	// it, less rwmutexMaxReaders while a writer holds or waits for it.
+	readers := atomic.LoadInt32(&s.rw.readerCount)
+	writer := int64(0)
+	if readers < 0 {
+		readers += rwmutexMaxReaders
+		writer = 1
+	}
+	emit("readers", false, int64(readers))
+	emit("writer", false, writer)
+	s.lm.emit(emit)
+}
+
+type semaphoreMetrics struct{ s *Semaphore }
+
+func (semaphoreMetrics) primitive() string { return "Semaphore" }
+
+func (s semaphoreMetrics) metrics(emit func(name string, counter bool, v int64)) {
+	emit("size", false, s.s.size)
+	emit("held", false, atomic.LoadInt64(&s.s.cur))
+	emit("waiters", false, atomic.LoadInt64(&s.s.waiters))
+}
+
+type poolMetrics struct{ p *Pool }
+
+func (poolMetrics) primitive() string { return "Pool" }
+
+func (s poolMetrics) metrics(emit func(name string, counter bool, v int64)) {
+	st := s.p.Stats()
+	emit("retained", false, int64(st.Retained))
+	emit("gets", true, int64(st.Gets))
+	emit("misses", true, int64(st.Misses))
+	emit("puts", true, int64(st.Puts))
+	emit("drops", true, int64(st.Drops))
+}
+
+type mapMetrics struct{ m *Map }
+
+func (mapMetrics) primitive() string { return "Map" }
+
+func (s mapMetrics) metrics(emit func(name string, counter bool, v int64)) {
+	size, misses := s.m.sizeAndMisses()
+	emit("size", false, int64(size))
+	emit("misses", false, int64(misses))
+}
+
+// sizeAndMisses returns the number of entries in m and its misses.
+// It does not take m.mu: it counts the entries of the read-only part,
+// which is never modified once published, and adds the number of keys
+// only in the dirty part. If m promotes its dirty part meanwhile, the
+// size may be off by that number.
+func (m *Map) sizeAndMisses() (size, misses int) {
+	read, _ := m.read.Load().(readOnly)
+	for _, e := range read.m {
+		if _, ok := e.load(); ok {
+			size++
+		}
+	}
+	if read.amended {
+		size += int(atomic.LoadUintptr(&m.added))
+	}
+	return size, int(atomic.LoadUintptr(&m.misses))
+}
@@ -0,0 +1,181 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"testing"
+	"time"
+)
+
+// metricValues returns the metrics of the primitive registered under
+// object, by name.
+func metricValues(object string) map[string]int64 {
+	vs := make(map[string]int64)
+	for _, m := range Metrics() {
+		if m.Object == object {
+			vs[m.Name] = m.Value
+		}
+	}
+	return vs
+}
+
+func TestMetrics(t *testing.T) {
+	var mu Mutex
+	var rw RWMutex
+	var m Map
+	var p Pool
+	s := NewSemaphore(10)
+	RegisterMetrics("test.mu", &mu)
+	RegisterMetrics("test.rw", &rw)
+	RegisterMetrics("test.map", &m)
+	RegisterMetrics("test.pool", &p)
+	RegisterMetrics("test.sema", s)
+	defer func() {
+		for _, name := range []string{"test.mu", "test.rw", "test.map", "test.pool", "test.sema"} {
+			UnregisterMetrics(name)
+		}
+	}()
+
+	blockOn(mu.Lock, mu.Unlock, mu.Lock, mu.Unlock)
+	mu.Lock()
+	if vs := metricValues("test.mu"); vs["locked"] != 1 || vs["waits"] != 1 || vs["wait_ns"] <= 0 {
+		t.Errorf("Mutex metrics = %v, want locked 1 and 1 wait", vs)
+	}
+	mu.Unlock()
+
+	rw.RLock()
+	rw.RLock()
+	if vs := metricValues("test.rw"); vs["readers"] != 2 || vs["writer"] != 0 || vs["waits"] != 0 {
+		t.Errorf("RWMutex metrics = %v, want 2 readers", vs)
+	}
+	rw.RUnlock()
+	rw.RUnlock()
+	blockOn(rw.Lock, rw.Unlock, rw.RLock, rw.RUnlock)
+	rw.Lock()
+	if vs := metricValues("test.rw"); vs["readers"] != 0 || vs["writer"] != 1 || vs["waits"] != 1 {
+		t.Errorf("RWMutex metrics = %v, want a writer and 1 wait", vs)
+	}
+	rw.Unlock()
+
+	m.Store(1, 1)
+	m.Store(2, 2)
+	m.Delete(1)
+	if vs := metricValues("test.map"); vs["size"] != 1 {
+		t.Errorf("Map metrics = %v, want size 1", vs)
+	}
+
+	// Registration turned on the counting of the pool.
+	p.Get()
+	p.Put(1)
+	if vs := metricValues("test.pool"); vs["gets"] != 1 || vs["misses"] != 1 || vs["puts"] != 1 {
+		t.Errorf("Pool metrics = %v, want 1 get, 1 miss and 1 put", vs)
+	}
+
+	s.TryAcquire(3)
+	if vs := metricValues("test.sema"); vs["size"] != 10 || vs["held"] != 3 || vs["waiters"] != 0 {
+		t.Errorf("Semaphore metrics = %v, want size 10 and 3 held", vs)
+	}
+
+	UnregisterMetrics("test.mu")
+	if vs := metricValues("test.mu"); len(vs) != 0 {
+		t.Errorf("metrics after UnregisterMetrics = %v", vs)
+	}
+	RegisterMetrics("test.mu", &mu)
+	if vs := metricValues("test.mu"); vs["waits"] != 0 {
+		t.Errorf("Mutex metrics after registering again = %v, want no waits", vs)
+	}
+}
+
+func TestMetricsTakeNoLocks(t *testing.T) {
+	var m Map
+	s := NewSemaphore(10)
+	RegisterMetrics("test.map", &m)
+	defer UnregisterMetrics("test.map")
+	RegisterMetrics("test.sema", s)
+	defer UnregisterMetrics("test.sema")
+	m.Store(1, 1)
+	m.Range(func(_, _ interface{}) bool { return true }) // promote
+	m.Store(2, 2)
+	m.Store(3, 3)
+	m.Delete(3)
+	s.TryAcquire(4)
+
+	m.MutexForTest().Lock()
+	s.MutexForTest().Lock()
+	done := make(chan bool)
+	go func() {
+		if vs := metricValues("test.map"); vs["size"] != 2 {
+			t.Errorf("Map metrics = %v, want size 2", vs)
+		}
+		if vs := metricValues("test.sema"); vs["held"] != 4 {
+			t.Errorf("Semaphore metrics = %v, want 4 held", vs)
+		}
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Metrics blocked on the lock of a registered primitive")
+	}
+	s.MutexForTest().Unlock()
+	m.MutexForTest().Unlock()
+}
+
+func TestRegisterMetricsPanics(t *testing.T) {
+	var mu Mutex
+	RegisterMetrics("test.dup", &mu)
+	defer UnregisterMetrics("test.dup")
+	for _, x := range []interface{}{&mu, new(WaitGroup)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterMetrics(%T) did not panic", x)
+				}
+			}()
+			name := "test.dup"
+			if _, ok := x.(*WaitGroup); ok {
+				name = "test.wg"
+			}
+			RegisterMetrics(name, x)
+		}()
+	}
+}
+
+func TestInstrumentLocker(t *testing.T) {
+	c := newFakeClock()
+	defer SetClockForTesting(SetClockForTesting(c))
+	var rw RWMutex
+	l := InstrumentLocker(rw.RLocker(), "test.locker")
+	defer UnregisterMetrics("test.locker")
+
+	l.Lock()
+	c.Advance(int64(3 * time.Millisecond))
+	l.Lock() // a second reader
+	c.Advance(int64(2 * time.Millisecond))
+	l.Unlock()
+	if got := metricValues("test.locker"); got["held"] != 1 || got["hold_ns"] != 0 {
+		t.Fatalf("metrics while held = %v; want held 1, hold_ns 0", got)
+	}
+	l.Unlock()
+	want := map[string]int64{
+		"held":     0,
+		"waiters":  0,
+		"acquires": 2,
+		"wait_ns":  0,
+		"hold_ns":  int64(5 * time.Millisecond),
+	}
+	got := metricValues("test.locker")
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("%s = %d; want %d", name, got[name], v)
+		}
+	}
+	for _, m := range Metrics() {
+		if m.Object == "test.locker" && m.Primitive != "Locker" {
+			t.Errorf("Primitive = %q; want Locker", m.Primitive)
+		}
+	}
+}
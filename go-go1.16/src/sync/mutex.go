@@ -12,6 +12,7 @@ package sync
 
 import (
 	"internal/race"
+	"internal/synchook"
 	"sync/atomic"
 	"unsafe"
 )
@@ -63,6 +64,8 @@ const (
 	// Normal mode has considerably better performance as a goroutine can acquire
 	// a mutex several times in a row even if there are blocked waiters.
 	// Starvation mode is important to prevent pathological cases of tail latency.
+	//
+	// The 1ms threshold is the default; SetStarvationThreshold changes it.
 	starvationThresholdNs = 1e6 // 等待超过 1 毫秒，饥饿
 )
 
@@ -72,28 +75,84 @@ const (
 func (m *Mutex) Lock() {
 	// Fast path: grab unlocked mutex.
 	// 幸运 case：锁是初始化状态, 直接上锁返回
+	if syncChaos {
+		chaosPause()
+	}
 	if atomic.CompareAndSwapInt32(&m.state, 0, mutexLocked) {
 		if race.Enabled {
 			race.Acquire(unsafe.Pointer(m))
 		}
+		if syncDebug {
+			recordLockOp(unsafe.Pointer(m), lockOpLock)
+		}
 		return
 	}
 	// Slow path (outlined so that the fast path can be inlined)
-	m.lockSlow()
+	m.lockSlow(LockMutex)
+	if syncDebug {
+		recordLockOp(unsafe.Pointer(m), lockOpLock)
+	}
+}
+
+// TryLock tries to lock m and reports whether it succeeded.
+// It never blocks, and it fails rather than take a mutex in
+// starvation mode, which belongs to the goroutines queued for it.
+func (m *Mutex) TryLock() bool {
+	old := m.state
+	if old&(mutexLocked|mutexStarving) != 0 {
+		return false
+	}
+	// There may be a goroutine waiting for the mutex, but we are
+	// running now and can try to grab the mutex before that
+	// goroutine wakes up.
+	if !atomic.CompareAndSwapInt32(&m.state, old, old|mutexLocked) {
+		return false
+	}
+	if race.Enabled {
+		race.Acquire(unsafe.Pointer(m))
+	}
+	if syncDebug {
+		recordLockOp(unsafe.Pointer(m), lockOpLock)
+	}
+	return true
+}
+
+// lockMap is Lock for the internal lock of a Map, which reports its waits
+// as lock events of kind LockMap, from the method of the Map.
+func (m *Mutex) lockMap() {
+	if syncChaos {
+		chaosPause()
+	}
+	if atomic.CompareAndSwapInt32(&m.state, 0, mutexLocked) {
+		if race.Enabled {
+			race.Acquire(unsafe.Pointer(m))
+		}
+	} else {
+		m.lockSlow(LockMap)
+	}
+	if syncDebug {
+		recordLockOp(unsafe.Pointer(m), lockOpLock)
+	}
 }
 
-func (m *Mutex) lockSlow() {
+// lockSlow tracks a blocked acquisition as a lockWait of the given kind
+// and returns it. A plain Mutex or the lock of a Map ends the wait here;
+// the Mutex of an RWMutex leaves that to the RWMutex, which may block
+// further.
+func (m *Mutex) lockSlow(kind LockKind) (w lockWait) {
+	schedPoint(synchook.Preempt, &m.sema)
 	var waitStartTime int64
 	starving := false // 饥饿标志
 	awoke := false	//唤醒标志
 	iter := 0 // 自旋次数
+	budget := spinBudget()
 	old := m.state
 	for {
 		// Don't spin in starvation mode, ownership is handed off to waiters
 		// so we won't be able to acquire the mutex anyway.
 		// 锁被持有 & 当前是非饥饿状态 & 满足自旋条件，进行自旋操作
 		// 如果是饥饿模式，那就别自旋了，赶紧给老同志让路
-		if old&(mutexLocked|mutexStarving) == mutexLocked && runtime_canSpin(iter) {
+		if old&(mutexLocked|mutexStarving) == mutexLocked && runtime_canSpin(iter, budget) {
 			// Active spinning makes sense.
 			// Try to set mutexWoken flag to inform Unlock
 			// to not wake other blocked goroutines.
@@ -131,26 +190,43 @@ func (m *Mutex) lockSlow() {
 			// The goroutine has been woken from sleep,
 			// so we need to reset the flag in either case.
 			if new&mutexWoken == 0 {
-				throw("sync: inconsistent mutex state")
+				throw(withLockHistory(unsafe.Pointer(m), "sync: inconsistent mutex state"))
 			}
 			new &^= mutexWoken
 		}
+		if syncChaos {
+			chaosPause()
+		}
 		// 成功设置新状态
 		if atomic.CompareAndSwapInt32(&m.state, old, new) {
 			// 不是饥饿模式，锁也是被释放的状态，说明成功获取到了锁，直接返回
 			if old&(mutexLocked|mutexStarving) == 0 {
+				if waitStartTime == 0 && iter > 0 {
+					recordSpin(true)
+				}
 				break // locked the mutex with CAS
 			}
 			// If we were already waiting before, queue at the front of the queue.
 			// 如果之前就在 waiter 队列里面，则把它放到队列的最前面，否则就放到最后面
 			queueLifo := waitStartTime != 0
 			if waitStartTime == 0 {
+				if iter > 0 {
+					recordSpin(false)
+				}
 				// 记录第一次执行到这里的时间，其实也就是开始执行的时间
-				waitStartTime = runtime_nanotime()
+				waitStartTime = nanotime()
+				if lockObserved() {
+					w.begin(unsafe.Pointer(m), kind, waitStartTime, 4)
+				}
 			}
+			schedPoint(synchook.Park, &m.sema)
 			runtime_SemacquireMutex(&m.sema, queueLifo, 1) // 阻塞等待
+			schedPoint(synchook.Woken, &m.sema)
+			if syncChaos {
+				chaosPause()
+			}
 			// 执行这一句的时候，次 goroutine 已经被唤醒了
-			starving = starving || runtime_nanotime()-waitStartTime > starvationThresholdNs // 判断是否满足饥饿条件：距离上次执行的时间已经超过了 1 毫秒
+			starving = starving || nanotime()-waitStartTime > starvationThreshold() // 判断是否满足饥饿条件：距离上次执行的时间已经超过了 1 毫秒
 			old = m.state
 			if old&mutexStarving != 0 { // 饥饿模式，直接抢到锁，返回
 				// If this goroutine was woken and mutex is in starvation mode,
@@ -158,7 +234,7 @@ func (m *Mutex) lockSlow() {
 				// inconsistent state: mutexLocked is not set and we are still
 				// accounted as waiter. Fix that.
 				if old&(mutexLocked|mutexWoken) != 0 || old>>mutexWaiterShift == 0 {
-					throw("sync: inconsistent mutex state")
+					throw(withLockHistory(unsafe.Pointer(m), "sync: inconsistent mutex state"))
 				}
 				// 加锁，并将 waiter 数 -1
 				// 假设现在的状态是 11100
@@ -190,6 +266,10 @@ func (m *Mutex) lockSlow() {
 	if race.Enabled {
 		race.Acquire(unsafe.Pointer(m))
 	}
+	if kind != LockRWMutex {
+		w.end(4)
+	}
+	return w
 }
 
 // Unlock unlocks m.
@@ -203,6 +283,9 @@ func (m *Mutex) Unlock() {
 		_ = m.state
 		race.Release(unsafe.Pointer(m))
 	}
+	if syncDebug {
+		recordLockOp(unsafe.Pointer(m), lockOpUnlock)
+	}
 
 	// Fast path: drop lock bit.
 	// 这里已经释放了锁，但如果是饥饿模式，那新来的 goroutine 也不会抢夺锁，这是和上个版本不同的地方
@@ -216,8 +299,9 @@ func (m *Mutex) Unlock() {
 
 func (m *Mutex) unlockSlow(new int32) {
 	if (new+mutexLocked)&mutexLocked == 0 {
-		throw("sync: unlock of unlocked mutex")
+		throw(withLockHistory(unsafe.Pointer(m), "sync: unlock of unlocked mutex"))
 	}
+	schedPoint(synchook.Preempt, &m.sema)
 	// 非饥饿模式，尝试唤醒一个 waiter
 	if new&mutexStarving == 0 {
 		old := new
@@ -233,7 +317,11 @@ func (m *Mutex) unlockSlow(new int32) {
 			}
 			// Grab the right to wake someone.
 			new = (old - 1<<mutexWaiterShift) | mutexWoken
+			if syncChaos {
+				chaosPause()
+			}
 			if atomic.CompareAndSwapInt32(&m.state, old, new) {
+				schedPoint(synchook.Wake, &m.sema)
 				runtime_Semrelease(&m.sema, false, 1)
 				return
 			}
@@ -245,6 +333,7 @@ func (m *Mutex) unlockSlow(new int32) {
 		// Note: mutexLocked is not set, the waiter will set it after wakeup.
 		// But mutex is still considered locked if mutexStarving is set,
 		// so new coming goroutines won't acquire it.
+		schedPoint(synchook.Wake, &m.sema)
 		runtime_Semrelease(&m.sema, true, 1)
 	}
 }
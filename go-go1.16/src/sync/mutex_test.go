@@ -81,6 +81,37 @@ func TestMutex(t *testing.T) {
 	}
 }
 
+func TestMutexTryLock(t *testing.T) {
+	var m Mutex
+	if !m.TryLock() {
+		t.Fatal("TryLock failed on an unlocked mutex")
+	}
+	if m.TryLock() {
+		t.Fatal("TryLock succeeded on a locked mutex")
+	}
+	m.Unlock()
+	if !m.TryLock() {
+		t.Fatal("TryLock failed after Unlock")
+	}
+	m.Unlock()
+
+	c := make(chan bool)
+	for i := 0; i < 10; i++ {
+		go func() {
+			for i := 0; i < 1000; i++ {
+				if !m.TryLock() {
+					m.Lock()
+				}
+				m.Unlock()
+			}
+			c <- true
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		<-c
+	}
+}
+
 var misuseTests = []struct {
 	name string
 	f    func()
@@ -0,0 +1,55 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A Notifier lets goroutines wait for another goroutine to announce an
+// event. It is like a Cond without a Locker, except that waiting yields
+// a channel, so waiters can also select on other channels, such as a
+// timer or a context's Done channel.
+//
+// The zero Notifier is ready for use. A Notifier must not be copied
+// after first use.
+type Notifier struct {
+	mu Mutex
+	ch chan struct{} // closed by the next Broadcast; nil if no one waits
+}
+
+// Wait returns a channel that the next call to Broadcast closes.
+// Broadcasts made before Wait do not affect the channel, so to avoid
+// missing an event, a goroutine should call Wait before checking the
+// state that the event announces changes to:
+//
+//    for {
+//        ch := n.Wait()
+//        if condition() {
+//            break
+//        }
+//        select {
+//        case <-ch:
+//        case <-ctx.Done():
+//            return ctx.Err()
+//        }
+//    }
+//
+func (n *Notifier) Wait() <-chan struct{} {
+	n.mu.Lock()
+	if n.ch == nil {
+		n.ch = make(chan struct{})
+	}
+	ch := n.ch
+	n.mu.Unlock()
+	return ch
+}
+
+// Broadcast wakes every goroutine waiting on n, by closing the channel
+// returned by all earlier calls to Wait.
+func (n *Notifier) Broadcast() {
+	n.mu.Lock()
+	if n.ch != nil {
+		close(n.ch)
+		n.ch = nil
+	}
+	n.mu.Unlock()
+}
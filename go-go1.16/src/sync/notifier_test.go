@@ -0,0 +1,84 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"testing"
+	"time"
+)
+
+func TestNotifier(t *testing.T) {
+	var n Notifier
+	n.Broadcast() // no waiters
+
+	ch1 := n.Wait()
+	ch2 := n.Wait()
+	select {
+	case <-ch1:
+		t.Fatal("Wait channel closed before Broadcast")
+	default:
+	}
+	n.Broadcast()
+	<-ch1
+	<-ch2
+
+	ch3 := n.Wait()
+	select {
+	case <-ch3:
+		t.Fatal("earlier Broadcast closed a new Wait channel")
+	default:
+	}
+}
+
+func TestNotifierSelect(t *testing.T) {
+	var (
+		n     Notifier
+		mu    Mutex
+		count int
+	)
+	const N = 100
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func() {
+			for {
+				ch := n.Wait()
+				mu.Lock()
+				c := count
+				mu.Unlock()
+				if c == N {
+					done <- true
+					return
+				}
+				select {
+				case <-ch:
+				case <-time.After(time.Minute):
+					t.Error("waiter missed a Broadcast")
+					done <- true
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < N; i++ {
+		mu.Lock()
+		count++
+		mu.Unlock()
+		n.Broadcast()
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+}
+
+func BenchmarkNotifier(b *testing.B) {
+	var n Notifier
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n.Wait()
+			n.Broadcast()
+		}
+	})
+}
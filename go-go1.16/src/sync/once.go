@@ -6,6 +6,7 @@ package sync
 
 import (
 	"sync/atomic"
+	"unsafe"
 )
 
 // Once is an object that will perform exactly one action.
@@ -17,8 +18,10 @@ type Once struct {
 	// The hot path is inlined at every call site.
 	// Placing done first allows more compact instructions on some architectures (amd64/386),
 	// and fewer instructions (to calculate offset) on other architectures.
-	done uint32
-	m    Mutex
+	done  uint32
+	m     Mutex
+	ch    unsafe.Pointer // *chan struct{}, created lazily by Done
+	owner uintptr        // ID of the goroutine running f, or 0
 }
 
 // Do calls the function f if and only if Do is being called for the
@@ -34,7 +37,10 @@ type Once struct {
 // 	config.once.Do(func() { config.init(filename) })
 //
 // Because no call to Do returns until the one call to f returns, if f causes
-// Do to be called, it will deadlock.
+// Do to be called on the same Once from the same goroutine, Do panics with
+// "sync: Once.Do called recursively"; the resulting stack trace shows both
+// the outer and the recursive call. If f waits for another goroutine that
+// calls Do, it will deadlock.
 //
 // If f panics, Do considers it to have returned; future calls of Do return
 // without calling f.
@@ -61,10 +67,118 @@ func (o *Once) Do(f func()) {
 }
 
 func (o *Once) doSlow(f func()) {
+	g := uintptr(runtime_goid())
+	if atomic.LoadUintptr(&o.owner) == g {
+		panic("sync: Once.Do called recursively")
+	}
 	o.m.Lock()
 	defer o.m.Unlock()
 	if o.done == 0 {
-		defer atomic.StoreUint32(&o.done, 1)
+		atomic.StoreUintptr(&o.owner, g)
+		defer o.finish()
 		f()
 	}
 }
+
+// finish marks o as done and wakes any goroutines selecting on Done.
+func (o *Once) finish() {
+	atomic.StoreUintptr(&o.owner, 0)
+	atomic.StoreUint32(&o.done, 1)
+	if p := atomic.LoadPointer(&o.ch); p != nil {
+		close(*(*chan struct{})(p))
+	}
+}
+
+// Done returns a channel that is closed when the call to f made by Do
+// has returned, so goroutines that depend on initialization performed
+// elsewhere can block until it has finished without calling Do themselves.
+// Done does not itself cause f to run.
+func (o *Once) Done() <-chan struct{} {
+	if atomic.LoadUint32(&o.done) != 0 {
+		return closedchan
+	}
+	p := atomic.LoadPointer(&o.ch)
+	if p == nil {
+		ch := make(chan struct{})
+		atomic.CompareAndSwapPointer(&o.ch, nil, unsafe.Pointer(&ch))
+		p = atomic.LoadPointer(&o.ch)
+	}
+	// finish may have observed a nil channel just before it was installed.
+	// It stores done before loading the channel, so checking done after
+	// installing it is enough to not miss the close.
+	if atomic.LoadUint32(&o.done) != 0 {
+		return closedchan
+	}
+	return *(*chan struct{})(p)
+}
+
+// closedchan is a reusable closed channel.
+var closedchan = make(chan struct{})
+
+func init() {
+	close(closedchan)
+}
+
+// OnceError is an object that will perform exactly one successful action.
+// Unlike Once, a call to f that returns a non-nil error (or panics) does not
+// mark the OnceError as done, so a later call to Do runs f again instead of
+// permanently observing a half-initialized state.
+//
+// A OnceError must not be copied after first use.
+type OnceError struct {
+	// done indicates whether the action has succeeded.
+	// See the comment on Once.done.
+	done     uint32
+	m        Mutex
+	owner    uintptr // ID of the goroutine running f, or 0
+	failures int     // consecutive failed calls, guarded by m
+
+	// Backoff optionally specifies a function that is called before f is
+	// retried after a failure. It is passed the number of consecutive
+	// failures so far and may sleep to delay the retry. Backoff is called
+	// with the OnceError's internal lock held, so concurrent callers of Do
+	// wait for it rather than retrying f all at once.
+	// It may not be changed concurrently with calls to Do.
+	Backoff func(failures int)
+}
+
+// Do calls the function f if and only if no earlier call to Do on this
+// instance of OnceError has returned a nil error from f. If f returns an
+// error, Do returns it and the next call to Do will call f again. Once f
+// has succeeded, Do returns nil without calling f.
+//
+// As with Once.Do, no call to Do returns until the one call to f in
+// progress returns, and if f calls Do on the same OnceError, Do panics.
+func (o *OnceError) Do(f func() error) error {
+	if atomic.LoadUint32(&o.done) == 0 {
+		// Outlined slow-path to allow inlining of the fast-path.
+		return o.doSlow(f)
+	}
+	return nil
+}
+
+func (o *OnceError) doSlow(f func() error) error {
+	g := uintptr(runtime_goid())
+	if atomic.LoadUintptr(&o.owner) == g {
+		panic("sync: OnceError.Do called recursively")
+	}
+	o.m.Lock()
+	defer o.m.Unlock()
+	if o.done != 0 {
+		return nil
+	}
+	if o.failures > 0 && o.Backoff != nil {
+		o.Backoff(o.failures)
+	}
+	// Count the call as a failure until f returns successfully,
+	// so that a panic in f is treated like an error.
+	o.failures++
+	atomic.StoreUintptr(&o.owner, g)
+	defer atomic.StoreUintptr(&o.owner, 0)
+	if err := f(); err != nil {
+		return err
+	}
+	o.failures = 0
+	atomic.StoreUint32(&o.done, 1)
+	return nil
+}
@@ -5,7 +5,9 @@
 package sync_test
 
 import (
+	"errors"
 	. "sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -66,3 +68,186 @@ func BenchmarkOnce(b *testing.B) {
 		}
 	})
 }
+
+func TestOnceError(t *testing.T) {
+	var once OnceError
+	var backoffs []int
+	once.Backoff = func(failures int) {
+		backoffs = append(backoffs, failures)
+	}
+	calls := 0
+	fail := errors.New("fail")
+	f := func() error {
+		calls++
+		if calls < 3 {
+			return fail
+		}
+		return nil
+	}
+	for i := 0; i < 2; i++ {
+		if err := once.Do(f); err != fail {
+			t.Fatalf("call %d: got %v; want %v", i, err, fail)
+		}
+	}
+	if err := once.Do(f); err != nil {
+		t.Fatalf("third call: got %v; want nil", err)
+	}
+	if err := once.Do(f); err != nil {
+		t.Fatalf("after success: got %v; want nil", err)
+	}
+	if calls != 3 {
+		t.Errorf("f called %d times; want 3", calls)
+	}
+	if len(backoffs) != 2 || backoffs[0] != 1 || backoffs[1] != 2 {
+		t.Errorf("Backoff called with %v; want [1 2]", backoffs)
+	}
+}
+
+func TestOnceErrorPanic(t *testing.T) {
+	var once OnceError
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatalf("OnceError.Do did not panic")
+			}
+		}()
+		once.Do(func() error {
+			panic("failed")
+		})
+	}()
+
+	called := false
+	if err := once.Do(func() error { called = true; return nil }); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if !called {
+		t.Fatalf("OnceError.Do did not retry after panic")
+	}
+}
+
+func TestOnceErrorConcurrent(t *testing.T) {
+	var once OnceError
+	var calls int32
+	const N = 10
+	c := make(chan error)
+	for i := 0; i < N; i++ {
+		go func() {
+			c <- once.Do(func() error {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					return errors.New("first call fails")
+				}
+				return nil
+			})
+		}()
+	}
+	failed := 0
+	for i := 0; i < N; i++ {
+		if err := <-c; err != nil {
+			failed++
+		}
+	}
+	if failed != 1 || calls != 2 {
+		t.Errorf("got %d failures and %d calls; want 1 and 2", failed, calls)
+	}
+}
+
+func TestOnceDone(t *testing.T) {
+	var once Once
+	done := once.Done()
+	select {
+	case <-done:
+		t.Fatal("Done closed before Do")
+	default:
+	}
+	start := make(chan bool)
+	go once.Do(func() { <-start })
+	c := make(chan bool)
+	for i := 0; i < 10; i++ {
+		go func() {
+			<-once.Done()
+			c <- true
+		}()
+	}
+	select {
+	case <-c:
+		t.Fatal("Done closed before f returned")
+	default:
+	}
+	close(start)
+	for i := 0; i < 10; i++ {
+		<-c
+	}
+	<-done
+	<-once.Done()
+}
+
+func TestOnceDonePanic(t *testing.T) {
+	var once Once
+	done := once.Done()
+	func() {
+		defer func() { recover() }()
+		once.Do(func() { panic("failed") })
+	}()
+	<-done
+}
+
+func TestOnceRecursive(t *testing.T) {
+	var once Once
+	defer func() {
+		if r := recover(); r != "sync: Once.Do called recursively" {
+			t.Fatalf("recovered %v; want recursive call panic", r)
+		}
+		// The outer call is considered to have returned.
+		once.Do(func() { t.Fatal("Once.Do called twice") })
+	}()
+	once.Do(func() {
+		once.Do(func() {})
+	})
+}
+
+func TestOnceErrorRecursive(t *testing.T) {
+	var once OnceError
+	defer func() {
+		if r := recover(); r != "sync: OnceError.Do called recursively" {
+			t.Fatalf("recovered %v; want recursive call panic", r)
+		}
+	}()
+	once.Do(func() error {
+		return once.Do(func() error { return nil })
+	})
+}
+
+func TestOnceMap(t *testing.T) {
+	var om OnceMap
+	var calls [2]int32
+	var wg WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(key int) {
+			defer wg.Done()
+			om.Do(key, func() { atomic.AddInt32(&calls[key], 1) })
+			if n := atomic.LoadInt32(&calls[key]); n != 1 {
+				t.Errorf("Do(%d) returned after %d calls; want 1", key, n)
+			}
+		}(i % 2)
+	}
+	wg.Wait()
+	select {
+	case <-om.Done(0):
+	default:
+		t.Fatal("Done channel of a key not closed after Do")
+	}
+	done := om.Done(2)
+	select {
+	case <-done:
+		t.Fatal("Done channel of a key never done is closed")
+	default:
+	}
+
+	om.Forget(0)
+	om.Do(0, func() { calls[0]++ })
+	om.Do(1, func() { calls[1]++ })
+	if calls != [2]int32{2, 1} {
+		t.Fatalf("calls after Forget = %v; want [2 1]", calls)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A OnceMap is a Once per key: Do calls its function for a key only the
+// first time it is called with that key, ever, and every call returns
+// once that function has. It suits one-time work named by a key, such
+// as migrations or lazy per-key registrations. Unlike a Singleflight,
+// which only merges calls that overlap, a OnceMap remembers each key
+// until it is told to forget it. Keys must be comparable, as for Map.
+//
+// The zero OnceMap is empty and ready for use. A OnceMap must not be
+// copied after first use.
+type OnceMap struct {
+	m Map // key -> *Once
+}
+
+// once returns the Once of key, making it if need be.
+func (om *OnceMap) once(key interface{}) *Once {
+	if o, ok := om.m.Load(key); ok {
+		return o.(*Once)
+	}
+	o, _ := om.m.LoadOrStore(key, new(Once))
+	return o.(*Once)
+}
+
+// Do calls f if and only if Do is being called for key for the first
+// time since om was made or key was last forgotten, and returns once
+// that call of f has returned, as Once.Do does for a single Once. Calls
+// for different keys do not wait for each other.
+//
+// If f panics, Do considers it to have returned; future calls of Do
+// for key return without calling f. If f calls Do with the same key,
+// it panics.
+func (om *OnceMap) Do(key interface{}, f func()) {
+	om.once(key).Do(f)
+}
+
+// Done returns a channel that is closed once the call of f made by Do
+// for key has returned. Done does not itself cause anything to run.
+func (om *OnceMap) Done(key interface{}) <-chan struct{} {
+	return om.once(key).Done()
+}
+
+// Forget makes om forget key, so that the next call of Do for key calls
+// its function again. Calls of Do for key already in progress are not
+// affected, and neither are the channels returned by Done for key
+// before Forget.
+func (om *OnceMap) Forget(key interface{}) {
+	om.m.Delete(key)
+}
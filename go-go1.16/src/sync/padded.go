@@ -0,0 +1,44 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"internal/cpu"
+	"unsafe"
+)
+
+// A CacheLinePad is padding the size of a cache line on the target
+// architecture, or of the larger of the sizes in use, such as 64 bytes on
+// amd64 and 256 on s390x. Placed between fields that different
+// goroutines write, it keeps them on different cache lines, so that
+// writes to one do not slow down accesses to the other ("false
+// sharing"):
+//
+//    type shard struct {
+//        mu    sync.Mutex
+//        items map[string]int
+//        _     sync.CacheLinePad
+//    }
+type CacheLinePad struct{ _ [cpu.CacheLinePadSize]byte }
+
+// A PaddedMutex is a Mutex padded to a multiple of the cache line size,
+// so that the mutexes in an array of them, such as the locks of a
+// sharded table, do not share cache lines. Its methods are those of
+// Mutex. The zero value is an unlocked mutex.
+//
+// A PaddedMutex must not be copied after first use.
+type PaddedMutex struct {
+	Mutex
+	_ [cpu.CacheLinePadSize - unsafe.Sizeof(Mutex{})%cpu.CacheLinePadSize]byte
+}
+
+// A PaddedRWMutex is an RWMutex padded like a PaddedMutex. Its methods
+// are those of RWMutex. The zero value is an unlocked mutex.
+//
+// A PaddedRWMutex must not be copied after first use.
+type PaddedRWMutex struct {
+	RWMutex
+	_ [cpu.CacheLinePadSize - unsafe.Sizeof(RWMutex{})%cpu.CacheLinePadSize]byte
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"testing"
+	"unsafe"
+)
+
+func TestPaddedSizes(t *testing.T) {
+	line := unsafe.Sizeof(CacheLinePad{})
+	if line < 32 || line&(line-1) != 0 {
+		t.Fatalf("CacheLinePad has size %d; want a power of two of at least 32", line)
+	}
+	for _, s := range []struct {
+		name string
+		size uintptr
+	}{
+		{"PaddedMutex", unsafe.Sizeof(PaddedMutex{})},
+		{"PaddedRWMutex", unsafe.Sizeof(PaddedRWMutex{})},
+	} {
+		if s.size == 0 || s.size%line != 0 {
+			t.Errorf("%s has size %d; want a multiple of %d", s.name, s.size, line)
+		}
+	}
+
+	// The locks of neighbors in an array are a line apart.
+	var locks [2]PaddedRWMutex
+	if d := uintptr(unsafe.Pointer(&locks[1].RWMutex)) - uintptr(unsafe.Pointer(&locks[0].RWMutex)); d < line {
+		t.Errorf("neighboring PaddedRWMutexes are %d bytes apart; want at least %d", d, line)
+	}
+}
+
+func TestPaddedMutex(t *testing.T) {
+	var locks [4]PaddedMutex
+	var rwlocks [4]PaddedRWMutex
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func(i int) {
+			for j := 0; j < 1000; j++ {
+				locks[(i+j)%4].Lock()
+				locks[(i+j)%4].Unlock()
+				rwlocks[(i+j)%4].RLock()
+				rwlocks[(i+j)%4].RUnlock()
+				rwlocks[(i+j)%4].Lock()
+				rwlocks[(i+j)%4].Unlock()
+			}
+			done <- true
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+	var _ Locker = &locks[0]
+	var _ Locker = rwlocks[0].RLocker()
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A Phaser is a reusable barrier whose number of parties may change
+// between phases. It suits pipelines in which workers join and leave
+// while the others proceed in lockstep, where a Barrier, sized once and
+// for all, does not.
+//
+// A Phaser advances through numbered phases, starting from 0. A phase
+// completes, and the next one starts, when every registered party has
+// arrived. Parties may arrive without waiting, with Arrive, or wait for
+// the others, with ArriveAndAwait.
+//
+// The zero Phaser has no parties and is ready for use. A Phaser must not
+// be copied after first use.
+type Phaser struct {
+	mu      Mutex
+	phase   int
+	parties int
+	arrived int
+	done    chan struct{} // closed when the current phase completes; nil until needed
+}
+
+// NewPhaser returns a new Phaser with the given number of parties.
+func NewPhaser(parties int) *Phaser {
+	if parties < 0 {
+		panic("sync: negative Phaser parties")
+	}
+	return &Phaser{parties: parties}
+}
+
+// Register adds a party to p and returns the current phase, which the
+// new party takes part in.
+func (p *Phaser) Register() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.parties++
+	return p.phase
+}
+
+// Arrive records the arrival of a party at the current phase, without
+// waiting for the others, and returns the phase arrived at.
+func (p *Phaser) Arrive() int {
+	return p.arrive(false)
+}
+
+// ArriveAndDeregister records the arrival of a party at the current
+// phase and removes the party from p, so that later phases do not wait
+// for it. It returns the phase arrived at.
+func (p *Phaser) ArriveAndDeregister() int {
+	return p.arrive(true)
+}
+
+func (p *Phaser) arrive(deregister bool) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.arrived >= p.parties {
+		panic("sync: Phaser arrival with no unarrived parties")
+	}
+	phase := p.phase
+	if deregister {
+		p.parties--
+	} else {
+		p.arrived++
+	}
+	if p.arrived == p.parties {
+		p.advance()
+	}
+	return phase
+}
+
+// advance completes the current phase. p.mu must be held.
+func (p *Phaser) advance() {
+	p.phase++
+	p.arrived = 0
+	if p.done != nil {
+		close(p.done)
+		p.done = nil
+	}
+}
+
+// ArriveAndAwait records the arrival of a party at the current phase
+// and waits for the other parties to arrive. It returns the number of
+// the next phase.
+func (p *Phaser) ArriveAndAwait() int {
+	return p.AwaitAdvance(p.Arrive())
+}
+
+// AwaitAdvance waits until p has completed the given phase, and returns
+// the number of the phase p is in. It returns immediately if the given
+// phase is not the current one.
+func (p *Phaser) AwaitAdvance(phase int) int {
+	next, _ := p.AwaitAdvanceContext(nil, phase)
+	return next
+}
+
+// AwaitAdvanceContext is like AwaitAdvance, but gives up waiting if ctx
+// is done first, in which case it returns the current phase and
+// ctx.Err(). A nil ctx never gives up.
+func (p *Phaser) AwaitAdvanceContext(ctx Context, phase int) (int, error) {
+	p.mu.Lock()
+	if p.phase != phase {
+		phase = p.phase
+		p.mu.Unlock()
+		return phase, nil
+	}
+	if p.done == nil {
+		p.done = make(chan struct{})
+	}
+	done := p.done
+	p.mu.Unlock()
+
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	var err error
+	select {
+	case <-done:
+	case <-cancel:
+		err = ctx.Err()
+	}
+	return p.Phase(), err
+}
+
+// Phase returns the current phase number.
+func (p *Phaser) Phase() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.phase
+}
+
+// Parties returns the number of parties registered with p.
+func (p *Phaser) Parties() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.parties
+}
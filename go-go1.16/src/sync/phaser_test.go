@@ -0,0 +1,78 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	. "sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPhaser(t *testing.T) {
+	p := NewPhaser(1) // the test itself
+	var (
+		wg      WaitGroup
+		running int32
+	)
+	// Worker i joins at phase i and leaves after 3 phases, so the
+	// number of parties changes every phase.
+	const workers = 5
+	for phase := 0; phase < workers+3; phase++ {
+		if phase < workers {
+			wg.Add(1)
+			start := p.Register()
+			if start != phase {
+				t.Fatalf("Register returned phase %d; want %d", start, phase)
+			}
+			go func() {
+				defer wg.Done()
+				atomic.AddInt32(&running, 1)
+				for i := 0; i < 2; i++ {
+					p.ArriveAndAwait()
+				}
+				atomic.AddInt32(&running, -1)
+				p.ArriveAndDeregister()
+			}()
+		}
+		if next := p.ArriveAndAwait(); next != phase+1 {
+			t.Fatalf("ArriveAndAwait returned phase %d; want %d", next, phase+1)
+		}
+	}
+	wg.Wait()
+	if n := p.Parties(); n != 1 {
+		t.Fatalf("got %d parties after workers left; want 1", n)
+	}
+	if running != 0 {
+		t.Fatalf("%d workers still running", running)
+	}
+}
+
+func TestPhaserAwaitAdvance(t *testing.T) {
+	p := NewPhaser(2)
+	phase := p.Arrive()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if next, err := p.AwaitAdvanceContext(ctx, phase); next != phase || err != context.Canceled {
+		t.Fatalf("AwaitAdvanceContext returned %d, %v; want %d, %v", next, err, phase, context.Canceled)
+	}
+	done := make(chan int)
+	go func() { done <- p.AwaitAdvance(phase) }()
+	p.Arrive()
+	if next := <-done; next != phase+1 {
+		t.Fatalf("AwaitAdvance returned %d; want %d", next, phase+1)
+	}
+	if next := p.AwaitAdvance(phase); next != phase+1 {
+		t.Fatalf("AwaitAdvance for a past phase returned %d; want %d", next, phase+1)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("arrival with no unarrived parties did not panic")
+		}
+	}()
+	var empty Phaser
+	empty.Arrive()
+}
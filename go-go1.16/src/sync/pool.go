@@ -50,16 +50,81 @@ type Pool struct {
 	victim     unsafe.Pointer // local from previous cycle
 	victimSize uintptr        // size of victims array
 
+	// Item counts for bounded pools, maintained only if max > 0.
+	max     int32 // maximum number of retained items, see SetMaxRetain
+	nlocal  int32 // number of items in local
+	nvictim int32 // number of items in victim and reserve
+
+	// Items kept across garbage collections, see SetMinRetain.
+	// reserve is a *poolDequeue. Only poolCleanup and SetMinRetain,
+	// which cannot run at the same time, push to it.
+	minRetain int32
+	reserve   unsafe.Pointer
+
+	policy PoolGCPolicy   // see SetGCPolicy
+	leaks  unsafe.Pointer // *poolLeaks, if leak checking, see SetLeakCheck
+
+	finalizer func(interface{}) // see SetFinalizer
+	async     unsafe.Pointer    // *poolAsync, if p has a reset function, see PutAsync
+
+	// flags records which optional features p uses. Put and Get load
+	// it once and take their plain fast paths while it is zero.
+	flags uint32
+
+	// Caches discarded by the garbage collector whose items have not
+	// been finalized yet, linked through poolLocalInternal.next.
+	// Only used if finalizer is set.
+	dead     unsafe.Pointer
+	deadSize uintptr
+
+	// Counters for Stats carried over from local arrays that p no
+	// longer uses. The current counts are kept per P in local. Only
+	// written and read with allPoolsMu held and p pinned, or with the
+	// world stopped, since it need not be 64-bit aligned.
+	stats poolStatsInternal
+
 	// New optionally specifies a function to generate
 	// a value when Get would otherwise return nil.
 	// It may not be changed concurrently with calls to Get.
 	New func() interface{}
 }
 
+// Bits in Pool.flags.
+const (
+	poolBounded   = 1 << iota // p has a maximum, see SetMaxRetain
+	poolFinalizer             // p has a finalizer, see SetFinalizer
+	poolClosed                // p is closed, see Close
+	poolTimed                 // p has an idle timeout, see SetIdleTimeout
+	poolLeakCheck             // p checks for leaks, see SetLeakCheck
+	poolCounting              // p counts Gets and Puts, see SetCounting
+)
+
+// setFlag sets or clears flag in p.flags.
+func (p *Pool) setFlag(flag uint32, on bool) {
+	for {
+		old := atomic.LoadUint32(&p.flags)
+		new := old &^ flag
+		if on {
+			new |= flag
+		}
+		if atomic.CompareAndSwapUint32(&p.flags, old, new) {
+			return
+		}
+	}
+}
+
 // Local per-P Pool appendix.
 type poolLocalInternal struct {
 	private interface{} // Can be used only by the respective P.
 	shared  poolChain   // Local P can pushHead/popHead; any P can popTail.
+
+	// Counters for Stats. They are only written by the respective P
+	// while pinned, so they need no atomic read-modify-write operations.
+	stats poolStatsInternal
+
+	// In element 0 of a dead cache, the next dead cache and its size.
+	next     unsafe.Pointer
+	nextSize uintptr
 }
 
 type poolLocal struct {
@@ -70,6 +135,29 @@ type poolLocal struct {
 	pad [128 - unsafe.Sizeof(poolLocalInternal{})%128]byte
 }
 
+type poolStatsInternal struct {
+	gets    uint64
+	misses  uint64
+	puts    uint64
+	drops   uint64
+	drained uint64
+	expired uint64
+	steals  uint64 // items Get took from the shared lists of other Ps
+}
+
+// PoolStats holds statistics about the use of a Pool.
+// See Pool.Stats.
+type PoolStats struct {
+	Gets      uint64 // calls to Get
+	Misses    uint64 // calls to Get that found the pool empty and called New, if set
+	Puts      uint64 // calls to Put with a non-nil item
+	Drops     uint64 // items Put to a full or closed pool, which it discarded
+	Drained   uint64 // items removed by Drain or Close
+	Expired   uint64 // items dropped for being idle, see SetIdleTimeout
+	Discarded uint64 // items discarded by garbage collections
+	Retained  uint64 // items currently in the pool
+}
+
 // from runtime
 func fastrand() uint32
 
@@ -91,6 +179,10 @@ func (p *Pool) Put(x interface{}) {
 	if x == nil {
 		return
 	}
+	if atomic.LoadUint32(&p.flags) != 0 {
+		p.putFlagged(x)
+		return
+	}
 	if race.Enabled {
 		if fastrand()%4 == 0 {
 			// Randomly drop x on floor.
@@ -122,6 +214,9 @@ func (p *Pool) Put(x interface{}) {
 // If Get would otherwise return nil and p.New is non-nil, Get returns
 // the result of calling p.New.
 func (p *Pool) Get() interface{} {
+	if atomic.LoadUint32(&p.flags) != 0 {
+		return p.getFlagged()
+	}
 	if race.Enabled {
 		race.Disable()
 	}
@@ -134,10 +229,52 @@ func (p *Pool) Get() interface{} {
 		// reuse.
 		x, _ = l.shared.popHead()
 		if x == nil {
-			x = p.getSlow(pid)
+			x, _ = p.getSlow(pid)
+		}
+	}
+	runtime_procUnpin()
+	if race.Enabled {
+		race.Enable()
+		if x != nil {
+			race.Acquire(poolRaceAddr(x))
+		}
+	}
+	if x == nil && p.New != nil {
+		x = p.New()
+	}
+	return x
+}
+
+// getFlagged is Get for pools that use any of the optional features in
+// p.flags.
+func (p *Pool) getFlagged() interface{} {
+	flags := atomic.LoadUint32(&p.flags)
+	if flags&poolFinalizer != 0 {
+		p.finalizeDead()
+	}
+	if race.Enabled {
+		race.Disable()
+	}
+	l, pid := p.pin()
+	x := l.private
+	l.private = nil
+	victim := false
+	if x == nil {
+		x, _ = l.shared.popHead()
+		if x == nil {
+			x, victim = p.getSlow(pid)
+		}
+	}
+	if flags&poolCounting != 0 {
+		l.stats.gets++
+		if x == nil {
+			l.stats.misses++
 		}
 	}
 	runtime_procUnpin()
+	if x != nil && flags&poolBounded != 0 {
+		p.unretain(victim)
+	}
 	if race.Enabled {
 		race.Enable()
 		if x != nil {
@@ -147,10 +284,17 @@ func (p *Pool) Get() interface{} {
 	if x == nil && p.New != nil {
 		x = p.New()
 	}
+	if flags&poolLeakCheck != 0 && x != nil {
+		if l := (*poolLeaks)(atomic.LoadPointer(&p.leaks)); l != nil {
+			l.record(x, 2) // omit getFlagged and Get
+		}
+	}
 	return x
 }
 
-func (p *Pool) getSlow(pid int) interface{} {
+// getSlow steals an item from another P or takes one from the victim
+// cache. It reports whether the item came from the victim cache.
+func (p *Pool) getSlow(pid int) (x interface{}, victim bool) {
 	// See the comment in pin regarding ordering of the loads.
 	size := runtime_LoadAcquintptr(&p.localSize) // load-acquire
 	locals := p.local                            // load-consume
@@ -158,7 +302,8 @@ func (p *Pool) getSlow(pid int) interface{} {
 	for i := 0; i < int(size); i++ {
 		l := indexLocal(locals, (pid+i+1)%int(size))
 		if x, _ := l.shared.popTail(); x != nil {
-			return x
+			indexLocal(locals, pid).stats.steals++
+			return x, false
 		}
 	}
 
@@ -167,18 +312,18 @@ func (p *Pool) getSlow(pid int) interface{} {
 	// victim cache to age out if at all possible.
 	size = atomic.LoadUintptr(&p.victimSize)
 	if uintptr(pid) >= size {
-		return nil
+		return p.getReserve()
 	}
 	locals = p.victim
 	l := indexLocal(locals, pid)
 	if x := l.private; x != nil {
 		l.private = nil
-		return x
+		return x, true
 	}
 	for i := 0; i < int(size); i++ {
 		l := indexLocal(locals, (pid+i)%int(size))
 		if x, _ := l.shared.popTail(); x != nil {
-			return x
+			return x, true
 		}
 	}
 
@@ -186,7 +331,197 @@ func (p *Pool) getSlow(pid int) interface{} {
 	// with it.
 	atomic.StoreUintptr(&p.victimSize, 0)
 
-	return nil
+	return p.getReserve()
+}
+
+// getReserve takes an item from the reserve kept by SetMinRetain.
+// Reserved items are counted as part of the victim cache.
+func (p *Pool) getReserve() (x interface{}, victim bool) {
+	r := (*poolDequeue)(atomic.LoadPointer(&p.reserve))
+	if r == nil {
+		return nil, false
+	}
+	x, _ = r.popTail()
+	return x, x != nil
+}
+
+// SetMinRetain makes p keep up to n items across garbage collections.
+// Normally every item is dropped by the second collection after it was
+// Put, so a pool is empty after a quiet period and the first Gets after
+// it all call New. With a minimum, items that would be dropped are kept
+// instead, until n are held in reserve. Get takes from the reserve only
+// once the rest of the pool is empty. Reserved items are exempt from the
+// idle timeout, see SetIdleTimeout.
+//
+// A value of n <= 0 removes the reserve, which is the default. Lowering
+// n discards reserved items beyond the new minimum, as Drain would.
+func (p *Pool) SetMinRetain(n int) {
+	if n > dequeueLimit {
+		n = dequeueLimit
+	}
+	var r *poolDequeue
+	if n > 0 {
+		size := 1
+		for size < n {
+			size <<= 1
+		}
+		r = &poolDequeue{vals: make([]eface, size)}
+	}
+
+	allPoolsMu.Lock()
+	runtime_procPin()
+	// poolCleanup won't be called while we are pinned.
+	old := (*poolDequeue)(p.reserve)
+	if old != nil && r != nil {
+		for r.len() < n {
+			x, ok := old.popTail()
+			if !ok {
+				break
+			}
+			r.pushHead(x)
+		}
+	}
+	if n < 0 {
+		n = 0
+	}
+	p.minRetain = int32(n)
+	atomic.StorePointer(&p.reserve, unsafe.Pointer(r))
+	runtime_procUnpin()
+	allPoolsMu.Unlock()
+
+	if old != nil {
+		p.addDrained(p.drainReserve(old))
+	}
+}
+
+// A PoolGCPolicy determines what a garbage collection does to the items
+// in a Pool. See Pool.SetGCPolicy.
+type PoolGCPolicy int
+
+const (
+	// PoolVictimCache, the default, drops the items that survived the
+	// previous collection and sets the others aside, where Get uses
+	// them only when nothing newer is left. An item Put to an idle
+	// pool is thus dropped by the second collection after.
+	PoolVictimCache PoolGCPolicy = iota
+
+	// PoolKeepAll keeps every item across collections. It suits pools
+	// of objects that are expensive to create, especially combined with
+	// SetMaxRetain or SetIdleTimeout to bound how much the pool holds.
+	PoolKeepAll
+
+	// PoolClearAll drops every item at each collection. It suits pools
+	// of objects that are cheap to recreate but large to keep.
+	PoolClearAll
+)
+
+// SetGCPolicy sets how garbage collections affect the items in p.
+// Items kept by SetMinRetain survive regardless of the policy.
+//
+// SetGCPolicy must be called before the pool is first used.
+func (p *Pool) SetGCPolicy(policy PoolGCPolicy) {
+	if policy < PoolVictimCache || policy > PoolClearAll {
+		panic("sync: invalid PoolGCPolicy")
+	}
+	p.policy = policy
+}
+
+// fillReserve moves items from the cache l of the given size, which
+// the garbage collector is about to drop, to p's reserve until it holds
+// p.minRetain items. It must be called with the world stopped.
+func (p *Pool) fillReserve(l unsafe.Pointer, size uintptr) {
+	r := (*poolDequeue)(p.reserve)
+	min := int(p.minRetain)
+	for i := 0; i < int(size) && r.len() < min; i++ {
+		pl := indexLocal(l, i)
+		if pl.private != nil {
+			r.pushHead(pl.private)
+			pl.private = nil
+		}
+		for r.len() < min {
+			x, ok := pl.shared.popTail()
+			if !ok {
+				break
+			}
+			r.pushHead(x)
+		}
+	}
+}
+
+// drainReserve empties the reserve r, calling p's finalizer, if any,
+// on each item, and returns the number of items removed.
+func (p *Pool) drainReserve(r *poolDequeue) (n int) {
+	for {
+		x, ok := r.popTail()
+		if !ok {
+			return n
+		}
+		n++
+		p.unretain(true)
+		p.discard(x)
+	}
+}
+
+// SetMaxRetain limits the number of items p retains to n. Once the limit
+// is reached, Put drops its argument instead of adding it to the pool,
+// so a burst of Puts cannot grow the pool without bound between garbage
+// collections. A value of n <= 0 removes the limit, which is the default.
+//
+// Bounded pools keep a shared count of their items, which makes Get and
+// Put somewhat more expensive under contention. The count is maintained
+// only while a limit is set, so SetMaxRetain should be called before the
+// pool is first used.
+//
+// The limit counts every item p retains, including items cached for a
+// single P that a Get running on another P cannot reach. A Get may
+// therefore return nil even though p holds n items.
+func (p *Pool) SetMaxRetain(n int) {
+	if n < 0 {
+		n = 0
+	}
+	if n > 1<<31-1 {
+		n = 1<<31 - 1
+	}
+	atomic.StoreInt32(&p.max, int32(n))
+	p.setFlag(poolBounded, n > 0)
+}
+
+// retain reserves room for one more item in p.
+// It reports false if p is bounded and full.
+func (p *Pool) retain() bool {
+	max := atomic.LoadInt32(&p.max)
+	if max <= 0 {
+		return true
+	}
+	if atomic.AddInt32(&p.nlocal, 1)+atomic.LoadInt32(&p.nvictim) > max {
+		atomic.AddInt32(&p.nlocal, -1)
+		return false
+	}
+	return true
+}
+
+// unretain releases the room held by an item taken from p's local
+// or, if victim is set, victim cache.
+func (p *Pool) unretain(victim bool) {
+	if atomic.LoadInt32(&p.max) <= 0 {
+		return
+	}
+	c := &p.nlocal
+	if victim {
+		c = &p.nvictim
+	}
+	decrementCount(c)
+}
+
+// decrementCount decrements the item count *c unless it is already zero,
+// which it may be if items were added before the pool was bounded.
+func decrementCount(c *int32) {
+	for {
+		n := atomic.LoadInt32(c)
+		if n <= 0 || atomic.CompareAndSwapInt32(c, n, n-1) {
+			return
+		}
+	}
 }
 
 // pin pins the current goroutine to P, disables preemption and
@@ -221,6 +556,14 @@ func (p *Pool) pinSlow() (*poolLocal, int) {
 	}
 	if p.local == nil {
 		allPools = append(allPools, p)
+	} else {
+		// Carry the counts over to the new array. This may miss
+		// a few updates by Ps that are still pinned.
+		p.foldStats(p.local, p.localSize)
+		if p.finalizer != nil {
+			// Keep the old array for finalization rather than losing it.
+			p.addDead(p.local, p.localSize)
+		}
 	}
 	// If GOMAXPROCS changes between GCs, we re-allocate the array and lose the old one.
 	size := runtime.GOMAXPROCS(0)
@@ -230,6 +573,100 @@ func (p *Pool) pinSlow() (*poolLocal, int) {
 	return &local[pid], pid
 }
 
+// foldStats adds the counters of the cache l of the given size, which
+// p is about to stop using, to p.stats. It must be called with the world
+// stopped or with p pinned and allPoolsMu held.
+func (p *Pool) foldStats(l unsafe.Pointer, size uintptr) {
+	for i := 0; i < int(size); i++ {
+		p.stats.add(&indexLocal(l, i).stats)
+	}
+}
+
+// Preallocate adds n items from p.New to p, so that the first Gets after
+// a program starts, or after a quiet period, need not all call New at
+// once. If p has not been used since the last garbage collection, the
+// items are spread over the per-P caches; otherwise they go to the
+// caller's. A bounded pool (see SetMaxRetain) is filled at most to its
+// limit. Preallocate does nothing if p.New is nil, and stops early if
+// p.New returns nil.
+//
+// Like any other items, preallocated ones are subject to being dropped
+// by the garbage collector; see SetMinRetain to keep some of them.
+func (p *Pool) Preallocate(n int) {
+	if p.New != nil {
+		p.preallocate(n, p.New)
+	}
+}
+
+// preallocate implements Preallocate, calling newf for the items.
+func (p *Pool) preallocate(n int, newf func() interface{}) {
+	flags := atomic.LoadUint32(&p.flags)
+	if n <= 0 || flags&poolClosed != 0 {
+		return
+	}
+	// Call newf before pinning, since it may block or use p.
+	// Stop at the first nil: a New that returns nil once is
+	// likely to keep doing so.
+	items := make([]interface{}, 0, n)
+	for len(items) < n && p.retain() {
+		x := newf()
+		if x == nil {
+			p.unretain(false)
+			break
+		}
+		items = append(items, x)
+	}
+	if len(items) == 0 {
+		return
+	}
+	var now int64
+	if flags&poolTimed != 0 {
+		now = nanotime()
+	}
+	if race.Enabled {
+		for _, x := range items {
+			race.ReleaseMerge(poolRaceAddr(x))
+		}
+		race.Disable()
+	}
+
+	allPoolsMu.Lock()
+	pid := runtime_procPin()
+	// poolCleanup won't be called while we are pinned.
+	fresh := p.local == nil
+	if fresh {
+		// No P can be using the array before we publish it,
+		// so we may push to every P's chain.
+		size := runtime.GOMAXPROCS(0)
+		local := make([]poolLocal, size)
+		for i, x := range items {
+			local[i%size].shared.pushHeadAt(x, now)
+		}
+		if flags&poolCounting != 0 {
+			local[pid].stats.puts += uint64(len(items))
+		}
+		allPools = append(allPools, p)
+		atomic.StorePointer(&p.local, unsafe.Pointer(&local[0])) // store-release
+		runtime_StoreReluintptr(&p.localSize, uintptr(size))     // store-release
+	}
+	runtime_procUnpin()
+	allPoolsMu.Unlock()
+
+	if !fresh {
+		l, _ := p.pin()
+		for _, x := range items {
+			l.shared.pushHeadAt(x, now)
+		}
+		if flags&poolCounting != 0 {
+			l.stats.puts += uint64(len(items))
+		}
+		runtime_procUnpin()
+	}
+	if race.Enabled {
+		race.Enable()
+	}
+}
+
 func poolCleanup() {
 	// This function is called with the world stopped, at the beginning of a garbage collection.
 	// It must not allocate and probably should not call any runtime functions.
@@ -239,16 +676,50 @@ func poolCleanup() {
 
 	// Drop victim caches from all pools.
 	for _, p := range oldPools {
+		if p.reserve != nil && p.victim != nil {
+			p.fillReserve(p.victim, p.victimSize)
+		}
+		if p.finalizer != nil && p.victim != nil {
+			// Leave the items for the next Get, Put or Drain to
+			// finalize, since we cannot call the finalizer here.
+			p.addDead(p.victim, p.victimSize)
+		}
 		p.victim = nil
 		p.victimSize = 0
+		p.nvictim = 0
+		if p.reserve != nil {
+			p.nvictim = int32((*poolDequeue)(p.reserve).len())
+		}
 	}
 
 	// Move primary cache to victim cache.
 	for _, p := range allPools {
+		switch p.policy {
+		case PoolKeepAll:
+			// Leave the primary cache alone. p drops out of
+			// allPools, and since its cache stays non-nil it is
+			// never added back, so later collections skip it.
+			continue
+		case PoolClearAll:
+			p.foldStats(p.local, p.localSize)
+			if p.reserve != nil {
+				p.fillReserve(p.local, p.localSize)
+			}
+			if p.finalizer != nil {
+				p.addDead(p.local, p.localSize)
+			}
+			p.local = nil
+			p.localSize = 0
+			p.nlocal = 0
+			continue
+		}
+		p.foldStats(p.local, p.localSize)
 		p.victim = p.local
 		p.victimSize = p.localSize
 		p.local = nil
 		p.localSize = 0
+		p.nvictim += p.nlocal
+		p.nlocal = 0
 	}
 
 	// The pools with non-empty primary caches now have non-empty
@@ -256,6 +727,307 @@ func poolCleanup() {
 	oldPools, allPools = allPools, nil
 }
 
+// SetFinalizer sets f to be called on every item that p discards other than
+// by returning it from Get: items Put to a full pool (see SetMaxRetain) or
+// to a closed pool, items emptied by Drain or Close, items dropped for being
+// idle (see SetIdleTimeout), and items dropped by the garbage collector. The
+// latter are finalized by the next call to Get, Put or Drain on p, since the
+// collector itself cannot call f. This lets pooled objects that hold file
+// descriptors or memory not managed by Go release them deterministically.
+//
+// A finalizing pool does not use its per-P fast path for Put, which makes
+// it somewhat slower than an ordinary pool.
+//
+// SetFinalizer must be called before the pool is first used.
+func (p *Pool) SetFinalizer(f func(x interface{})) {
+	p.finalizer = f
+	p.setFlag(poolFinalizer, f != nil)
+}
+
+// Drain removes every item from p, including those kept from before the
+// last garbage collection, and calls p's finalizer on each. Items Put
+// concurrently with Drain may remain in the pool. If p has no finalizer,
+// Drain may also leave behind an item cached privately by each P other
+// than the caller's.
+func (p *Pool) Drain() {
+	p.finalizeDead()
+
+	if race.Enabled {
+		race.Disable()
+	}
+	// Pin to load consistent caches; see the comment in pin.
+	// The arrays stay valid after unpinning even if a garbage
+	// collection moves them, and popTail is safe from any P.
+	l, _ := p.pin()
+	// Only our own P may touch its private item.
+	private := l.private
+	l.private = nil
+	size := runtime_LoadAcquintptr(&p.localSize) // load-acquire
+	locals := p.local                            // load-consume
+	victimSize := atomic.LoadUintptr(&p.victimSize)
+	victim := p.victim
+	runtime_procUnpin()
+	if race.Enabled {
+		race.Enable()
+	}
+
+	n := 0
+	if private != nil {
+		n++
+		p.unretain(false)
+		p.discard(private)
+	}
+	n += p.drainLocals(locals, size, &p.nlocal)
+	n += p.drainLocals(victim, victimSize, &p.nvictim)
+	if r := (*poolDequeue)(atomic.LoadPointer(&p.reserve)); r != nil {
+		n += p.drainReserve(r)
+	}
+	p.addDrained(n)
+	p.finalizeDead()
+}
+
+// addDrained counts n items removed by Drain.
+func (p *Pool) addDrained(n int) {
+	if n == 0 {
+		return
+	}
+	if race.Enabled {
+		race.Disable()
+	}
+	l, _ := p.pin()
+	l.stats.drained += uint64(n)
+	runtime_procUnpin()
+	if race.Enabled {
+		race.Enable()
+	}
+}
+
+// Close drains p and makes it discard, and finalize, every item Put to
+// it from then on. Get on a closed pool returns the result of calling
+// p.New, or nil.
+// Close may be called concurrently with other methods.
+func (p *Pool) Close() {
+	p.setFlag(poolClosed, true)
+	p.Drain()
+}
+
+// putFlagged is Put for pools that use any of the optional features in
+// p.flags. Closed pools and pools with a finalizer or an idle timeout
+// never use the private slot, so that Drain and the idle sweep can reach
+// every item.
+func (p *Pool) putFlagged(x interface{}) {
+	flags := atomic.LoadUint32(&p.flags)
+	if flags&poolLeakCheck != 0 {
+		if l := (*poolLeaks)(atomic.LoadPointer(&p.leaks)); l != nil {
+			l.forget(x)
+		}
+	}
+	if flags&poolFinalizer != 0 {
+		p.finalizeDead()
+	}
+	if flags&poolClosed != 0 || !p.retain() {
+		// The pool is closed or full; drop x on the floor.
+		p.countDrop()
+		if p.finalizer != nil {
+			p.finalizer(x)
+		}
+		return
+	}
+	if race.Enabled {
+		race.ReleaseMerge(poolRaceAddr(x))
+		race.Disable()
+	}
+	var now int64
+	if flags&poolTimed != 0 {
+		now = nanotime()
+	}
+	l, _ := p.pin()
+	if flags&poolCounting != 0 {
+		l.stats.puts++
+	}
+	if flags&(poolFinalizer|poolClosed|poolTimed) == 0 && l.private == nil {
+		l.private = x
+	} else {
+		l.shared.pushHeadAt(x, now)
+	}
+	runtime_procUnpin()
+	if race.Enabled {
+		race.Enable()
+	}
+}
+
+// addDead adds the cache l of the given size to p's dead list.
+// It must be called with the world stopped or with p pinned and
+// allPoolsMu held.
+func (p *Pool) addDead(l unsafe.Pointer, size uintptr) {
+	if size == 0 {
+		return
+	}
+	head := indexLocal(l, 0)
+	head.next, head.nextSize = p.dead, p.deadSize
+	atomic.StorePointer(&p.dead, l)
+	p.deadSize = size
+}
+
+// finalizeDead finalizes the items in caches the garbage collector
+// has discarded since the last call.
+func (p *Pool) finalizeDead() {
+	if atomic.LoadPointer(&p.dead) == nil {
+		return
+	}
+	allPoolsMu.Lock()
+	runtime_procPin()
+	// poolCleanup won't be called while we are pinned.
+	dead, size := p.dead, p.deadSize
+	atomic.StorePointer(&p.dead, nil)
+	p.deadSize = 0
+	runtime_procUnpin()
+	allPoolsMu.Unlock()
+
+	for dead != nil {
+		head := indexLocal(dead, 0)
+		next, nextSize := head.next, head.nextSize
+		p.drainLocals(dead, size, nil)
+		dead, size = next, nextSize
+	}
+}
+
+// drainLocals empties the cache l of the given size, calling p's
+// finalizer, if any, on each item, and returns the number of items
+// removed. If p is bounded, count is the item count to maintain for l.
+func (p *Pool) drainLocals(l unsafe.Pointer, size uintptr, count *int32) (n int) {
+	bounded := count != nil && atomic.LoadInt32(&p.max) > 0
+	for i := 0; i < int(size); i++ {
+		for {
+			x, ok := indexLocal(l, i).shared.popTail()
+			if !ok {
+				break
+			}
+			n++
+			if bounded {
+				decrementCount(count)
+			}
+			p.discard(x)
+		}
+	}
+	return n
+}
+
+// discard disposes of x, which was in p, calling p's finalizer if set.
+func (p *Pool) discard(x interface{}) {
+	if race.Enabled {
+		race.Acquire(poolRaceAddr(x))
+	}
+	if p.finalizer != nil {
+		p.finalizer(x)
+	}
+}
+
+// SetCounting turns the counting of Gets, Misses and Puts for Stats and
+// Shards on or off. Counting is off by default, so that the fast paths
+// of an ordinary pool cost no more than they would without Stats; like
+// the other optional features, turning it on moves Get and Put to a
+// slower path. The other counts of Stats are kept regardless.
+// RegisterMetrics turns counting on for the pools it publishes.
+func (p *Pool) SetCounting(enabled bool) {
+	p.setFlag(poolCounting, enabled)
+}
+
+// Stats returns statistics about the use of p since it was created.
+// Gets, Misses and Puts count only the calls made while counting is on,
+// see SetCounting, so Discarded, which is derived from them, is only
+// meaningful if counting has been on since p was created. The counts are
+// gathered without stopping concurrent Gets and Puts, so they are only
+// approximately consistent with each other while p is in use.
+func (p *Pool) Stats() PoolStats {
+	var sum poolStatsInternal
+	// p.stats is written with allPoolsMu held and p pinned, by pinSlow,
+	// or with the world stopped, by poolCleanup, which pinning holds
+	// off. See also the comment in Drain.
+	allPoolsMu.Lock()
+	runtime_procPin()
+	sum.add(&p.stats)
+	localSize := runtime_LoadAcquintptr(&p.localSize) // load-acquire
+	locals := p.local                                 // load-consume
+	for i := 0; i < int(localSize); i++ {
+		sum.load(&indexLocal(locals, i).stats)
+	}
+	victimSize := atomic.LoadUintptr(&p.victimSize)
+	victim := p.victim
+	runtime_procUnpin()
+	allPoolsMu.Unlock()
+	retained := countLocals(locals, localSize) + countLocals(victim, victimSize)
+	if r := (*poolDequeue)(atomic.LoadPointer(&p.reserve)); r != nil {
+		retained += uint64(r.len())
+	}
+
+	s := PoolStats{
+		Gets:     sum.gets,
+		Misses:   sum.misses,
+		Puts:     sum.puts + sum.drops,
+		Drops:    sum.drops,
+		Drained:  sum.drained,
+		Expired:  sum.expired,
+		Retained: retained,
+	}
+	// Whatever was added to the pool and is neither retained nor
+	// otherwise accounted for was discarded by the garbage collector.
+	out := (sum.gets - sum.misses) + sum.drained + sum.expired + retained
+	if sum.puts > out {
+		s.Discarded = sum.puts - out
+	}
+	return s
+}
+
+// countDrop counts an item that Put discarded.
+func (p *Pool) countDrop() {
+	if race.Enabled {
+		race.Disable()
+	}
+	l, _ := p.pin()
+	l.stats.drops++
+	runtime_procUnpin()
+	if race.Enabled {
+		race.Enable()
+	}
+}
+
+// countLocals returns the number of items in the cache l of the given size.
+func countLocals(l unsafe.Pointer, size uintptr) uint64 {
+	n := 0
+	for i := 0; i < int(size); i++ {
+		pl := indexLocal(l, i)
+		// The private item may be changing under us,
+		// but its type word is enough to tell whether it is set.
+		if atomic.LoadPointer(&(*eface)(unsafe.Pointer(&pl.private)).typ) != nil {
+			n++
+		}
+		n += pl.shared.len()
+	}
+	return uint64(n)
+}
+
+func (s *poolStatsInternal) add(t *poolStatsInternal) {
+	s.gets += t.gets
+	s.misses += t.misses
+	s.puts += t.puts
+	s.drops += t.drops
+	s.drained += t.drained
+	s.expired += t.expired
+	s.steals += t.steals
+}
+
+// load adds the counters in t, which may be updated concurrently, to s.
+func (s *poolStatsInternal) load(t *poolStatsInternal) {
+	s.gets += atomic.LoadUint64(&t.gets)
+	s.misses += atomic.LoadUint64(&t.misses)
+	s.puts += atomic.LoadUint64(&t.puts)
+	s.drops += atomic.LoadUint64(&t.drops)
+	s.drained += atomic.LoadUint64(&t.drained)
+	s.expired += atomic.LoadUint64(&t.expired)
+	s.steals += atomic.LoadUint64(&t.steals)
+}
+
 var (
 	allPoolsMu Mutex
 
@@ -11,6 +11,7 @@ import (
 	"runtime"
 	"runtime/debug"
 	"sort"
+	"strings"
 	. "sync"
 	"sync/atomic"
 	"testing"
@@ -90,6 +91,572 @@ func TestPoolNew(t *testing.T) {
 	}
 }
 
+func TestPoolMaxRetain(t *testing.T) {
+	// disable GC so we can control when it happens.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	// The limit counts items cached for a single P, which a Get on
+	// another P cannot reach; run on one P so every item can be counted.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	var p Pool
+	p.SetMaxRetain(3)
+	count := func() int {
+		n := 0
+		for p.Get() != nil {
+			n++
+		}
+		return n
+	}
+	for i := 0; i < 10; i++ {
+		p.Put(i)
+	}
+	if n := count(); n != 3 {
+		t.Fatalf("got %d items; want 3", n)
+	}
+
+	// Items in the victim cache count towards the limit.
+	for i := 0; i < 2; i++ {
+		p.Put(i)
+	}
+	runtime.GC()
+	for i := 0; i < 10; i++ {
+		p.Put(i)
+	}
+	if n := count(); n != 3 {
+		t.Fatalf("got %d items after GC; want 3", n)
+	}
+
+	p.SetMaxRetain(0)
+	for i := 0; i < 10; i++ {
+		p.Put(i)
+	}
+	if n := count(); n != 10 {
+		t.Fatalf("got %d items after removing limit; want 10", n)
+	}
+}
+
+func TestPoolFinalizer(t *testing.T) {
+	// disable GC so we can control when it happens.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	var p Pool
+	finalized := make(map[int]int)
+	p.SetFinalizer(func(x interface{}) {
+		finalized[x.(int)]++
+	})
+	p.SetMaxRetain(8)
+	for i := 0; i < 10; i++ {
+		p.Put(i)
+	}
+	// The pool is full after 8 items.
+	if len(finalized) != 2 || finalized[8] != 1 || finalized[9] != 1 {
+		t.Fatalf("finalized %v after overflow; want 8 and 9", finalized)
+	}
+
+	// Move half of the items to the victim cache.
+	for i := 0; i < 4; i++ {
+		p.Get()
+	}
+	runtime.GC()
+	for i := 10; i < 12; i++ {
+		p.Put(i)
+	}
+	p.Drain()
+	if len(finalized) != 8 {
+		t.Fatalf("finalized %d items after Drain; want 8", len(finalized))
+	}
+	for x, n := range finalized {
+		if n != 1 {
+			t.Errorf("item %d finalized %d times", x, n)
+		}
+	}
+	if x := p.Get(); x != nil {
+		t.Fatalf("got %v after Drain; want nil", x)
+	}
+}
+
+func TestPoolFinalizerGC(t *testing.T) {
+	// disable GC so we can control when it happens.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	var p Pool
+	finalized := 0
+	p.SetFinalizer(func(x interface{}) {
+		finalized++
+	})
+	for i := 0; i < 10; i++ {
+		p.Put(i)
+	}
+	// After two GCs the items are dropped from the pool and
+	// finalized by the next Get.
+	runtime.GC()
+	runtime.GC()
+	if x := p.Get(); x != nil {
+		t.Fatalf("got %v after two GCs; want nil", x)
+	}
+	if finalized != 10 {
+		t.Fatalf("finalized %d items; want 10", finalized)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	var p Pool
+	finalized := 0
+	p.SetFinalizer(func(x interface{}) {
+		finalized++
+	})
+	p.Put(new(int))
+	p.Close()
+	if finalized != 1 {
+		t.Fatalf("finalized %d items on Close; want 1", finalized)
+	}
+	p.Put(new(int))
+	if finalized != 2 {
+		t.Fatalf("Put after Close did not finalize")
+	}
+	if x := p.Get(); x != nil {
+		t.Fatalf("got %v from closed pool; want nil", x)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	// disable GC so we can control when it happens.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	var p Pool
+	p.SetCounting(true)
+	p.SetMaxRetain(10)
+	for i := 0; i < 12; i++ {
+		p.Put(i)
+	}
+	for i := 0; i < 4; i++ {
+		p.Get()
+	}
+	want := PoolStats{Gets: 4, Puts: 12, Drops: 2, Retained: 6}
+	if s := p.Stats(); s != want {
+		t.Fatalf("got %+v; want %+v", s, want)
+	}
+
+	// The first GC moves the items to the victim cache,
+	// the second discards them.
+	runtime.GC()
+	if s := p.Stats(); s.Retained != 6 || s.Discarded != 0 {
+		t.Fatalf("got %+v after one GC; want 6 retained", s)
+	}
+	runtime.GC()
+	p.Get()
+	want = PoolStats{Gets: 5, Misses: 1, Puts: 12, Drops: 2, Discarded: 6}
+	if s := p.Stats(); s != want {
+		t.Fatalf("got %+v after two GCs; want %+v", s, want)
+	}
+
+	// Drain reaches every item of a finalizing pool.
+	var q Pool
+	q.SetCounting(true)
+	q.SetFinalizer(func(interface{}) {})
+	for i := 0; i < 3; i++ {
+		q.Put(i)
+	}
+	q.Drain()
+	want = PoolStats{Puts: 3, Drained: 3}
+	if s := q.Stats(); s != want {
+		t.Fatalf("got %+v after Drain; want %+v", s, want)
+	}
+
+	// The counts survive the collections that drop the caches.
+	var r Pool
+	r.SetCounting(true)
+	r.Put(1)
+	r.Get()
+	r.Get()
+	runtime.GC()
+	runtime.GC()
+	want = PoolStats{Gets: 2, Misses: 1, Puts: 1}
+	if s := r.Stats(); s != want {
+		t.Fatalf("got %+v for a counting pool; want %+v", s, want)
+	}
+
+	// Without counting, Gets and Puts go uncounted.
+	r.SetCounting(false)
+	r.Put(1)
+	r.Get()
+	if s := r.Stats(); s != want {
+		t.Fatalf("got %+v after counting stopped; want %+v", s, want)
+	}
+}
+
+func TestPoolRebalance(t *testing.T) {
+	// disable GC so we can control when it happens.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	var p Pool
+	p.SetCounting(true)
+	if s := p.Shards(); s != nil {
+		t.Fatalf("got %+v for an unused pool; want nil", s)
+	}
+	// Put everything on one P.
+	Runtime_procPin()
+	for i := 0; i < 41; i++ {
+		p.Put(i)
+	}
+	Runtime_procUnpin()
+	shards := p.Shards()
+	if len(shards) != 4 {
+		t.Fatalf("got %d shards; want 4", len(shards))
+	}
+	busy := 0
+	for i, s := range shards {
+		if s.Puts == 0 {
+			continue
+		}
+		busy++
+		if want := (PoolShard{Private: true, Shared: 40, Puts: 41}); s != want {
+			t.Errorf("shard %d: got %+v; want %+v", i, s, want)
+		}
+	}
+	if busy != 1 {
+		t.Fatalf("items were Put on %d shards; want 1", busy)
+	}
+
+	p.Rebalance()
+	for i, s := range p.Shards() {
+		if s.Shared != 10 || s.Puts != 0 {
+			t.Errorf("shard %d after Rebalance: got %+v; want 10 shared items", i, s)
+		}
+	}
+	if s := p.Stats(); s.Puts != 41 {
+		t.Errorf("got %+v after Rebalance; want 41 Puts", s)
+	}
+	seen := make(map[interface{}]bool)
+	for x := p.Get(); x != nil; x = p.Get() {
+		if seen[x] {
+			t.Fatalf("got %v twice", x)
+		}
+		seen[x] = true
+	}
+	if len(seen) < 40 {
+		t.Fatalf("got %d items back after Rebalance; want at least 40", len(seen))
+	}
+}
+
+func TestPoolRebalanceMaxRetain(t *testing.T) {
+	// disable GC so we can control when it happens.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	var p Pool
+	p.SetMaxRetain(1)
+	// Put an item privately on another P and keep that P busy,
+	// so that Rebalance runs elsewhere and drops the item.
+	var put, done uint32
+	go func() {
+		Runtime_procPin()
+		p.Put(1)
+		atomic.StoreUint32(&put, 1)
+		for atomic.LoadUint32(&done) == 0 {
+		}
+		Runtime_procUnpin()
+	}()
+	for atomic.LoadUint32(&put) == 0 {
+		runtime.Gosched()
+	}
+	p.Rebalance()
+	atomic.StoreUint32(&done, 1)
+	for i, s := range p.Shards() {
+		if s.Private {
+			t.Fatalf("shard %d kept a private item after Rebalance", i)
+		}
+	}
+	// The dropped item no longer takes up room.
+	Runtime_procPin()
+	p.Put(2)
+	x := p.Get()
+	Runtime_procUnpin()
+	if x != 2 {
+		t.Fatalf("got %v after Rebalance dropped an item; want 2", x)
+	}
+}
+
+func TestPoolPreallocate(t *testing.T) {
+	// disable GC so we can control when it happens.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	var p Pool
+	p.SetCounting(true)
+	var n int32
+	p.New = func() interface{} {
+		return atomic.AddInt32(&n, 1)
+	}
+	p.Preallocate(10)
+	if n != 10 {
+		t.Fatalf("Preallocate(10) called New %d times", n)
+	}
+	if s := p.Stats(); s.Puts != 10 || s.Retained != 10 {
+		t.Fatalf("got %+v; want 10 items retained", s)
+	}
+	// Preallocating an active pool fills the caller's cache.
+	p.Preallocate(5)
+	for i := 0; i < 15; i++ {
+		p.Get()
+	}
+	if n != 15 {
+		t.Fatalf("Get called New %d times after Preallocate; want 0", n-15)
+	}
+
+	// A bounded pool is filled to its limit.
+	var q Pool
+	q.New = func() interface{} { return 1 }
+	q.SetCounting(true)
+	q.SetMaxRetain(3)
+	q.Preallocate(10)
+	if s := q.Stats(); s.Puts != 3 || s.Retained != 3 {
+		t.Fatalf("got %+v; want 3 items retained", s)
+	}
+}
+
+func TestPoolPreallocateNil(t *testing.T) {
+	// disable GC so we can control when it happens.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	for _, max := range []int{0, 10} {
+		// Preallocate stops at the first nil from New.
+		var p Pool
+		calls := 0
+		p.New = func() interface{} {
+			calls++
+			if calls > 2 {
+				return nil
+			}
+			return calls
+		}
+		p.SetCounting(true)
+		p.SetMaxRetain(max)
+		p.Preallocate(5)
+		if calls != 3 {
+			t.Fatalf("max %d: Preallocate(5) called New %d times; want 3", max, calls)
+		}
+		if s := p.Stats(); s.Puts != 2 || s.Retained != 2 {
+			t.Fatalf("max %d: got %+v; want 2 items retained", max, s)
+		}
+		// The room reserved for the nil is released.
+		for i := 0; i < 2*max; i++ {
+			p.Put(i)
+		}
+		if s := p.Stats(); max > 0 && s.Retained != uint64(max) {
+			t.Fatalf("max %d: got %+v after filling the pool", max, s)
+		}
+	}
+}
+
+func TestPoolMinRetain(t *testing.T) {
+	// disable GC so we can control when it happens.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	var p Pool
+	p.SetCounting(true)
+	p.SetMinRetain(3)
+	for i := 0; i < 5; i++ {
+		p.Put(i)
+	}
+	for i := 0; i < 4; i++ {
+		runtime.GC()
+	}
+	if s := p.Stats(); s.Retained != 3 || s.Discarded != 2 {
+		t.Fatalf("got %+v after GCs; want 3 items retained", s)
+	}
+	seen := make(map[interface{}]bool)
+	for i := 0; i < 3; i++ {
+		x := p.Get()
+		if x == nil || seen[x] {
+			t.Fatalf("Get #%d returned %v; want a distinct reserved item", i, x)
+		}
+		seen[x] = true
+	}
+	if x := p.Get(); x != nil {
+		t.Fatalf("got %v from an empty pool; want nil", x)
+	}
+
+	// Lowering the minimum discards the excess.
+	for i := 0; i < 3; i++ {
+		p.Put(i)
+	}
+	runtime.GC()
+	runtime.GC()
+	p.SetMinRetain(1)
+	if s := p.Stats(); s.Retained != 1 {
+		t.Fatalf("got %+v after SetMinRetain(1); want 1 item retained", s)
+	}
+	p.Drain()
+	if s := p.Stats(); s.Retained != 0 {
+		t.Fatalf("got %+v after Drain; want no items retained", s)
+	}
+}
+
+func TestPoolGCPolicy(t *testing.T) {
+	// disable GC so we can control when it happens.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	for _, tt := range []struct {
+		policy PoolGCPolicy
+		want   []uint64 // items retained after each GC
+	}{
+		{PoolVictimCache, []uint64{5, 0, 0}},
+		{PoolKeepAll, []uint64{5, 5, 5}},
+		{PoolClearAll, []uint64{0, 0, 0}},
+	} {
+		var p Pool
+		var finalized int
+		p.SetCounting(true)
+		p.SetFinalizer(func(interface{}) { finalized++ })
+		p.SetGCPolicy(tt.policy)
+		for i := 0; i < 5; i++ {
+			p.Put(i)
+		}
+		for i, want := range tt.want {
+			runtime.GC()
+			if s := p.Stats(); s.Retained != want || s.Discarded != 5-want {
+				t.Fatalf("policy %d: got %+v after GC #%d; want %d retained", tt.policy, s, i+1, want)
+			}
+		}
+		p.Drain()
+		if finalized != 5 {
+			t.Fatalf("policy %d: finalized %d items; want 5", tt.policy, finalized)
+		}
+	}
+}
+
+func TestPoolLeakCheck(t *testing.T) {
+	var p Pool
+	p.New = func() interface{} { return new(int) }
+	if leaks := p.Leaks(0); leaks != nil {
+		t.Fatalf("got %d leaks with leak checking off", len(leaks))
+	}
+	p.SetLeakCheck(true)
+	x := p.Get()
+	time.Sleep(time.Millisecond)
+	y := p.Get()
+	p.Put(new(int))
+	leaks := p.Leaks(0)
+	if len(leaks) != 2 || leaks[0].Item != x || leaks[1].Item != y {
+		t.Fatalf("got %+v; want leaks of x and y, oldest first", leaks)
+	}
+	frames := runtime.CallersFrames(leaks[0].Stack)
+	if f, _ := frames.Next(); !strings.HasSuffix(f.Function, "sync_test.TestPoolLeakCheck") {
+		t.Fatalf("leak recorded at %s; want TestPoolLeakCheck", f.Function)
+	}
+	if leaks := p.Leaks(int64(time.Hour)); len(leaks) != 0 {
+		t.Fatalf("got %d leaks older than an hour", len(leaks))
+	}
+	p.Put(x)
+	p.Put(y)
+	if leaks := p.Leaks(0); len(leaks) != 0 {
+		t.Fatalf("got %+v after putting everything back", leaks)
+	}
+	p.SetLeakCheck(false)
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	// disable GC so we can control when it happens.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	const idle = 50 * time.Millisecond
+	var p Pool
+	var finalized int32
+	p.SetFinalizer(func(interface{}) { atomic.AddInt32(&finalized, 1) })
+	p.SetIdleTimeout(int64(idle))
+	defer p.SetIdleTimeout(0)
+	for i := 0; i < 10; i++ {
+		p.Put(i)
+	}
+	if s := p.Stats(); s.Retained != 10 || s.Expired != 0 {
+		t.Fatalf("got %+v; want 10 items retained", s)
+	}
+
+	// An item in use is never idle for long.
+	for start := time.Now(); time.Since(start) < 3*idle; {
+		p.Put(p.Get())
+		time.Sleep(idle / 10)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s := p.Stats()
+		if s.Expired == 10 && s.Retained == 0 {
+			break
+		}
+		if s.Expired > 10 || time.Now().After(deadline) {
+			t.Fatalf("got %+v; want 10 items expired and the one in use kept", s)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&finalized); n != 10 {
+		t.Fatalf("finalized %d items; want 10", n)
+	}
+}
+
+func TestPoolPutAsync(t *testing.T) {
+	// disable GC so we can control when it happens.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	// With one P, every item the worker puts is in reach of Get.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	var p Pool
+	var first, resets int32
+	started := make(chan bool)
+	release := make(chan bool)
+	p.SetReset(func(x interface{}) {
+		if atomic.CompareAndSwapInt32(&first, 0, 1) {
+			started <- true
+			<-release
+		}
+		*x.(*int) = 0
+		atomic.AddInt32(&resets, 1)
+	})
+
+	// The worker blocks in the first reset; the queue behind it fills
+	// up, and the next item is reset by PutAsync itself.
+	p.PutAsync(newInt(1))
+	<-started
+	for i := 0; i < PoolAsyncQueue; i++ {
+		p.PutAsync(newInt(1))
+	}
+	if n := atomic.LoadInt32(&resets); n != 0 {
+		t.Fatalf("got %d resets while the worker is blocked; want 0", n)
+	}
+	p.PutAsync(newInt(1))
+	if n := atomic.LoadInt32(&resets); n != 1 {
+		t.Fatalf("got %d resets after the queue filled up; want 1", n)
+	}
+
+	close(release)
+	const total = PoolAsyncQueue + 2
+	deadline := time.Now().Add(10 * time.Second)
+	for p.Stats().Retained != total {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %+v; want %d items retained", p.Stats(), total)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&resets); n != total {
+		t.Fatalf("got %d resets; want %d", n, total)
+	}
+	for i := 0; i < total; i++ {
+		if x := p.Get().(*int); *x != 0 {
+			t.Fatalf("got item %d from the pool; want it reset to 0", *x)
+		}
+	}
+
+	// Without a reset function, PutAsync is Put.
+	p.SetReset(nil)
+	p.PutAsync(newInt(7))
+	if x := p.Get(); x == nil || *x.(*int) != 7 {
+		t.Fatalf("got %v; want the item just Put", x)
+	}
+}
+
+func newInt(v int) *int { return &v }
+
 // Test that Pool does not hold pointers to previously cached resources.
 func TestPoolGC(t *testing.T) {
 	testPool(t, true)
@@ -270,6 +837,17 @@ func BenchmarkPoolOverflow(b *testing.B) {
 	})
 }
 
+func BenchmarkPoolMaxRetain(b *testing.B) {
+	var p Pool
+	p.SetMaxRetain(1 << 10)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			p.Put(1)
+			p.Get()
+		}
+	})
+}
+
 var globalSink interface{}
 
 func BenchmarkPoolSTW(b *testing.B) {
@@ -0,0 +1,86 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// poolAsyncQueue is the number of items PutAsync queues for a pool
+// before it resets them on the caller's goroutine instead.
+const poolAsyncQueue = 64
+
+// poolAsync holds the items of a Pool waiting to be reset by its
+// worker, a goroutine that runs while the queue is non-empty.
+type poolAsync struct {
+	reset   func(x interface{})
+	queue   chan interface{}
+	running uint32 // whether a worker is running; atomic
+}
+
+// SetReset sets the function PutAsync calls on each item before the
+// item goes back into p, such as one that zeroes a large buffer. Put
+// does not call it: it is for items the caller has already reset.
+// Calling SetReset with nil makes PutAsync behave like Put. Items
+// already queued by PutAsync are reset with the previous function.
+func (p *Pool) SetReset(reset func(x interface{})) {
+	var a *poolAsync
+	if reset != nil {
+		a = &poolAsync{reset: reset, queue: make(chan interface{}, poolAsyncQueue)}
+	}
+	atomic.StorePointer(&p.async, unsafe.Pointer(a))
+}
+
+// PutAsync adds x to the pool once p's reset function, see SetReset,
+// has been called on it. The reset runs off the caller's path, on a
+// goroutine p starts when needed and that exits once it runs out of
+// items, so that a caller returning an item that is expensive to reset
+// does not wait for it. If that goroutine falls behind, PutAsync resets
+// x itself before it returns, which holds callers to the pace at which
+// items are reset rather than queue an unbounded number of them.
+//
+// x must not be used after the call: until it is reset, it is neither
+// the caller's nor in the pool. If p has no reset function, PutAsync is
+// the same as Put.
+func (p *Pool) PutAsync(x interface{}) {
+	a := (*poolAsync)(atomic.LoadPointer(&p.async))
+	if a == nil {
+		p.Put(x)
+		return
+	}
+	if x == nil {
+		return
+	}
+	select {
+	case a.queue <- x:
+	default:
+		a.reset(x)
+		p.Put(x)
+		return
+	}
+	if atomic.LoadUint32(&a.running) == 0 && atomic.CompareAndSwapUint32(&a.running, 0, 1) {
+		go p.resetQueued(a)
+	}
+}
+
+// resetQueued resets the items in a's queue and puts them into p until
+// the queue is empty.
+func (p *Pool) resetQueued(a *poolAsync) {
+	for {
+		select {
+		case x := <-a.queue:
+			a.reset(x)
+			p.Put(x)
+		default:
+			atomic.StoreUint32(&a.running, 0)
+			// An item queued after the receive failed but before
+			// running was cleared started no worker; take it over.
+			if len(a.queue) == 0 || !atomic.CompareAndSwapUint32(&a.running, 0, 1) {
+				return
+			}
+		}
+	}
+}
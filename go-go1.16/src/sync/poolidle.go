@@ -0,0 +1,143 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"internal/race"
+	"sync/atomic"
+	"unsafe"
+)
+
+// minIdleSweep is the shortest interval, in nanoseconds, between
+// sweeps of pools with an idle timeout.
+const minIdleSweep = 1e6
+
+// idlePools holds the idle timeouts of the pools that have one.
+// A single background goroutine, running while the map is non-empty,
+// sweeps them all.
+var idlePools struct {
+	mu      Mutex
+	timeout map[*Pool]int64
+	running bool
+}
+
+// SetIdleTimeout makes p drop items that have been in it, unused, for
+// longer than d nanoseconds, so that a pool sized for a burst of load
+// shrinks again once the burst is over, even if garbage collections are
+// rare. Dropped items are passed to p's finalizer, if any, from a
+// background goroutine that sweeps p every d/2 nanoseconds or so; an
+// item may therefore linger for up to about 1.5*d. A value of d <= 0
+// removes the timeout, which is the default.
+//
+// A pool with an idle timeout does not use its per-P fast path for Put,
+// and the sweeper keeps it reachable until its timeout is removed.
+//
+// SetIdleTimeout should be called before the pool is first used.
+// Items Put earlier carry no timestamp: the first sweep drops them,
+// except for any cached privately by a P, which it cannot reach.
+func (p *Pool) SetIdleTimeout(d int64) {
+	idlePools.mu.Lock()
+	defer idlePools.mu.Unlock()
+	if d <= 0 {
+		p.setFlag(poolTimed, false)
+		delete(idlePools.timeout, p)
+		return
+	}
+	if idlePools.timeout == nil {
+		idlePools.timeout = make(map[*Pool]int64)
+	}
+	idlePools.timeout[p] = d
+	p.setFlag(poolTimed, true)
+	if !idlePools.running {
+		idlePools.running = true
+		go sweepIdlePools()
+	}
+}
+
+// sweepIdlePools periodically expires idle items from the pools in
+// idlePools until none is left.
+func sweepIdlePools() {
+	var (
+		pools    []*Pool
+		timeouts []int64
+	)
+	for {
+		idlePools.mu.Lock()
+		if len(idlePools.timeout) == 0 {
+			idlePools.running = false
+			idlePools.mu.Unlock()
+			return
+		}
+		period := int64(-1)
+		for p, d := range idlePools.timeout {
+			pools = append(pools, p)
+			timeouts = append(timeouts, d)
+			if period < 0 || d/2 < period {
+				period = d / 2
+			}
+		}
+		idlePools.mu.Unlock()
+
+		now := nanotime()
+		for i, p := range pools {
+			p.expire(now - timeouts[i])
+			pools[i] = nil
+		}
+		pools, timeouts = pools[:0], timeouts[:0]
+
+		if period < minIdleSweep {
+			period = minIdleSweep
+		}
+		sleep(period)
+	}
+}
+
+// expire drops the items in p that were Put before cutoff.
+func (p *Pool) expire(cutoff int64) {
+	p.finalizeDead()
+
+	// See the comment in Drain.
+	runtime_procPin()
+	size := runtime_LoadAcquintptr(&p.localSize) // load-acquire
+	locals := p.local                            // load-consume
+	victimSize := atomic.LoadUintptr(&p.victimSize)
+	victim := p.victim
+	runtime_procUnpin()
+
+	n := p.expireLocals(locals, size, &p.nlocal, cutoff)
+	n += p.expireLocals(victim, victimSize, &p.nvictim, cutoff)
+	if n > 0 {
+		if race.Enabled {
+			race.Disable()
+		}
+		l, _ := p.pin()
+		l.stats.expired += uint64(n)
+		runtime_procUnpin()
+		if race.Enabled {
+			race.Enable()
+		}
+	}
+}
+
+// expireLocals drops the items in the cache l of the given size that
+// were Put before cutoff and returns their number. If p is bounded,
+// count is the item count to maintain for l.
+func (p *Pool) expireLocals(l unsafe.Pointer, size uintptr, count *int32, cutoff int64) (n int) {
+	bounded := atomic.LoadInt32(&p.max) > 0
+	for i := 0; i < int(size); i++ {
+		for {
+			x, ok := indexLocal(l, i).shared.popTailBefore(cutoff)
+			if !ok {
+				break
+			}
+			n++
+			if bounded {
+				decrementCount(count)
+			}
+			p.discard(x)
+		}
+	}
+	return n
+}
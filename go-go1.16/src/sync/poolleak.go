@@ -0,0 +1,102 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A PoolLeak describes an item that was taken from a Pool by Get and
+// has not been Put back. See Pool.Leaks.
+type PoolLeak struct {
+	Item  interface{} // the item
+	Age   int64       // nanoseconds since Get returned it
+	Stack []uintptr   // call stack of Get's caller, as reported by runtime.Callers
+}
+
+// poolLeaks tracks the items a leak-checking Pool has handed out.
+type poolLeaks struct {
+	mu  Mutex
+	out map[unsafe.Pointer]*poolLeakRecord // keyed by the item's data word
+}
+
+type poolLeakRecord struct {
+	item  interface{}
+	when  int64
+	stack []uintptr
+}
+
+// maxLeakStack is the maximum number of frames recorded per Get.
+const maxLeakStack = 32
+
+// SetLeakCheck turns leak checking for p on or off. While it is on, p
+// remembers the call stack of each Get until the item is Put back, and
+// Leaks reports the items still outstanding, which helps find code that
+// takes items from a pool and forgets to return them.
+//
+// Items are identified by their pointer, so only items of pointer type
+// are tracked reliably. Leak checking keeps outstanding items reachable
+// and makes Get and Put much slower; it is meant for debugging.
+// Turning it off forgets every outstanding item.
+func (p *Pool) SetLeakCheck(enabled bool) {
+	var l *poolLeaks
+	if enabled {
+		if atomic.LoadPointer(&p.leaks) != nil {
+			return
+		}
+		l = &poolLeaks{out: make(map[unsafe.Pointer]*poolLeakRecord)}
+	}
+	atomic.StorePointer(&p.leaks, unsafe.Pointer(l))
+	p.setFlag(poolLeakCheck, enabled)
+}
+
+// Leaks returns the items taken from p by Get at least minAge
+// nanoseconds ago and not yet Put back, oldest first. It returns nil
+// if leak checking is off; see SetLeakCheck.
+func (p *Pool) Leaks(minAge int64) []PoolLeak {
+	l := (*poolLeaks)(atomic.LoadPointer(&p.leaks))
+	if l == nil {
+		return nil
+	}
+	now := nanotime()
+	var leaks []PoolLeak
+	l.mu.Lock()
+	for _, r := range l.out {
+		if age := now - r.when; age >= minAge {
+			leaks = append(leaks, PoolLeak{Item: r.item, Age: age, Stack: r.stack})
+		}
+	}
+	l.mu.Unlock()
+	sortSlice(len(leaks), func(i, j int) bool { return leaks[i].Age > leaks[j].Age }, func(i, j int) { leaks[i], leaks[j] = leaks[j], leaks[i] })
+	return leaks
+}
+
+// record notes that Get is about to return x. skip is the number of
+// frames to omit, counting from record's caller.
+func (l *poolLeaks) record(x interface{}, skip int) {
+	var pcs [maxLeakStack]uintptr
+	n := runtime.Callers(skip+2, pcs[:])
+	r := &poolLeakRecord{
+		item:  x,
+		when:  nanotime(),
+		stack: append([]uintptr(nil), pcs[:n]...),
+	}
+	l.mu.Lock()
+	l.out[leakKey(x)] = r
+	l.mu.Unlock()
+}
+
+// forget notes that x was Put back.
+func (l *poolLeaks) forget(x interface{}) {
+	l.mu.Lock()
+	delete(l.out, leakKey(x))
+	l.mu.Unlock()
+}
+
+func leakKey(x interface{}) unsafe.Pointer {
+	return (*eface)(unsafe.Pointer(&x)).val
+}
@@ -42,6 +42,13 @@ type poolDequeue struct {
 	// is set to nil atomically by the consumer and read
 	// atomically by the producer.
 	vals []eface
+
+	// stamps, if non-nil, records when each value in vals was
+	// pushed, as reported by nanotime. It is parallel to
+	// vals and is only allocated for pools with an idle timeout.
+	// Slots are written atomically by the producer while it owns
+	// them and read atomically by consumers.
+	stamps []int64
 }
 
 type eface struct {
@@ -75,9 +82,22 @@ func (d *poolDequeue) pack(head, tail uint32) uint64 {
 		uint64(tail&mask)
 }
 
+// len returns the number of elements in d. If d is being modified
+// concurrently, the result is only approximate.
+func (d *poolDequeue) len() int {
+	head, tail := d.unpack(atomic.LoadUint64(&d.headTail))
+	return int(head - tail)
+}
+
 // pushHead adds val at the head of the queue. It returns false if the
 // queue is full. It must only be called by a single producer.
 func (d *poolDequeue) pushHead(val interface{}) bool {
+	return d.pushHeadAt(val, 0)
+}
+
+// pushHeadAt is like pushHead, but also records now as the time val
+// was pushed if d keeps stamps.
+func (d *poolDequeue) pushHeadAt(val interface{}, now int64) bool {
 	ptrs := atomic.LoadUint64(&d.headTail)
 	head, tail := d.unpack(ptrs)
 	if (tail+uint32(len(d.vals)))&(1<<dequeueBits-1) == head {
@@ -99,6 +119,9 @@ func (d *poolDequeue) pushHead(val interface{}) bool {
 		val = dequeueNil(nil)
 	}
 	*(*interface{})(unsafe.Pointer(slot)) = val
+	if d.stamps != nil {
+		atomic.StoreInt64(&d.stamps[head&uint32(len(d.vals)-1)], now)
+	}
 
 	// Increment head. This passes ownership of slot to popTail
 	// and acts as a store barrier for writing the slot.
@@ -145,13 +168,20 @@ func (d *poolDequeue) popHead() (interface{}, bool) {
 // It returns false if the queue is empty. It may be called by any
 // number of consumers.
 func (d *poolDequeue) popTail() (interface{}, bool) {
+	val, _, ok := d.popTailStamped()
+	return val, ok
+}
+
+// popTailStamped is like popTail, but also returns the time the
+// element was pushed, or 0 if d keeps no stamps.
+func (d *poolDequeue) popTailStamped() (val interface{}, stamp int64, ok bool) {
 	var slot *eface
 	for {
 		ptrs := atomic.LoadUint64(&d.headTail)
 		head, tail := d.unpack(ptrs)
 		if tail == head {
 			// Queue is empty.
-			return nil, false
+			return nil, 0, false
 		}
 
 		// Confirm head and tail (for our speculative check
@@ -161,12 +191,15 @@ func (d *poolDequeue) popTail() (interface{}, bool) {
 		if atomic.CompareAndSwapUint64(&d.headTail, ptrs, ptrs2) {
 			// Success.
 			slot = &d.vals[tail&uint32(len(d.vals)-1)]
+			if d.stamps != nil {
+				stamp = atomic.LoadInt64(&d.stamps[tail&uint32(len(d.vals)-1)])
+			}
 			break
 		}
 	}
 
 	// We now own slot.
-	val := *(*interface{})(unsafe.Pointer(slot))
+	val = *(*interface{})(unsafe.Pointer(slot))
 	if val == dequeueNil(nil) {
 		val = nil
 	}
@@ -181,7 +214,46 @@ func (d *poolDequeue) popTail() (interface{}, bool) {
 	atomic.StorePointer(&slot.typ, nil)
 	// At this point pushHead owns the slot.
 
-	return val, true
+	return val, stamp, true
+}
+
+// popTailBefore is like popTail, but only removes the element at the
+// tail if it was pushed before cutoff. Elements pushed without a stamp
+// count as pushed at time 0. It reports whether the queue was empty if
+// it removes nothing.
+func (d *poolDequeue) popTailBefore(cutoff int64) (val interface{}, ok, empty bool) {
+	var slot *eface
+	for {
+		ptrs := atomic.LoadUint64(&d.headTail)
+		head, tail := d.unpack(ptrs)
+		if tail == head {
+			// Queue is empty.
+			return nil, false, true
+		}
+
+		// The slot at tail stays ours to inspect for as long as
+		// tail does not move. If another consumer takes it, and
+		// the producer refills it, the CAS below fails.
+		if d.stamps != nil && atomic.LoadInt64(&d.stamps[tail&uint32(len(d.vals)-1)]) >= cutoff {
+			return nil, false, false
+		}
+
+		ptrs2 := d.pack(head, tail+1)
+		if atomic.CompareAndSwapUint64(&d.headTail, ptrs, ptrs2) {
+			// Success.
+			slot = &d.vals[tail&uint32(len(d.vals)-1)]
+			break
+		}
+	}
+
+	// We now own slot. See popTail.
+	val = *(*interface{})(unsafe.Pointer(slot))
+	if val == dequeueNil(nil) {
+		val = nil
+	}
+	slot.val = nil
+	atomic.StorePointer(&slot.typ, nil)
+	return val, true, false
 }
 
 // poolChain is a dynamically-sized version of poolDequeue.
@@ -226,17 +298,27 @@ func loadPoolChainElt(pp **poolChainElt) *poolChainElt {
 }
 
 func (c *poolChain) pushHead(val interface{}) {
+	c.pushHeadAt(val, 0)
+}
+
+// pushHeadAt is like pushHead, but records now as the time val was
+// pushed. A non-zero now makes every dequeue allocated from then on
+// keep stamps.
+func (c *poolChain) pushHeadAt(val interface{}, now int64) {
 	d := c.head
 	if d == nil {
 		// Initialize the chain.
 		const initSize = 8 // Must be a power of 2
 		d = new(poolChainElt)
 		d.vals = make([]eface, initSize)
+		if now != 0 {
+			d.stamps = make([]int64, initSize)
+		}
 		c.head = d
 		storePoolChainElt(&c.tail, d)
 	}
 
-	if d.pushHead(val) {
+	if d.pushHeadAt(val, now) {
 		return
 	}
 
@@ -250,9 +332,23 @@ func (c *poolChain) pushHead(val interface{}) {
 
 	d2 := &poolChainElt{prev: d}
 	d2.vals = make([]eface, newSize)
+	if now != 0 {
+		d2.stamps = make([]int64, newSize)
+	}
 	c.head = d2
 	storePoolChainElt(&d.next, d2)
-	d2.pushHead(val)
+	d2.pushHeadAt(val, now)
+}
+
+// len returns the number of elements in c. It may be called by any
+// goroutine, but if c is being modified concurrently, the result is
+// only approximate.
+func (c *poolChain) len() int {
+	n := 0
+	for d := loadPoolChainElt(&c.tail); d != nil; d = loadPoolChainElt(&d.next) {
+		n += d.len()
+	}
+	return n
 }
 
 func (c *poolChain) popHead() (interface{}, bool) {
@@ -269,9 +365,16 @@ func (c *poolChain) popHead() (interface{}, bool) {
 }
 
 func (c *poolChain) popTail() (interface{}, bool) {
+	val, _, ok := c.popTailStamped()
+	return val, ok
+}
+
+// popTailStamped is like popTail, but also returns the time the
+// element was pushed, or 0 if it was pushed without a stamp.
+func (c *poolChain) popTailStamped() (interface{}, int64, bool) {
 	d := loadPoolChainElt(&c.tail)
 	if d == nil {
-		return nil, false
+		return nil, 0, false
 	}
 
 	for {
@@ -283,14 +386,14 @@ func (c *poolChain) popTail() (interface{}, bool) {
 		// safe to drop d from the chain.
 		d2 := loadPoolChainElt(&d.next)
 
-		if val, ok := d.popTail(); ok {
-			return val, ok
+		if val, stamp, ok := d.popTailStamped(); ok {
+			return val, stamp, ok
 		}
 
 		if d2 == nil {
 			// This is the only dequeue. It's empty right
 			// now, but could be pushed to in the future.
-			return nil, false
+			return nil, 0, false
 		}
 
 		// The tail of the chain has been drained, so move on
@@ -307,3 +410,34 @@ func (c *poolChain) popTail() (interface{}, bool) {
 		d = d2
 	}
 }
+
+// popTailBefore removes and returns the element at the tail of the
+// chain if it was pushed before cutoff. Since elements are stamped in
+// the order they are pushed, repeated calls remove every element older
+// than cutoff.
+func (c *poolChain) popTailBefore(cutoff int64) (interface{}, bool) {
+	d := loadPoolChainElt(&c.tail)
+	if d == nil {
+		return nil, false
+	}
+
+	for {
+		// See popTail for why next must be loaded first.
+		d2 := loadPoolChainElt(&d.next)
+
+		val, ok, empty := d.popTailBefore(cutoff)
+		if ok {
+			return val, ok
+		}
+		if !empty || d2 == nil {
+			// The oldest element is too young, or there is none.
+			return nil, false
+		}
+
+		// Drop the empty dequeue as popTail does.
+		if atomic.CompareAndSwapPointer((*unsafe.Pointer)(unsafe.Pointer(&c.tail)), unsafe.Pointer(d), unsafe.Pointer(d2)) {
+			storePoolChainElt(&d2.prev, nil)
+		}
+		d = d2
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"internal/race"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A PoolShard describes the cache a Pool keeps for one P.
+// See Pool.Shards.
+type PoolShard struct {
+	Private bool // whether the P holds an item in its private slot
+	Shared  int  // items in the P's shared list
+
+	// Counts of calls made on the P since the cache was created,
+	// which happens after each garbage collection and Rebalance.
+	// Gets, Misses and Puts are only counted while counting is on;
+	// see Pool.SetCounting.
+	Gets   uint64 // calls to Get
+	Misses uint64 // calls to Get that found the pool empty
+	Puts   uint64 // calls to Put that kept the item
+	Steals uint64 // items Get took from the shared lists of other Ps
+}
+
+// Shards returns a description of p's cache for each P, indexed by P.
+// It is meant for diagnosing pools whose use is unbalanced across Ps:
+// if items are Put on some Ps and taken on others, most Gets find their
+// own P's cache empty and steal from the others, which shows up as
+// high Steals on the Ps that Get and long Shared lists on those that
+// Put. Rebalance spreads the shared lists back out.
+//
+// Like Stats, Shards does not stop concurrent Gets and Puts, so the
+// shards are only approximately consistent with each other while p is
+// in use. It returns nil if p has no cache, as after a garbage
+// collection with no use of p since.
+func (p *Pool) Shards() []PoolShard {
+	// See the comment in Drain.
+	runtime_procPin()
+	size := runtime_LoadAcquintptr(&p.localSize) // load-acquire
+	locals := p.local                            // load-consume
+	runtime_procUnpin()
+	if size == 0 {
+		return nil
+	}
+	shards := make([]PoolShard, size)
+	for i := range shards {
+		l := indexLocal(locals, i)
+		var st poolStatsInternal
+		st.load(&l.stats)
+		shards[i] = PoolShard{
+			// See countLocals.
+			Private: atomic.LoadPointer(&(*eface)(unsafe.Pointer(&l.private)).typ) != nil,
+			Shared:  l.shared.len(),
+			Gets:    st.gets,
+			Misses:  st.misses,
+			Puts:    st.puts,
+			Steals:  st.steals,
+		}
+	}
+	return shards
+}
+
+// Rebalance redistributes the items in the shared lists of p's per-P
+// caches evenly over the Ps, so that a pool filled by Puts on a few Ps
+// serves Gets on the others from their own caches again. It does not
+// move the items that Ps other than the caller's hold in their private
+// slots: those are dropped, as a garbage collection would drop them, or
+// finalized later if p has a finalizer. Dropped items no longer count
+// towards the limit set by SetMaxRetain.
+//
+// Rebalance replaces p's cache, as a change of GOMAXPROCS does, so
+// Puts running concurrently may leave their items in the old cache,
+// where they are lost in the same way, and the per-P counts reported by
+// Shards start again from zero. The counts reported by Stats are kept.
+// Rebalance is meant to be called now and then, not on every use of p.
+func (p *Pool) Rebalance() {
+	if race.Enabled {
+		race.Disable()
+	}
+	// As in pinSlow, the mutex is taken before pinning, and
+	// poolCleanup won't be called while we are pinned.
+	allPoolsMu.Lock()
+	pid := runtime_procPin()
+	old, size := p.local, p.localSize
+	if size > 1 {
+		local := make([]poolLocal, size)
+		local[pid].private = indexLocal(old, pid).private
+		indexLocal(old, pid).private = nil
+		// Deal the items out round-robin, taking them from each
+		// old shard from the tail so that each new shared list
+		// stays roughly in the order its items were Put.
+		n := 0
+		for i := 0; i < int(size); i++ {
+			shared := &indexLocal(old, i).shared
+			for {
+				x, stamp, ok := shared.popTailStamped()
+				if !ok {
+					break
+				}
+				local[n%int(size)].shared.pushHeadAt(x, stamp)
+				n++
+			}
+		}
+		// The other Ps' private items are dropped with old; they
+		// no longer count towards p's limit.
+		for i := 0; i < int(size); i++ {
+			// See countLocals.
+			if atomic.LoadPointer(&(*eface)(unsafe.Pointer(&indexLocal(old, i).private)).typ) != nil {
+				p.unretain(false)
+			}
+		}
+		p.foldStats(old, size)
+		if p.finalizer != nil {
+			p.addDead(old, size)
+		}
+		atomic.StorePointer(&p.local, unsafe.Pointer(&local[0])) // store-release
+		runtime_StoreReluintptr(&p.localSize, size)              // store-release
+	}
+	runtime_procUnpin()
+	allPoolsMu.Unlock()
+	if race.Enabled {
+		race.Enable()
+	}
+}
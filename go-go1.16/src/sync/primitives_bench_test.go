@@ -0,0 +1,171 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	. "sync"
+	"testing"
+)
+
+// The benchmarks in this file run each primitive's common operation
+// from 1 to 1024 goroutines, sharing one instance of the primitive
+// (contended) or using one instance per goroutine (uncontended), with
+// GOMAXPROCS as given and with it lowered so that each P runs up to
+// four of the goroutines (oversubscribed). They are meant to catch
+// regressions in the layout of the primitives' state words, so run
+// them before and after a change to that layout and compare the
+// results with benchstat:
+//
+//	go test -run=NONE -bench=Primitive -count=10 sync
+
+// A primitiveBench describes one operation of a primitive.
+type primitiveBench struct {
+	name string
+	// new returns a function doing the operation once on a new
+	// instance of the primitive.
+	new func() func()
+}
+
+var primitiveBenches = []primitiveBench{
+	{"Mutex", func() func() {
+		var mu Mutex
+		return func() {
+			mu.Lock()
+			mu.Unlock()
+		}
+	}},
+	{"MutexTryLock", func() func() {
+		var mu Mutex
+		return func() {
+			if mu.TryLock() {
+				mu.Unlock()
+			}
+		}
+	}},
+	{"RWMutexRead", func() func() {
+		var rw RWMutex
+		return func() {
+			rw.RLock()
+			rw.RUnlock()
+		}
+	}},
+	{"RWMutexTryRLock", func() func() {
+		var rw RWMutex
+		return func() {
+			if rw.TryRLock() {
+				rw.RUnlock()
+			}
+		}
+	}},
+	{"RWMutexWrite", func() func() {
+		var rw RWMutex
+		return func() {
+			rw.Lock()
+			rw.Unlock()
+		}
+	}},
+	{"RWMutexTryLock", func() func() {
+		var rw RWMutex
+		return func() {
+			if rw.TryLock() {
+				rw.Unlock()
+			}
+		}
+	}},
+	{"Semaphore", func() func() {
+		s := NewSemaphore(1)
+		ctx := context.Background()
+		return func() {
+			s.Acquire(ctx, 1)
+			s.Release(1)
+		}
+	}},
+	{"SemaphoreTryAcquire", func() func() {
+		s := NewSemaphore(1)
+		return func() {
+			if s.TryAcquire(1) {
+				s.Release(1)
+			}
+		}
+	}},
+	{"WaitGroup", func() func() {
+		var wg WaitGroup
+		return func() {
+			wg.Add(1)
+			wg.Done()
+		}
+	}},
+	{"Once", func() func() {
+		var once Once
+		return func() {
+			once.Do(func() {})
+		}
+	}},
+}
+
+func BenchmarkPrimitive(b *testing.B) {
+	for _, pr := range primitiveBenches {
+		pr := pr
+		b.Run(pr.name, func(b *testing.B) {
+			for _, contended := range []bool{true, false} {
+				name := "uncontended"
+				if contended {
+					name = "contended"
+				}
+				b.Run(name, func(b *testing.B) {
+					for g := 1; g <= 1024; g *= 4 {
+						benchmarkPrimitive(b, pr, contended, g, false)
+						benchmarkPrimitive(b, pr, contended, g, true)
+					}
+				})
+			}
+		})
+	}
+}
+
+func benchmarkPrimitive(b *testing.B, pr primitiveBench, contended bool, goroutines int, oversubscribe bool) {
+	procs := runtime.GOMAXPROCS(0)
+	if oversubscribe {
+		procs = (goroutines + 3) / 4
+		if procs >= runtime.GOMAXPROCS(0) {
+			// Not lower than as given, which the run without
+			// oversubscription covers.
+			return
+		}
+	}
+	b.Run(fmt.Sprintf("g=%d/procs=%d", goroutines, procs), func(b *testing.B) {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+		ops := make([]func(), goroutines)
+		for i := range ops {
+			if contended && i > 0 {
+				ops[i] = ops[0]
+			} else {
+				ops[i] = pr.new()
+			}
+		}
+		var start, done WaitGroup
+		start.Add(1)
+		done.Add(goroutines)
+		for i, op := range ops {
+			n := b.N / goroutines
+			if i < b.N%goroutines {
+				n++
+			}
+			go func(op func(), n int) {
+				defer done.Done()
+				start.Wait()
+				for ; n > 0; n-- {
+					op()
+				}
+			}(op, n)
+		}
+		b.ResetTimer()
+		start.Done()
+		done.Wait()
+	})
+}
@@ -0,0 +1,251 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A PriorityQueue is a queue of bounded capacity between producers and
+// consumers, as a BlockingQueue is, that hands out its values in order
+// of priority rather than of arrival: Take returns the least value
+// according to the queue's less function. Values that are equal under
+// less come out in the order they were put.
+//
+// Put waits while the queue is full and Take while it is empty; both
+// give up when their context is done, and Close stops the producers but
+// lets the consumers drain the queue, as for a BlockingQueue.
+//
+// The values live in a binary heap guarded by a mutex. Rather than wait
+// on a Cond, which could not wait for a context, waiters wait for a
+// channel that the next change of the queue closes; every waiter wakes,
+// and those that find nothing to do wait again.
+//
+// A PriorityQueue must be created with NewPriorityQueue and must not be
+// copied after first use.
+type PriorityQueue struct {
+	less func(a, b interface{}) bool
+	cap  int
+
+	mu       Mutex
+	heap     []pqItem
+	seq      uint64 // number of values put so far
+	closed   bool
+	notEmpty chan struct{} // closed by a Put or Close; made by waiting Takes
+	notFull  chan struct{} // closed by a Take or Close; made by waiting Puts
+}
+
+type pqItem struct {
+	v   interface{}
+	seq uint64 // order of arrival, to break ties
+}
+
+// NewPriorityQueue returns a new PriorityQueue that holds up to capacity
+// values and hands them out least first, as ordered by less. less must
+// be a strict weak ordering, as for sort.Slice; it is called with the
+// queue's lock held, and must not use the queue. NewPriorityQueue panics
+// if capacity is not positive.
+func NewPriorityQueue(capacity int, less func(a, b interface{}) bool) *PriorityQueue {
+	if capacity <= 0 {
+		panic("sync: NewPriorityQueue with non-positive capacity")
+	}
+	return &PriorityQueue{less: less, cap: capacity}
+}
+
+// Put adds v to q, waiting for room if q is full. It returns
+// ErrQueueClosed if q is closed before v is added, or ctx.Err() if ctx
+// is done first. A nil ctx never gives up.
+func (q *PriorityQueue) Put(ctx Context, v interface{}) error {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return ErrQueueClosed
+		}
+		if len(q.heap) < q.cap {
+			q.pushLocked(v)
+			q.mu.Unlock()
+			return nil
+		}
+		if q.notFull == nil {
+			q.notFull = make(chan struct{})
+		}
+		ch := q.notFull
+		q.mu.Unlock()
+
+		select {
+		case <-ch:
+		case <-cancel:
+			return ctx.Err()
+		}
+	}
+}
+
+// TryPut adds v to q if there is room, without waiting. It reports
+// whether it added v, which it does not if q is full or closed.
+func (q *PriorityQueue) TryPut(v interface{}) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || len(q.heap) >= q.cap {
+		return false
+	}
+	q.pushLocked(v)
+	return true
+}
+
+// Take removes and returns the least value in q, waiting for one if q
+// is empty. It returns ErrQueueClosed if q is closed and empty, or
+// ctx.Err() if ctx is done first. A nil ctx never gives up.
+func (q *PriorityQueue) Take(ctx Context) (interface{}, error) {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	for {
+		q.mu.Lock()
+		if len(q.heap) > 0 {
+			v := q.popLocked()
+			q.mu.Unlock()
+			return v, nil
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return nil, ErrQueueClosed
+		}
+		if q.notEmpty == nil {
+			q.notEmpty = make(chan struct{})
+		}
+		ch := q.notEmpty
+		q.mu.Unlock()
+
+		select {
+		case <-ch:
+		case <-cancel:
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// TryTake removes and returns the least value in q, if there is one,
+// without waiting. The ok result reports whether there was.
+func (q *PriorityQueue) TryTake() (v interface{}, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.heap) == 0 {
+		return nil, false
+	}
+	return q.popLocked(), true
+}
+
+// Peek returns the least value in q without removing it, if there is
+// one. The ok result reports whether there was. Another goroutine may
+// take the value before the caller can.
+func (q *PriorityQueue) Peek() (v interface{}, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.heap) == 0 {
+		return nil, false
+	}
+	return q.heap[0].v, true
+}
+
+// Len returns the number of values in q.
+func (q *PriorityQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.heap)
+}
+
+// Cap returns the capacity of q.
+func (q *PriorityQueue) Cap() int {
+	return q.cap
+}
+
+// Close closes q to producers: waiting and later calls of Put fail, and
+// once the values queued by then have been taken, so do calls of Take.
+// Calling Close more than once is harmless.
+func (q *PriorityQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	wakeWaiters(&q.notEmpty)
+	wakeWaiters(&q.notFull)
+}
+
+// wakeWaiters closes *ch, if it is not nil, to wake the goroutines
+// waiting for it, and clears it for the next waiters.
+func wakeWaiters(ch *chan struct{}) {
+	if *ch != nil {
+		close(*ch)
+		*ch = nil
+	}
+}
+
+// pushLocked adds v to the heap. q.mu must be held.
+func (q *PriorityQueue) pushLocked(v interface{}) {
+	q.heap = append(q.heap, pqItem{v, q.seq})
+	q.seq++
+	q.up(len(q.heap) - 1)
+	wakeWaiters(&q.notEmpty)
+}
+
+// popLocked removes and returns the least value of the heap, which must
+// not be empty. q.mu must be held.
+func (q *PriorityQueue) popLocked() interface{} {
+	h := q.heap
+	v := h[0].v
+	n := len(h) - 1
+	h[0] = h[n]
+	h[n] = pqItem{}
+	q.heap = h[:n]
+	if n > 0 {
+		q.down(0)
+	}
+	wakeWaiters(&q.notFull)
+	return v
+}
+
+func (q *PriorityQueue) before(i, j int) bool {
+	a, b := &q.heap[i], &q.heap[j]
+	if q.less(a.v, b.v) {
+		return true
+	}
+	if q.less(b.v, a.v) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+func (q *PriorityQueue) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !q.before(i, parent) {
+			break
+		}
+		q.heap[i], q.heap[parent] = q.heap[parent], q.heap[i]
+		i = parent
+	}
+}
+
+func (q *PriorityQueue) down(i int) {
+	n := len(q.heap)
+	for {
+		least := i
+		if l := 2*i + 1; l < n && q.before(l, least) {
+			least = l
+		}
+		if r := 2*i + 2; r < n && q.before(r, least) {
+			least = r
+		}
+		if least == i {
+			return
+		}
+		q.heap[i], q.heap[least] = q.heap[least], q.heap[i]
+		i = least
+	}
+}
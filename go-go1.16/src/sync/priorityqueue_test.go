@@ -0,0 +1,84 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	. "sync"
+	"testing"
+	"time"
+)
+
+type prioItem struct {
+	prio int
+	name string
+}
+
+func TestPriorityQueue(t *testing.T) {
+	q := NewPriorityQueue(4, func(a, b interface{}) bool {
+		return a.(prioItem).prio < b.(prioItem).prio
+	})
+	for _, it := range []prioItem{{3, "c"}, {1, "a1"}, {2, "b"}, {1, "a2"}} {
+		if !q.TryPut(it) {
+			t.Fatalf("TryPut(%v) failed with room in the queue", it)
+		}
+	}
+	if q.TryPut(prioItem{0, "x"}) {
+		t.Fatal("TryPut succeeded on a full queue")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Put(ctx, prioItem{0, "x"}); err != context.DeadlineExceeded {
+		t.Fatalf("Put on a full queue = %v; want %v", err, context.DeadlineExceeded)
+	}
+	if v, ok := q.Peek(); !ok || v.(prioItem).name != "a1" {
+		t.Fatalf("Peek = %v, %v; want a1", v, ok)
+	}
+
+	// A waiting Put goes in as soon as a Take makes room.
+	done := make(chan error)
+	go func() { done <- q.Put(nil, prioItem{0, "z"}) }()
+	var got []string
+	for i := 0; i < 5; i++ {
+		v, err := q.Take(nil)
+		if err != nil {
+			t.Fatalf("Take: %v", err)
+		}
+		got = append(got, v.(prioItem).name)
+		if i == 0 {
+			if err := <-done; err != nil {
+				t.Fatalf("Put after Take = %v", err)
+			}
+		}
+	}
+	want := []string{"a1", "z", "a2", "b", "c"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Take order = %v; want %v", got, want)
+		}
+	}
+
+	// A waiting Take gets the next value put, and a closed queue drains.
+	vc := make(chan interface{})
+	go func() {
+		v, _ := q.Take(nil)
+		vc <- v
+	}()
+	q.Put(nil, prioItem{5, "e"})
+	if v := <-vc; v.(prioItem).name != "e" {
+		t.Fatalf("waiting Take = %v; want e", v)
+	}
+	q.Put(nil, prioItem{6, "f"})
+	q.Close()
+	if err := q.Put(nil, prioItem{7, "g"}); err != ErrQueueClosed {
+		t.Fatalf("Put after Close = %v; want %v", err, ErrQueueClosed)
+	}
+	if v, err := q.Take(nil); err != nil || v.(prioItem).name != "f" {
+		t.Fatalf("Take after Close = %v, %v; want f, nil", v, err)
+	}
+	if v, err := q.Take(nil); err != ErrQueueClosed {
+		t.Fatalf("Take of a closed, empty queue = %v, %v; want %v", v, err, ErrQueueClosed)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A RateLimiter limits how often events may happen. It behaves as a token
+// bucket that holds up to burst tokens and gains one every interval
+// nanoseconds, where each event takes one token.
+//
+// The bucket is kept as a single word, the time at which it would next be
+// full, following the generic cell rate algorithm; Allow, Reserve and Wait
+// update it with compare-and-swap, so a RateLimiter takes no lock and
+// scales to many concurrent callers.
+//
+// A RateLimiter is safe for use by multiple goroutines simultaneously.
+type RateLimiter struct {
+	tat      int64 // theoretical arrival time, in nanotime units
+	interval int64
+	window   int64 // interval * burst
+}
+
+// NewRateLimiter returns a RateLimiter that allows an event every interval
+// nanoseconds on average, and up to burst events at once. It starts full.
+// NewRateLimiter panics if interval or burst is not positive.
+func NewRateLimiter(interval int64, burst int) *RateLimiter {
+	if interval <= 0 || burst <= 0 {
+		panic("sync: NewRateLimiter with non-positive interval or burst")
+	}
+	return &RateLimiter{interval: interval, window: interval * int64(burst)}
+}
+
+// Allow reports whether an event may happen now, taking a token if so.
+func (l *RateLimiter) Allow() bool {
+	_, ok := l.reserve(0)
+	return ok
+}
+
+// Reserve takes a token, waiting for one if the bucket is empty, and
+// returns how many nanoseconds the caller must wait before acting on it.
+// Reserve never blocks; it is for callers that schedule the event
+// themselves. A returned delay of 0 means the event may happen now.
+func (l *RateLimiter) Reserve() (delay int64) {
+	delay, _ = l.reserve(1<<63 - 1)
+	return delay
+}
+
+// Wait blocks until an event may happen, or until ctx is done. In the
+// latter case, it gives back the token it reserved and returns ctx.Err().
+// A nil ctx never gives up.
+func (l *RateLimiter) Wait(ctx Context) error {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	select {
+	case <-cancel:
+		return ctx.Err()
+	default:
+	}
+	delay := l.Reserve()
+	if delay == 0 {
+		return nil
+	}
+	ready := make(chan struct{})
+	stop := startCloseTimer(delay, ready)
+	select {
+	case <-ready:
+		return nil
+	case <-cancel:
+		stop()
+		// Hand the token back. Later reservations have already been
+		// given their delays; this only lets the next one after them
+		// go sooner, so the long-run rate is unchanged.
+		atomic.AddInt64(&l.tat, -l.interval)
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token if the wait for one would be at most maxDelay
+// nanoseconds. It returns the wait and whether it took the token.
+func (l *RateLimiter) reserve(maxDelay int64) (delay int64, ok bool) {
+	now := nanotime()
+	for {
+		old := atomic.LoadInt64(&l.tat)
+		tat := old
+		if tat < now {
+			tat = now
+		}
+		next := tat + l.interval
+		delay = next - now - l.window
+		if delay < 0 {
+			delay = 0
+		}
+		if delay > maxDelay {
+			return delay, false
+		}
+		if atomic.CompareAndSwapInt64(&l.tat, old, next) {
+			return delay, true
+		}
+	}
+}
+
+// A SlidingWindowLimiter limits how many events may happen within any
+// window of time: it allows an event if fewer than limit happened in the
+// window nanoseconds before it. Unlike a RateLimiter, it never lets a
+// burst of limit events follow right after another.
+//
+// It counts events in fixed windows and estimates the count over the
+// sliding window as the count of the current fixed window plus the count
+// of the previous one, weighted by how much of the previous window the
+// sliding window still covers. The estimate assumes that the events of
+// the previous window were evenly spread. Allow and Wait update the
+// count with compare-and-swap, so a SlidingWindowLimiter takes no lock;
+// only the first event of each window allocates.
+//
+// A SlidingWindowLimiter is safe for use by multiple goroutines
+// simultaneously.
+type SlidingWindowLimiter struct {
+	w      unsafe.Pointer // *slidingWindow; the current fixed window
+	window int64
+	limit  int64
+}
+
+// A slidingWindow is one fixed window of a SlidingWindowLimiter. Its
+// counts are separate allocations, so that the window after it can
+// count on n without keeping the whole chain of windows alive.
+type slidingWindow struct {
+	start int64
+	n     *int64 // events in this window
+	prev  *int64 // events in the window just before, or nil
+}
+
+// NewSlidingWindowLimiter returns a SlidingWindowLimiter that allows up
+// to limit events in any window of window nanoseconds. It panics if
+// window or limit is not positive.
+func NewSlidingWindowLimiter(window int64, limit int) *SlidingWindowLimiter {
+	if window <= 0 || limit <= 0 {
+		panic("sync: NewSlidingWindowLimiter with non-positive window or limit")
+	}
+	return &SlidingWindowLimiter{window: window, limit: int64(limit)}
+}
+
+// Allow reports whether an event may happen now, counting it if so.
+func (l *SlidingWindowLimiter) Allow() bool {
+	_, ok := l.take()
+	return ok
+}
+
+// Wait blocks until an event may happen, counting it, or until ctx is
+// done, in which case it returns ctx.Err(). A nil ctx never gives up.
+func (l *SlidingWindowLimiter) Wait(ctx Context) error {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	for {
+		select {
+		case <-cancel:
+			return ctx.Err()
+		default:
+		}
+		delay, ok := l.take()
+		if ok {
+			return nil
+		}
+		// Other callers may take the event first, so sleep until it
+		// might be allowed and try again.
+		ready := make(chan struct{})
+		stop := startCloseTimer(delay, ready)
+		select {
+		case <-ready:
+		case <-cancel:
+			stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// take counts an event if the estimate for the sliding window is below
+// the limit. If not, it returns how many nanoseconds must pass before the
+// estimate drops below the limit, as long as no other event is counted.
+func (l *SlidingWindowLimiter) take() (delay int64, ok bool) {
+	now := nanotime()
+	for {
+		w := (*slidingWindow)(atomic.LoadPointer(&l.w))
+		if w == nil || now >= w.start+l.window {
+			l.advance(w, now)
+			continue
+		}
+		n := atomic.LoadInt64(w.n)
+		var prev int64
+		if w.prev != nil {
+			prev = atomic.LoadInt64(w.prev)
+		}
+		// The part of the previous window the sliding window covers.
+		rest := float64(l.window-(now-w.start)) / float64(l.window)
+		if float64(n)+float64(prev)*rest < float64(l.limit) {
+			if atomic.CompareAndSwapInt64(w.n, n, n+1) {
+				return 0, true
+			}
+			continue
+		}
+		// Wait for the previous window to slide out far enough, or for
+		// this window to end if it alone is at the limit.
+		delay = w.start + l.window - now
+		if n < l.limit {
+			d := int64((1 - float64(l.limit-n)/float64(prev)) * float64(l.window))
+			if d = w.start + d - now + 1; d < delay {
+				delay = d
+			}
+		}
+		if delay < 1 {
+			delay = 1
+		}
+		return delay, false
+	}
+}
+
+// advance replaces w, the current window of l, with the fixed window that
+// holds now.
+func (l *SlidingWindowLimiter) advance(w *slidingWindow, now int64) {
+	start := now - now%l.window
+	if start > now {
+		start -= l.window
+	}
+	nw := &slidingWindow{start: start, n: new(int64)}
+	if w != nil && w.start == start-l.window {
+		nw.prev = w.n
+	}
+	atomic.CompareAndSwapPointer(&l.w, unsafe.Pointer(w), unsafe.Pointer(nw))
+}
@@ -0,0 +1,173 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	"runtime"
+	. "sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	l := NewRateLimiter(int64(time.Hour), 3)
+	for i := 0; i < 3; i++ {
+		if !l.Allow() {
+			t.Fatalf("Allow() = false for event %d within burst", i)
+		}
+	}
+	if l.Allow() {
+		t.Fatal("Allow() = true with empty bucket")
+	}
+	if d := l.Reserve(); d <= int64(time.Hour)-int64(time.Minute) || d > int64(time.Hour) {
+		t.Fatalf("Reserve() = %v; want about 1h", time.Duration(d))
+	}
+	if d := l.Reserve(); d <= int64(2*time.Hour)-int64(time.Minute) {
+		t.Fatalf("second Reserve() = %v; want about 2h", time.Duration(d))
+	}
+}
+
+func TestRateLimiterConcurrent(t *testing.T) {
+	const burst = 50
+	l := NewRateLimiter(int64(time.Hour), burst)
+	var allowed Counter
+	var wg WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if l.Allow() {
+					allowed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := allowed.Sum(); n != burst {
+		t.Fatalf("allowed %d events; want %d", n, burst)
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l := NewRateLimiter(int64(10*time.Millisecond), 1)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 15*time.Millisecond {
+		t.Fatalf("3 events at 1 per 10ms took %v", d)
+	}
+
+	l = NewRateLimiter(int64(time.Hour), 1)
+	l.Allow()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Wait() = %v; want %v", err, context.DeadlineExceeded)
+	}
+	// The canceled Wait must have returned its token.
+	if d := l.Reserve(); d > int64(time.Hour) {
+		t.Fatalf("Reserve() after canceled Wait = %v; want at most 1h", time.Duration(d))
+	}
+}
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	c := newFakeClock()
+	defer SetClockForTesting(SetClockForTesting(c))
+	l := NewSlidingWindowLimiter(int64(time.Second), 3)
+	allowed := func() int {
+		n := 0
+		for l.Allow() {
+			n++
+		}
+		return n
+	}
+	if n := allowed(); n != 3 {
+		t.Fatalf("allowed %d events in the first window; want 3", n)
+	}
+	// The sliding window still covers all of the previous window.
+	c.Advance(int64(time.Second))
+	if n := allowed(); n != 0 {
+		t.Fatalf("allowed %d events at the start of the second window; want 0", n)
+	}
+	// Half of it: with 1 event counted, 3*0.5 + 1 is below the limit,
+	// but with 2, 3*0.5 + 2 is not.
+	c.Advance(int64(time.Second / 2))
+	if n := allowed(); n != 2 {
+		t.Fatalf("allowed %d events halfway through the second window; want 2", n)
+	}
+	// After an idle window, nothing is left to count.
+	c.Advance(int64(2 * time.Second))
+	if n := allowed(); n != 3 {
+		t.Fatalf("allowed %d events after an idle window; want 3", n)
+	}
+}
+
+func TestSlidingWindowLimiterWait(t *testing.T) {
+	c := newFakeClock()
+	defer SetClockForTesting(SetClockForTesting(c))
+	l := NewSlidingWindowLimiter(int64(time.Second), 2)
+	l.Allow()
+	l.Allow()
+
+	done := make(chan error)
+	go func() { done <- l.Wait(nil) }()
+	for c.numTimers() == 0 {
+		runtime.Gosched()
+	}
+	// Wait sleeps until the full window ends, then until the previous
+	// window has slid halfway out, where the estimate is 2*0.5 = 1.
+	c.Advance(int64(time.Second / 2))
+	select {
+	case err := <-done:
+		t.Fatalf("Wait returned %v before the window moved", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	for i := 0; i < 2; i++ {
+		for c.numTimers() == 0 {
+			runtime.Gosched()
+		}
+		c.Advance(int64(time.Second / 2))
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// With that event, the estimate is at the limit again.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- l.Wait(ctx) }()
+	for c.numTimers() == 0 {
+		runtime.Gosched()
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Wait() = %v; want %v", err, context.Canceled)
+	}
+	if n := c.numTimers(); n != 0 {
+		t.Fatalf("%d timers left after a canceled Wait", n)
+	}
+}
+
+func BenchmarkSlidingWindowLimiterAllow(b *testing.B) {
+	l := NewSlidingWindowLimiter(1e9, 1<<30)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Allow()
+		}
+	})
+}
+
+func BenchmarkRateLimiterAllow(b *testing.B) {
+	l := NewRateLimiter(1, 1)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Allow()
+		}
+	})
+}
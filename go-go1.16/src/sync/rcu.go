@@ -0,0 +1,271 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// Read-copy-update.
+//
+// RCUList and RCUMap keep their contents in an immutable version that a
+// writer replaces with an updated copy in one atomic store. Readers load
+// the current version and read it without taking any lock, so they
+// never wait for writers or for each other; writers copy the whole
+// version, which suits contents such as routing tables and feature-flag
+// sets, updated a few times a minute and read millions of times a
+// second.
+//
+// The garbage collector keeps an old version alive for as long as a
+// reader uses it. What it does not do is release the resources of the
+// values a writer removes, such as connections in a routing table: a
+// retire function, called for each removed value, does that, and an
+// Epoch delays the call until every reader that was reading a version
+// holding the value is done with it. Readers that only load values do
+// not pin the Epoch, and must not rely on the resources of a value once
+// it may have been removed; those that do use the methods that run a
+// function while pinned. Pinning takes no lock either, once the Epoch
+// has as many guards as there are concurrent readers.
+
+// rcu is the machinery shared by RCUList and RCUMap.
+type rcu struct {
+	epoch Epoch          // first, for the alignment of its 64-bit fields
+	cur   unsafe.Pointer // current version; nil means empty
+	mu    Mutex          // serializes writers
+}
+
+// load returns the current version.
+func (r *rcu) load() unsafe.Pointer {
+	return atomic.LoadPointer(&r.cur)
+}
+
+// publish replaces the current version with v. r.mu must be held.
+func (r *rcu) publish(v unsafe.Pointer) {
+	atomic.StorePointer(&r.cur, v)
+}
+
+// retire defers f, if not nil, until the readers pinned to versions
+// replaced so far have unpinned, and runs the deferred functions that
+// are due. The caller must not hold r.mu, as the functions run on the
+// calling goroutine.
+func (r *rcu) retire(f func()) {
+	if f != nil {
+		r.epoch.Defer(f)
+	}
+	// Updates are rare, so rather than wait for enough of them to
+	// advance the epoch, try at each one.
+	r.epoch.Reclaim()
+}
+
+// An RCUList is a list of values that readers go through without locks
+// while writers update it by read-copy-update. See the comment on
+// read-copy-update in rcu.go.
+//
+// An RCUList must be created with NewRCUList and must not be copied
+// after first use.
+type RCUList struct {
+	r      rcu // *[]interface{}
+	retire func(v interface{})
+}
+
+// NewRCUList returns a new, empty RCUList. If retire is not nil, it is
+// called with each value removed from the list once no call of Range
+// that may have seen the value is running. It is called by a writer,
+// with no lock held.
+func NewRCUList(retire func(v interface{})) *RCUList {
+	return &RCUList{retire: retire}
+}
+
+func (l *RCUList) values() []interface{} {
+	if p := l.r.load(); p != nil {
+		return *(*[]interface{})(p)
+	}
+	return nil
+}
+
+// Len returns the number of values in l.
+func (l *RCUList) Len() int {
+	return len(l.values())
+}
+
+// Range calls f for each value in l, in order, until f returns false.
+// It sees the list as it was when Range was called, whatever writers do
+// meanwhile, and the values it passes to f are not retired before it
+// returns.
+func (l *RCUList) Range(f func(v interface{}) bool) {
+	g := l.r.epoch.Pin()
+	defer g.Unpin()
+	for _, v := range l.values() {
+		if !f(v) {
+			return
+		}
+	}
+}
+
+// PushBack adds v at the end of l.
+func (l *RCUList) PushBack(v interface{}) {
+	l.r.mu.Lock()
+	old := l.values()
+	vs := make([]interface{}, len(old), len(old)+1)
+	copy(vs, old)
+	vs = append(vs, v)
+	l.r.publish(unsafe.Pointer(&vs))
+	l.r.mu.Unlock()
+	l.r.retire(nil)
+}
+
+// PushFront adds v at the start of l.
+func (l *RCUList) PushFront(v interface{}) {
+	l.r.mu.Lock()
+	old := l.values()
+	vs := make([]interface{}, 0, len(old)+1)
+	vs = append(vs, v)
+	vs = append(vs, old...)
+	l.r.publish(unsafe.Pointer(&vs))
+	l.r.mu.Unlock()
+	l.r.retire(nil)
+}
+
+// Remove removes the values of l for which match returns true, and
+// returns how many it removed. match is called with the writers' lock
+// held and must not update l.
+func (l *RCUList) Remove(match func(v interface{}) bool) int {
+	l.r.mu.Lock()
+	old := l.values()
+	var vs, removed []interface{}
+	for _, v := range old {
+		if match(v) {
+			removed = append(removed, v)
+		} else {
+			vs = append(vs, v)
+		}
+	}
+	if len(removed) == 0 {
+		l.r.mu.Unlock()
+		return 0
+	}
+	l.r.publish(unsafe.Pointer(&vs))
+	l.r.mu.Unlock()
+
+	var retire func()
+	if l.retire != nil {
+		retire = func() {
+			for _, v := range removed {
+				l.retire(v)
+			}
+		}
+	}
+	l.r.retire(retire)
+	return len(removed)
+}
+
+// An RCUMap is a map that readers look up without locks, not even on a
+// miss as Map may take, while writers update it by read-copy-update.
+// See the comment on read-copy-update in rcu.go. Keys must be
+// comparable, as for map keys.
+//
+// An RCUMap must be created with NewRCUMap and must not be copied after
+// first use.
+type RCUMap struct {
+	r      rcu // *map[interface{}]interface{}
+	retire func(key, value interface{})
+}
+
+// NewRCUMap returns a new, empty RCUMap. If retire is not nil, it is
+// called with each value deleted from the map or replaced in it, even
+// by itself, and its key, once no call of Do or Range that may have
+// seen the value is running. It is called by a writer, with no lock
+// held.
+func NewRCUMap(retire func(key, value interface{})) *RCUMap {
+	return &RCUMap{retire: retire}
+}
+
+func (m *RCUMap) entries() map[interface{}]interface{} {
+	if p := m.r.load(); p != nil {
+		return *(*map[interface{}]interface{})(p)
+	}
+	return nil
+}
+
+// Load returns the value stored in the map for key, or nil if no value
+// is present. The ok result indicates whether value was found in the
+// map. Load does not keep the value from being retired; see Do.
+func (m *RCUMap) Load(key interface{}) (value interface{}, ok bool) {
+	value, ok = m.entries()[key]
+	return value, ok
+}
+
+// Do calls f with the value stored in the map for key, as Load returns
+// it, and keeps the value from being retired until f returns.
+func (m *RCUMap) Do(key interface{}, f func(value interface{}, ok bool)) {
+	g := m.r.epoch.Pin()
+	defer g.Unpin()
+	value, ok := m.entries()[key]
+	f(value, ok)
+}
+
+// Len returns the number of keys in m.
+func (m *RCUMap) Len() int {
+	return len(m.entries())
+}
+
+// Range calls f for each key and value in m, in no particular order,
+// until f returns false. It sees the map as it was when Range was
+// called, whatever writers do meanwhile, and the values it passes to f
+// are not retired before it returns.
+func (m *RCUMap) Range(f func(key, value interface{}) bool) {
+	g := m.r.epoch.Pin()
+	defer g.Unpin()
+	for k, v := range m.entries() {
+		if !f(k, v) {
+			return
+		}
+	}
+}
+
+// Store sets the value for key, copying the map.
+func (m *RCUMap) Store(key, value interface{}) {
+	m.r.mu.Lock()
+	old := m.entries()
+	es := make(map[interface{}]interface{}, len(old)+1)
+	for k, v := range old {
+		es[k] = v
+	}
+	es[key] = value
+	prev, replaced := old[key]
+	m.r.publish(unsafe.Pointer(&es))
+	m.r.mu.Unlock()
+	m.r.retire(m.retireFunc(key, prev, replaced))
+}
+
+// Delete deletes the value for key, copying the map if key is present.
+func (m *RCUMap) Delete(key interface{}) {
+	m.r.mu.Lock()
+	old := m.entries()
+	prev, ok := old[key]
+	if !ok {
+		m.r.mu.Unlock()
+		return
+	}
+	es := make(map[interface{}]interface{}, len(old))
+	for k, v := range old {
+		if k != key {
+			es[k] = v
+		}
+	}
+	m.r.publish(unsafe.Pointer(&es))
+	m.r.mu.Unlock()
+	m.r.retire(m.retireFunc(key, prev, true))
+}
+
+// retireFunc returns the function that retires value, the value of key
+// removed from m, or nil if there is none.
+func (m *RCUMap) retireFunc(key, value interface{}, removed bool) func() {
+	if !removed || m.retire == nil {
+		return nil
+	}
+	return func() { m.retire(key, value) }
+}
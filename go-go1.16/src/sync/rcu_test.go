@@ -0,0 +1,77 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"fmt"
+	. "sync"
+	"testing"
+)
+
+func TestRCUList(t *testing.T) {
+	var retired []interface{}
+	l := NewRCUList(func(v interface{}) { retired = append(retired, v) })
+	l.PushBack(2)
+	l.PushBack(3)
+	l.PushFront(1)
+	var got []interface{}
+	l.Range(func(v interface{}) bool {
+		got = append(got, v)
+		return true
+	})
+	if s := fmt.Sprint(got); s != "[1 2 3]" {
+		t.Fatalf("Range saw %s; want [1 2 3]", s)
+	}
+
+	// A value removed during a Range is retired only after it.
+	l.Range(func(v interface{}) bool {
+		if n := l.Remove(func(v interface{}) bool { return v == 2 }); n != 1 {
+			t.Fatalf("Remove removed %d values; want 1", n)
+		}
+		if len(retired) != 0 {
+			t.Fatalf("%v retired during a Range", retired)
+		}
+		return false
+	})
+	l.PushBack(4) // the next update retires what is due
+	if s := fmt.Sprint(retired); s != "[2]" {
+		t.Fatalf("retired %s; want [2]", s)
+	}
+	if n := l.Len(); n != 3 {
+		t.Fatalf("Len = %d; want 3", n)
+	}
+}
+
+func TestRCUMap(t *testing.T) {
+	retired := make(map[interface{}]interface{})
+	m := NewRCUMap(func(k, v interface{}) { retired[k] = v })
+	m.Store("a", 1)
+	m.Store("b", 2)
+	if v, ok := m.Load("a"); !ok || v != 1 {
+		t.Fatalf("Load(a) = %v, %v; want 1, true", v, ok)
+	}
+
+	m.Do("a", func(v interface{}, ok bool) {
+		m.Store("a", 10)
+		if _, ok := retired["a"]; ok {
+			t.Fatal("value of a retired while Do held it")
+		}
+		if v != 1 {
+			t.Fatalf("Do saw %v; want 1", v)
+		}
+	})
+	m.Delete("b")
+	if retired["a"] != 1 || retired["b"] != 2 {
+		t.Fatalf("retired %v; want a:1 and b:2", retired)
+	}
+	if v, _ := m.Load("a"); v != 10 || m.Len() != 1 {
+		t.Fatalf("Load(a) = %v with Len %d; want 10 with 1", v, m.Len())
+	}
+	n := 0
+	m.Range(func(_, _ interface{}) bool { n++; return true })
+	if n != 1 {
+		t.Fatalf("Range visited %d keys; want 1", n)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A RefCounted holds a value whose resources, such as a file, a
+// connection or a memory mapping, must be freed once no goroutine uses
+// it any longer, which is not when the garbage collector would find
+// out. Each user acquires a reference and releases it when done, and
+// the last release calls the destructor, exactly once.
+//
+// The count starts at one, for the goroutine that makes the RefCounted;
+// it gives up that reference with Release. Acquiring a reference once
+// the count has dropped to zero, or releasing one twice, is a bug, which
+// RefCounted reports by panicking; in debug mode, when the package is
+// built with the syncdebug build tag, the panic shows where the final
+// release was made.
+//
+// A RefCounted must be created with NewRefCounted and must not be copied
+// after first use.
+type RefCounted struct {
+	// n is first in the struct so that 64-bit atomic operations on it
+	// are aligned on 32-bit platforms.
+	n       int64 // number of references; atomic
+	v       interface{}
+	destroy func(v interface{})
+	final   unsafe.Pointer // *[]uintptr, the stack of the final release in debug mode
+}
+
+// NewRefCounted returns a new RefCounted holding v, with one reference,
+// that calls destroy with v when the last reference is released.
+func NewRefCounted(v interface{}, destroy func(v interface{})) *RefCounted {
+	return &RefCounted{v: v, destroy: destroy, n: 1}
+}
+
+// Acquire acquires a new reference to the value of r and returns the
+// value and a function that releases the reference. Calling release
+// more than once panics. Acquire panics if the count of r has dropped
+// to zero; a caller that may race with the final release, such as a
+// cache that hands out values it may be dropping, uses TryAcquire.
+func (r *RefCounted) Acquire() (v interface{}, release func()) {
+	v, release, ok := r.TryAcquire()
+	if !ok {
+		r.fail("sync: RefCounted acquired after its final release")
+	}
+	return v, release
+}
+
+// TryAcquire is like Acquire, but if the count of r has dropped to zero,
+// it returns with ok false, a nil value and a nil release instead of
+// panicking.
+func (r *RefCounted) TryAcquire() (v interface{}, release func(), ok bool) {
+	for {
+		n := atomic.LoadInt64(&r.n)
+		if n <= 0 {
+			return nil, nil, false
+		}
+		if atomic.CompareAndSwapInt64(&r.n, n, n+1) {
+			break
+		}
+	}
+	var released uint32
+	return r.v, func() {
+		if !atomic.CompareAndSwapUint32(&released, 0, 1) {
+			r.fail("sync: RefCounted reference released twice")
+		}
+		r.Release()
+	}, true
+}
+
+// Release releases the reference to r of the goroutine that made it,
+// or one acquired by another means than Acquire, such as one handed
+// over by that goroutine. If it was the last reference, Release calls
+// the destructor before it returns.
+func (r *RefCounted) Release() {
+	n := atomic.AddInt64(&r.n, -1)
+	if n > 0 {
+		return
+	}
+	if n < 0 {
+		r.fail("sync: RefCounted released after its final release")
+	}
+	if syncDebug {
+		stack := make([]uintptr, 32)
+		stack = stack[:runtime.Callers(2, stack)]
+		atomic.StorePointer(&r.final, unsafe.Pointer(&stack))
+	}
+	v := r.v
+	r.v = nil
+	if r.destroy != nil {
+		r.destroy(v)
+	}
+}
+
+// Refs returns the number of references to r. If other goroutines
+// acquire or release references concurrently, it is only a snapshot.
+func (r *RefCounted) Refs() int64 {
+	n := atomic.LoadInt64(&r.n)
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// fail panics with msg, followed in debug mode by the stack of the
+// final release of r.
+func (r *RefCounted) fail(msg string) {
+	if p := (*[]uintptr)(atomic.LoadPointer(&r.final)); p != nil {
+		msg = string(appendFrames([]byte(msg+"\n\nfinal release:\n"), *p, "\t"))
+	}
+	panic(msg)
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"strings"
+	. "sync"
+	"testing"
+)
+
+func TestRefCounted(t *testing.T) {
+	var destroyed []interface{}
+	r := NewRefCounted("conn", func(v interface{}) { destroyed = append(destroyed, v) })
+
+	var wg WaitGroup
+	for i := 0; i < 10; i++ {
+		v, release := r.Acquire()
+		if v != "conn" {
+			t.Fatalf("Acquire = %v; want conn", v)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release()
+		}()
+	}
+	wg.Wait()
+	if n := r.Refs(); n != 1 || len(destroyed) != 0 {
+		t.Fatalf("after releases: Refs = %d, destroyed %v; want 1, none", n, destroyed)
+	}
+
+	_, release := r.Acquire()
+	r.Release()
+	if len(destroyed) != 0 {
+		t.Fatal("destroyed with a reference left")
+	}
+	release()
+	if len(destroyed) != 1 || destroyed[0] != "conn" {
+		t.Fatalf("destroyed %v; want [conn]", destroyed)
+	}
+	if _, _, ok := r.TryAcquire(); ok {
+		t.Fatal("TryAcquire succeeded after the final release")
+	}
+
+	for _, tt := range []struct {
+		name string
+		f    func()
+		want string
+	}{
+		{"Acquire", func() { r.Acquire() }, "acquired after its final release"},
+		{"release", release, "released twice"},
+		{"Release", r.Release, "released after its final release"},
+	} {
+		func() {
+			defer func() {
+				msg, _ := recover().(string)
+				if !strings.Contains(msg, tt.want) {
+					t.Errorf("%s after the final release panicked with %q; want %q", tt.name, msg, tt.want)
+				}
+				if SyncDebug && !strings.Contains(msg, "TestRefCounted") {
+					t.Errorf("%s panic does not show the final release:\n%s", tt.name, msg)
+				}
+			}()
+			tt.f()
+		}()
+	}
+	if len(destroyed) != 1 {
+		t.Fatalf("destroyed %d times; want once", len(destroyed))
+	}
+}
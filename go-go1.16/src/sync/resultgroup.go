@@ -0,0 +1,58 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A ResultGroup runs tasks in goroutines and collects their results, in
+// the order the tasks were started, for a fan-out that needs every
+// result rather than only the first error: each task returns a value
+// and an error, and Wait returns all the values and the first error.
+//
+// The first task to fail fires the group's Signal with its error. Every
+// task is passed that Signal as its context, so the others can give up
+// early.
+//
+// The zero ResultGroup is ready for use. A ResultGroup runs one batch of
+// tasks: Go must not be called once Wait has been called. A ResultGroup
+// must not be copied after first use.
+type ResultGroup struct {
+	wg      WaitGroup
+	failed  Signal // fired with the first error
+	mu      Mutex
+	results []interface{}
+}
+
+// Go runs f in a new goroutine, with the group's Signal as its context.
+// The value f returns is the result of the task, in the position of
+// this call among the calls of Go; if f returns an error and no task of
+// g has failed before, the error is that of the group.
+func (g *ResultGroup) Go(f func(ctx Context) (interface{}, error)) {
+	g.mu.Lock()
+	i := len(g.results)
+	g.results = append(g.results, nil)
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		v, err := f(&g.failed)
+		g.mu.Lock()
+		g.results[i] = v
+		g.mu.Unlock()
+		if err != nil {
+			g.failed.Fire(err)
+		}
+	}()
+}
+
+// Wait waits for all the tasks started by Go to return, and returns
+// their results, in the order they were started, and the first error
+// they returned, if any.
+func (g *ResultGroup) Wait() ([]interface{}, error) {
+	g.wg.Wait()
+	g.mu.Lock()
+	results := g.results
+	g.mu.Unlock()
+	return results, g.failed.Err()
+}
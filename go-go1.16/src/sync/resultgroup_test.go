@@ -0,0 +1,59 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"errors"
+	. "sync"
+	"testing"
+)
+
+func TestResultGroup(t *testing.T) {
+	var g ResultGroup
+	release := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		i := i
+		g.Go(func(ctx Context) (interface{}, error) {
+			if i%2 == 0 {
+				// Finish out of order.
+				<-release
+			}
+			return i * i, nil
+		})
+	}
+	close(release)
+	results, err := g.Wait()
+	if err != nil {
+		t.Fatalf("Wait error = %v", err)
+	}
+	if len(results) != 10 {
+		t.Fatalf("Wait returned %d results; want 10", len(results))
+	}
+	for i, v := range results {
+		if v != i*i {
+			t.Fatalf("result %d = %v; want %d", i, v, i*i)
+		}
+	}
+}
+
+func TestResultGroupError(t *testing.T) {
+	var g ResultGroup
+	errBoom := errors.New("boom")
+	g.Go(func(ctx Context) (interface{}, error) {
+		// Gives up once its sibling fails.
+		<-ctx.Done()
+		return "canceled", ctx.Err()
+	})
+	g.Go(func(ctx Context) (interface{}, error) {
+		return "partial", errBoom
+	})
+	results, err := g.Wait()
+	if err != errBoom {
+		t.Fatalf("Wait error = %v; want %v", err, errBoom)
+	}
+	if len(results) != 2 || results[0] != "canceled" || results[1] != "partial" {
+		t.Fatalf("Wait results = %v; want [canceled partial]", results)
+	}
+}
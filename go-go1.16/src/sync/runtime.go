@@ -28,6 +28,11 @@ func runtime_SemacquireMutex(s *uint32, lifo bool, skipframes int)
 // runtime_Semrelease's caller.
 func runtime_Semrelease(s *uint32, handoff bool, skipframes int)
 
+// SemreleaseN is n calls of Semrelease without handoff, except that
+// it wakes the waiters all at once, taking the runtime's lock for the
+// semaphore once rather than once per waiter.
+func runtime_SemreleaseN(s *uint32, n uint32, skipframes int)
+
 // See runtime/sema.go for documentation.
 func runtime_notifyListAdd(l *notifyList) uint32
 
@@ -48,10 +53,33 @@ func init() {
 }
 
 // Active spinning runtime support.
-// runtime_canSpin reports whether spinning makes sense at the moment.
-func runtime_canSpin(i int) bool
+// runtime_canSpin reports whether spinning makes sense at the moment,
+// for the i'th spin of at most budget.
+func runtime_canSpin(i, budget int) bool
+
+// runtime_gomaxprocs returns the current value of GOMAXPROCS.
+func runtime_gomaxprocs() int
 
 // runtime_doSpin does active spinning.
 func runtime_doSpin()
 
 func runtime_nanotime() int64
+
+// runtime_sleep puts the calling goroutine to sleep for at least ns nanoseconds.
+func runtime_sleep(ns int64)
+
+// runtime_goid returns the ID of the calling goroutine.
+// It is used only to diagnose misuse, never for correctness.
+func runtime_goid() int64
+
+// runtime_efaceHash returns the hash of i with the given seed, as a map
+// with interface{} keys computes it. It panics if i is not comparable.
+func runtime_efaceHash(i interface{}, seed uintptr) uintptr
+
+// runtime_traceEnabled reports whether the runtime is tracing.
+func runtime_traceEnabled() bool
+
+// runtime_traceRegion emits a user region event of the given mode,
+// traceRegionStart or traceRegionEnd, in the background task.
+// See runtime/trace.go for documentation.
+func runtime_traceRegion(mode uint64, name string)
@@ -6,6 +6,7 @@ package sync
 
 import (
 	"internal/race"
+	"internal/synchook"
 	"sync/atomic"
 	"unsafe"
 )
@@ -25,12 +26,18 @@ import (
 // recursive read locking. This is to ensure that the lock eventually becomes
 // available; a blocked Lock call excludes new readers from acquiring the
 // lock.
+//
+// Like a Mutex, a RWMutex switches to a starvation mode when goroutines
+// wait for it for too long, on the side of its writers and on that of its
+// readers; see SetStarvationThreshold.
 type RWMutex struct {
 	w           Mutex  // held if there are pending writers
 	writerSem   uint32 // semaphore for writers to wait for completing readers
 	readerSem   uint32 // semaphore for readers to wait for completing writers
 	readerCount int32  // number of pending readers
 	readerWait  int32  // number of departing readers
+
+	readerStarving int32 // set while readers wait longer than the starvation threshold
 }
 
 const rwmutexMaxReaders = 1 << 30
@@ -58,9 +65,16 @@ func (rw *RWMutex) RLock() {
 		_ = rw.w.state
 		race.Disable()
 	}
+	if syncChaos {
+		chaosPause()
+	}
 	if atomic.AddInt32(&rw.readerCount, 1) < 0 {
 		// A writer is pending, wait for it.
-		runtime_SemacquireMutex(&rw.readerSem, false, 0)
+		// Outlined slow-path to allow the fast-path to be inlined
+		rw.rLockSlow()
+	}
+	if syncDebug {
+		recordLockOp(unsafe.Pointer(rw), lockOpRLock)
 	}
 	if race.Enabled {
 		race.Enable()
@@ -68,6 +82,61 @@ func (rw *RWMutex) RLock() {
 	}
 }
 
+// TryRLock tries to lock rw for reading and reports whether it
+// succeeded. It fails without blocking if rw is locked for writing or
+// a writer is waiting for it.
+func (rw *RWMutex) TryRLock() bool {
+	if race.Enabled {
+		_ = rw.w.state
+		race.Disable()
+	}
+	for {
+		c := atomic.LoadInt32(&rw.readerCount)
+		if c < 0 {
+			if race.Enabled {
+				race.Enable()
+			}
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&rw.readerCount, c, c+1) {
+			if syncDebug {
+				recordLockOp(unsafe.Pointer(rw), lockOpRLock)
+			}
+			if race.Enabled {
+				race.Enable()
+				race.Acquire(unsafe.Pointer(&rw.readerSem))
+			}
+			return true
+		}
+	}
+}
+
+func (rw *RWMutex) rLockSlow() {
+	var w lockWait
+	start := nanotime()
+	if lockObserved() {
+		w.begin(unsafe.Pointer(rw), LockRWMutexRead, start, 4)
+	}
+	schedPoint(synchook.Park, &rw.readerSem)
+	runtime_SemacquireMutex(&rw.readerSem, false, 0)
+	schedPoint(synchook.Woken, &rw.readerSem)
+	if syncChaos {
+		chaosPause()
+	}
+	// Readers that waited too long for writers make the next writer
+	// hand them the processor when it unlocks; the first reader that
+	// did not switches that off again. Write only on a change, as all
+	// the readers of a batch get here at once.
+	starving := int32(0)
+	if nanotime()-start > starvationThreshold() {
+		starving = 1
+	}
+	if atomic.LoadInt32(&rw.readerStarving) != starving {
+		atomic.StoreInt32(&rw.readerStarving, starving)
+	}
+	w.end(4)
+}
+
 // RUnlock undoes a single RLock call;
 // it does not affect other simultaneous readers.
 // It is a run-time error if rw is not locked for reading
@@ -78,6 +147,9 @@ func (rw *RWMutex) RUnlock() {
 		race.ReleaseMerge(unsafe.Pointer(&rw.writerSem))
 		race.Disable()
 	}
+	if syncDebug {
+		recordLockOp(unsafe.Pointer(rw), lockOpRUnlock)
+	}
 	if r := atomic.AddInt32(&rw.readerCount, -1); r < 0 {
 		// Outlined slow-path to allow the fast-path to be inlined
 		rw.rUnlockSlow(r)
@@ -90,11 +162,12 @@ func (rw *RWMutex) RUnlock() {
 func (rw *RWMutex) rUnlockSlow(r int32) {
 	if r+1 == 0 || r+1 == -rwmutexMaxReaders {
 		race.Enable()
-		throw("sync: RUnlock of unlocked RWMutex")
+		throw(withLockHistory(unsafe.Pointer(rw), "sync: RUnlock of unlocked RWMutex"))
 	}
 	// A writer is pending.
 	if atomic.AddInt32(&rw.readerWait, -1) == 0 {
 		// The last reader unblocks the writer.
+		schedPoint(synchook.Wake, &rw.writerSem)
 		runtime_Semrelease(&rw.writerSem, false, 1)
 	}
 }
@@ -107,13 +180,36 @@ func (rw *RWMutex) Lock() {
 		_ = rw.w.state
 		race.Disable()
 	}
-	// First, resolve competition with other writers.
-	rw.w.Lock()
+	// First, resolve competition with other writers. This is rw.w.Lock,
+	// except that a wait is reported as one on rw, below.
+	var w lockWait
+	if syncChaos {
+		chaosPause()
+	}
+	if !atomic.CompareAndSwapInt32(&rw.w.state, 0, mutexLocked) {
+		w = rw.w.lockSlow(LockRWMutex)
+	}
 	// Announce to readers there is a pending writer.
 	r := atomic.AddInt32(&rw.readerCount, -rwmutexMaxReaders) + rwmutexMaxReaders
 	// Wait for active readers.
 	if r != 0 && atomic.AddInt32(&rw.readerWait, r) != 0 {
+		start := nanotime()
+		if w.start == 0 && lockObserved() {
+			w.begin(unsafe.Pointer(rw), LockRWMutex, start, 3)
+		}
+		schedPoint(synchook.Park, &rw.writerSem)
 		runtime_SemacquireMutex(&rw.writerSem, false, 0)
+		schedPoint(synchook.Woken, &rw.writerSem)
+		if syncChaos {
+			chaosPause()
+		}
+		if nanotime()-start > starvationThreshold() {
+			rw.starveWriters()
+		}
+	}
+	w.end(3)
+	if syncDebug {
+		recordLockOp(unsafe.Pointer(rw), lockOpLock)
 	}
 	if race.Enabled {
 		race.Enable()
@@ -122,6 +218,44 @@ func (rw *RWMutex) Lock() {
 	}
 }
 
+// TryLock tries to lock rw for writing and reports whether it
+// succeeded. It fails without blocking if rw is locked for reading
+// or writing.
+func (rw *RWMutex) TryLock() bool {
+	if race.Enabled {
+		_ = rw.w.state
+		race.Disable()
+	}
+	// This is rw.w.TryLock, except that it is not recorded in the
+	// lock history.
+	if old := rw.w.state; old&(mutexLocked|mutexStarving) != 0 ||
+		!atomic.CompareAndSwapInt32(&rw.w.state, old, old|mutexLocked) {
+		if race.Enabled {
+			race.Enable()
+		}
+		return false
+	}
+	if !atomic.CompareAndSwapInt32(&rw.readerCount, 0, -rwmutexMaxReaders) {
+		// There are readers; let other writers proceed.
+		if new := atomic.AddInt32(&rw.w.state, -mutexLocked); new != 0 {
+			rw.w.unlockSlow(new)
+		}
+		if race.Enabled {
+			race.Enable()
+		}
+		return false
+	}
+	if syncDebug {
+		recordLockOp(unsafe.Pointer(rw), lockOpLock)
+	}
+	if race.Enabled {
+		race.Enable()
+		race.Acquire(unsafe.Pointer(&rw.readerSem))
+		race.Acquire(unsafe.Pointer(&rw.writerSem))
+	}
+	return true
+}
+
 // Unlock unlocks rw for writing. It is a run-time error if rw is
 // not locked for writing on entry to Unlock.
 //
@@ -134,24 +268,61 @@ func (rw *RWMutex) Unlock() {
 		race.Release(unsafe.Pointer(&rw.readerSem))
 		race.Disable()
 	}
+	if syncDebug {
+		recordLockOp(unsafe.Pointer(rw), lockOpUnlock)
+	}
 
 	// Announce to readers there is no active writer.
 	r := atomic.AddInt32(&rw.readerCount, rwmutexMaxReaders)
 	if r >= rwmutexMaxReaders {
 		race.Enable()
-		throw("sync: Unlock of unlocked RWMutex")
+		throw(withLockHistory(unsafe.Pointer(rw), "sync: Unlock of unlocked RWMutex"))
 	}
-	// Unblock blocked readers, if any.
-	for i := 0; i < int(r); i++ {
-		runtime_Semrelease(&rw.readerSem, false, 0)
+	// Unblock blocked readers, if any, in one batch. If readers are
+	// starving, hand the processor to the last of them, as a Mutex in
+	// starvation mode does to its next waiter.
+	if synchook.Enabled() {
+		for i := 0; i < int(r); i++ {
+			schedPoint(synchook.Wake, &rw.readerSem)
+		}
+	}
+	if r > 0 && atomic.LoadInt32(&rw.readerStarving) != 0 {
+		runtime_SemreleaseN(&rw.readerSem, uint32(r-1), 0)
+		runtime_Semrelease(&rw.readerSem, true, 0)
+	} else {
+		runtime_SemreleaseN(&rw.readerSem, uint32(r), 0)
+	}
+	// Allow other writers to proceed. This is rw.w.Unlock, except that
+	// it is not recorded in the lock history a second time.
+	if new := atomic.AddInt32(&rw.w.state, -mutexLocked); new != 0 {
+		rw.w.unlockSlow(new)
 	}
-	// Allow other writers to proceed.
-	rw.w.Unlock()
 	if race.Enabled {
 		race.Enable()
 	}
 }
 
+// starveWriters switches rw.w, which the calling writer holds, to
+// starvation mode if other writers are queued for it, so that Unlock
+// hands it to the writer at the front of the queue instead of letting a
+// newly arriving writer take it and make the queue wait for another
+// round of readers. The writer that takes it switches it back to normal
+// mode as lockSlow does, if it did not wait too long or is the last.
+func (rw *RWMutex) starveWriters() {
+	for {
+		// A woken writer is about to take its place in the queue or
+		// the lock, and the handoff expects none; leave the switch to
+		// the next writer that waits too long.
+		old := atomic.LoadInt32(&rw.w.state)
+		if old>>mutexWaiterShift == 0 || old&(mutexWoken|mutexStarving) != 0 {
+			return
+		}
+		if atomic.CompareAndSwapInt32(&rw.w.state, old, old|mutexStarving) {
+			return
+		}
+	}
+}
+
 // RLocker returns a Locker interface that implements
 // the Lock and Unlock methods by calling rw.RLock and rw.RUnlock.
 func (rw *RWMutex) RLocker() Locker {
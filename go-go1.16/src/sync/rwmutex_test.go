@@ -125,6 +125,57 @@ func TestRWMutex(t *testing.T) {
 	HammerRWMutex(10, 5, n)
 }
 
+func TestRWMutexStarvation(t *testing.T) {
+	// With a threshold of a nanosecond, every wait starves, so the
+	// handoffs on both sides of the RWMutex run all the time.
+	defer SetStarvationThreshold(SetStarvationThreshold(1))
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(-1))
+	n := 1000
+	if testing.Short() {
+		n = 5
+	}
+	HammerRWMutex(1, 3, n)
+	HammerRWMutex(4, 3, n)
+	HammerRWMutex(10, 10, n)
+
+	if old := SetStarvationThreshold(0); old != 1 {
+		t.Fatalf("SetStarvationThreshold returned %d; want 1", old)
+	}
+	if old := SetStarvationThreshold(0); old != 1e6 {
+		t.Fatalf("SetStarvationThreshold(0) set %d; want the default 1e6", old)
+	}
+}
+
+func TestRWMutexTryLock(t *testing.T) {
+	var rw RWMutex
+	if !rw.TryLock() {
+		t.Fatal("TryLock failed on an unlocked RWMutex")
+	}
+	if rw.TryLock() {
+		t.Fatal("TryLock succeeded on a write-locked RWMutex")
+	}
+	if rw.TryRLock() {
+		t.Fatal("TryRLock succeeded on a write-locked RWMutex")
+	}
+	rw.Unlock()
+
+	if !rw.TryRLock() {
+		t.Fatal("TryRLock failed on an unlocked RWMutex")
+	}
+	if !rw.TryRLock() {
+		t.Fatal("TryRLock failed on a read-locked RWMutex")
+	}
+	if rw.TryLock() {
+		t.Fatal("TryLock succeeded on a read-locked RWMutex")
+	}
+	rw.RUnlock()
+	rw.RUnlock()
+
+	// A failed TryLock must leave rw usable by writers.
+	rw.Lock()
+	rw.Unlock()
+}
+
 func TestRLocker(t *testing.T) {
 	var wl RWMutex
 	var rl Locker
@@ -215,3 +266,30 @@ func BenchmarkRWMutexWorkWrite100(b *testing.B) {
 func BenchmarkRWMutexWorkWrite10(b *testing.B) {
 	benchmarkRWMutex(b, 100, 10)
 }
+
+// BenchmarkRWMutexWakeReaders measures a writer releasing many readers
+// that queued behind it.
+func BenchmarkRWMutexWakeReaders(b *testing.B) {
+	for _, n := range []int{8, 64} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			var rw RWMutex
+			var wg WaitGroup
+			for i := 0; i < b.N; i++ {
+				rw.Lock()
+				wg.Add(n)
+				for j := 0; j < n; j++ {
+					go func() {
+						rw.RLock()
+						rw.RUnlock()
+						wg.Done()
+					}()
+				}
+				for RWMutexBlockedReaders(&rw) < n {
+					runtime.Gosched()
+				}
+				rw.Unlock()
+				wg.Wait()
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"internal/synchook"
+	"unsafe"
+)
+
+// schedPoint tells the scheduler of package sync/synctest, if one is
+// running, that the calling goroutine reached point p for the semaphore
+// at sema. It is only called on slow paths, next to the semaphore calls
+// the points describe; see internal/synchook.
+func schedPoint(p synchook.Point, sema *uint32) {
+	if synchook.Enabled() {
+		synchook.Call(p, unsafe.Pointer(sema))
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Semaphore is a weighted semaphore: it limits how much of a resource
+// of a given size is in use at once, with each user acquiring as many
+// units as it needs.
+//
+// Waiters are served in FIFO order. In particular, a request for a
+// large weight blocks later, smaller requests until it is satisfied,
+// so that it cannot be starved by a steady stream of them.
+//
+// AcquirePriority lets some waiters go first: when weight frees up, it
+// goes to the waiter of the highest priority, and to the earliest of
+// those with that priority. So that waiters of low priority are not
+// starved by a steady stream of higher ones, a waiter's priority rises
+// by one for each period it has waited; see SetPriorityAging.
+//
+// A Semaphore must be created with NewSemaphore and must not be copied
+// after first use.
+type Semaphore struct {
+	size int64
+	mu   Mutex
+
+	// cur and waiters are written with mu held, and read atomically
+	// by Metrics, which does not take mu.
+	cur     int64
+	waiters int64 // length of the queue
+
+	// head and tail delimit the queue of blocked Acquires.
+	head, tail *semaWaiter
+
+	prioritized int   // waiters in the queue with a priority other than 0
+	aging       int64 // nanoseconds of waiting that raise a priority by one
+}
+
+// A semaWaiter is a goroutine blocked in Semaphore.Acquire.
+type semaWaiter struct {
+	n          int64
+	prio       int
+	since      int64         // when the waiter was queued
+	ready      chan struct{} // closed when the semaphore is acquired
+	prev, next *semaWaiter
+}
+
+// defaultSemaphoreAging is the aging period of a new Semaphore.
+const defaultSemaphoreAging = 10e6 // 10ms
+
+// NewSemaphore returns a new Semaphore with a total weight of n.
+func NewSemaphore(n int64) *Semaphore {
+	return &Semaphore{size: n, aging: defaultSemaphoreAging}
+}
+
+// SetPriorityAging sets the period of waiting that raises the priority
+// of a waiter by one to d nanoseconds. A waiter of priority 0 that has
+// waited for 3*d goes before one of priority 2 that has just started
+// waiting. If d is zero or negative, priorities do not age, and waiters
+// of low priority wait for as long as there are higher ones. The
+// period of a new Semaphore is 10ms.
+func (s *Semaphore) SetPriorityAging(d int64) {
+	s.mu.Lock()
+	s.aging = d
+	s.mu.Unlock()
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until
+// resources are available or ctx is done. On success, it returns nil.
+// On failure, it returns ctx.Err() and leaves the semaphore unchanged.
+// A nil ctx never gives up.
+//
+// If ctx is already done, Acquire may still succeed without blocking.
+func (s *Semaphore) Acquire(ctx Context, n int64) error {
+	return s.AcquirePriority(ctx, n, 0)
+}
+
+// AcquirePriority is like Acquire, but if it has to wait, it waits with
+// priority prio: it goes before the waiters of lower priority, as
+// adjusted for aging. Acquire waits with priority 0. A priority may be
+// negative.
+func (s *Semaphore) AcquirePriority(ctx Context, n int64, prio int) error {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	s.mu.Lock()
+	if s.size-s.cur >= n && s.head == nil {
+		atomic.AddInt64(&s.cur, n)
+		s.mu.Unlock()
+		if syncDebug {
+			recordHold(unsafe.Pointer(s), n)
+		}
+		return nil
+	}
+
+	if n > s.size {
+		// Don't make other Acquire calls block on one that's
+		// doomed to fail.
+		s.mu.Unlock()
+		<-cancel
+		return ctx.Err()
+	}
+
+	w := &semaWaiter{n: n, prio: prio, since: nanotime(), ready: make(chan struct{})}
+	s.push(w)
+	s.mu.Unlock()
+
+	var lw lockWait
+	lw.track(unsafe.Pointer(s), LockSemaphore)
+	select {
+	case <-cancel:
+		lw.untrack()
+		err := ctx.Err()
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			// Acquired the semaphore after we were canceled.
+			// Rather than trying to fix up the queue, just
+			// pretend we didn't notice the cancelation.
+			err = nil
+		default:
+			isNext := s.next() == w
+			s.remove(w)
+			// If we were to be served next and there are
+			// extra tokens left, notify other waiters.
+			if isNext && s.size > s.cur {
+				s.notifyWaiters()
+			}
+		}
+		s.mu.Unlock()
+		if syncDebug && err == nil {
+			recordHold(unsafe.Pointer(s), n)
+		}
+		return err
+
+	case <-w.ready:
+		lw.untrack()
+		if syncDebug {
+			recordHold(unsafe.Pointer(s), n)
+		}
+		return nil
+	}
+}
+
+// TryAcquire acquires the semaphore with a weight of n without
+// blocking. It reports whether it succeeded; on failure, it leaves the
+// semaphore unchanged.
+func (s *Semaphore) TryAcquire(n int64) bool {
+	s.mu.Lock()
+	ok := s.size-s.cur >= n && s.head == nil
+	if ok {
+		atomic.AddInt64(&s.cur, n)
+	}
+	s.mu.Unlock()
+	if syncDebug && ok {
+		recordHold(unsafe.Pointer(s), n)
+	}
+	return ok
+}
+
+// Release releases the semaphore with a weight of n.
+func (s *Semaphore) Release(n int64) {
+	s.mu.Lock()
+	if atomic.AddInt64(&s.cur, -n) < 0 {
+		s.mu.Unlock()
+		panic("sync: Semaphore released more than held")
+	}
+	s.notifyWaiters()
+	s.mu.Unlock()
+	if syncDebug {
+		recordRelease(unsafe.Pointer(s), n)
+	}
+}
+
+// AsLocker returns a Locker interface that implements the Lock and
+// Unlock methods by acquiring and releasing s with a weight of n, so
+// that s can serve where a Locker is expected, as the L of a Cond. Lock
+// waits as long as it takes.
+func (s *Semaphore) AsLocker(n int64) Locker {
+	return &semaLocker{s, n}
+}
+
+type semaLocker struct {
+	s *Semaphore
+	n int64
+}
+
+func (l *semaLocker) Lock()   { l.s.Acquire(nil, l.n) }
+func (l *semaLocker) Unlock() { l.s.Release(l.n) }
+
+// notifyWaiters wakes the waiters to be served next for which there
+// are enough resources. s.mu must be held.
+func (s *Semaphore) notifyWaiters() {
+	for w := s.next(); w != nil; w = s.next() {
+		if s.size-s.cur < w.n {
+			// Not enough tokens for the next waiter. We could
+			// keep going (to try to find a waiter with a smaller
+			// request), but under load that could cause
+			// starvation for large requests; instead, we leave
+			// all remaining waiters blocked.
+			break
+		}
+		atomic.AddInt64(&s.cur, w.n)
+		s.remove(w)
+		close(w.ready)
+	}
+}
+
+// next returns the waiter to be served next, or nil if there is none.
+// s.mu must be held.
+func (s *Semaphore) next() *semaWaiter {
+	if s.prioritized == 0 {
+		return s.head
+	}
+	now := nanotime()
+	var best *semaWaiter
+	bestPrio := 0
+	for w := s.head; w != nil; w = w.next {
+		prio := w.prio
+		if s.aging > 0 {
+			prio += int((now - w.since) / s.aging)
+		}
+		if best == nil || prio > bestPrio {
+			best, bestPrio = w, prio
+		}
+	}
+	return best
+}
+
+// push adds w to the back of the queue. s.mu must be held.
+func (s *Semaphore) push(w *semaWaiter) {
+	w.prev = s.tail
+	if s.tail != nil {
+		s.tail.next = w
+	} else {
+		s.head = w
+	}
+	s.tail = w
+	if w.prio != 0 {
+		s.prioritized++
+	}
+	atomic.AddInt64(&s.waiters, 1)
+}
+
+// remove removes w from the queue. s.mu must be held.
+func (s *Semaphore) remove(w *semaWaiter) {
+	if w.prev != nil {
+		w.prev.next = w.next
+	} else {
+		s.head = w.next
+	}
+	if w.next != nil {
+		w.next.prev = w.prev
+	} else {
+		s.tail = w.prev
+	}
+	w.prev, w.next = nil, nil
+	if w.prio != 0 {
+		s.prioritized--
+	}
+	atomic.AddInt64(&s.waiters, -1)
+}
@@ -0,0 +1,297 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	"runtime"
+	. "sync"
+	"testing"
+	"time"
+)
+
+func hammerWeighted(s *Semaphore, n int64, loops int) {
+	for i := 0; i < loops; i++ {
+		s.Acquire(context.Background(), n)
+		runtime.Gosched()
+		s.Release(n)
+	}
+}
+
+func TestSemaphoreWeighted(t *testing.T) {
+	n := runtime.GOMAXPROCS(0)
+	loops := 10000 / n
+	s := NewSemaphore(int64(n))
+	var wg WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		i := i
+		go func() {
+			defer wg.Done()
+			hammerWeighted(s, int64(i), loops)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSemaphorePanic(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("release of an unacquired Semaphore did not panic")
+		}
+	}()
+	s := NewSemaphore(1)
+	s.Release(1)
+}
+
+func TestSemaphoreTryAcquire(t *testing.T) {
+	ctx := context.Background()
+	s := NewSemaphore(2)
+	tries := []bool{}
+	s.Acquire(ctx, 1)
+	tries = append(tries, s.TryAcquire(1))
+	tries = append(tries, s.TryAcquire(1))
+
+	s.Release(2)
+
+	tries = append(tries, s.TryAcquire(1))
+	s.Acquire(ctx, 1)
+	tries = append(tries, s.TryAcquire(1))
+
+	want := []bool{true, false, true, false}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+}
+
+func TestSemaphoreAcquire(t *testing.T) {
+	ctx := context.Background()
+	s := NewSemaphore(2)
+	tryAcquire := func(n int64) bool {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		return s.Acquire(ctx, n) == nil
+	}
+
+	tries := []bool{}
+	s.Acquire(ctx, 1)
+	tries = append(tries, tryAcquire(1))
+	tries = append(tries, tryAcquire(1))
+
+	s.Release(2)
+
+	tries = append(tries, tryAcquire(1))
+	s.Acquire(ctx, 1)
+	tries = append(tries, tryAcquire(1))
+
+	want := []bool{true, false, true, false}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+}
+
+// Test that a large Acquire doesn't block other Acquires forever when
+// it cannot succeed.
+func TestSemaphoreLargeAcquireDoesntHang(t *testing.T) {
+	ctx := context.Background()
+	s := NewSemaphore(2)
+	// Acquire more than the semaphore's size.
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- s.Acquire(ctx, 3) }()
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Acquire(3) returned %v; want %v", err, context.Canceled)
+	}
+	if !s.TryAcquire(2) {
+		t.Fatal("TryAcquire(2) failed after a canceled oversized Acquire")
+	}
+}
+
+// Test that a waiter that gives up at the front of the queue lets the
+// waiters behind it proceed.
+func TestSemaphoreCancelFront(t *testing.T) {
+	ctx := context.Background()
+	s := NewSemaphore(2)
+	s.Acquire(ctx, 1)
+
+	bigCtx, cancel := context.WithCancel(ctx)
+	bigErr := make(chan error)
+	go func() { bigErr <- s.Acquire(bigCtx, 2) }()
+	for s.TryAcquire(1) {
+		// Wait for the big waiter to queue up.
+		s.Release(1)
+		runtime.Gosched()
+	}
+	smallErr := make(chan error)
+	go func() { smallErr <- s.Acquire(ctx, 1) }()
+
+	cancel()
+	if err := <-bigErr; err != context.Canceled {
+		t.Fatalf("Acquire(2) returned %v; want %v", err, context.Canceled)
+	}
+	if err := <-smallErr; err != nil {
+		t.Fatalf("Acquire(1) behind a canceled waiter returned %v", err)
+	}
+}
+
+// queueAcquire starts an AcquirePriority of weight 1 with priority prio
+// on s, which must be fully held, and waits for it to queue. It sends
+// name on order once the acquisition succeeds.
+func queueAcquire(s *Semaphore, prio int, name string, order chan<- string) {
+	n := SemaphoreWaiters(s)
+	go func() {
+		s.AcquirePriority(context.Background(), 1, prio)
+		order <- name
+	}()
+	for SemaphoreWaiters(s) == n {
+		runtime.Gosched()
+	}
+}
+
+func TestSemaphorePriority(t *testing.T) {
+	s := NewSemaphore(1)
+	s.SetPriorityAging(0)
+	s.Acquire(context.Background(), 1)
+	order := make(chan string, 3)
+	queueAcquire(s, 0, "batch", order)
+	queueAcquire(s, -1, "background", order)
+	queueAcquire(s, 1, "interactive", order)
+	for _, want := range []string{"interactive", "batch", "background"} {
+		s.Release(1)
+		if got := <-order; got != want {
+			t.Fatalf("%s acquired the semaphore; want %s", got, want)
+		}
+	}
+	s.Release(1)
+}
+
+func TestSemaphorePriorityAging(t *testing.T) {
+	s := NewSemaphore(1)
+	// Age waiters by a priority level every nanosecond, so that
+	// the batch waiter, queued first, has aged past the interactive
+	// one by the time the semaphore is released.
+	s.SetPriorityAging(1)
+	s.Acquire(context.Background(), 1)
+	order := make(chan string, 2)
+	queueAcquire(s, 0, "batch", order)
+	time.Sleep(time.Millisecond)
+	queueAcquire(s, 1, "interactive", order)
+	for _, want := range []string{"batch", "interactive"} {
+		s.Release(1)
+		if got := <-order; got != want {
+			t.Fatalf("%s acquired the semaphore; want %s", got, want)
+		}
+	}
+	s.Release(1)
+}
+
+func BenchmarkSemaphoreWeighted(b *testing.B) {
+	s := NewSemaphore(int64(runtime.GOMAXPROCS(0)))
+	ctx := context.Background()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.Acquire(ctx, 1)
+			s.Release(1)
+		}
+	})
+}
+
+func TestSemaphoreAsLocker(t *testing.T) {
+	s := NewSemaphore(3)
+	l := s.AsLocker(2)
+	l.Lock()
+	if s.TryAcquire(2) {
+		t.Fatal("TryAcquire(2) succeeded with 2 of 3 held by the Locker")
+	}
+	l.Unlock()
+	if !s.TryAcquire(3) {
+		t.Fatal("TryAcquire(3) failed after the Locker unlocked")
+	}
+	s.Release(3)
+
+	// Lock waits for as long as the weight is held.
+	if !s.TryAcquire(2) {
+		t.Fatal("TryAcquire(2) failed on an idle semaphore")
+	}
+	locked := make(chan bool)
+	go func() {
+		l.Lock()
+		locked <- true
+	}()
+	for SemaphoreWaiters(s) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-locked:
+		t.Fatal("Lock succeeded with 2 of 3 held")
+	default:
+	}
+	s.Release(2)
+	<-locked
+	l.Unlock()
+
+	// The Locker serves as the L of a Cond.
+	c := NewCond(l)
+	ready := false
+	done := make(chan bool)
+	go func() {
+		l.Lock()
+		for !ready {
+			c.Wait()
+		}
+		l.Unlock()
+		done <- true
+	}()
+	l.Lock()
+	ready = true
+	c.Signal()
+	l.Unlock()
+	<-done
+}
+
+func TestKeyedSemaphore(t *testing.T) {
+	s := NewKeyedSemaphore(func(key interface{}) int64 {
+		if key == "big" {
+			return 4
+		}
+		return 1
+	})
+	if !s.TryAcquire("small", 1) {
+		t.Fatal("TryAcquire(small, 1) failed on an idle key")
+	}
+	if s.TryAcquire("small", 1) {
+		t.Fatal("TryAcquire(small, 1) succeeded beyond the capacity of small")
+	}
+	if !s.TryAcquire("big", 4) {
+		t.Fatal("TryAcquire(big, 4) failed on an idle key of capacity 4")
+	}
+	if n := s.Len(); n != 2 {
+		t.Fatalf("Len = %d; want 2", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Acquire(ctx, "small", 1); err != context.DeadlineExceeded {
+		t.Fatalf("Acquire of a full key = %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	done := make(chan error)
+	go func() { done <- s.Acquire(context.Background(), "small", 1) }()
+	s.Release("small", 1)
+	if err := <-done; err != nil {
+		t.Fatalf("Acquire after Release = %v", err)
+	}
+	s.Release("small", 1)
+	s.Release("big", 2)
+	s.Release("big", 2)
+	if n := s.Len(); n != 0 {
+		t.Fatalf("Len after releasing everything = %d; want 0", n)
+	}
+}
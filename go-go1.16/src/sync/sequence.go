@@ -0,0 +1,140 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// sequenceLeaseBlocks is the number of blocks a Sequence reserves each
+// time it calls its persist function.
+const sequenceLeaseBlocks = 1024
+
+// A Sequence hands out unique uint64 IDs, such as row or message IDs,
+// to heavily concurrent callers. Rather than add one to a shared counter
+// per ID, which bounces its cache line between every processor that asks
+// for one, it takes a block of IDs at a time from the counter into a
+// cell per P, and hands them out from there. So the IDs handed out on
+// one P increase, and every ID is handed out once, but IDs handed out on
+// different Ps interleave: an ID may be handed out after a greater one.
+//
+// A Sequence with a persist function can resume after a crash without
+// handing out an ID again: before it hands out IDs above the last high
+// mark it persisted, it reserves many blocks ahead and persists the new
+// mark, and after a restart it starts from the last mark persisted. The
+// IDs reserved but not handed out before the crash are skipped.
+//
+// A Sequence must be created with NewSequence and must not be copied
+// after first use.
+type Sequence struct {
+	// 64-bit atomic fields first, for alignment on 32-bit platforms.
+	next uint64 // first ID of the next block to take; atomic
+	high uint64 // IDs below high may be handed out; atomic
+
+	block   uint64
+	persist func(high uint64) error
+	cells   unsafe.Pointer // *[]sequenceCell, allocated on first Next
+
+	leaseMu Mutex // serializes calls of persist
+}
+
+type sequenceCell struct {
+	mu          Mutex
+	next, limit uint64 // the rest of the cell's block
+
+	// Prevents false sharing on widespread platforms with
+	// 128 mod (cache line size) = 0 .
+	pad [128 - (unsafe.Sizeof(Mutex{})+16)%128]byte
+}
+
+// NewSequence returns a new Sequence whose IDs start at start and that
+// takes block IDs at a time into each P, or 64 if block is zero or
+// less. If persist is not nil, the Sequence calls it with a new high
+// mark before it hands out IDs at or above the previous one, the first
+// being start, and after a restart start should be the last mark
+// persisted. persist is called by one goroutine at a time, while those
+// that need the IDs it reserves wait for it.
+func NewSequence(start uint64, block int, persist func(high uint64) error) *Sequence {
+	if block <= 0 {
+		block = 64
+	}
+	s := &Sequence{block: uint64(block), persist: persist, next: start, high: start}
+	if persist == nil {
+		s.high = ^uint64(0)
+	}
+	return s
+}
+
+// Next returns a new ID. It returns an error only if s has a persist
+// function and it fails to persist the IDs Next would hand out; later
+// calls try again.
+func (s *Sequence) Next() (uint64, error) {
+	cells := s.load()
+	if cells == nil {
+		cells = s.alloc()
+	}
+	// The P only picks a cell; the cell's lock keeps it correct if the
+	// goroutine migrates or GOMAXPROCS changes.
+	pid := runtime_procPin()
+	runtime_procUnpin()
+	c := &cells[pid%len(cells)]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.next == c.limit {
+		base, err := s.take()
+		if err != nil {
+			return 0, err
+		}
+		c.next, c.limit = base, base+s.block
+	}
+	id := c.next
+	c.next++
+	return id, nil
+}
+
+// take takes the next block from the shared counter and returns its
+// first ID, persisting a new high mark first if the block reaches past
+// the current one.
+func (s *Sequence) take() (uint64, error) {
+	base := atomic.AddUint64(&s.next, s.block) - s.block
+	end := base + s.block
+	if end <= atomic.LoadUint64(&s.high) {
+		return base, nil
+	}
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+	if high := atomic.LoadUint64(&s.high); end > high {
+		// Reserve from the counter as it is now, so that one lease
+		// covers the blocks taken meanwhile by other Ps.
+		if next := atomic.LoadUint64(&s.next); next > high {
+			high = next
+		}
+		high += sequenceLeaseBlocks * s.block
+		if err := s.persist(high); err != nil {
+			// The block is lost, which leaves a gap but no duplicate.
+			return 0, err
+		}
+		atomic.StoreUint64(&s.high, high)
+	}
+	return base, nil
+}
+
+func (s *Sequence) load() []sequenceCell {
+	p := (*[]sequenceCell)(atomic.LoadPointer(&s.cells))
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func (s *Sequence) alloc() []sequenceCell {
+	cells := make([]sequenceCell, runtime.GOMAXPROCS(0))
+	if atomic.CompareAndSwapPointer(&s.cells, nil, unsafe.Pointer(&cells)) {
+		return cells
+	}
+	return s.load() // another goroutine won the race
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"errors"
+	. "sync"
+	"testing"
+)
+
+func TestSequence(t *testing.T) {
+	var persisted []uint64
+	persist := func(high uint64) error {
+		persisted = append(persisted, high)
+		return nil
+	}
+	s := NewSequence(100, 8, persist)
+
+	const (
+		workers = 8
+		per     = 5000
+	)
+	ids := make(chan uint64, workers*per)
+	done := make(chan bool)
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := 0; i < per; i++ {
+				id, err := s.Next()
+				if err != nil {
+					t.Error(err)
+					break
+				}
+				ids <- id
+			}
+			done <- true
+		}()
+	}
+	for w := 0; w < workers; w++ {
+		<-done
+	}
+	close(ids)
+	seen := make(map[uint64]bool)
+	var max uint64
+	for id := range ids {
+		if id < 100 {
+			t.Fatalf("ID %d below the start", id)
+		}
+		if seen[id] {
+			t.Fatalf("ID %d handed out twice", id)
+		}
+		seen[id] = true
+		if id > max {
+			max = id
+		}
+	}
+	if len(persisted) == 0 {
+		t.Fatal("persist never called")
+	}
+	high := persisted[len(persisted)-1]
+	if max >= high {
+		t.Fatalf("ID %d handed out at or above the persisted mark %d", max, high)
+	}
+
+	// After a crash, a Sequence started from the persisted mark hands out
+	// none of the IDs handed out before.
+	s = NewSequence(high, 8, persist)
+	if id, err := s.Next(); err != nil || id != high {
+		t.Fatalf("Next after restart = %d, %v; want %d, nil", id, err, high)
+	}
+}
+
+func TestSequencePersistError(t *testing.T) {
+	errDisk := errors.New("disk full")
+	fail := true
+	s := NewSequence(0, 4, func(high uint64) error {
+		if fail {
+			return errDisk
+		}
+		return nil
+	})
+	if _, err := s.Next(); err != errDisk {
+		t.Fatalf("Next with a failing persist = %v; want %v", err, errDisk)
+	}
+	fail = false
+	if _, err := s.Next(); err != nil {
+		t.Fatalf("Next after persist recovers = %v", err)
+	}
+}
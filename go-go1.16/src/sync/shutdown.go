@@ -0,0 +1,219 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// ErrStepTimeout is the error with which the context of a Shutdown step
+// is done when the step runs out of time, and the error of a step that
+// had not returned by then.
+var ErrStepTimeout error = syncError("sync: shutdown step timed out")
+
+// A Shutdown coordinates the graceful shutdown of the components of a
+// program. Components track their in-flight work with Enter and Exit,
+// and register the steps that release their resources with Register.
+// Begin then stops new work, waits for the in-flight work to finish and
+// runs the steps, group by group.
+//
+// Groups order the steps by dependency: the steps of a component that
+// uses another go in a higher group than that component's, as a server
+// in group 2 uses workers in group 1, which use a database in group 0.
+// Begin runs the groups from the highest down. The steps of a group run
+// concurrently, and the next group starts once they have all returned
+// or run out of time.
+//
+// The zero Shutdown is ready for use. A Shutdown must not be copied
+// after first use.
+type Shutdown struct {
+	mu       Mutex
+	steps    []shutdownStep
+	begun    bool
+	started  Signal    // fired when Begin is first called
+	inflight WaitGroup // work between Enter and Exit
+	finished Signal    // fired with the result of Begin when it is done
+}
+
+type shutdownStep struct {
+	seq     int // order of registration
+	group   int
+	name    string
+	timeout int64
+	f       func(ctx Context) error
+}
+
+// A ShutdownStepError is the error of a step run by Shutdown.Begin.
+type ShutdownStepError struct {
+	Group int
+	Name  string
+	Err   error // what the step returned, or ErrStepTimeout
+}
+
+func (e *ShutdownStepError) Error() string {
+	return "sync: shutdown step " + e.Name + ": " + e.Err.Error()
+}
+
+func (e *ShutdownStepError) Unwrap() error { return e.Err }
+
+// Register registers f as a step named name in group, to be run by
+// Begin with a context that is done when the step has run for timeout
+// nanoseconds, with ErrStepTimeout, or when the context of Begin is
+// done. A timeout of zero or less leaves the step only the context of
+// Begin. Begin does not wait for a step after its context is done, so
+// f should return promptly then. Register panics if Begin has been
+// called.
+func (s *Shutdown) Register(group int, name string, timeout int64, f func(ctx Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.begun {
+		panic("sync: Shutdown.Register called after Begin")
+	}
+	s.steps = append(s.steps, shutdownStep{len(s.steps), group, name, timeout, f})
+}
+
+// Enter marks the start of a unit of in-flight work, such as a
+// request, and reports whether it may go ahead. It returns false once
+// Begin has been called; otherwise, the caller must call Exit when the
+// work is done.
+func (s *Shutdown) Enter() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.begun {
+		return false
+	}
+	s.inflight.Add(1)
+	return true
+}
+
+// Exit marks the end of a unit of work started by a successful Enter.
+func (s *Shutdown) Exit() {
+	s.inflight.Done()
+}
+
+// Done returns a channel that is closed when Begin is first called, for
+// components that stop their own loops on shutdown.
+func (s *Shutdown) Done() <-chan struct{} {
+	return s.started.Done()
+}
+
+// Begin shuts down: it makes Enter refuse new work, waits for the work
+// in flight to finish, and runs the registered steps in order. It
+// returns the error of the first step that failed, as a
+// *ShutdownStepError, after running all of them. If ctx is done before
+// the work in flight has finished, Begin stops waiting for it and runs
+// the steps, whose contexts are then done already. A nil ctx never
+// gives up.
+//
+// Only the first call runs the shutdown; later ones wait for it to
+// finish and return its result.
+func (s *Shutdown) Begin(ctx Context) error {
+	s.mu.Lock()
+	first := !s.begun
+	s.begun = true
+	steps := s.steps
+	s.mu.Unlock()
+	if !first {
+		<-s.finished.Done()
+		return s.finishedErr()
+	}
+	s.started.Fire(nil)
+
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	drained := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-cancel:
+	}
+
+	// Sort by descending group, keeping the order of registration
+	// within each group.
+	sortSlice(len(steps), func(i, j int) bool {
+		if steps[i].group != steps[j].group {
+			return steps[i].group > steps[j].group
+		}
+		return steps[i].seq < steps[j].seq
+	}, func(i, j int) { steps[i], steps[j] = steps[j], steps[i] })
+	var err error
+	for i := 0; i < len(steps); {
+		j := i + 1
+		for j < len(steps) && steps[j].group == steps[i].group {
+			j++
+		}
+		if e := runShutdownSteps(ctx, steps[i:j]); err == nil {
+			err = e
+		}
+		i = j
+	}
+	if err == nil {
+		s.finished.Fire(nil)
+	} else {
+		s.finished.Fire(err)
+	}
+	return err
+}
+
+// finishedErr returns the result of the Begin that ran the shutdown.
+func (s *Shutdown) finishedErr() error {
+	if err := s.finished.Err(); err != ErrFired {
+		return err
+	}
+	return nil
+}
+
+// runShutdownSteps runs steps concurrently and returns the error of the
+// first of them, in order, that failed.
+func runShutdownSteps(ctx Context, steps []shutdownStep) error {
+	errs := make([]error, len(steps))
+	var wg WaitGroup
+	wg.Add(len(steps))
+	for i := range steps {
+		go func(i int) {
+			defer wg.Done()
+			if err := runShutdownStep(ctx, steps[i]); err != nil {
+				errs[i] = &ShutdownStepError{steps[i].group, steps[i].name, err}
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runShutdownStep runs step with a context that is done when ctx is
+// done or the step's time is up, and returns once the step has
+// returned or its context is done. In the latter case, the step goes
+// on running, and its result is dropped.
+func runShutdownStep(ctx Context, step shutdownStep) error {
+	var stepCtx Signal
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	var timeout chan struct{}
+	if step.timeout > 0 {
+		timeout = make(chan struct{})
+		stop := startCloseTimer(step.timeout, timeout)
+		defer stop()
+	}
+	result := make(chan error, 1)
+	go func() { result <- step.f(&stepCtx) }()
+	select {
+	case err := <-result:
+		return err
+	case <-cancel:
+		stepCtx.Fire(ctx.Err())
+	case <-timeout:
+		stepCtx.Fire(ErrStepTimeout)
+	}
+	return stepCtx.Err()
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "sync"
+	"testing"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	var s Shutdown
+	var mu Mutex
+	var order []string
+	step := func(name string) func(Context) error {
+		return func(Context) error {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return nil
+		}
+	}
+	s.Register(0, "db", 0, step("db"))
+	s.Register(2, "server", 0, step("server"))
+	s.Register(1, "workers", 0, step("workers"))
+
+	if !s.Enter() {
+		t.Fatal("Enter before Begin returned false")
+	}
+	done := make(chan error)
+	go func() { done <- s.Begin(context.Background()) }()
+	<-s.Done()
+	if s.Enter() {
+		t.Fatal("Enter after Begin returned true")
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Begin returned %v with work in flight", err)
+	default:
+	}
+	s.Exit()
+	if err := <-done; err != nil {
+		t.Fatalf("Begin returned %v", err)
+	}
+	if got := fmt.Sprint(order); got != "[server workers db]" {
+		t.Fatalf("steps ran in order %v; want [server workers db]", got)
+	}
+	if err := s.Begin(nil); err != nil {
+		t.Fatalf("second Begin returned %v", err)
+	}
+}
+
+func TestShutdownStepErrors(t *testing.T) {
+	var s Shutdown
+	errClose := errors.New("close failed")
+	release := make(chan struct{})
+	defer close(release)
+	s.Register(1, "stuck", 1e6, func(ctx Context) error {
+		<-release // ignore the context
+		return nil
+	})
+	s.Register(0, "failing", 0, func(Context) error { return errClose })
+	ran := make(chan bool, 1)
+	s.Register(0, "fine", 0, func(Context) error {
+		ran <- true
+		return nil
+	})
+
+	err := s.Begin(nil)
+	var se *ShutdownStepError
+	if !errors.As(err, &se) || se.Name != "stuck" || se.Group != 1 || !errors.Is(err, ErrStepTimeout) {
+		t.Fatalf("Begin returned %v; want a timeout of step stuck", err)
+	}
+	select {
+	case <-ran:
+	default:
+		t.Fatal("Begin did not run the steps after a failed one")
+	}
+	if err2 := s.Begin(nil); err2 != err {
+		t.Fatalf("second Begin returned %v; want %v", err2, err)
+	}
+}
+
+func TestShutdownCanceled(t *testing.T) {
+	var s Shutdown
+	s.Enter() // never exits
+	release := make(chan struct{})
+	defer close(release)
+	s.Register(0, "step", 0, func(ctx Context) error {
+		<-release
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Begin(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Begin returned %v; want %v", err, context.Canceled)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Register after Begin did not panic")
+		}
+	}()
+	s.Register(0, "late", 0, func(Context) error { return nil })
+}
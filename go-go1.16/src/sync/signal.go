@@ -0,0 +1,64 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// ErrFired is the error a Signal reports when it was fired with a nil
+// error.
+var ErrFired error = syncError("sync: signal fired")
+
+// A Signal is a one-shot broadcast that carries an error, such as the
+// reason a component is shutting down. It is the done channel and error
+// of a context, without the rest of a context: once fired, its Done
+// channel is closed and Err returns the error it was fired with.
+//
+// Because it has Done and Err methods, a *Signal can be passed wherever
+// this package accepts a Context.
+//
+// The zero Signal is unfired and ready for use. A Signal must not be
+// copied after first use.
+type Signal struct {
+	mu   Mutex
+	done chan struct{} // closed when fired; nil until needed
+	err  error         // non-nil once fired
+}
+
+// Fire fires s with err, closing its Done channel, and reports whether
+// this call fired it. Only the first call has an effect; later ones are
+// ignored. If err is nil, s reports ErrFired instead.
+func (s *Signal) Fire(err error) bool {
+	if err == nil {
+		err = ErrFired
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return false
+	}
+	s.err = err
+	if s.done == nil {
+		s.done = closedchan
+	} else {
+		close(s.done)
+	}
+	return true
+}
+
+// Done returns a channel that is closed when s is fired.
+func (s *Signal) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done == nil {
+		s.done = make(chan struct{})
+	}
+	return s.done
+}
+
+// Err returns nil if s has not been fired, and the error it was fired
+// with otherwise.
+func (s *Signal) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	"errors"
+	. "sync"
+	"testing"
+)
+
+func TestSignal(t *testing.T) {
+	var s Signal
+	if err := s.Err(); err != nil {
+		t.Fatalf("unfired Signal has Err %v", err)
+	}
+	done := s.Done()
+	select {
+	case <-done:
+		t.Fatal("Done closed before Fire")
+	default:
+	}
+	errStop := errors.New("stop")
+	if !s.Fire(errStop) {
+		t.Fatal("first Fire returned false")
+	}
+	if s.Fire(errors.New("again")) {
+		t.Fatal("second Fire returned true")
+	}
+	<-done
+	if err := s.Err(); err != errStop {
+		t.Fatalf("Err() = %v; want %v", err, errStop)
+	}
+
+	var s2 Signal
+	s2.Fire(nil)
+	<-s2.Done()
+	if err := s2.Err(); err != ErrFired {
+		t.Fatalf("Err() = %v; want ErrFired", err)
+	}
+}
+
+func TestSignalAsContext(t *testing.T) {
+	var s Signal
+	var c Future
+	go s.Fire(nil)
+	if _, err := c.Get(&s); err != ErrFired {
+		t.Fatalf("Get() = %v; want ErrFired", err)
+	}
+}
+
+func TestMergeCancel(t *testing.T) {
+	// Enough parents for more than one watching goroutine.
+	var parents []Context
+	var cancels []context.CancelFunc
+	for i := 0; i < 6; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		parents = append(parents, ctx)
+		cancels = append(cancels, cancel)
+	}
+	parents = append(parents, nil, context.Background())
+	ctx, cancel := MergeCancel(parents...)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		t.Fatal("merged context done before any parent")
+	default:
+	}
+	cancels[5]()
+	<-ctx.Done()
+	if err := ctx.Err(); err != context.Canceled {
+		t.Fatalf("merged Err = %v; want %v", err, context.Canceled)
+	}
+
+	// A parent done already makes the merged context done at once.
+	ctx, _ = MergeCancel(parents[5], parents[0])
+	if err := ctx.Err(); err != context.Canceled {
+		t.Fatalf("merged Err with a done parent = %v; want %v", err, context.Canceled)
+	}
+
+	ctx, cancel = MergeCancel(parents[0])
+	cancel()
+	cancel()
+	<-ctx.Done()
+	if err := ctx.Err(); err != ErrCanceled {
+		t.Fatalf("Err after cancel = %v; want %v", err, ErrCanceled)
+	}
+}
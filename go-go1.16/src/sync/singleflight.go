@@ -0,0 +1,132 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// singleflightCall is an in-flight or completed Singleflight.Do call.
+type singleflightCall struct {
+	wg WaitGroup
+
+	// These fields are written once before the WaitGroup is done
+	// and are only read after the WaitGroup is done.
+	val interface{}
+	err error
+
+	// These fields are read and written with the Singleflight
+	// mutex held before the WaitGroup is done, and are read but
+	// not written after the WaitGroup is done.
+	dups  int
+	chans []chan<- SingleflightResult
+}
+
+// A Singleflight suppresses duplicate function calls: it represents a
+// class of work and forms a namespace of keys in which units of work
+// can be executed at most once at a time. It suits caches, where many
+// goroutines may miss on the same key at once and only one of them
+// should fetch the value.
+//
+// The zero Singleflight is ready for use. A Singleflight must not be
+// copied after first use.
+type Singleflight struct {
+	mu Mutex                        // protects m
+	m  map[string]*singleflightCall // lazily initialized
+}
+
+// SingleflightResult holds the results of Singleflight.Do, so they can
+// be passed on a channel.
+type SingleflightResult struct {
+	Val    interface{}
+	Err    error
+	Shared bool
+}
+
+// errSingleflightPanic is the error that duplicate callers get if the
+// function they wait for panics.
+var errSingleflightPanic = syncError("sync: Singleflight function panicked")
+
+// Do executes and returns the results of the given function, making
+// sure that only one execution is in-flight for a given key at a
+// time. If a duplicate comes in, the duplicate caller waits for the
+// original to complete and receives the same results.
+// The return value shared indicates whether v was given to multiple callers.
+//
+// If fn panics, the panic propagates in the goroutine that called fn,
+// and the duplicate callers get an error.
+func (g *Singleflight) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*singleflightCall)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+	c := new(singleflightCall)
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	g.doCall(c, key, fn)
+	return c.val, c.err, c.dups > 0
+}
+
+// DoChan is like Do but returns a channel that will receive the
+// results when they are ready. The channel is never closed.
+func (g *Singleflight) DoChan(key string, fn func() (interface{}, error)) <-chan SingleflightResult {
+	ch := make(chan SingleflightResult, 1)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*singleflightCall)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
+	}
+	c := &singleflightCall{chans: []chan<- SingleflightResult{ch}}
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	go g.doCall(c, key, fn)
+
+	return ch
+}
+
+// doCall handles the single call for a key.
+func (g *Singleflight) doCall(c *singleflightCall, key string, fn func() (interface{}, error)) {
+	normalReturn := false
+	defer func() {
+		if !normalReturn {
+			// fn panicked or called runtime.Goexit. Release
+			// the duplicates and let the panic go on.
+			c.val, c.err = nil, errSingleflightPanic
+		}
+		c.wg.Done()
+
+		g.mu.Lock()
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+		for _, ch := range c.chans {
+			ch <- SingleflightResult{c.val, c.err, c.dups > 0}
+		}
+		g.mu.Unlock()
+	}()
+	c.val, c.err = fn()
+	normalReturn = true
+}
+
+// Forget tells g to forget about key. Future calls to Do for this key
+// will call the function rather than waiting for an earlier call to
+// complete. Callers already waiting for the earlier call still get its
+// results.
+func (g *Singleflight) Forget(key string) {
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"errors"
+	. "sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleflightDo(t *testing.T) {
+	var g Singleflight
+	v, err, _ := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil {
+		t.Errorf("Do = %v, %v; want bar, nil", v, err)
+	}
+
+	someErr := errors.New("some error")
+	v, err, _ = g.Do("key", func() (interface{}, error) {
+		return nil, someErr
+	})
+	if v != nil || err != someErr {
+		t.Errorf("Do = %v, %v; want nil, %v", v, err, someErr)
+	}
+}
+
+func TestSingleflightDupSuppress(t *testing.T) {
+	var g Singleflight
+	var wg1, wg2 WaitGroup
+	c := make(chan string, 1)
+	var calls int32
+	fn := func() (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// First invocation.
+			wg1.Done()
+		}
+		v := <-c
+		c <- v // pump; make available for any future calls
+
+		time.Sleep(10 * time.Millisecond) // let more goroutines enter Do
+
+		return v, nil
+	}
+
+	const n = 10
+	wg1.Add(1)
+	for i := 0; i < n; i++ {
+		wg1.Add(1)
+		wg2.Add(1)
+		go func() {
+			defer wg2.Done()
+			wg1.Done()
+			v, err, _ := g.Do("key", fn)
+			if err != nil {
+				t.Errorf("Do error: %v", err)
+				return
+			}
+			if s, _ := v.(string); s != "bar" {
+				t.Errorf("Do = %T %v; want %q", v, v, "bar")
+			}
+		}()
+	}
+	wg1.Wait()
+	// At least one goroutine is in fn now and all of them have at
+	// least reached the line before the Do.
+	c <- "bar"
+	wg2.Wait()
+	if got := atomic.LoadInt32(&calls); got <= 0 || got >= n {
+		t.Errorf("number of calls = %d; want over 0 and less than %d", got, n)
+	}
+}
+
+func TestSingleflightDoChan(t *testing.T) {
+	var g Singleflight
+	release := make(chan bool)
+	fn := func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	}
+	ch1 := g.DoChan("key", fn)
+	ch2 := g.DoChan("key", fn)
+	close(release)
+	for _, ch := range []<-chan SingleflightResult{ch1, ch2} {
+		if r := <-ch; r.Val != "bar" || r.Err != nil || !r.Shared {
+			t.Errorf("DoChan sent %+v; want a shared bar", r)
+		}
+	}
+}
+
+func TestSingleflightForget(t *testing.T) {
+	var g Singleflight
+	release := make(chan bool)
+	first := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	g.Forget("key")
+	// The forgotten call is still running, but a new one starts.
+	v, _, shared := g.Do("key", func() (interface{}, error) {
+		return 2, nil
+	})
+	if v != 2 || shared {
+		t.Errorf("Do after Forget = %v, shared %t; want 2, unshared", v, shared)
+	}
+	close(release)
+	if r := <-first; r.Val != 1 {
+		t.Errorf("forgotten call sent %v; want 1", r.Val)
+	}
+}
+
+func TestSingleflightPanic(t *testing.T) {
+	var g Singleflight
+	inCall := make(chan bool)
+	release := make(chan bool)
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		g.Do("key", func() (interface{}, error) {
+			close(inCall)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-inCall
+	dup := g.DoChan("key", nil)
+	close(release)
+	if err := <-panicked; err != "boom" {
+		t.Fatalf("got panic %v; want boom", err)
+	}
+	if r := <-dup; r.Err == nil || !r.Shared {
+		t.Fatalf("duplicate of a panicking call got %+v; want an error", r)
+	}
+	// The key is free again.
+	v, err, _ := g.Do("key", func() (interface{}, error) { return 1, nil })
+	if v != 1 || err != nil {
+		t.Fatalf("Do after panic = %v, %v; want 1, nil", v, err)
+	}
+}
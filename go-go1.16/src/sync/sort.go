@@ -0,0 +1,39 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// sortSlice sorts the n elements of a slice, as sort.Slice does, given
+// functions that compare and swap the elements at indices i and j.
+// Package sync sits below sort in the dependency order, so it cannot
+// import it. sortSlice is a heapsort: it takes O(n log n) time and does
+// not allocate, but it is not stable.
+func sortSlice(n int, less func(i, j int) bool, swap func(i, j int)) {
+	for i := n/2 - 1; i >= 0; i-- {
+		siftDown(i, n, less, swap)
+	}
+	for i := n - 1; i > 0; i-- {
+		swap(0, i)
+		siftDown(0, i, less, swap)
+	}
+}
+
+// siftDown restores the heap order of the n elements rooted at i,
+// whose subtrees are heaps.
+func siftDown(i, n int, less func(i, j int) bool, swap func(i, j int)) {
+	for {
+		child := 2*i + 1
+		if child >= n {
+			return
+		}
+		if child+1 < n && less(child, child+1) {
+			child++
+		}
+		if !less(i, child) {
+			return
+		}
+		swap(i, child)
+		i = child
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"math/rand"
+	"sort"
+	. "sync"
+	"testing"
+)
+
+func TestSortSlice(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 2, 3, 10, 100, 1000} {
+		for _, mod := range []int{3, 1 << 30} {
+			a := make([]int, n)
+			for i := range a {
+				a[i] = r.Intn(mod)
+			}
+			want := append([]int(nil), a...)
+			sort.Ints(want)
+			SortSlice(len(a), func(i, j int) bool { return a[i] < a[j] }, func(i, j int) { a[i], a[j] = a[j], a[i] })
+			for i := range a {
+				if a[i] != want[i] {
+					t.Fatalf("n %d, mod %d: element %d is %d; want %d", n, mod, i, a[i], want[i])
+				}
+			}
+		}
+	}
+}
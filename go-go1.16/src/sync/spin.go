@@ -0,0 +1,82 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// Spin budget.
+//
+// A goroutine that finds a Mutex locked spins for a while before it
+// queues, in the hope that the holder releases the lock soon. How long
+// that is worth depends on the machine: with few Ps, the holder is
+// likely descheduled and spinning only delays it, while with many, a
+// short critical section often ends within a few more spins. It also
+// depends on the program: if spinning rarely ends with the lock taken,
+// it is wasted work.
+//
+// So the number of spins is not fixed. The base budget grows with the
+// logarithm of GOMAXPROCS, from 3 spins at GOMAXPROCS=2 to 4 at 4 and 9
+// at 128, and a package-wide score of recent outcomes scales it between
+// half and one and a half times that: each slow Lock that takes the lock
+// while spinning raises the score, and each that spins and then has to
+// queue lowers it. SetSpinBudget fixes the budget instead.
+
+const spinScoreMax = 64
+
+var spin struct {
+	budget int32 // fixed by SetSpinBudget, or -1 to adapt
+	score  int32 // in [-spinScoreMax, spinScoreMax]
+}
+
+func init() {
+	spin.budget = -1
+}
+
+// SetSpinBudget fixes the number of times a goroutine spins on a locked
+// Mutex or RWMutex before it queues for it at n and returns the previous
+// setting. A budget of 0 turns spinning off, and a negative one restores
+// the default, which adapts the budget to GOMAXPROCS and to how often
+// spinning has recently paid off. The runtime may still stop spinning
+// early, as when GOMAXPROCS is 1 or other goroutines are ready to run.
+func SetSpinBudget(n int) (old int) {
+	if n < 0 {
+		n = -1
+	}
+	return int(atomic.SwapInt32(&spin.budget, int32(n)))
+}
+
+// spinBudget returns the number of times a slow Lock may spin.
+func spinBudget() int {
+	if n := atomic.LoadInt32(&spin.budget); n >= 0 {
+		return int(n)
+	}
+	base := bitLen(uint(runtime_gomaxprocs())) + 1
+	n := base + base*int(atomic.LoadInt32(&spin.score))/(2*spinScoreMax)
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// recordSpin records whether a slow Lock that spun took the lock while
+// spinning. It writes the score only when the score changes, so that a
+// steady outcome does not make every slow Lock write the same word.
+func recordSpin(acquired bool) {
+	for {
+		old := atomic.LoadInt32(&spin.score)
+		new := old
+		switch {
+		case acquired && old < spinScoreMax:
+			new++
+		case !acquired && old > -spinScoreMax:
+			new--
+		default:
+			return
+		}
+		if atomic.CompareAndSwapInt32(&spin.score, old, new) {
+			return
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	. "sync"
+	"testing"
+)
+
+func TestSetSpinBudget(t *testing.T) {
+	if old := SetSpinBudget(7); old != -1 {
+		t.Fatalf("SetSpinBudget returned %d the first time; want -1", old)
+	}
+	defer SetSpinBudget(-1)
+	if n := SpinBudget(); n != 7 {
+		t.Errorf("budget after SetSpinBudget(7) = %d; want 7", n)
+	}
+	if old := SetSpinBudget(0); old != 7 {
+		t.Errorf("SetSpinBudget returned %d; want 7", old)
+	}
+	if n := SpinBudget(); n != 0 {
+		t.Errorf("budget after SetSpinBudget(0) = %d; want 0", n)
+	}
+	m := new(Mutex)
+	c := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go HammerMutex(m, 1000, c)
+	}
+	for i := 0; i < 4; i++ {
+		<-c
+	}
+	if old := SetSpinBudget(-5); old != 0 {
+		t.Errorf("SetSpinBudget returned %d; want 0", old)
+	}
+	if old := SetSpinBudget(-1); old != -1 {
+		t.Errorf("SetSpinBudget returned %d after a negative budget; want -1", old)
+	}
+}
+
+func TestAdaptiveSpinBudget(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	// Push the score to each end and back to the middle.
+	for i := 0; i < 1000; i++ {
+		RecordSpin(true)
+	}
+	if n := SpinBudget(); n != 6 {
+		t.Errorf("budget at GOMAXPROCS=4 after successful spins = %d; want 6", n)
+	}
+	for i := 0; i < 1000; i++ {
+		RecordSpin(false)
+	}
+	if n := SpinBudget(); n != 2 {
+		t.Errorf("budget at GOMAXPROCS=4 after failed spins = %d; want 2", n)
+	}
+	for i := 0; i < 64; i++ {
+		RecordSpin(true)
+	}
+	if n := SpinBudget(); n != 4 {
+		t.Errorf("budget at GOMAXPROCS=4 = %d; want 4", n)
+	}
+	runtime.GOMAXPROCS(128)
+	if n := SpinBudget(); n != 9 {
+		t.Errorf("budget at GOMAXPROCS=128 = %d; want 9", n)
+	}
+}
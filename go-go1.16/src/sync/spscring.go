@@ -0,0 +1,153 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// An SPSCRing is a bounded first-in, first-out queue for exactly one
+// producing goroutine and one consuming goroutine. Every operation is
+// wait-free: it completes in a bounded number of steps whatever the other
+// side is doing, and never takes a lock.
+//
+// The producer's and consumer's indices live on separate cache lines, and
+// each side keeps a private copy of the other's index, so in the steady
+// state the two sides touch shared memory only to publish. Write and Read
+// move many values per publication, which makes SPSCRing cheaper than a
+// buffered channel for high-volume pipelines such as logging and telemetry.
+//
+// Using an SPSCRing from more than one producer or more than one consumer
+// at a time corrupts it. Callers that need that must add their own mutual
+// exclusion on the side that is shared.
+type SPSCRing struct {
+	// Consumer side. head is the index of the next value to read; only
+	// the consumer writes it. tail is the consumer's cached copy of
+	// prod.tail, refreshed when the ring looks empty.
+	cons struct {
+		head uint64
+		tail uint64
+	}
+	// Prevents false sharing on widespread platforms with
+	// 128 mod (cache line size) = 0 .
+	_ [128 - 16]byte
+
+	// Producer side. tail is the index of the next slot to write; only
+	// the producer writes it. head is the producer's cached copy of
+	// cons.head, refreshed when the ring looks full.
+	prod struct {
+		tail uint64
+		head uint64
+	}
+	_ [128 - 16]byte
+
+	buf  []interface{}
+	mask uint64
+}
+
+// NewSPSCRing returns an empty SPSCRing that holds up to size values.
+// Size is rounded up to a power of two. It panics if size is not positive.
+func NewSPSCRing(size int) *SPSCRing {
+	if size <= 0 {
+		panic("sync: NewSPSCRing with non-positive size")
+	}
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+	return &SPSCRing{buf: make([]interface{}, n), mask: uint64(n - 1)}
+}
+
+// TryPush adds v to the back of r and reports whether there was room
+// for it. It must only be called by the producer.
+func (r *SPSCRing) TryPush(v interface{}) bool {
+	tail := r.prod.tail
+	if tail-r.prod.head == uint64(len(r.buf)) {
+		r.prod.head = atomic.LoadUint64(&r.cons.head)
+		if tail-r.prod.head == uint64(len(r.buf)) {
+			return false
+		}
+	}
+	r.buf[tail&r.mask] = v
+	atomic.StoreUint64(&r.prod.tail, tail+1)
+	return true
+}
+
+// Write adds as many values from the front of vs as fit to the back of r
+// and publishes them to the consumer at once. It returns the number of
+// values added. It must only be called by the producer.
+func (r *SPSCRing) Write(vs []interface{}) int {
+	tail := r.prod.tail
+	free := uint64(len(r.buf)) - (tail - r.prod.head)
+	if free < uint64(len(vs)) {
+		r.prod.head = atomic.LoadUint64(&r.cons.head)
+		free = uint64(len(r.buf)) - (tail - r.prod.head)
+	}
+	n := uint64(len(vs))
+	if n > free {
+		n = free
+	}
+	for i := uint64(0); i < n; i++ {
+		r.buf[(tail+i)&r.mask] = vs[i]
+	}
+	if n > 0 {
+		atomic.StoreUint64(&r.prod.tail, tail+n)
+	}
+	return int(n)
+}
+
+// TryPop removes and returns the value at the front of r. If r is empty,
+// it returns nil and false. It must only be called by the
+// consumer.
+func (r *SPSCRing) TryPop() (v interface{}, ok bool) {
+	head := r.cons.head
+	if head == r.cons.tail {
+		r.cons.tail = atomic.LoadUint64(&r.prod.tail)
+		if head == r.cons.tail {
+			return v, false
+		}
+	}
+	slot := &r.buf[head&r.mask]
+	v = *slot
+	*slot = nil // don't retain v on the consumer's behalf
+	atomic.StoreUint64(&r.cons.head, head+1)
+	return v, true
+}
+
+// Read removes up to len(vs) values from the front of r into vs and
+// returns the number of values read. The freed slots are handed back to
+// the producer at once. It must only be called by the consumer.
+func (r *SPSCRing) Read(vs []interface{}) int {
+	head := r.cons.head
+	avail := r.cons.tail - head
+	if avail < uint64(len(vs)) {
+		r.cons.tail = atomic.LoadUint64(&r.prod.tail)
+		avail = r.cons.tail - head
+	}
+	n := uint64(len(vs))
+	if n > avail {
+		n = avail
+	}
+	for i := uint64(0); i < n; i++ {
+		slot := &r.buf[(head+i)&r.mask]
+		vs[i] = *slot
+		*slot = nil
+	}
+	if n > 0 {
+		atomic.StoreUint64(&r.cons.head, head+n)
+	}
+	return int(n)
+}
+
+// Len returns the number of values in r. If r is in use, the answer may
+// be out of date by the time Len returns.
+func (r *SPSCRing) Len() int {
+	head := atomic.LoadUint64(&r.cons.head)
+	tail := atomic.LoadUint64(&r.prod.tail)
+	return int(tail - head)
+}
+
+// Cap returns the number of values r can hold.
+func (r *SPSCRing) Cap() int {
+	return len(r.buf)
+}
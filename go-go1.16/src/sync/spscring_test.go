@@ -0,0 +1,127 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	. "sync"
+	"testing"
+)
+
+func TestSPSCRing(t *testing.T) {
+	r := NewSPSCRing(3)
+	if r.Cap() != 4 {
+		t.Fatalf("Cap() = %d; want 4", r.Cap())
+	}
+	if _, ok := r.TryPop(); ok {
+		t.Fatal("TryPop on empty ring succeeded")
+	}
+	for i := 0; i < 4; i++ {
+		if !r.TryPush(i) {
+			t.Fatalf("TryPush(%d) failed", i)
+		}
+	}
+	if r.TryPush(4) {
+		t.Fatal("TryPush on full ring succeeded")
+	}
+	if n := r.Len(); n != 4 {
+		t.Fatalf("Len() = %d; want 4", n)
+	}
+	if v, ok := r.TryPop(); v != 0 || !ok {
+		t.Fatalf("TryPop() = %d, %t; want 0, true", v, ok)
+	}
+	if n := r.Write([]interface{}{4, 5, 6}); n != 1 {
+		t.Fatalf("Write wrote %d values; want 1", n)
+	}
+	buf := make([]interface{}, 8)
+	if n := r.Read(buf); n != 4 || buf[0] != 1 || buf[3] != 4 {
+		t.Fatalf("Read returned %d, %v; want 4, [1 2 3 4]", n, buf[:n])
+	}
+	if n := r.Read(buf); n != 0 {
+		t.Fatalf("Read on empty ring returned %d", n)
+	}
+}
+
+func TestSPSCRingConcurrent(t *testing.T) {
+	N := 100000
+	if testing.Short() {
+		N = 10000
+	}
+	r := NewSPSCRing(64)
+	done := make(chan bool)
+	go func() {
+		batch := make([]interface{}, 0, 16)
+		for i := 0; i < N; {
+			if i%2 == 0 {
+				if r.TryPush(i) {
+					i++
+				} else {
+					runtime.Gosched()
+				}
+				continue
+			}
+			batch = batch[:0]
+			for j := i; j < N && len(batch) < cap(batch); j++ {
+				batch = append(batch, j)
+			}
+			n := r.Write(batch)
+			if n == 0 {
+				runtime.Gosched()
+			}
+			i += n
+		}
+		done <- true
+	}()
+	buf := make([]interface{}, 10)
+	for want := 0; want < N; {
+		if want%3 == 0 {
+			v, ok := r.TryPop()
+			if !ok {
+				runtime.Gosched()
+				continue
+			}
+			if v != want {
+				t.Fatalf("TryPop() = %d; want %d", v, want)
+			}
+			want++
+			continue
+		}
+		n := r.Read(buf)
+		if n == 0 {
+			runtime.Gosched()
+		}
+		for _, v := range buf[:n] {
+			if v != want {
+				t.Fatalf("Read got %d; want %d", v, want)
+			}
+			want++
+		}
+	}
+	<-done
+}
+
+func BenchmarkSPSCRing(b *testing.B) {
+	r := NewSPSCRing(1024)
+	done := make(chan bool)
+	go func() {
+		buf := make([]interface{}, 64)
+		for n := 0; n < b.N; {
+			k := r.Read(buf)
+			if k == 0 {
+				runtime.Gosched()
+			}
+			n += k
+		}
+		done <- true
+	}()
+	for i := 0; i < b.N; {
+		if r.TryPush(i) {
+			i++
+		} else {
+			runtime.Gosched()
+		}
+	}
+	<-done
+}
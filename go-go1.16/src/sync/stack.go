@@ -0,0 +1,118 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Stack is a lock-free last-in, first-out stack of values,
+// safe for use by multiple goroutines simultaneously. It is a Treiber
+// stack: Push and Pop swing the top of the stack with a single
+// compare-and-swap, so they never block each other.
+//
+// Lock-free stacks written in languages without garbage collection must
+// guard against the ABA problem, in which a node popped and pushed back
+// while another goroutine is in the middle of a Pop makes that goroutine's
+// compare-and-swap succeed wrongly. Stack needs no tags or epochs for
+// this: each Push allocates a new node, and the garbage collector does
+// not reuse a node's memory while any goroutine still refers to it.
+//
+// Under contention, Push and Pop back off through an elimination array:
+// a Push and a Pop whose compare-and-swaps both failed can meet in an
+// Exchanger and hand the value over directly, which completes both
+// without touching the top of the stack.
+//
+// The zero Stack is empty and ready for use. A Stack must not be copied
+// after first use.
+type Stack struct {
+	top  unsafe.Pointer            // *stackNode
+	elim [stackElimSlots]Exchanger // of stackOps
+}
+
+// A stackOp is a Push or Pop offered for elimination.
+type stackOp struct {
+	push bool
+	v    interface{}
+}
+
+const (
+	stackElimSlots = 4 // Exchangers in a Stack's elimination array
+	stackElimSpins = 8 // how long a Push or Pop waits in one
+)
+
+type stackNode struct {
+	v    interface{}
+	next *stackNode
+}
+
+// Push adds v to the top of s.
+func (s *Stack) Push(v interface{}) {
+	n := &stackNode{v: v}
+	for {
+		top := atomic.LoadPointer(&s.top)
+		n.next = (*stackNode)(top)
+		if atomic.CompareAndSwapPointer(&s.top, top, unsafe.Pointer(n)) {
+			return
+		}
+		if _, ok := s.eliminate(stackOp{push: true, v: v}); ok {
+			return
+		}
+	}
+}
+
+// Pop removes and returns the value at the top of s. If s is empty, it
+// returns nil and false.
+func (s *Stack) Pop() (v interface{}, ok bool) {
+	for {
+		top := atomic.LoadPointer(&s.top)
+		if top == nil {
+			return v, false
+		}
+		n := (*stackNode)(top)
+		if atomic.CompareAndSwapPointer(&s.top, top, unsafe.Pointer(n.next)) {
+			return n.v, true
+		}
+		if v, ok := s.eliminate(stackOp{}); ok {
+			return v, true
+		}
+	}
+}
+
+// eliminate offers op in a random slot of the elimination array. If it
+// meets the opposite operation there, both are complete: it reports true
+// and, for a Pop, returns the pushed value. Meeting the same operation
+// completes neither, and both go back to the top of the stack.
+func (s *Stack) eliminate(op stackOp) (v interface{}, ok bool) {
+	x := &s.elim[fastrand()%stackElimSlots]
+	y, ok := x.trySpin(op, stackElimSpins)
+	if !ok {
+		return nil, false
+	}
+	other := y.(stackOp)
+	if other.push == op.push {
+		return nil, false
+	}
+	return other.v, true
+}
+
+// PopAll removes every value from s and returns them, most recently
+// pushed first. It empties s with a single atomic operation, so values
+// pushed concurrently are either all returned or all left in s.
+func (s *Stack) PopAll() []interface{} {
+	n := (*stackNode)(atomic.SwapPointer(&s.top, nil))
+	var vs []interface{}
+	for ; n != nil; n = n.next {
+		vs = append(vs, n.v)
+	}
+	return vs
+}
+
+// Empty reports whether s is empty. If s is used concurrently, the
+// answer may be out of date by the time Empty returns.
+func (s *Stack) Empty() bool {
+	return atomic.LoadPointer(&s.top) == nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	. "sync"
+	"testing"
+)
+
+func TestStack(t *testing.T) {
+	var s Stack
+	if !s.Empty() {
+		t.Fatal("zero Stack is not empty")
+	}
+	if v, ok := s.Pop(); ok {
+		t.Fatalf("Pop on empty Stack returned %v", v)
+	}
+	for i := 0; i < 3; i++ {
+		s.Push(i)
+	}
+	if v, ok := s.Pop(); v != 2 || !ok {
+		t.Fatalf("Pop returned %v, %t; want 2, true", v, ok)
+	}
+	s.Push(3)
+	if vs := s.PopAll(); len(vs) != 3 || vs[0] != 3 || vs[1] != 1 || vs[2] != 0 {
+		t.Fatalf("PopAll returned %v; want [3 1 0]", vs)
+	}
+	if !s.Empty() {
+		t.Fatal("Stack not empty after PopAll")
+	}
+}
+
+func TestStackConcurrent(t *testing.T) {
+	var s Stack
+	P := runtime.GOMAXPROCS(0)
+	N := 10000
+	if testing.Short() {
+		N = 1000
+	}
+	var wg WaitGroup
+	popped := make([][]int, P)
+	for p := 0; p < P; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < N; i++ {
+				s.Push(p*N + i)
+				// Pop right away, so that nodes churn at the top
+				// of the stack, as they would in a free list.
+				if v, ok := s.Pop(); ok {
+					popped[p] = append(popped[p], v.(int))
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+	seen := make([]bool, P*N)
+	for _, v := range s.PopAll() {
+		popped[0] = append(popped[0], v.(int))
+	}
+	for _, vs := range popped {
+		for _, v := range vs {
+			if seen[v] {
+				t.Fatalf("value %d popped twice", v)
+			}
+			seen[v] = true
+		}
+	}
+	for v, ok := range seen {
+		if !ok {
+			t.Fatalf("value %d lost", v)
+		}
+	}
+}
+
+func BenchmarkStack(b *testing.B) {
+	var s Stack
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.Push(1)
+			s.Pop()
+		}
+	})
+}
@@ -0,0 +1,41 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// Starvation threshold.
+//
+// A Mutex switches to starvation mode, in which it hands the lock from
+// goroutine to goroutine in queue order, once a waiter has waited longer
+// than the starvation threshold; see the comment on Mutex fairness in
+// mutex.go. An RWMutex does the same on both of its sides: the writers
+// queue on a Mutex, and a writer that waits longer than the threshold
+// for readers to leave puts that Mutex in starvation mode for the
+// writers behind it; and readers that wait longer than the threshold
+// for writers make the writer that releases them hand them the
+// processor, as a Mutex in starvation mode hands it to the next waiter.
+//
+// Both modes end once a waiter is served within the threshold.
+// SetStarvationThreshold trades the throughput of normal mode against
+// the tail latency of waiters.
+
+var starvationNs int64 = starvationThresholdNs
+
+// SetStarvationThreshold sets to ns the time in nanoseconds a goroutine
+// waits for a Mutex or RWMutex before the lock switches to starvation
+// mode, and returns the previous setting. A threshold of zero or less
+// restores the default of one millisecond.
+func SetStarvationThreshold(ns int64) (old int64) {
+	if ns <= 0 {
+		ns = starvationThresholdNs
+	}
+	return atomic.SwapInt64(&starvationNs, ns)
+}
+
+// starvationThreshold returns the current starvation threshold.
+func starvationThreshold() int64 {
+	return atomic.LoadInt64(&starvationNs)
+}
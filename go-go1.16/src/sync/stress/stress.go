@@ -0,0 +1,285 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package stress provides torture tests for implementations of
+// sync.Locker, so that a custom lock can be put through the same paces as
+// sync.Mutex.
+//
+// Run locks a Locker from many goroutines at once, as described by a
+// Config, and checks that no two goroutines ever hold it together, that
+// an optional invariant on the data it guards holds, and optionally that
+// it is fair. Standard is a set of configurations that exercise a lock
+// the way the tests of package sync exercise Mutex:
+//
+//    for _, c := range stress.Standard {
+//        t.Run(c.Name, func(t *testing.T) {
+//            if _, err := stress.Run(NewSpinLock(), c); err != nil {
+//                t.Fatal(err)
+//            }
+//        })
+//    }
+package stress
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Dist is a distribution of durations, from which hold and think
+// times are drawn.
+type Dist func(r *rand.Rand) time.Duration
+
+// Fixed returns a Dist that always returns d.
+func Fixed(d time.Duration) Dist {
+	return func(*rand.Rand) time.Duration { return d }
+}
+
+// Uniform returns a Dist uniform over [min, max).
+func Uniform(min, max time.Duration) Dist {
+	if max <= min {
+		return Fixed(min)
+	}
+	return func(r *rand.Rand) time.Duration {
+		return min + time.Duration(r.Int63n(int64(max-min)))
+	}
+}
+
+// Exponential returns an exponential Dist with the given mean.
+func Exponential(mean time.Duration) Dist {
+	return func(r *rand.Rand) time.Duration {
+		return time.Duration(r.ExpFloat64() * float64(mean))
+	}
+}
+
+// A Config describes a torture test.
+type Config struct {
+	Name string // name of the test, for Standard
+
+	// Goroutines is the number of goroutines locking at once.
+	// The default is 4.
+	Goroutines int
+
+	// Iterations is the number of times each goroutine locks the
+	// lock. The default is 1000. It is ignored if Duration is set.
+	Iterations int
+
+	// Duration, if positive, makes the goroutines lock the lock
+	// repeatedly for that long rather than a fixed number of times.
+	Duration time.Duration
+
+	// Hold is how long a goroutine holds the lock, and Think how long
+	// it waits before locking it again. Nil means no time at all.
+	// Short times are spent spinning, long ones sleeping.
+	Hold, Think Dist
+
+	// Seed seeds the random numbers drawn from Hold and Think.
+	Seed int64
+
+	// Invariant, if not nil, is called with the lock held, right
+	// after it is locked and right before it is unlocked, and fails
+	// the test if it returns an error. The goroutine holding the lock
+	// is identified by g, from 0 to Goroutines-1, so that Invariant
+	// can change the guarded data as well as check it.
+	Invariant func(g int) error
+
+	// MaxWait, if positive, fails the test if any goroutine waits
+	// longer than that to lock the lock.
+	MaxWait time.Duration
+
+	// MinShare, if positive, fails the test if any goroutine locks
+	// the lock fewer than MinShare times its fair share of all the
+	// acquisitions. It makes sense only with Duration.
+	MinShare float64
+
+	// Timeout is how long the test may take before it fails as
+	// probably deadlocked. The default is one minute.
+	Timeout time.Duration
+}
+
+// Standard is a set of torture tests that exercise a lock the way the
+// tests of package sync exercise Mutex: without contention, with heavy
+// contention, with holds short and long, and for fairness between a
+// goroutine that keeps the lock busy and one that only wants it now and
+// then.
+var Standard = []Config{
+	{Name: "Uncontended", Goroutines: 1, Iterations: 10000},
+	{Name: "Contended", Goroutines: 8, Iterations: 2000},
+	{Name: "ShortHolds", Goroutines: 8, Iterations: 500, Hold: Uniform(0, 2*time.Microsecond), Think: Uniform(0, 2*time.Microsecond)},
+	{Name: "LongHolds", Goroutines: 4, Iterations: 50, Hold: Exponential(100 * time.Microsecond)},
+	{Name: "Fairness", Goroutines: 2, Duration: 100 * time.Millisecond, Hold: Fixed(100 * time.Microsecond), MaxWait: 10 * time.Second, MinShare: 0.1},
+}
+
+// A Result summarizes a torture test.
+type Result struct {
+	Acquisitions int64         // number of times the lock was locked
+	PerGoroutine []int64       // acquisitions by goroutine
+	MaxWait      time.Duration // longest wait to lock the lock
+	TotalWait    time.Duration // total time spent waiting to lock it
+	Elapsed      time.Duration // duration of the test
+}
+
+// Run runs the torture test c against l and returns its result, along
+// with an error describing the first failure, if any. If the test times
+// out, its goroutines are abandoned, blocked on l.
+func Run(l sync.Locker, c Config) (*Result, error) {
+	if c.Goroutines <= 0 {
+		c.Goroutines = 4
+	}
+	if c.Iterations <= 0 {
+		c.Iterations = 1000
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = time.Minute
+	}
+	t := &torture{
+		l:     l,
+		c:     &c,
+		waits: make([]time.Duration, c.Goroutines),
+		max:   make([]time.Duration, c.Goroutines),
+		res:   &Result{PerGoroutine: make([]int64, c.Goroutines)},
+	}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for g := 0; g < c.Goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			t.run(g)
+		}(g)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	var stop <-chan time.Time
+	if c.Duration > 0 {
+		stop = time.After(c.Duration)
+	}
+	timeout := time.NewTimer(c.Timeout)
+	defer timeout.Stop()
+	for done != nil {
+		select {
+		case <-done:
+			done = nil
+		case <-stop:
+			atomic.StoreInt32(&t.stop, 1)
+			stop = nil
+		case <-timeout.C:
+			atomic.StoreInt32(&t.stop, 1)
+			return nil, fmt.Errorf("stress: %s timed out after %v; the lock may be deadlocked", c.Name, c.Timeout)
+		}
+	}
+	res := t.res
+	res.Elapsed = time.Since(start)
+	for g, n := range res.PerGoroutine {
+		res.Acquisitions += n
+		res.TotalWait += t.waits[g]
+		if t.max[g] > res.MaxWait {
+			res.MaxWait = t.max[g]
+		}
+	}
+	if t.err != nil {
+		return res, t.err
+	}
+	if c.MaxWait > 0 && res.MaxWait > c.MaxWait {
+		return res, fmt.Errorf("stress: %s: a goroutine waited %v for the lock, longer than %v", c.Name, res.MaxWait, c.MaxWait)
+	}
+	if c.MinShare > 0 {
+		fair := float64(res.Acquisitions) / float64(c.Goroutines)
+		for g, n := range res.PerGoroutine {
+			if float64(n) < math.Ceil(c.MinShare*fair) {
+				return res, fmt.Errorf("stress: %s: goroutine %d locked the lock %d times of %d; want at least %.0f%% of its share", c.Name, g, n, res.Acquisitions, 100*c.MinShare)
+			}
+		}
+	}
+	return res, nil
+}
+
+// A torture is a running torture test.
+type torture struct {
+	l       sync.Locker
+	c       *Config
+	holders int32 // goroutines holding l
+	stop    int32 // set to make the goroutines return
+
+	mu  sync.Mutex
+	err error // first failure
+
+	// By goroutine, written only by that goroutine.
+	waits, max []time.Duration
+	res        *Result
+}
+
+func (t *torture) run(g int) {
+	c := t.c
+	r := rand.New(rand.NewSource(c.Seed + int64(g)))
+	for i := 0; c.Duration > 0 || i < c.Iterations; i++ {
+		if atomic.LoadInt32(&t.stop) != 0 {
+			return
+		}
+		if c.Think != nil {
+			pause(c.Think(r))
+		}
+		start := time.Now()
+		t.l.Lock()
+		wait := time.Since(start)
+		t.res.PerGoroutine[g]++
+		t.waits[g] += wait
+		if wait > t.max[g] {
+			t.max[g] = wait
+		}
+		ok := t.check(g, atomic.AddInt32(&t.holders, 1))
+		if ok && c.Hold != nil {
+			pause(c.Hold(r))
+		}
+		ok = ok && t.check(g, atomic.LoadInt32(&t.holders))
+		atomic.AddInt32(&t.holders, -1)
+		t.l.Unlock()
+		if !ok {
+			return
+		}
+	}
+}
+
+// check checks the lock's guarantees while goroutine g holds it, with
+// holders goroutines holding it, and records the failure if there is one.
+func (t *torture) check(g int, holders int32) bool {
+	var err error
+	if holders != 1 {
+		err = fmt.Errorf("stress: %s: mutual exclusion violated: %d goroutines held the lock at once", t.c.Name, holders)
+	} else if t.c.Invariant != nil {
+		if err = t.c.Invariant(g); err != nil {
+			err = fmt.Errorf("stress: %s: goroutine %d: %v", t.c.Name, g, err)
+		}
+	}
+	if err == nil {
+		return true
+	}
+	t.mu.Lock()
+	if t.err == nil {
+		t.err = err
+	}
+	t.mu.Unlock()
+	atomic.StoreInt32(&t.stop, 1)
+	return false
+}
+
+// pause spends d, spinning if it is short enough that sleeping would
+// take much longer.
+func pause(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	if d >= 50*time.Microsecond {
+		time.Sleep(d)
+		return
+	}
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
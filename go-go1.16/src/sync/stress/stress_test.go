@@ -0,0 +1,88 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stress_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	. "sync/stress"
+	"testing"
+	"time"
+)
+
+func TestStandard(t *testing.T) {
+	for _, l := range []struct {
+		name string
+		new  func() sync.Locker
+	}{
+		{"Mutex", func() sync.Locker { return new(sync.Mutex) }},
+		{"RWMutex", func() sync.Locker { return new(sync.RWMutex) }},
+	} {
+		for _, c := range Standard {
+			t.Run(l.name+"/"+c.Name, func(t *testing.T) {
+				res, err := Run(l.new(), c)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if c.Duration == 0 && res.Acquisitions != int64(c.Goroutines*c.Iterations) {
+					t.Errorf("%d acquisitions; want %d", res.Acquisitions, c.Goroutines*c.Iterations)
+				}
+			})
+		}
+	}
+}
+
+// noLock is a Locker that does not lock.
+type noLock struct{}
+
+func (noLock) Lock()   {}
+func (noLock) Unlock() {}
+
+func TestMutualExclusionViolated(t *testing.T) {
+	_, err := Run(noLock{}, Config{Name: "broken", Goroutines: 4, Iterations: 100, Hold: Fixed(100 * time.Microsecond)})
+	if err == nil || !strings.Contains(err.Error(), "mutual exclusion violated") {
+		t.Fatalf("Run with a lock that does not lock: %v", err)
+	}
+}
+
+func TestInvariant(t *testing.T) {
+	var mu sync.Mutex
+	n := 0
+	_, err := Run(&mu, Config{
+		Goroutines: 4,
+		Iterations: 100,
+		Invariant: func(g int) error {
+			n++
+			if n == 150 {
+				return errors.New("bad state")
+			}
+			return nil
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "bad state") {
+		t.Fatalf("Run with a failing invariant: %v", err)
+	}
+}
+
+func TestMaxWait(t *testing.T) {
+	var mu sync.Mutex
+	mu.Lock()
+	time.AfterFunc(50*time.Millisecond, mu.Unlock)
+	res, err := Run(&mu, Config{Goroutines: 1, Iterations: 1, MaxWait: 10 * time.Millisecond})
+	if err == nil || res.MaxWait < 50*time.Millisecond {
+		t.Fatalf("Run with a wait of 50ms and MaxWait of 10ms: %v, max wait %v", err, res.MaxWait)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	var mu sync.Mutex
+	mu.Lock()
+	defer mu.Unlock()
+	_, err := Run(&mu, Config{Goroutines: 1, Timeout: 10 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "deadlocked") {
+		t.Fatalf("Run on a lock that is never unlocked: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A StripedRWMutex is a set of reader/writer locks, the stripes, for
+// read-mostly data split into shards by key: an operation on a key
+// locks only the stripe the key hashes to, so operations on keys of
+// different stripes do not contend, while an operation on the whole
+// data locks every stripe.
+//
+// The stripes are always locked in one order, so whole-data operations
+// do not deadlock with each other. An operation on a key holds a single
+// stripe, so it does not deadlock with them either; a goroutine must
+// not lock a stripe while it holds another, except through LockKeys,
+// which takes care of the order. To keep the shards of the data in line
+// with the stripes, shard it by Stripe.
+//
+// Keys must be comparable, as for map keys.
+//
+// A StripedRWMutex must be created with NewStripedRWMutex and must not
+// be copied after first use.
+type StripedRWMutex struct {
+	stripes []PaddedRWMutex
+	seed    uintptr
+}
+
+// NewStripedRWMutex returns a new StripedRWMutex with n stripes, rounded
+// up to a power of two, or with four per GOMAXPROCS if n is zero or
+// less.
+func NewStripedRWMutex(n int) *StripedRWMutex {
+	if n <= 0 {
+		n = 4 * runtime_gomaxprocs()
+	}
+	size := 1
+	for size < n {
+		size *= 2
+	}
+	return &StripedRWMutex{
+		stripes: make([]PaddedRWMutex, size),
+		seed:    uintptr(fastrand()),
+	}
+}
+
+// Stripes returns the number of stripes of s.
+func (s *StripedRWMutex) Stripes() int {
+	return len(s.stripes)
+}
+
+// Stripe returns the index, from 0 to s.Stripes()-1, of the stripe
+// that guards key.
+func (s *StripedRWMutex) Stripe(key interface{}) int {
+	return int(runtime_efaceHash(key, s.seed) & uintptr(len(s.stripes)-1))
+}
+
+// RLockKey locks the stripe of key for reading.
+func (s *StripedRWMutex) RLockKey(key interface{}) {
+	s.stripes[s.Stripe(key)].RLock()
+}
+
+// RUnlockKey undoes a single RLockKey call for key.
+func (s *StripedRWMutex) RUnlockKey(key interface{}) {
+	s.stripes[s.Stripe(key)].RUnlock()
+}
+
+// LockKey locks the stripe of key for writing.
+func (s *StripedRWMutex) LockKey(key interface{}) {
+	s.stripes[s.Stripe(key)].Lock()
+}
+
+// UnlockKey unlocks the stripe of key for writing.
+func (s *StripedRWMutex) UnlockKey(key interface{}) {
+	s.stripes[s.Stripe(key)].Unlock()
+}
+
+// LockKeys locks for writing the stripes of all of keys, in the order
+// of s, for an operation on several keys at once, such as a transfer
+// between two accounts. It returns a function that unlocks them.
+func (s *StripedRWMutex) LockKeys(keys ...interface{}) (unlock func()) {
+	idx := make([]int, len(keys))
+	for i, key := range keys {
+		idx[i] = s.Stripe(key)
+	}
+	sortSlice(len(idx), func(i, j int) bool { return idx[i] < idx[j] }, func(i, j int) { idx[i], idx[j] = idx[j], idx[i] })
+	n := 0
+	for i, x := range idx {
+		if i > 0 && x == idx[n-1] {
+			continue
+		}
+		s.stripes[x].Lock()
+		idx[n] = x
+		n++
+	}
+	idx = idx[:n]
+	return func() {
+		for i := len(idx) - 1; i >= 0; i-- {
+			s.stripes[idx[i]].Unlock()
+		}
+	}
+}
+
+// RLockAll locks every stripe for reading, for an operation that reads
+// the whole data, such as a consistent snapshot: it waits for the
+// writers of all keys, and keeps them out until RUnlockAll, while
+// readers of keys go on.
+func (s *StripedRWMutex) RLockAll() {
+	for i := range s.stripes {
+		s.stripes[i].RLock()
+	}
+}
+
+// RUnlockAll undoes a single RLockAll call.
+func (s *StripedRWMutex) RUnlockAll() {
+	for i := len(s.stripes) - 1; i >= 0; i-- {
+		s.stripes[i].RUnlock()
+	}
+}
+
+// LockAll locks every stripe for writing, for an operation that changes
+// the whole data, such as clearing it or resizing its shards.
+func (s *StripedRWMutex) LockAll() {
+	for i := range s.stripes {
+		s.stripes[i].Lock()
+	}
+}
+
+// UnlockAll unlocks every stripe for writing.
+func (s *StripedRWMutex) UnlockAll() {
+	for i := len(s.stripes) - 1; i >= 0; i-- {
+		s.stripes[i].Unlock()
+	}
+}
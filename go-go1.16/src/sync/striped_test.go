@@ -0,0 +1,67 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"testing"
+)
+
+func TestStripedRWMutex(t *testing.T) {
+	s := NewStripedRWMutex(6)
+	if n := s.Stripes(); n != 8 {
+		t.Fatalf("Stripes = %d; want 8", n)
+	}
+	for _, key := range []interface{}{"a", 1, struct{ x, y int }{1, 2}} {
+		if i, j := s.Stripe(key), s.Stripe(key); i != j || i < 0 || i >= 8 {
+			t.Fatalf("Stripe(%v) = %d, then %d", key, i, j)
+		}
+	}
+
+	// Shards guarded by the stripes; a snapshot under RLockAll must see
+	// each transfer whole.
+	shards := make([]map[int]int, s.Stripes())
+	for i := range shards {
+		shards[i] = make(map[int]int)
+	}
+	const accounts = 100
+	for k := 0; k < accounts; k++ {
+		shards[s.Stripe(k)][k] = 10
+	}
+	done := make(chan bool)
+	for g := 0; g < 4; g++ {
+		go func(g int) {
+			for i := 0; i < 1000; i++ {
+				from, to := (g+i)%accounts, (g*7+i*3)%accounts
+				unlock := s.LockKeys(from, to)
+				shards[s.Stripe(from)][from]--
+				shards[s.Stripe(to)][to]++
+				unlock()
+				s.RLockKey(to)
+				_ = shards[s.Stripe(to)][to]
+				s.RUnlockKey(to)
+			}
+			done <- true
+		}(g)
+	}
+	for i := 0; i < 100; i++ {
+		s.RLockAll()
+		total := 0
+		for _, shard := range shards {
+			for _, v := range shard {
+				total += v
+			}
+		}
+		s.RUnlockAll()
+		if total != 10*accounts {
+			t.Fatalf("snapshot total = %d; want %d", total, 10*accounts)
+		}
+	}
+	for g := 0; g < 4; g++ {
+		<-done
+	}
+	s.LockAll()
+	s.UnlockAll()
+}
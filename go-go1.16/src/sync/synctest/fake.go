@@ -0,0 +1,266 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package synctest
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// The fakes below stand in for the primitives of package sync in unit
+// tests of code that takes them through interfaces. They never block:
+// a FakeLocker panics where a real lock would deadlock, a FakeSemaphore
+// grants or denies each request as scripted, and a FakeOnce can be
+// completed and reset at will. Fakes that share a Recorder log their
+// calls to it in order, so that a test can check, for instance, that two
+// locks are always taken in the same order.
+
+// A Recorder records the calls made on fakes that share it.
+// The zero Recorder is ready for use.
+type Recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+// Calls returns the calls recorded so far, in order, each as the name
+// of the fake, a dot and the call, such as "a.Lock" or
+// "sem.Acquire(2)".
+func (r *Recorder) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+// Reset forgets the calls recorded so far.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.calls = nil
+	r.mu.Unlock()
+}
+
+func (r *Recorder) record(name, call string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.calls = append(r.calls, name+"."+call)
+	r.mu.Unlock()
+}
+
+// A FakeLocker is a sync.Locker that records its calls and panics on
+// misuse: locking it while it is locked, which would block forever in a
+// single-goroutine test, or unlocking it while it is unlocked.
+type FakeLocker struct {
+	Name     string    // name of the lock in recorded calls
+	Recorder *Recorder // if not nil, where calls are recorded
+
+	mu     sync.Mutex
+	locked bool
+	locks  int
+}
+
+// Lock marks l locked.
+func (l *FakeLocker) Lock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locked {
+		panic("synctest: Lock of locked FakeLocker " + strconv.Quote(l.Name))
+	}
+	l.locked = true
+	l.locks++
+	l.Recorder.record(l.Name, "Lock")
+}
+
+// Unlock marks l unlocked.
+func (l *FakeLocker) Unlock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.locked {
+		panic("synctest: Unlock of unlocked FakeLocker " + strconv.Quote(l.Name))
+	}
+	l.locked = false
+	l.Recorder.record(l.Name, "Unlock")
+}
+
+// Locked reports whether l is locked.
+func (l *FakeLocker) Locked() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.locked
+}
+
+// Locks returns the number of times l has been locked.
+func (l *FakeLocker) Locks() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.locks
+}
+
+// A FakeSemaphore has the methods of a sync.Semaphore, but grants or
+// denies each Acquire, AcquirePriority and TryAcquire as scripted by
+// Script, regardless of its weight and priority. Requests beyond the script are granted.
+type FakeSemaphore struct {
+	Name     string    // name of the semaphore in recorded calls
+	Recorder *Recorder // if not nil, where calls are recorded
+
+	mu     sync.Mutex
+	script []bool
+	held   int64
+}
+
+// Script appends outcomes for the next requests: true grants one and
+// false denies it.
+func (s *FakeSemaphore) Script(grants ...bool) {
+	s.mu.Lock()
+	s.script = append(s.script, grants...)
+	s.mu.Unlock()
+}
+
+func (s *FakeSemaphore) next(call string, n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ok := true
+	if len(s.script) > 0 {
+		ok = s.script[0]
+		s.script = s.script[1:]
+	}
+	if ok {
+		s.held += n
+	}
+	s.Recorder.record(s.Name, call+"("+strconv.FormatInt(n, 10)+")="+strconv.FormatBool(ok))
+	return ok
+}
+
+// Acquire takes the next outcome from the script. If the request is
+// denied, it returns ctx.Err(), or context.DeadlineExceeded if ctx is
+// not done, as if ctx had expired while waiting.
+func (s *FakeSemaphore) Acquire(ctx sync.Context, n int64) error {
+	return s.acquire(ctx, "Acquire", n)
+}
+
+// AcquirePriority is Acquire, recorded as a call of AcquirePriority.
+func (s *FakeSemaphore) AcquirePriority(ctx sync.Context, n int64, prio int) error {
+	return s.acquire(ctx, "AcquirePriority", n)
+}
+
+func (s *FakeSemaphore) acquire(ctx sync.Context, call string, n int64) error {
+	if s.next(call, n) {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return context.DeadlineExceeded
+}
+
+// TryAcquire takes the next outcome from the script and reports it.
+func (s *FakeSemaphore) TryAcquire(n int64) bool {
+	return s.next("TryAcquire", n)
+}
+
+// Release releases a weight of n. Like sync.Semaphore, it panics if
+// that is more than is held.
+func (s *FakeSemaphore) Release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Recorder.record(s.Name, "Release("+strconv.FormatInt(n, 10)+")")
+	if n > s.held {
+		panic("synctest: FakeSemaphore " + strconv.Quote(s.Name) + " released more than held")
+	}
+	s.held -= n
+}
+
+// Held returns the weight granted and not yet released.
+func (s *FakeSemaphore) Held() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.held
+}
+
+// A FakeOnce has the methods of a sync.Once, and can be completed
+// without calling a function and reset to call one again. Unlike a
+// sync.Once, a Do that finds the function running does not wait for it.
+type FakeOnce struct {
+	Name     string    // name of the Once in recorded calls
+	Recorder *Recorder // if not nil, where calls are recorded
+
+	mu    sync.Mutex
+	done  bool
+	ch    chan struct{} // closed when done
+	calls int
+}
+
+// Do calls f unless o is done, and marks o done.
+func (o *FakeOnce) Do(f func()) {
+	o.mu.Lock()
+	run := !o.done
+	o.Recorder.record(o.Name, "Do="+strconv.FormatBool(run))
+	if run {
+		o.done = true
+		o.calls++
+	}
+	o.mu.Unlock()
+	if run {
+		defer o.closeDone()
+		f()
+	}
+}
+
+// Complete marks o done without calling a function, as if another
+// goroutine had already run Do.
+func (o *FakeOnce) Complete() {
+	o.mu.Lock()
+	o.done = true
+	o.mu.Unlock()
+	o.closeDone()
+}
+
+// Reset makes o not done, so that the next Do calls its function.
+func (o *FakeOnce) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.done = false
+	if o.ch != nil {
+		select {
+		case <-o.ch:
+			o.ch = nil
+		default:
+		}
+	}
+}
+
+// Done returns a channel that is closed once o is done.
+func (o *FakeOnce) Done() <-chan struct{} {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.ch == nil {
+		o.ch = make(chan struct{})
+		if o.done {
+			close(o.ch)
+		}
+	}
+	return o.ch
+}
+
+// Calls returns the number of functions o has called.
+func (o *FakeOnce) Calls() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.calls
+}
+
+func (o *FakeOnce) closeDone() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.ch == nil {
+		return
+	}
+	select {
+	case <-o.ch:
+	default:
+		close(o.ch)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package synctest_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	. "sync/synctest"
+	"testing"
+)
+
+// The fakes have the method sets of what they fake.
+var (
+	_ sync.Locker = (*FakeLocker)(nil)
+	_ semaphore   = (*FakeSemaphore)(nil)
+	_ semaphore   = (*sync.Semaphore)(nil)
+	_ once        = (*FakeOnce)(nil)
+	_ once        = (*sync.Once)(nil)
+)
+
+type semaphore interface {
+	Acquire(ctx sync.Context, n int64) error
+	TryAcquire(n int64) bool
+	Release(n int64)
+}
+
+type once interface {
+	Do(f func())
+	Done() <-chan struct{}
+}
+
+// mustPanic calls f and fails if it does not panic.
+func mustPanic(t *testing.T, what string, f func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s did not panic", what)
+		}
+	}()
+	f()
+}
+
+func TestFakeLocker(t *testing.T) {
+	var r Recorder
+	a := &FakeLocker{Name: "a", Recorder: &r}
+	b := &FakeLocker{Name: "b", Recorder: &r}
+	a.Lock()
+	b.Lock()
+	if !a.Locked() || !b.Locked() {
+		t.Fatal("locks not locked after Lock")
+	}
+	b.Unlock()
+	a.Unlock()
+	want := []string{"a.Lock", "b.Lock", "b.Unlock", "a.Unlock"}
+	if got := r.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Calls() = %q; want %q", got, want)
+	}
+	if a.Locks() != 1 || a.Locked() {
+		t.Errorf("a: %d locks, locked %v; want 1, false", a.Locks(), a.Locked())
+	}
+	mustPanic(t, "Unlock of unlocked FakeLocker", a.Unlock)
+	a.Lock()
+	mustPanic(t, "Lock of locked FakeLocker", a.Lock)
+	r.Reset()
+	if got := r.Calls(); len(got) != 0 {
+		t.Errorf("Calls() after Reset = %q", got)
+	}
+}
+
+func TestFakeSemaphore(t *testing.T) {
+	var r Recorder
+	s := &FakeSemaphore{Name: "sem", Recorder: &r}
+	s.Script(true, false, false)
+	if err := s.Acquire(context.Background(), 2); err != nil {
+		t.Fatalf("scripted grant: Acquire = %v", err)
+	}
+	if err := s.Acquire(context.Background(), 1); err != context.DeadlineExceeded {
+		t.Fatalf("scripted denial: Acquire = %v; want DeadlineExceeded", err)
+	}
+	if s.TryAcquire(1) {
+		t.Fatal("scripted denial: TryAcquire succeeded")
+	}
+	if !s.TryAcquire(3) {
+		t.Fatal("past the script: TryAcquire failed")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Script(false)
+	if err := s.Acquire(ctx, 1); err != context.Canceled {
+		t.Fatalf("denial with canceled ctx: Acquire = %v; want Canceled", err)
+	}
+	if s.Held() != 5 {
+		t.Fatalf("Held() = %d; want 5", s.Held())
+	}
+	s.Release(5)
+	mustPanic(t, "Release of more than held", func() { s.Release(1) })
+	want := []string{
+		"sem.Acquire(2)=true", "sem.Acquire(1)=false", "sem.TryAcquire(1)=false",
+		"sem.TryAcquire(3)=true", "sem.Acquire(1)=false", "sem.Release(5)", "sem.Release(1)",
+	}
+	if got := r.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Calls() = %q; want %q", got, want)
+	}
+}
+
+func TestFakeOnce(t *testing.T) {
+	var o FakeOnce
+	done := o.Done()
+	n := 0
+	o.Do(func() { n++ })
+	o.Do(func() { n++ })
+	if n != 1 || o.Calls() != 1 {
+		t.Fatalf("after two Do calls: ran %d times, Calls() = %d; want 1", n, o.Calls())
+	}
+	select {
+	case <-done:
+	default:
+		t.Fatal("Done not closed after Do")
+	}
+
+	o.Reset()
+	select {
+	case <-o.Done():
+		t.Fatal("Done closed after Reset")
+	default:
+	}
+	o.Do(func() { n++ })
+	if n != 2 {
+		t.Fatalf("Do after Reset did not call f")
+	}
+
+	o.Reset()
+	done = o.Done()
+	o.Complete()
+	<-done
+	o.Do(func() { n++ })
+	if n != 2 || o.Calls() != 2 {
+		t.Errorf("Do after Complete called f")
+	}
+}
@@ -0,0 +1,428 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package synctest runs tests of concurrent code under a controlled
+// scheduler, so that an interleaving that exposes a bug can be found
+// systematically and reproduced exactly.
+//
+// Under the scheduler only one goroutine runs at a time. It runs until it
+// blocks in a Mutex, RWMutex or WaitGroup of package sync, starts to lock
+// or unlock a contended Mutex, calls Yield or exits. The scheduler then
+// picks the next goroutine to run. Run picks at random from a seed,
+// Explore tries every sequence of choices in turn, and Replay repeats the
+// choices recorded in an Error:
+//
+//    err := synctest.Run(seed, func() {
+//        var mu sync.Mutex
+//        n := 0
+//        for i := 0; i < 2; i++ {
+//            synctest.Go(func() {
+//                mu.Lock()
+//                v := n
+//                mu.Unlock()
+//                synctest.Yield()
+//                mu.Lock()
+//                n = v + 1
+//                mu.Unlock()
+//            })
+//        }
+//    })
+//
+// Every goroutine that uses the locks under test must be started with Go.
+// The goroutines may block only in the primitives listed above; one that
+// blocks elsewhere, for instance on a channel or in a Cond, stalls the
+// scheduler, and the run fails after a timeout. A run also fails if a
+// goroutine panics or if all goroutines are blocked. Goroutines left
+// blocked by a failed run are abandoned.
+//
+// The package also provides fakes of the sync primitives, which let unit
+// tests check how code uses them without blocking; see FakeLocker.
+//
+// A run is reproducible as long as the goroutines' behavior depends only
+// on the order in which they run. Mutex switches to starvation mode based
+// on real time, so a Replay may occasionally diverge from the run that
+// recorded the schedule.
+package synctest
+
+import (
+	"fmt"
+	"internal/synchook"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// A Schedule is the sequence of choices a scheduler made. Each entry is
+// the index of the goroutine it picked among those ready to run, counting
+// in the order they were started from the one after the goroutine that ran
+// last, so that 0 picks goroutines round-robin. Choices between fewer than
+// two goroutines are not recorded.
+type Schedule []int
+
+// An Error describes a failed run.
+type Error struct {
+	Schedule Schedule // the choices made up to the failure, for Replay
+	Msg      string   // what went wrong
+}
+
+func (e *Error) Error() string {
+	return "synctest: " + e.Msg + " (schedule " + fmt.Sprint([]int(e.Schedule)) + ")"
+}
+
+// Run calls f in a new goroutine under a scheduler that picks the next
+// goroutine to run at random, using seed. It returns when f and all the
+// goroutines it started with Go have exited, or when the run fails, in
+// which case the error is an *Error. Only one run may be active at a time.
+func Run(seed int64, f func()) error {
+	r := rand.New(rand.NewSource(seed))
+	return run(r.Intn, f)
+}
+
+// Replay calls f like Run, but makes the choices in s, and then picks
+// goroutines round-robin.
+func Replay(s Schedule, f func()) error {
+	k := 0
+	return run(func(n int) int {
+		i := 0
+		if k < len(s) {
+			i = s[k]
+			k++
+		}
+		if i >= n {
+			i = n - 1
+		}
+		return i
+	}, f)
+}
+
+// Explore calls f like Run once for each sequence of choices, depth
+// first, until a run fails or all sequences have been tried. If limit is
+// positive, it stops after that many runs. It returns the number of runs
+// and the error from the failed run, if any.
+func Explore(limit int, f func()) (runs int, err error) {
+	type choice struct{ i, n int }
+	var trail []choice
+	for limit <= 0 || runs < limit {
+		k := 0
+		err := run(func(n int) int {
+			if k == len(trail) {
+				trail = append(trail, choice{0, n})
+			}
+			c := &trail[k]
+			k++
+			c.n = n
+			if c.i >= n {
+				c.i = n - 1
+			}
+			return c.i
+		}, f)
+		runs++
+		if err != nil {
+			return runs, err
+		}
+		trail = trail[:k]
+		for len(trail) > 0 && trail[len(trail)-1].i+1 >= trail[len(trail)-1].n {
+			trail = trail[:len(trail)-1]
+		}
+		if len(trail) == 0 {
+			break
+		}
+		trail[len(trail)-1].i++
+	}
+	return runs, nil
+}
+
+// Go starts f in a new goroutine under the scheduler. It must be called
+// from a goroutine running under Run, Replay or Explore.
+func Go(f func()) {
+	s := current()
+	if s == nil || !s.call(event{kind: evSpawn, f: f}) {
+		panic("synctest: Go called outside a run")
+	}
+}
+
+// Yield lets the scheduler run another goroutine. Outside a run, it does
+// nothing.
+func Yield() {
+	if s := current(); s != nil {
+		s.call(event{kind: evYield})
+	}
+}
+
+// stallTimeout is how long the scheduler waits for the running goroutine
+// to reach a scheduling point before failing the run.
+const stallTimeout = 10 * time.Second
+
+var (
+	active int32        // 1 while a run is active
+	cur    atomic.Value // *scheduler of the active run
+)
+
+func current() *scheduler {
+	s, _ := cur.Load().(*scheduler)
+	return s
+}
+
+type gstate uint8
+
+const (
+	gRunnable gstate = iota
+	gRunning
+	gParked
+	gDone
+)
+
+// A g is a goroutine under the scheduler.
+type g struct {
+	id     int // 1 + the number of goroutines started before it
+	goid   int64
+	state  gstate
+	resume chan bool // where to send the go-ahead when picked
+}
+
+type eventKind uint8
+
+const (
+	evStart eventKind = iota // a new goroutine is ready to run
+	evYield                  // the goroutine is ready to run again
+	evPark                   // the goroutine is about to block
+	evWoken                  // the goroutine stopped blocking
+	evWake                   // the goroutine is about to wake another
+	evSpawn                  // the goroutine starts another
+	evExit                   // the goroutine exited
+)
+
+type event struct {
+	kind  eventKind
+	goid  int64
+	g     *g        // for evStart
+	f     func()    // for evSpawn
+	msg   string    // for evExit: why the goroutine failed, if it did
+	reply chan bool // true if the goroutine is under the scheduler
+}
+
+type scheduler struct {
+	choose  func(n int) int
+	events  chan event
+	quit    chan struct{} // closed when the run is over
+	gs      []*g
+	byGoid  map[int64]*g
+	running *g
+	last    int // id of the goroutine that ran last
+	pending int // wake-ups and starts that have not arrived yet
+	trail   Schedule
+	err     *Error
+}
+
+func run(choose func(n int) int, f func()) error {
+	if !atomic.CompareAndSwapInt32(&active, 0, 1) {
+		panic("synctest: concurrent runs")
+	}
+	defer atomic.StoreInt32(&active, 0)
+	s := &scheduler{
+		choose: choose,
+		events: make(chan event),
+		quit:   make(chan struct{}),
+		byGoid: make(map[int64]*g),
+	}
+	cur.Store(s)
+	synchook.Set(s.hook)
+	s.loop(f)
+	synchook.Set(nil)
+	cur.Store((*scheduler)(nil))
+	close(s.quit)
+	if s.err != nil {
+		return s.err
+	}
+	return nil
+}
+
+func (s *scheduler) hook(p synchook.Point, addr unsafe.Pointer) {
+	switch p {
+	case synchook.Preempt:
+		s.call(event{kind: evYield})
+	case synchook.Park:
+		s.call(event{kind: evPark})
+	case synchook.Woken:
+		s.call(event{kind: evWoken})
+	case synchook.Wake:
+		s.call(event{kind: evWake})
+	}
+}
+
+// call sends ev to the scheduler and waits for its reply. It reports
+// whether the calling goroutine is under the scheduler.
+func (s *scheduler) call(ev event) bool {
+	if ev.goid == 0 {
+		ev.goid = goid()
+	}
+	ev.reply = make(chan bool, 1)
+	select {
+	case s.events <- ev:
+	case <-s.quit:
+		return false
+	}
+	if ev.kind == evExit {
+		return true
+	}
+	select {
+	case ok := <-ev.reply:
+		return ok
+	case <-s.quit:
+		return false
+	}
+}
+
+func (s *scheduler) loop(f func()) {
+	s.spawn(f)
+	timer := time.NewTimer(stallTimeout)
+	defer timer.Stop()
+	for {
+		if s.running == nil && s.pending == 0 && !s.next() {
+			return
+		}
+		select {
+		case ev := <-s.events:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(stallTimeout)
+			s.handle(ev)
+		case <-timer.C:
+			msg := "a goroutine being woken did not return"
+			if s.running != nil {
+				msg = "goroutine " + strconv.Itoa(s.running.id) + " blocked outside the scheduler"
+			}
+			s.fail(msg)
+			return
+		}
+	}
+}
+
+func (s *scheduler) spawn(f func()) {
+	ng := &g{id: len(s.gs) + 1}
+	s.gs = append(s.gs, ng)
+	s.pending++
+	go func() {
+		exited := false
+		defer func() {
+			var msg string
+			if !exited {
+				msg = "goroutine " + strconv.Itoa(ng.id) + " panicked: " + fmt.Sprint(recover())
+			}
+			s.call(event{kind: evExit, goid: ng.goid, msg: msg})
+		}()
+		ng.goid = goid()
+		s.call(event{kind: evStart, goid: ng.goid, g: ng})
+		f()
+		exited = true
+	}()
+}
+
+func (s *scheduler) handle(ev event) {
+	g := s.byGoid[ev.goid]
+	if ev.kind == evStart {
+		g = ev.g
+		g.goid = ev.goid
+		s.byGoid[g.goid] = g
+	}
+	if g == nil {
+		// Not ours; let it go on unscheduled.
+		ev.reply <- false
+		return
+	}
+	switch ev.kind {
+	case evStart, evWoken:
+		if s.pending > 0 {
+			s.pending--
+		}
+		g.state = gRunnable
+		g.resume = ev.reply
+	case evYield:
+		g.state = gRunnable
+		g.resume = ev.reply
+		s.running = nil
+	case evPark:
+		g.state = gParked
+		s.running = nil
+		ev.reply <- true
+	case evWake:
+		s.pending++
+		ev.reply <- true
+	case evSpawn:
+		s.spawn(ev.f)
+		ev.reply <- true
+	case evExit:
+		g.state = gDone
+		delete(s.byGoid, g.goid)
+		if s.running == g {
+			s.running = nil
+		}
+		if ev.msg != "" {
+			s.fail(ev.msg)
+		}
+	}
+}
+
+// next picks the goroutine to run next. It reports false if there is none
+// because the run is over.
+func (s *scheduler) next() bool {
+	var ready []*g
+	for i := range s.gs {
+		if g := s.gs[(s.last+i)%len(s.gs)]; g.state == gRunnable {
+			ready = append(ready, g)
+		}
+	}
+	if len(ready) == 0 {
+		var msg string
+		for _, g := range s.gs {
+			if g.state == gParked {
+				if msg != "" {
+					msg += ", "
+				}
+				msg += strconv.Itoa(g.id)
+			}
+		}
+		if msg != "" {
+			s.fail("all goroutines are blocked: " + msg)
+		}
+		return false
+	}
+	i := 0
+	if len(ready) > 1 {
+		i = s.choose(len(ready))
+		s.trail = append(s.trail, i)
+	}
+	g := ready[i]
+	g.state = gRunning
+	s.running = g
+	s.last = g.id
+	g.resume <- true
+	return true
+}
+
+// fail records the first failure of the run.
+func (s *scheduler) fail(msg string) {
+	if s.err == nil {
+		s.err = &Error{Schedule: append(Schedule(nil), s.trail...), Msg: msg}
+	}
+}
+
+// goid returns the ID of the calling goroutine.
+func goid() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = b[len("goroutine "):]
+	var id int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + int64(c-'0')
+	}
+	return id
+}
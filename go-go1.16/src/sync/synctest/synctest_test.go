@@ -0,0 +1,145 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package synctest_test
+
+import (
+	"strings"
+	"sync"
+	. "sync/synctest"
+	"testing"
+)
+
+// lostUpdate increments a counter from two goroutines without holding the
+// lock across the read and the write, and panics if an update is lost.
+func lostUpdate() {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	n := 0
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		Go(func() {
+			defer wg.Done()
+			mu.Lock()
+			v := n
+			mu.Unlock()
+			Yield()
+			mu.Lock()
+			n = v + 1
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	if n != 2 {
+		panic("lost update")
+	}
+}
+
+func TestExploreFindsBug(t *testing.T) {
+	runs, err := Explore(0, lostUpdate)
+	e, ok := err.(*Error)
+	if !ok || !strings.Contains(e.Msg, "lost update") {
+		t.Fatalf("Explore = %d, %v; want lost update", runs, err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := Replay(e.Schedule, lostUpdate); err == nil || err.Error() != e.Error() {
+			t.Fatalf("Replay(%v) = %v; want %v", e.Schedule, err, e)
+		}
+	}
+}
+
+func TestExploreAll(t *testing.T) {
+	var mu sync.RWMutex
+	n := 0
+	runs, err := Explore(0, func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			Go(func() {
+				defer wg.Done()
+				mu.Lock()
+				v := n
+				Yield()
+				n = v + 1
+				mu.Unlock()
+				Yield()
+				mu.RLock()
+				_ = n
+				mu.RUnlock()
+			})
+		}
+		wg.Wait()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs < 2 || n != 2*runs {
+		t.Fatalf("Explore made %d runs and %d increments; want several runs, 2 increments each", runs, n)
+	}
+	if r, _ := Explore(2, func() { Go(func() {}); Yield() }); r != 2 {
+		t.Errorf("Explore with limit 2 made %d runs", r)
+	}
+}
+
+func TestDeadlock(t *testing.T) {
+	_, err := Explore(0, func() {
+		var a, b sync.Mutex
+		Go(func() {
+			a.Lock()
+			Yield()
+			b.Lock()
+			b.Unlock()
+			a.Unlock()
+		})
+		b.Lock()
+		Yield()
+		a.Lock()
+		a.Unlock()
+		b.Unlock()
+	})
+	if e, ok := err.(*Error); !ok || !strings.Contains(e.Msg, "all goroutines are blocked: 1, 2") {
+		t.Fatalf("Explore = %v; want deadlock of goroutines 1 and 2", err)
+	}
+}
+
+func TestRunSeed(t *testing.T) {
+	trace := func(seed int64) string {
+		var order []string
+		err := Run(seed, func() {
+			for _, name := range []string{"a", "b", "c"} {
+				name := name
+				Go(func() {
+					for i := 0; i < 3; i++ {
+						order = append(order, name)
+						Yield()
+					}
+				})
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(order, "")
+	}
+	seen := make(map[string]bool)
+	for seed := int64(0); seed < 10; seed++ {
+		s := trace(seed)
+		if s2 := trace(seed); s2 != s {
+			t.Fatalf("seed %d: runs went %s and %s", seed, s, s2)
+		}
+		seen[s] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("10 seeds gave only %d interleavings", len(seen))
+	}
+}
+
+func TestGoOutsideRun(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Go outside a run did not panic")
+		}
+	}()
+	Go(func() {})
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// Interface to timers implemented in package runtime.
+// Must be in sync with ../runtime/time.go:/^type timer
+// and ../time/sleep.go:/^type runtimeTimer.
+type runtimeTimer struct {
+	pp       uintptr
+	when     int64
+	period   int64
+	f        func(interface{}, uintptr) // NOTE: must not be closure
+	arg      interface{}
+	seq      uintptr
+	nextwhen int64
+	status   uint32
+}
+
+// Implemented in runtime.
+func runtime_startTimer(t *runtimeTimer)
+func runtime_stopTimer(t *runtimeTimer) bool
+
+// timerWhen returns the runtime_nanotime value d nanoseconds from now,
+// for the when field of a runtimeTimer. See time.when.
+func timerWhen(d int64) int64 {
+	if d <= 0 {
+		return runtime_nanotime()
+	}
+	t := runtime_nanotime() + d
+	if t < 0 {
+		t = 1<<63 - 1 // math.MaxInt64
+	}
+	return t
+}
+
+// startCloseTimer starts a timer of the package's clock that closes ch in
+// d nanoseconds. Calling stop stops it, as runtime_stopTimer does.
+func startCloseTimer(d int64, ch chan struct{}) (stop func() bool) {
+	if c := loadClock(); c != nil {
+		return c.AfterFunc(d, func() { close(ch) })
+	}
+	t := &runtimeTimer{
+		when: timerWhen(d),
+		f:    closeTimerChan,
+		arg:  ch,
+	}
+	runtime_startTimer(t)
+	return func() bool { return runtime_stopTimer(t) }
+}
+
+func closeTimerChan(arg interface{}, seq uintptr) {
+	close(arg.(chan struct{}))
+}
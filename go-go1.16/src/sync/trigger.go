@@ -0,0 +1,98 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// A Trigger coalesces notifications for a consumer that does the same
+// work however many times it is asked, such as flushing a buffer or
+// recomputing a cache: any number of goroutines call Kick, and the
+// consumer, waiting in Wait, wakes once for all the kicks made since it
+// last woke. It replaces the channel of capacity 1 written with a
+// non-blocking send, with a Kick that costs only an atomic load once a
+// wakeup is pending, and with optional debouncing.
+//
+// A Trigger made by NewTrigger with a minimum interval debounces its
+// consumer: Wait does not return sooner than the interval after it last
+// returned, and the kicks made meanwhile all fold into that wakeup.
+//
+// The zero Trigger is ready for use, without debouncing. A Trigger
+// must not be copied after first use.
+type Trigger struct {
+	pending  uint32 // 1 if a kick has not yet woken the consumer
+	interval int64  // minimum nanoseconds between wakeups
+
+	mu Mutex
+	ch chan struct{} // capacity 1; holds a token while a wakeup is pending
+
+	last int64 // nanotime when Wait last returned; owned by the consumer
+}
+
+// NewTrigger returns a new Trigger whose Wait returns at most once every
+// interval nanoseconds. An interval of zero or less does not debounce.
+func NewTrigger(interval int64) *Trigger {
+	return &Trigger{interval: interval}
+}
+
+func (t *Trigger) channel() chan struct{} {
+	t.mu.Lock()
+	if t.ch == nil {
+		t.ch = make(chan struct{}, 1)
+	}
+	ch := t.ch
+	t.mu.Unlock()
+	return ch
+}
+
+// Kick asks the consumer of t to wake. If a wakeup is already pending,
+// Kick folds into it. Kick never blocks.
+func (t *Trigger) Kick() {
+	if atomic.LoadUint32(&t.pending) != 0 || !atomic.CompareAndSwapUint32(&t.pending, 0, 1) {
+		return
+	}
+	t.channel() <- struct{}{}
+}
+
+// Wait waits for a kick of t, if none is pending, and returns nil once
+// it may go ahead, after the minimum interval of t if need be. Kicks
+// made until Wait returns fold into this wakeup; those made after it
+// returns make the next Wait return. If ctx is done first, Wait returns
+// ctx.Err() and leaves a pending wakeup pending. A nil ctx never gives
+// up.
+//
+// A Trigger has a single consumer: Wait must not be called by more than
+// one goroutine at a time.
+func (t *Trigger) Wait(ctx Context) error {
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	ch := t.channel()
+	select {
+	case <-ch:
+	case <-cancel:
+		return ctx.Err()
+	}
+
+	if t.interval > 0 && t.last != 0 {
+		if d := t.last + t.interval - nanotime(); d > 0 {
+			timer := make(chan struct{})
+			stop := startCloseTimer(d, timer)
+			select {
+			case <-timer:
+			case <-cancel:
+				stop()
+				// Put the token back for the next Wait.
+				ch <- struct{}{}
+				return ctx.Err()
+			}
+		}
+	}
+	// Clear pending only now, so that the kicks made while debouncing
+	// fold into this wakeup.
+	atomic.StoreUint32(&t.pending, 0)
+	t.last = nanotime()
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	"runtime"
+	. "sync"
+	"testing"
+	"time"
+)
+
+func TestTrigger(t *testing.T) {
+	var tr Trigger
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := tr.Wait(ctx); err != context.Canceled {
+		t.Fatalf("Wait without a kick = %v; want %v", err, context.Canceled)
+	}
+
+	// Kicks fold into one wakeup.
+	for i := 0; i < 10; i++ {
+		tr.Kick()
+	}
+	if err := tr.Wait(nil); err != nil {
+		t.Fatalf("Wait after Kick = %v", err)
+	}
+	if err := tr.Wait(ctx); err != context.Canceled {
+		t.Fatalf("second Wait after folded kicks = %v; want %v", err, context.Canceled)
+	}
+
+	// A kick after Wait returns wakes the next Wait.
+	done := make(chan error)
+	go func() { done <- tr.Wait(nil) }()
+	tr.Kick()
+	if err := <-done; err != nil {
+		t.Fatalf("Wait = %v", err)
+	}
+}
+
+func TestTriggerInterval(t *testing.T) {
+	c := newFakeClock()
+	defer SetClockForTesting(SetClockForTesting(c))
+	const interval = int64(10 * time.Millisecond)
+	tr := NewTrigger(interval)
+	tr.Kick()
+	if err := tr.Wait(nil); err != nil {
+		t.Fatalf("first Wait = %v", err)
+	}
+
+	// The next wakeup waits out the interval, and kicks made meanwhile
+	// fold into it.
+	tr.Kick()
+	done := make(chan error)
+	go func() { done <- tr.Wait(nil) }()
+	for c.numTimers() == 0 {
+		runtime.Gosched()
+	}
+	tr.Kick()
+	select {
+	case err := <-done:
+		t.Fatalf("Wait returned %v within the interval", err)
+	default:
+	}
+	c.Advance(interval)
+	if err := <-done; err != nil {
+		t.Fatalf("Wait after the interval = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := tr.Wait(ctx); err != context.Canceled {
+		t.Fatalf("Wait after folded kicks = %v; want %v", err, context.Canceled)
+	}
+
+	// A Wait canceled while debouncing leaves the wakeup pending.
+	tr.Kick()
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() { done <- tr.Wait(ctx) }()
+	for c.numTimers() == 0 {
+		runtime.Gosched()
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("canceled Wait = %v; want %v", err, context.Canceled)
+	}
+	c.Advance(interval)
+	if err := tr.Wait(nil); err != nil {
+		t.Fatalf("Wait after a canceled Wait = %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A Turnstile admits goroutines to a region of code and lets an operator
+// stop admitting them and wait for those inside to leave, as for a
+// maintenance window or a configuration swap. Goroutines enter with Pass
+// and leave with Leave; Pause closes the turnstile and waits for the
+// region to empty, and Resume opens it again.
+//
+// Unlike an RWMutex used for the same purpose, a Turnstile lets goroutines
+// waiting to pass give up when their context is done, and a goroutine
+// inside the region does not hold a lock that it must release on the same
+// path it acquired it.
+//
+// The zero Turnstile is open and ready for use. A Turnstile must not be
+// copied after first use.
+type Turnstile struct {
+	noCopy noCopy
+
+	gate Gate // closed while paused
+
+	mu      Mutex
+	inside  int
+	drained chan struct{} // closed when inside drops to 0 during Pause
+}
+
+// Pass waits until t is open and then enters the region t guards. The
+// caller must call Leave when it is done. If ctx is done first, Pass
+// returns ctx.Err() without entering. A nil ctx never gives up.
+func (t *Turnstile) Pass(ctx Context) error {
+	for {
+		t.mu.Lock()
+		if t.gate.IsOpen() {
+			t.inside++
+			t.mu.Unlock()
+			return nil
+		}
+		t.mu.Unlock()
+		if err := t.gate.Wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Leave leaves the region t guards. It panics if there is no goroutine
+// inside, that is, if it is called more often than Pass returned nil.
+func (t *Turnstile) Leave() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.inside == 0 {
+		panic("sync: Turnstile.Leave without Pass")
+	}
+	t.inside--
+	if t.inside == 0 && t.drained != nil {
+		close(t.drained)
+		t.drained = nil
+	}
+}
+
+// Pause closes t to new arrivals and waits for the goroutines inside the
+// region to leave. When Pause returns, the region is empty and stays so
+// until Resume is called. Pausing a paused Turnstile waits likewise.
+func (t *Turnstile) Pause() {
+	t.mu.Lock()
+	t.gate.Close()
+	if t.inside == 0 {
+		t.mu.Unlock()
+		return
+	}
+	if t.drained == nil {
+		t.drained = make(chan struct{})
+	}
+	drained := t.drained
+	t.mu.Unlock()
+	<-drained
+}
+
+// Resume opens t, letting through the goroutines waiting to pass and any
+// that arrive later. Resuming an open Turnstile has no effect. There is
+// no count of pauses: one Resume undoes any number of Pause calls.
+func (t *Turnstile) Resume() {
+	t.mu.Lock()
+	t.gate.Open()
+	t.mu.Unlock()
+}
+
+// Inside returns the number of goroutines inside the region t guards.
+func (t *Turnstile) Inside() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.inside
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	. "sync"
+	"testing"
+	"time"
+)
+
+func TestTurnstile(t *testing.T) {
+	var ts Turnstile
+	if err := ts.Pass(nil); err != nil {
+		t.Fatal(err)
+	}
+	paused := make(chan bool)
+	go func() {
+		ts.Pause()
+		paused <- true
+	}()
+	// Pause must wait for the goroutine inside to leave.
+	select {
+	case <-paused:
+		t.Fatal("Pause returned with a goroutine inside")
+	case <-time.After(10 * time.Millisecond):
+	}
+	ts.Leave()
+	<-paused
+
+	passed := make(chan error)
+	go func() {
+		passed <- ts.Pass(context.Background())
+	}()
+	select {
+	case <-passed:
+		t.Fatal("Pass entered a paused Turnstile")
+	case <-time.After(10 * time.Millisecond):
+	}
+	ts.Resume()
+	if err := <-passed; err != nil {
+		t.Fatal(err)
+	}
+	if n := ts.Inside(); n != 1 {
+		t.Fatalf("Inside() = %d; want 1", n)
+	}
+	ts.Leave()
+}
+
+func TestTurnstilePassContext(t *testing.T) {
+	var ts Turnstile
+	ts.Pause()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := ts.Pass(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Pass() = %v; want %v", err, context.DeadlineExceeded)
+	}
+	if n := ts.Inside(); n != 0 {
+		t.Fatalf("Inside() = %d after Pass gave up; want 0", n)
+	}
+}
+
+func TestTurnstileLeaveWithoutPass(t *testing.T) {
+	var ts Turnstile
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Leave without Pass did not panic")
+		}
+	}()
+	ts.Leave()
+}
+
+func TestTurnstileConcurrent(t *testing.T) {
+	var ts Turnstile
+	var inside AtomicInt32
+	done := make(chan bool)
+	var wg WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				ts.Pass(nil)
+				inside.Add(1)
+				inside.Add(-1)
+				ts.Leave()
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		ts.Pause()
+		if n := inside.Load(); n != 0 {
+			t.Fatalf("%d goroutines inside after Pause", n)
+		}
+		ts.Resume()
+	}
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,199 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"internal/race"
+	"sync/atomic"
+	"unsafe"
+)
+
+// waiters holds the lockWaits of the goroutines blocked in a lock
+// method, keyed by goroutine ID and sharded by it so that unrelated
+// waits rarely touch the same shard. A goroutine blocks on at most one
+// lock at a time.
+//
+// The shards are guarded by spin locks rather than Mutexes, since
+// waiting for a Mutex registers the waiter here. The spin locks tell the
+// race detector of the order they impose, as it cannot see through the
+// package's atomic operations.
+var waiters [64]waiterShard
+
+type waiterShardInternal struct {
+	lock uint32
+	m    map[int64]lockWait
+}
+
+type waiterShard struct {
+	waiterShardInternal
+
+	// Prevents false sharing on widespread platforms with
+	// 128 mod (cache line size) = 0 .
+	pad [128 - unsafe.Sizeof(waiterShardInternal{})%128]byte
+}
+
+func (s *waiterShard) acquire() {
+	var b Backoff
+	for !atomic.CompareAndSwapUint32(&s.lock, 0, 1) {
+		b.Wait()
+	}
+	if race.Enabled {
+		race.Acquire(unsafe.Pointer(s))
+	}
+}
+
+func (s *waiterShard) release() {
+	if race.Enabled {
+		race.Release(unsafe.Pointer(s))
+	}
+	atomic.StoreUint32(&s.lock, 0)
+}
+
+// raceDisabledWait reports whether waits of kind are registered with
+// the race detector's handling of synchronization disabled: the lock
+// methods of RWMutex and WaitGroup.Wait call race.Disable, as they model
+// their own synchronization by hand.
+func raceDisabledWait(kind LockKind) bool {
+	return kind == LockRWMutex || kind == LockRWMutexRead || kind == LockWaitGroup
+}
+
+// addWaiter registers w, which has begun, as the wait of the calling
+// goroutine, and removeWaiter unregisters it.
+func addWaiter(w *lockWait) {
+	if race.Enabled && raceDisabledWait(w.kind) {
+		// Step out of the caller's disabled region, or the race
+		// detector misses the synchronization of the shard.
+		race.Enable()
+		defer race.Disable()
+	}
+	s := &waiters[uint64(w.goid)%uint64(len(waiters))]
+	s.acquire()
+	if s.m == nil {
+		s.m = make(map[int64]lockWait)
+	}
+	s.m[w.goid] = *w
+	s.release()
+}
+
+func removeWaiter(w *lockWait) {
+	if race.Enabled && raceDisabledWait(w.kind) {
+		race.Enable()
+		defer race.Disable()
+	}
+	s := &waiters[uint64(w.goid)%uint64(len(waiters))]
+	s.acquire()
+	delete(s.m, w.goid)
+	s.release()
+}
+
+// SetWaiterTracking turns the tracking of blocked goroutines for
+// DumpWaiters and FindLeakedWaiters on or off. Tracking costs a map
+// update when a goroutine blocks on a lock and another when it acquires
+// the lock, and nothing otherwise. It is always on in debug mode, when
+// the package is built with the syncdebug build tag.
+func SetWaiterTracking(enabled bool) {
+	setLockEvents(lockEventWaiters, enabled)
+}
+
+// track registers w as a wait of the calling goroutine of the given
+// kind, for a WaitGroup or Semaphore at lock, if waiters are tracked,
+// and untrack unregisters it. Unlike the waits of begin and end, these
+// are not lock events: they appear only in DumpWaiters and
+// FindLeakedWaiters.
+func (w *lockWait) track(lock unsafe.Pointer, kind LockKind) {
+	if !syncDebug && atomic.LoadUint32(&lockEvents)&lockEventWaiters == 0 {
+		return
+	}
+	w.lock = lock
+	w.kind = kind
+	w.start = nanotime()
+	w.goid = runtime_goid()
+	addWaiter(w)
+}
+
+func (w *lockWait) untrack() {
+	if w.goid != 0 {
+		removeWaiter(w)
+	}
+}
+
+// DumpWaiters writes a description of every goroutine that is currently
+// blocked locking a Mutex or RWMutex, or waiting in WaitGroup.Wait or
+// Semaphore.Acquire, to w, longest waiting first: the goroutine's ID,
+// the kind, label and address of what it waits for and how long it has
+// waited. The goroutine IDs match those of a
+// goroutine dump, such as the one of runtime.Stack, which has the
+// stacks of the goroutines. Only waits that began while waiter tracking
+// was on are described; see SetWaiterTracking.
+//
+// In debug mode, when the package is built with the syncdebug build tag,
+// DumpWaiters also tells which goroutine holds each lock that is locked
+// for writing, and the stack it locked the lock from, as far as the
+// lock's recent history tells.
+//
+// Write errors are ignored.
+func DumpWaiters(w Writer) {
+	var ws []lockWait
+	for i := range waiters {
+		s := &waiters[i]
+		s.acquire()
+		for _, lw := range s.m {
+			ws = append(ws, lw)
+		}
+		s.release()
+	}
+	sortSlice(len(ws), func(i, j int) bool { return ws[i].start < ws[j].start }, func(i, j int) { ws[i], ws[j] = ws[j], ws[i] })
+
+	now := nanotime()
+	buf := []byte("sync: " + itoa(len(ws)) + " blocked goroutines\n")
+	for _, lw := range ws {
+		buf = append(buf, "goroutine "+itoa(int(lw.goid))+": "+lw.kind.String()...)
+		if label := lockLabel(lw.lock); label != "" {
+			buf = append(buf, " \""+label+"\""...)
+		}
+		buf = append(buf, " "+hexString(uintptr(lw.lock))+", blocked "+durationString(now-lw.start)+"\n"...)
+		if syncDebug {
+			if goid, stack := lockHolder(lw.lock); goid != 0 {
+				buf = append(buf, "\theld by goroutine "+itoa(int(goid))+", locked at\n"...)
+				buf = appendFrames(buf, stack, "\t\t")
+			}
+		}
+	}
+	w.Write(buf)
+}
+
+// Writer is io.Writer, the destination of DumpWaiters. Any io.Writer
+// satisfies it; package sync declares its own type only because package
+// io depends on it.
+type Writer interface {
+	Write(p []byte) (n int, err error)
+}
+
+// hexString formats v as a hexadecimal number with a 0x prefix.
+func hexString(v uintptr) string {
+	const digits = "0123456789abcdef"
+	var buf [2 + 2*unsafe.Sizeof(v)]byte
+	i := len(buf)
+	for {
+		i--
+		buf[i] = digits[v%16]
+		v /= 16
+		if v == 0 {
+			break
+		}
+	}
+	i -= 2
+	buf[i], buf[i+1] = '0', 'x'
+	return string(buf[i:])
+}
+
+// durationString formats d nanoseconds in whole microseconds below a
+// millisecond and in whole milliseconds otherwise.
+func durationString(d int64) string {
+	if d < 1e6 {
+		return itoa(int(d/1e3)) + "µs"
+	}
+	return itoa(int(d/1e6)) + "ms"
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"bytes"
+	"strings"
+	. "sync"
+	"testing"
+	"time"
+)
+
+// waitersDump returns the output of DumpWaiters once it mentions want,
+// or after a while.
+func waitersDump(want string) string {
+	var buf bytes.Buffer
+	for i := 0; i < 100; i++ {
+		buf.Reset()
+		DumpWaiters(&buf)
+		if strings.Contains(buf.String(), want) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return buf.String()
+}
+
+func TestDumpWaiters(t *testing.T) {
+	SetWaiterTracking(true)
+	defer SetWaiterTracking(false)
+	var mu Mutex
+	var rw RWMutex
+	SetLockLabel(&mu, "dump-mu")
+	defer SetLockLabel(&mu, "")
+
+	mu.Lock()
+	rw.Lock()
+	done := make(chan bool)
+	go func() {
+		mu.Lock()
+		mu.Unlock()
+		done <- true
+	}()
+	go func() {
+		rw.RLock()
+		rw.RUnlock()
+		done <- true
+	}()
+	for _, want := range []string{`Mutex "dump-mu" 0x`, "RWMutex.RLock 0x"} {
+		if dump := waitersDump(want); !strings.Contains(dump, want) {
+			t.Errorf("DumpWaiters does not mention %q:\n%s", want, dump)
+		}
+	}
+	if dump := waitersDump(""); !strings.HasPrefix(dump, "sync: ") || !strings.Contains(dump, "goroutine ") || !strings.Contains(dump, ", blocked ") {
+		t.Errorf("unexpected DumpWaiters output:\n%s", dump)
+	}
+
+	mu.Unlock()
+	rw.Unlock()
+	<-done
+	<-done
+	var buf bytes.Buffer
+	DumpWaiters(&buf)
+	if dump := buf.String(); strings.Contains(dump, "dump-mu") || strings.Contains(dump, "RWMutex.RLock") {
+		t.Errorf("DumpWaiters mentions waits that ended:\n%s", dump)
+	}
+}
+
+func TestDumpWaitersUntracked(t *testing.T) {
+	if SyncDebug {
+		t.Skip("waiters are always tracked in debug mode")
+	}
+	var mu Mutex
+	SetLockLabel(&mu, "untracked-mu")
+	defer SetLockLabel(&mu, "")
+
+	mu.Lock()
+	done := make(chan bool)
+	go func() {
+		mu.Lock()
+		mu.Unlock()
+		done <- true
+	}()
+	for MutexWaiters(&mu) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	var buf bytes.Buffer
+	DumpWaiters(&buf)
+	if dump := buf.String(); strings.Contains(dump, "untracked-mu") {
+		t.Errorf("DumpWaiters mentions a wait that began with tracking off:\n%s", dump)
+	}
+	mu.Unlock()
+	<-done
+}
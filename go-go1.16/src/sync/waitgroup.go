@@ -6,6 +6,7 @@ package sync
 
 import (
 	"internal/race"
+	"internal/synchook"
 	"sync/atomic"
 	"unsafe"
 )
@@ -73,6 +74,21 @@ func (wg *WaitGroup) Add(delta int) {
 	if v < 0 {
 		panic("sync: negative WaitGroup counter")
 	}
+	if syncDebug {
+		if race.Enabled {
+			// The holds are guarded by a Mutex, which the race
+			// detector sees only outside the disabled region.
+			race.Enable()
+		}
+		if v == 0 {
+			clearHolds(unsafe.Pointer(wg))
+		} else if delta > 0 {
+			recordHold(unsafe.Pointer(wg), int64(delta))
+		}
+		if race.Enabled {
+			race.Disable()
+		}
+	}
 	if w != 0 && delta > 0 && v == int32(delta) {
 		panic("sync: WaitGroup misuse: Add called concurrently with Wait")
 	}
@@ -89,9 +105,12 @@ func (wg *WaitGroup) Add(delta int) {
 	}
 	// Reset waiters count to 0.
 	*statep = 0
-	for ; w != 0; w-- {
-		runtime_Semrelease(semap, false, 0)
+	if synchook.Enabled() {
+		for i := w; i != 0; i-- {
+			schedPoint(synchook.Wake, semap)
+		}
 	}
+	runtime_SemreleaseN(semap, w, 0)
 }
 
 // Done decrements the WaitGroup counter by one.
@@ -119,6 +138,9 @@ func (wg *WaitGroup) Wait() {
 			return
 		}
 		// Increment waiters count.
+		if syncChaos {
+			chaosPause()
+		}
 		if atomic.CompareAndSwapUint64(statep, state, state+1) {
 			if race.Enabled && w == 0 {
 				// Wait must be synchronized with the first Add.
@@ -127,7 +149,15 @@ func (wg *WaitGroup) Wait() {
 				// otherwise concurrent Waits will race with each other.
 				race.Write(unsafe.Pointer(semap))
 			}
+			var lw lockWait
+			lw.track(unsafe.Pointer(wg), LockWaitGroup)
+			schedPoint(synchook.Park, semap)
 			runtime_Semacquire(semap)
+			schedPoint(synchook.Woken, semap)
+			lw.untrack()
+			if syncChaos {
+				chaosPause()
+			}
 			if *statep != 0 {
 				panic("sync: WaitGroup is reused before previous Wait has returned")
 			}
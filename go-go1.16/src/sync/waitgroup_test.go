@@ -5,6 +5,7 @@
 package sync_test
 
 import (
+	"fmt"
 	"internal/race"
 	"runtime"
 	. "sync"
@@ -299,3 +300,29 @@ func BenchmarkWaitGroupActuallyWait(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkWaitGroupWakeWaiters measures the last Done releasing many
+// goroutines blocked in Wait.
+func BenchmarkWaitGroupWakeWaiters(b *testing.B) {
+	for _, n := range []int{8, 64} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			var done WaitGroup
+			for i := 0; i < b.N; i++ {
+				var wg WaitGroup
+				wg.Add(1)
+				done.Add(n)
+				for j := 0; j < n; j++ {
+					go func() {
+						wg.Wait()
+						done.Done()
+					}()
+				}
+				for WaitGroupWaiters(&wg) < n {
+					runtime.Gosched()
+				}
+				wg.Done()
+				done.Wait()
+			}
+		})
+	}
+}
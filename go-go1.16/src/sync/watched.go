@@ -0,0 +1,72 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A Watched holds a value and delivers each new value to its
+// subscribers, as when distributing reloaded configuration. Get is a
+// single atomic load; Set fans the value out to every subscriber without
+// blocking on slow ones.
+//
+// Subscribers see updates coalesced: each subscription channel holds at
+// most one value, and a Set that finds the previous value still unread
+// replaces it. A subscriber therefore always sees the latest value but may
+// skip intermediate ones.
+//
+// The zero Watched holds nil and is ready for use. A
+// Watched must not be copied after first use.
+type Watched struct {
+	val Atomic
+
+	mu   Mutex // serializes Set and guards subs
+	subs map[chan interface{}]struct{}
+}
+
+// Get returns the current value of w.
+func (w *Watched) Get() interface{} {
+	return w.val.Load()
+}
+
+// Set sets the value of w to v and delivers it to every subscriber.
+func (w *Watched) Set(v interface{}) {
+	w.mu.Lock()
+	w.val.Store(v)
+	for ch := range w.subs {
+		w.deliver(ch, v)
+	}
+	w.mu.Unlock()
+}
+
+// deliver replaces any unread value in ch with v. w.mu must be held, so
+// that nothing else sends on ch.
+func (w *Watched) deliver(ch chan interface{}, v interface{}) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- v
+}
+
+// Subscribe returns a channel that receives the values of w, starting
+// with its current value, and a function that ends the subscription.
+// After cancel is called, the channel receives no more values and is
+// closed. Calling cancel more than once is harmless.
+func (w *Watched) Subscribe() (updates <-chan interface{}, cancel func()) {
+	ch := make(chan interface{}, 1)
+	w.mu.Lock()
+	if w.subs == nil {
+		w.subs = make(map[chan interface{}]struct{})
+	}
+	w.subs[ch] = struct{}{}
+	w.deliver(ch, w.val.Load())
+	w.mu.Unlock()
+	return ch, func() {
+		w.mu.Lock()
+		if _, ok := w.subs[ch]; ok {
+			delete(w.subs, ch)
+			close(ch)
+		}
+		w.mu.Unlock()
+	}
+}
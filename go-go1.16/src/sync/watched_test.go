@@ -0,0 +1,80 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"testing"
+)
+
+func TestWatched(t *testing.T) {
+	var w Watched
+	if v := w.Get(); v != nil {
+		t.Fatalf("zero Watched holds %v", v)
+	}
+	w.Set("a")
+	ch, cancel := w.Subscribe()
+	if v := <-ch; v != "a" {
+		t.Fatalf("first value = %v; want a", v)
+	}
+	w.Set("b")
+	if v := <-ch; v != "b" {
+		t.Fatalf("got %v; want b", v)
+	}
+
+	// Rapid updates coalesce to the latest.
+	w.Set("c")
+	w.Set("d")
+	w.Set("e")
+	if v := <-ch; v != "e" {
+		t.Fatalf("got %v; want e", v)
+	}
+	select {
+	case v := <-ch:
+		t.Fatalf("got extra value %v", v)
+	default:
+	}
+	if v := w.Get(); v != "e" {
+		t.Fatalf("Get() = %v; want e", v)
+	}
+
+	cancel()
+	cancel()
+	w.Set("f")
+	if v, ok := <-ch; ok {
+		t.Fatalf("got %v after cancel", v)
+	}
+}
+
+func TestWatchedConcurrent(t *testing.T) {
+	var w Watched
+	w.Set(0)
+	const N = 1000
+	var wg WaitGroup
+	for s := 0; s < 4; s++ {
+		ch, cancel := w.Subscribe()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			last := -1
+			for x := range ch {
+				v := x.(int)
+				if v < last {
+					t.Errorf("value went backwards: %d after %d", v, last)
+					return
+				}
+				last = v
+				if v == N {
+					return
+				}
+			}
+		}()
+	}
+	for i := 1; i <= N; i++ {
+		w.Set(i)
+	}
+	wg.Wait()
+}
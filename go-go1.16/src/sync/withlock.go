@@ -0,0 +1,30 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// WithLock calls f with l locked. It unlocks l when f returns, or when
+// f panics, so that an early return or a panic in f cannot leave l
+// locked.
+func WithLock(l Locker, f func()) {
+	l.Lock()
+	defer l.Unlock()
+	f()
+}
+
+// WithLockValue calls f with l locked, as WithLock does, and returns
+// what f returns.
+func WithLockValue(l Locker, f func() interface{}) interface{} {
+	l.Lock()
+	defer l.Unlock()
+	return f()
+}
+
+// WithRLock calls f with rw locked for reading. It unlocks rw when f
+// returns, or when f panics.
+func WithRLock(rw *RWMutex, f func()) {
+	rw.RLock()
+	defer rw.RUnlock()
+	f()
+}
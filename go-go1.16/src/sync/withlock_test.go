@@ -0,0 +1,85 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	. "sync"
+	"testing"
+)
+
+func TestWithLock(t *testing.T) {
+	var mu Mutex
+	WithLock(&mu, func() {
+		if mu.TryLock() {
+			t.Fatal("mu not locked in WithLock")
+		}
+	})
+	if v := WithLockValue(&mu, func() interface{} { return 42 }); v != 42 {
+		t.Fatalf("WithLockValue = %v; want 42", v)
+	}
+
+	// A panic in f unlocks.
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("WithLock did not propagate the panic")
+			}
+		}()
+		WithLock(&mu, func() { panic("boom") })
+	}()
+	if !mu.TryLock() {
+		t.Fatal("mu still locked after a panic in WithLock")
+	}
+	mu.Unlock()
+
+	var rw RWMutex
+	WithRLock(&rw, func() {
+		if rw.TryLock() {
+			t.Fatal("rw not read-locked in WithRLock")
+		}
+		if !rw.TryRLock() {
+			t.Fatal("TryRLock failed in WithRLock")
+		}
+		rw.RUnlock()
+	})
+	if !rw.TryLock() {
+		t.Fatal("rw still locked after WithRLock")
+	}
+	rw.Unlock()
+}
+
+func TestGuarded(t *testing.T) {
+	type account struct{ balance int }
+	g := NewGuarded(&account{})
+	var wg WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				g.Do(func(v *interface{}) { (*v).(*account).balance++ })
+			}
+		}()
+	}
+	wg.Wait()
+	g.RDo(func(v interface{}) {
+		if b := v.(*account).balance; b != 1000 {
+			t.Fatalf("balance = %d; want 1000", b)
+		}
+	})
+
+	var z Guarded
+	z.Do(func(v *interface{}) {
+		if *v != nil {
+			t.Fatalf("zero Guarded holds %v; want nil", *v)
+		}
+		*v = 1
+	})
+	z.RDo(func(v interface{}) {
+		if v != 1 {
+			t.Fatalf("RDo after Do sees %v; want 1", v)
+		}
+	})
+}
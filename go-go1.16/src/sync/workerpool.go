@@ -0,0 +1,224 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// ErrWorkerPoolClosed is returned by WorkerPool.Submit after Shutdown
+// has been called.
+var ErrWorkerPoolClosed error = syncError("sync: WorkerPool is shut down")
+
+// A WorkerPool runs submitted tasks on a bounded, dynamically sized set
+// of goroutines.
+//
+// A submitted task goes to an idle worker if there is one. Otherwise the
+// pool starts a new worker for it, up to its maximum, and once at the
+// maximum queues it in a first-in, first-out queue of fixed capacity. The
+// pool keeps at least its minimum number of workers; a worker beyond the
+// minimum that stays idle for the pool's idle timeout exits.
+//
+// A WorkerPool must be created with NewWorkerPool and must not be copied
+// after first use.
+type WorkerPool struct {
+	min, max int
+	size     int   // queue capacity
+	idle     int64 // idle timeout in nanoseconds; <= 0 means never
+
+	mu       Mutex
+	notEmpty Cond // signaled when a task is queued or the pool closes
+	notFull  Cond // signaled when a task leaves a full queue
+	queue    []func()
+	workers  int           // running workers
+	idlers   []*poolIdler  // unclaimed workers waiting in notEmpty, oldest first
+	closed   bool          // Shutdown has been called
+	done     chan struct{} // closed when the last worker exits after Shutdown
+}
+
+// A poolIdler is a worker waiting for a task. A task submitted while it
+// waits claims it, so that the next task does not count on the same one.
+type poolIdler struct {
+	claimed bool
+}
+
+// NewWorkerPool returns a WorkerPool that runs between minWorkers and
+// maxWorkers tasks at a time and queues up to queueSize more. Workers
+// beyond minWorkers exit after idleTimeout nanoseconds without a task;
+// if idleTimeout is not positive, they never do. The minimum number of
+// workers start at once.
+//
+// NewWorkerPool panics if minWorkers is negative, maxWorkers is less than
+// minWorkers or not positive, or queueSize is not positive.
+func NewWorkerPool(minWorkers, maxWorkers, queueSize int, idleTimeout int64) *WorkerPool {
+	if minWorkers < 0 || maxWorkers < minWorkers || maxWorkers <= 0 || queueSize <= 0 {
+		panic("sync: NewWorkerPool with invalid sizes")
+	}
+	p := &WorkerPool{
+		min:  minWorkers,
+		max:  maxWorkers,
+		size: queueSize,
+		idle: idleTimeout,
+		done: make(chan struct{}),
+	}
+	p.notEmpty.L = &p.mu
+	p.notFull.L = &p.mu
+	p.workers = minWorkers
+	for i := 0; i < minWorkers; i++ {
+		go p.worker(nil)
+	}
+	return p
+}
+
+// Submit queues task to be run by a worker, waiting for room in the queue
+// if it is full. It returns ErrWorkerPoolClosed, without queuing task, if
+// the pool is shut down.
+func (p *WorkerPool) Submit(task func()) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for !p.closed && p.full() {
+		p.notFull.Wait()
+	}
+	return p.enqueue(task)
+}
+
+// TrySubmit is like Submit, but never waits. It reports whether task was
+// queued, which it is not if the queue is full or the pool is shut down.
+func (p *WorkerPool) TrySubmit(task func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.full() {
+		return false
+	}
+	return p.enqueue(task) == nil
+}
+
+// full reports whether a task submitted now would have to wait: no worker
+// is idle, no more may start, and the queue is at capacity. p.mu must be
+// held.
+func (p *WorkerPool) full() bool {
+	return len(p.idlers) == 0 && p.workers >= p.max && len(p.queue) >= p.size
+}
+
+// enqueue hands task to an idle worker or a new one if it can, and queues
+// it otherwise. p.mu must be held.
+func (p *WorkerPool) enqueue(task func()) error {
+	if p.closed {
+		return ErrWorkerPoolClosed
+	}
+	switch {
+	case len(p.idlers) > 0:
+		// Claim the waiter here rather than when it wakes, so
+		// that the next task does not count on the same one.
+		w := p.idlers[0]
+		w.claimed = true
+		p.idlers[0] = nil
+		p.idlers = p.idlers[1:]
+		p.queue = append(p.queue, task)
+		p.notEmpty.Signal()
+	case p.workers < p.max:
+		p.workers++
+		go p.worker(task)
+	default:
+		p.queue = append(p.queue, task)
+	}
+	return nil
+}
+
+// Workers returns the number of running workers.
+func (p *WorkerPool) Workers() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.workers
+}
+
+// Shutdown stops p from accepting tasks and waits for the queued and
+// running ones to finish, or for ctx to be done, in which case it returns
+// ctx.Err(). The tasks go on running either way; calling Shutdown again
+// waits for them again. A nil ctx never gives up.
+func (p *WorkerPool) Shutdown(ctx Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		if p.workers == 0 {
+			close(p.done)
+		}
+		for _, w := range p.idlers {
+			w.claimed = true
+		}
+		p.idlers = nil
+		p.notEmpty.Broadcast()
+		p.notFull.Broadcast()
+	}
+	p.mu.Unlock()
+	var cancel <-chan struct{}
+	if ctx != nil {
+		cancel = ctx.Done()
+	}
+	select {
+	case <-p.done:
+		return nil
+	case <-cancel:
+		return ctx.Err()
+	}
+}
+
+// worker runs first, if it is not nil, and then tasks from the queue
+// until the pool shuts down or the worker has been idle too long.
+func (p *WorkerPool) worker(first func()) {
+	if first != nil {
+		first()
+	}
+	var w poolIdler
+	p.mu.Lock()
+	for {
+		for len(p.queue) == 0 && !p.closed {
+			w.claimed = false
+			p.idlers = append(p.idlers, &w)
+			timedOut := false
+			if p.idle > 0 && p.workers > p.min {
+				timedOut = !p.notEmpty.WaitTimeout(p.idle)
+			} else {
+				p.notEmpty.Wait()
+			}
+			if w.claimed {
+				// Whoever claimed us took us off idlers, and
+				// counts on us to run a task, even if Signal
+				// woke another worker or we timed out first.
+				continue
+			}
+			p.removeIdler(&w)
+			if timedOut && len(p.queue) == 0 && !p.closed && p.workers > p.min {
+				p.workers--
+				p.mu.Unlock()
+				return
+			}
+		}
+		if len(p.queue) == 0 {
+			// Shut down and drained.
+			p.workers--
+			if p.workers == 0 {
+				close(p.done)
+			}
+			p.mu.Unlock()
+			return
+		}
+		task := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		p.notFull.Signal()
+		p.mu.Unlock()
+		task()
+		p.mu.Lock()
+	}
+}
+
+// removeIdler takes w off p.idlers. p.mu must be held.
+func (p *WorkerPool) removeIdler(w *poolIdler) {
+	for i, x := range p.idlers {
+		if x == w {
+			copy(p.idlers[i:], p.idlers[i+1:])
+			p.idlers[len(p.idlers)-1] = nil
+			p.idlers = p.idlers[:len(p.idlers)-1]
+			return
+		}
+	}
+}
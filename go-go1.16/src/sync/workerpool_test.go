@@ -0,0 +1,151 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	"runtime"
+	. "sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool(t *testing.T) {
+	p := NewWorkerPool(1, 4, 8, 0)
+	var n int32
+	for i := 0; i < 100; i++ {
+		if err := p.Submit(func() { atomic.AddInt32(&n, 1) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Fatalf("ran %d tasks; want 100", n)
+	}
+	if err := p.Submit(func() {}); err != ErrWorkerPoolClosed {
+		t.Fatalf("Submit after Shutdown = %v; want ErrWorkerPoolClosed", err)
+	}
+	if p.TrySubmit(func() {}) {
+		t.Fatal("TrySubmit after Shutdown succeeded")
+	}
+	if w := p.Workers(); w != 0 {
+		t.Fatalf("Workers() = %d after Shutdown; want 0", w)
+	}
+}
+
+func TestWorkerPoolBounds(t *testing.T) {
+	p := NewWorkerPool(0, 2, 1, 0)
+	release := make(chan struct{})
+	var running, peak int32
+	task := func() {
+		r := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if r <= old || atomic.CompareAndSwapInt32(&peak, old, r) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+	}
+	// Two workers start, and one task fits in the queue.
+	for i := 0; i < 3; i++ {
+		if !p.TrySubmit(task) {
+			t.Fatalf("TrySubmit %d failed", i)
+		}
+	}
+	for p.Workers() < 2 || atomic.LoadInt32(&running) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if p.TrySubmit(task) {
+		t.Fatal("TrySubmit succeeded with full queue")
+	}
+	close(release)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if peak > 2 {
+		t.Fatalf("%d tasks ran at once; want at most 2", peak)
+	}
+}
+
+// TestWorkerPoolIdleRace submits a task after an idle worker's timeout
+// has fired but before the worker has retaken the pool's lock. The task
+// claims the worker, which must then count itself idle exactly once.
+func TestWorkerPoolIdleRace(t *testing.T) {
+	c := newFakeClock()
+	defer SetClockForTesting(SetClockForTesting(c))
+	p := NewWorkerPool(0, 1, 1, int64(time.Hour))
+	ran := make(chan bool)
+	if err := p.Submit(func() {}); err != nil {
+		t.Fatal(err)
+	}
+	for c.numTimers() == 0 {
+		runtime.Gosched()
+	}
+
+	p.LockForTest()
+	c.Advance(int64(time.Hour))
+	for MutexWaiters(p.MutexForTest()) == 0 {
+		runtime.Gosched()
+	}
+	if err := p.EnqueueLockedForTest(func() { ran <- true }); err != nil {
+		t.Fatal(err)
+	}
+	p.UnlockForTest()
+	<-ran
+
+	// The worker is idle again, and a new task must wake it without
+	// waiting for its timeout.
+	for c.numTimers() == 0 {
+		runtime.Gosched()
+	}
+	if !p.TrySubmit(func() { ran <- true }) {
+		t.Fatal("TrySubmit failed with an idle worker")
+	}
+	select {
+	case <-ran:
+	case <-time.After(10 * time.Second):
+		t.Fatal("task not run by the idle worker")
+	}
+	if err := p.Shutdown(nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkerPoolShrink(t *testing.T) {
+	p := NewWorkerPool(1, 4, 4, int64(time.Millisecond))
+	release := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		p.Submit(func() { <-release })
+	}
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Workers() > 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Workers() = %d long after going idle; want 1", p.Workers())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	p.Shutdown(context.Background())
+}
+
+func TestWorkerPoolShutdownContext(t *testing.T) {
+	p := NewWorkerPool(1, 1, 1, 0)
+	release := make(chan struct{})
+	p.Submit(func() { <-release })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown() = %v; want %v", err, context.DeadlineExceeded)
+	}
+	close(release)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A WorkStealingDeque is a double-ended queue of tasks for a
+// work-stealing scheduler, as the runtime keeps per P: one goroutine,
+// the owner, pushes and pops tasks at the bottom, last in first out,
+// which keeps it on the tasks whose data is still in its cache; other
+// goroutines, thieves, steal the oldest tasks from the top when they run
+// out of their own. Only the owner may call PushBottom and PopBottom;
+// any goroutine may call Steal.
+//
+// It is the deque of Chase and Lev, "Dynamic Circular Work-Stealing
+// Deque" (SPAA 2005): the owner works at the bottom without atomic
+// read-modify-write operations, and contends with thieves, through a
+// compare-and-swap of the top index, only for the last task. The
+// circular array grows as needed and never shrinks.
+//
+// The zero WorkStealingDeque is empty and ready for use. A
+// WorkStealingDeque must not be copied after first use.
+type WorkStealingDeque struct {
+	top    int64          // index of the oldest task; only ever incremented, by thieves' CAS or the owner's
+	bottom int64          // index of the next task to push; written only by the owner
+	array  unsafe.Pointer // *wsArray
+}
+
+// A wsArray is the circular array of a WorkStealingDeque. Task i is in
+// slot i&(len(slots)-1). The slots hold *interface{}, read and written
+// atomically, as a thief may read a slot the owner is writing, though it
+// then fails to claim it.
+type wsArray struct {
+	slots []unsafe.Pointer
+}
+
+// wsMinSize is the size of the first array of a WorkStealingDeque.
+const wsMinSize = 32
+
+func (a *wsArray) load(i int64) unsafe.Pointer {
+	return atomic.LoadPointer(&a.slots[i&int64(len(a.slots)-1)])
+}
+
+func (a *wsArray) store(i int64, p unsafe.Pointer) {
+	atomic.StorePointer(&a.slots[i&int64(len(a.slots)-1)], p)
+}
+
+// PushBottom adds v at the bottom of d. Only the owner of d may call it.
+func (d *WorkStealingDeque) PushBottom(v interface{}) {
+	b := atomic.LoadInt64(&d.bottom)
+	t := atomic.LoadInt64(&d.top)
+	a := (*wsArray)(atomic.LoadPointer(&d.array))
+	if a == nil || b-t >= int64(len(a.slots)) {
+		a = d.grow(a, t, b)
+	}
+	a.store(b, unsafe.Pointer(&v))
+	atomic.StoreInt64(&d.bottom, b+1)
+}
+
+// grow replaces a, which holds tasks t to b, with an array twice as
+// large, or makes the first array if a is nil. Thieves still reading a
+// find the tasks they may claim unchanged there, as the owner writes only
+// to the new array from then on.
+func (d *WorkStealingDeque) grow(a *wsArray, t, b int64) *wsArray {
+	n := wsMinSize
+	if a != nil {
+		n = 2 * len(a.slots)
+	}
+	na := &wsArray{slots: make([]unsafe.Pointer, n)}
+	for i := t; i < b; i++ {
+		na.store(i, a.load(i))
+	}
+	atomic.StorePointer(&d.array, unsafe.Pointer(na))
+	return na
+}
+
+// PopBottom removes and returns the task at the bottom of d, the one
+// pushed last. The ok result reports whether there was one; it is false
+// if d is empty or if thieves took its last task. Only the owner of d
+// may call it.
+func (d *WorkStealingDeque) PopBottom() (v interface{}, ok bool) {
+	a := (*wsArray)(atomic.LoadPointer(&d.array))
+	if a == nil {
+		return nil, false
+	}
+	// Claim the bottom task before looking at the top: a thief that
+	// reads the top after this sees the task gone, and one that read it
+	// before is seen by the load of the top below.
+	b := atomic.LoadInt64(&d.bottom) - 1
+	atomic.StoreInt64(&d.bottom, b)
+	t := atomic.LoadInt64(&d.top)
+	if t > b {
+		// Empty.
+		atomic.StoreInt64(&d.bottom, b+1)
+		return nil, false
+	}
+	p := a.load(b)
+	if t == b {
+		// The last task: race the thieves for it, by taking it from
+		// the top as they do.
+		ok = atomic.CompareAndSwapInt64(&d.top, t, t+1)
+		atomic.StoreInt64(&d.bottom, b+1)
+		if !ok {
+			return nil, false
+		}
+	}
+	// The slot is the owner's again; clear it so that it does not keep
+	// the task alive.
+	a.store(b, nil)
+	return *(*interface{})(p), true
+}
+
+// Steal removes and returns the task at the top of d, the oldest one.
+// The ok result reports whether there was one; Steal retries when other
+// goroutines take the task it was after, and fails only when d is
+// empty. Any goroutine may call it.
+func (d *WorkStealingDeque) Steal() (v interface{}, ok bool) {
+	for {
+		t := atomic.LoadInt64(&d.top)
+		b := atomic.LoadInt64(&d.bottom)
+		if t >= b {
+			return nil, false
+		}
+		// The array loaded after the bottom holds task t: the owner
+		// stores a new array before the tasks pushed into it.
+		a := (*wsArray)(atomic.LoadPointer(&d.array))
+		p := a.load(t)
+		if atomic.CompareAndSwapInt64(&d.top, t, t+1) {
+			return *(*interface{})(p), true
+		}
+	}
+}
+
+// Len returns the number of tasks in d. If goroutines are working on d
+// concurrently, it is only an estimate.
+func (d *WorkStealingDeque) Len() int {
+	b := atomic.LoadInt64(&d.bottom)
+	t := atomic.LoadInt64(&d.top)
+	if b <= t {
+		return 0
+	}
+	return int(b - t)
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	. "sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWorkStealingDeque(t *testing.T) {
+	var d WorkStealingDeque
+	if _, ok := d.PopBottom(); ok {
+		t.Fatal("PopBottom succeeded on an empty deque")
+	}
+	if _, ok := d.Steal(); ok {
+		t.Fatal("Steal succeeded on an empty deque")
+	}
+	// Enough to grow the array a few times.
+	const n = 1000
+	for i := 0; i < n; i++ {
+		d.PushBottom(i)
+	}
+	if l := d.Len(); l != n {
+		t.Fatalf("Len = %d; want %d", l, n)
+	}
+	for i := 0; i < n/2; i++ {
+		if v, ok := d.Steal(); !ok || v != i {
+			t.Fatalf("Steal = %v, %v; want %d, true", v, ok, i)
+		}
+		if v, ok := d.PopBottom(); !ok || v != n-1-i {
+			t.Fatalf("PopBottom = %v, %v; want %d, true", v, ok, n-1-i)
+		}
+	}
+	if _, ok := d.PopBottom(); ok {
+		t.Fatal("PopBottom succeeded on an emptied deque")
+	}
+	d.PushBottom(nil)
+	if v, ok := d.PopBottom(); !ok || v != nil {
+		t.Fatalf("PopBottom = %v, %v; want nil, true", v, ok)
+	}
+}
+
+// TestWorkStealingDequeRace checks that every task is taken exactly once
+// while thieves steal from an owner that pushes and pops. Popping after
+// every push or two keeps the deque near empty, so the owner and the
+// thieves keep racing for the last task.
+func TestWorkStealingDequeRace(t *testing.T) {
+	const (
+		tasks   = 100000
+		thieves = 4
+	)
+	var d WorkStealingDeque
+	taken := make([]int32, tasks)
+	var done int32
+	var wg WaitGroup
+	wg.Add(thieves)
+	for i := 0; i < thieves; i++ {
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&done) == 0 || d.Len() > 0 {
+				if v, ok := d.Steal(); ok {
+					atomic.AddInt32(&taken[v.(int)], 1)
+				} else {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+	for i := 0; i < tasks; i++ {
+		d.PushBottom(i)
+		if i%3 != 0 {
+			if v, ok := d.PopBottom(); ok {
+				atomic.AddInt32(&taken[v.(int)], 1)
+			}
+		}
+		if i%1000 == 0 {
+			// Let the deque fill up and wrap around its array too.
+			for j := 0; j < 100; j++ {
+				i++
+				d.PushBottom(i)
+			}
+		}
+	}
+	atomic.StoreInt32(&done, 1)
+	wg.Wait()
+	for i, n := range taken {
+		if n != 1 {
+			t.Fatalf("task %d taken %d times", i, n)
+		}
+	}
+}